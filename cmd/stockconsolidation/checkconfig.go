@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"stock-consolidation/internal/adapter/db/postgres"
+	"stock-consolidation/pkg/config"
+)
+
+// runCheckConfig validates the configuration and prints it with secrets redacted
+func runCheckConfig(c *cli, args []string) error {
+	flags, configFile := c.flagSet("check-config")
+	connect := flags.Bool("connect", false, "also check that the branch databases are reachable")
+	if err := c.parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return usagef("unexpected arguments %v", flags.Args())
+	}
+	if err := initConsoleLogging(); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode configuration: %v", err)
+	}
+	fmt.Fprintln(c.stdout, string(encoded))
+
+	if *connect {
+		sources, err := selectSources(cfg, "")
+		if err != nil {
+			return err
+		}
+		for _, srcCfg := range append([]*config.Config{cfg}, sources...) {
+			db, err := postgres.OpenDB(srcCfg)
+			if err != nil {
+				return err
+			}
+			_ = db.Close()
+			fmt.Fprintf(c.stderr, "database %s:%s/%s is reachable\n", srcCfg.DBHost, srcCfg.DBPort, srcCfg.DBName)
+		}
+	}
+	fmt.Fprintln(c.stderr, "configuration is valid")
+	return nil
+}
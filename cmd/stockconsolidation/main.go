@@ -2,87 +2,230 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
-	"os/signal"
-	"syscall"
+	"strings"
+	// Embed the time zone database for BRANCH_TIMEZONE, the image has none
+	_ "time/tzdata"
 
-	"github.com/gofiber/fiber/v2"
-
-	"stock-consolidation/internal/adapter/db/postgres"
-	"stock-consolidation/internal/adapter/http"
-	"stock-consolidation/internal/service"
 	"stock-consolidation/pkg/config"
 	"stock-consolidation/pkg/logger"
 )
 
-func main() {
-	// Initialize logger
+// Exit codes of the stockconsolidation binary
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// command is a subcommand of the stockconsolidation binary
+type command struct {
+	name string
+	// args describes the arguments that follow the flags
+	args    string
+	summary string
+	run     func(c *cli, args []string) error
+}
+
+func commands() []command {
+	return []command{
+		{"serve", "", "forward stock changes to HQ and serve the HTTP API (default)", runServe},
+		{"migrate", "up | down [-steps n] | status", "manage the database schema", runMigrate},
+		{"snapshot", "", "write every stock row as JSON lines, optionally sending them to HQ", runSnapshot},
+		{"replay", "[file]", "send stock changes read as JSON lines from file or stdin to HQ", runReplay},
+		{"check-config", "", "validate the configuration and print it with secrets redacted", runCheckConfig},
+		{"tail", "", "print decoded stock notifications as they arrive", runTail},
+		{"receive", "", "run the HQ receiver storing the stock sent by the branches", runReceive},
+	}
+}
 
-	if err := logger.Init(); err != nil {
-		panic(fmt.Sprintf("Failed to initialize logger: %v", err))
+func lookupCommand(name string) (command, bool) {
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			return cmd, true
+		}
 	}
-	defer logger.Close()
+	return command{}, false
+}
 
-	logger.Info("Starting Stock Consolidation Service...")
+// usageError is returned for invalid arguments and exits with exitUsage
+type usageError struct {
+	msg string
+}
 
-	// Load configuration
-	cfg, err := config.Load()
-	if err != nil {
-		logger.Fatal("Failed to load config: %v", err)
-		return
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...interface{}) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// cli carries the output streams of a command
+type cli struct {
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the subcommand named by args[0] and returns the exit code.
+// Without a subcommand the service is started, as before subcommands existed.
+func run(args []string, stdout, stderr io.Writer) int {
+	c := &cli{stdout: stdout, stderr: stderr}
+
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	switch name {
+	case "help":
+		if len(args) > 0 {
+			if cmd, ok := lookupCommand(args[0]); ok {
+				// Every command prints its usage and returns flag.ErrHelp for -h
+				_ = cmd.run(&cli{stdout: stdout, stderr: stdout}, []string{"-h"})
+				return exitOK
+			}
+		}
+		c.usage(stdout)
+		return exitOK
 	}
 
-	// Initialize PostgreSQL listener
-	listener, err := postgres.NewListener(cfg)
-	if err != nil {
-		logger.Fatal("Failed to create PostgreSQL listener: %v", err)
-		return
+	cmd, ok := lookupCommand(name)
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n\n", name)
+		c.usage(stderr)
+		return exitUsage
 	}
 
-	// Initialize services
-	stockService := service.NewStockService(listener)
+	err := cmd.run(c, args)
+	var usageErr *usageError
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(stderr, "%s: %v\n", cmd.name, err)
+		fmt.Fprintf(stderr, "run 'stockconsolidation help %s' for usage\n", cmd.name)
+		return exitUsage
+	default:
+		fmt.Fprintf(stderr, "%s: %v\n", cmd.name, err)
+		return exitError
+	}
+}
 
-	// Initialize Fiber app with custom config
-	app := fiber.New(fiber.Config{
-		DisableStartupMessage: true,
-	})
+// usage prints the list of subcommands
+func (c *cli) usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: stockconsolidation <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-14s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Every command accepts -config. Run 'stockconsolidation help <command>' for its flags.")
+	fmt.Fprintln(w, "Exit codes: 0 success, 1 failure, 2 invalid arguments.")
+}
 
-	// Setup routes
-	http.SetupRoutes(app)
+// flagSet returns the flag set of the named command with the flags shared by
+// every command
+func (c *cli) flagSet(name string) (*flag.FlagSet, *string) {
+	cmd, _ := lookupCommand(name)
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	configFile := flags.String("config", "", "dotenv style file overriding the environment (CONFIG_FILE)")
+	flags.Usage = func() {
+		w := flags.Output()
+		fmt.Fprintf(w, "usage: stockconsolidation %s [flags] %s\n\n%s\n\nflags:\n", cmd.name, cmd.args, cmd.summary)
+		flags.PrintDefaults()
+	}
+	return flags, configFile
+}
 
-	// Start listening for stock changes in background
-	go func() {
-		defer func() {
-			if err := listener.Close(); err != nil {
-				logger.Error("Error closing listener: %v", err)
-			}
-		}()
-		if err := stockService.ListenForChanges(); err != nil {
-			logger.Error("Error listening for changes: %v", err)
+// parse parses args and reports invalid flags as a usage error
+func (c *cli) parse(flags *flag.FlagSet, args []string) error {
+	// run reports invalid flags, so keep the flag package from printing them
+	flags.SetOutput(io.Discard)
+	err := flags.Parse(args)
+	flags.SetOutput(c.stderr)
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		flags.Usage()
+		return err
+	case err != nil:
+		return usagef("%v", err)
+	}
+	return nil
+}
+
+// loadConfig loads the configuration, reading configFile when it is set
+func loadConfig(configFile string) (*config.Config, error) {
+	if configFile != "" {
+		if err := os.Setenv("CONFIG_FILE", configFile); err != nil {
+			return nil, err
 		}
-	}()
-
-	// Set up graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-
-	// Start HTTP server in a goroutine
-	go func() {
-		addr := fmt.Sprintf("0.0.0.0:%s", cfg.ServicePort)
-		logger.Info("Starting HTTP server on %s", addr)
-		if err := app.Listen(addr); err != nil {
-			logger.Fatal("Failed to start server: %v", err)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+	return cfg, nil
+}
+
+// loadReceiverConfig loads the configuration of the receive command, reading
+// configFile when it is set
+func loadReceiverConfig(configFile string) (*config.ReceiverConfig, error) {
+	if configFile != "" {
+		if err := os.Setenv("CONFIG_FILE", configFile); err != nil {
+			return nil, err
 		}
-	}()
+	}
+	cfg, err := config.LoadReceiver()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+	return cfg, nil
+}
 
-	// Wait for interrupt signal
-	<-quit
+// selectSources returns the configuration of each distinct branch database,
+// or only that of the source called name
+func selectSources(cfg *config.Config, name string) ([]*config.Config, error) {
+	if name != "" {
+		src, ok := cfg.Source(name)
+		if !ok {
+			return nil, usagef("unknown branch source %q", name)
+		}
+		return []*config.Config{cfg.ForSource(src)}, nil
+	}
 
-	// Graceful shutdown
-	logger.Info("Shutting down server...")
-	if err := app.Shutdown(); err != nil {
-		logger.Fatal("Error shutting down server: %v", err)
+	var sources []*config.Config
+	seen := make(map[string]bool)
+	for _, src := range cfg.Sources {
+		database := src.DBHost + ":" + src.DBPort + "/" + src.DBName
+		if seen[database] {
+			continue
+		}
+		seen[database] = true
+		sources = append(sources, cfg.ForSource(src))
 	}
+	return sources, nil
+}
 
+// initConsoleLogging sets up logging for the commands other than serve. They
+// only log to stderr, and only warnings unless LOG_LEVEL says otherwise.
+func initConsoleLogging() error {
+	level := logger.LevelWarn
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		var err error
+		if level, err = logger.ParseLevel(value); err != nil {
+			return err
+		}
+	}
+	logger.SetLevel(level)
+	return nil
 }
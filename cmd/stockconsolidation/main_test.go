@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setConfig sets a valid configuration in the environment
+func setConfig(t *testing.T) {
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "admin")
+	t.Setenv("DB_PASSWORD", "admin123")
+	t.Setenv("DB_NAME", "stockdb")
+	t.Setenv("SERVICE_PORT", "3000")
+	t.Setenv("HQ_END_POINT", "http://localhost:8085/stock")
+	t.Setenv("HQ_BASIC_AUTHORIZATION", "Basic dXNlcjpwYXNz")
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{"help", []string{"help"}, exitOK, "commands:", ""},
+		{"command help", []string{"help", "replay"}, exitOK, "-dry-run", ""},
+		{"flag help", []string{"snapshot", "-h"}, exitOK, "", "-product-id"},
+		{"unknown command", []string{"frobnicate"}, exitUsage, "", `unknown command "frobnicate"`},
+		{"unknown flag", []string{"tail", "-bogus"}, exitUsage, "", "flag provided but not defined"},
+		{"missing migrate command", []string{"migrate"}, exitUsage, "", "missing migrate command"},
+		{"unknown migrate command", []string{"migrate", "sideways"}, exitUsage, "", `unknown migrate command "sideways"`},
+		{"invalid steps", []string{"migrate", "down", "-steps", "0"}, exitUsage, "", "-steps must be positive"},
+		{"negative rate", []string{"replay", "-rate", "-1"}, exitUsage, "", "-rate must not be negative"},
+		{"receive help", []string{"help", "receive"}, exitOK, "-migrate", ""},
+		{"receiver source", []string{"migrate", "status", "-receiver", "-source", "bkk"}, exitUsage, "", "-receiver and -source cannot be combined"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run(tt.args, &stdout, &stderr); code != tt.wantCode {
+				t.Errorf("run(%v) = %d, want %d (stderr %q)", tt.args, code, tt.wantCode, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tt.wantStdout) {
+				t.Errorf("stdout = %q, want it to contain %q", stdout.String(), tt.wantStdout)
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.wantStderr)
+			}
+		})
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	setConfig(t)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"check-config"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("check-config = %d, want %d (stderr %q)", code, exitOK, stderr.String())
+	}
+	if strings.Contains(stdout.String(), "admin123") {
+		t.Errorf("check-config printed the database password: %s", stdout.String())
+	}
+	if !strings.Contains(stdout.String(), "localhost") {
+		t.Errorf("check-config output = %s, want the configuration", stdout.String())
+	}
+
+	t.Setenv("DB_HOST", "")
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"check-config"}, &stdout, &stderr); code != exitError {
+		t.Errorf("check-config with invalid configuration = %d, want %d", code, exitError)
+	}
+	if !strings.Contains(stderr.String(), "DB_HOST is required") {
+		t.Errorf("stderr = %q, want the validation error", stderr.String())
+	}
+}
+
+func TestSelectSources(t *testing.T) {
+	setConfig(t)
+	t.Setenv("BRANCH_SOURCES", "bkk,bkk_annex,cnx")
+	t.Setenv("BRANCH_SOURCE_BKK_ANNEX_BRANCH_ID", "3")
+	t.Setenv("BRANCH_SOURCE_CNX_DB_HOST", "cnx-db")
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// bkk and bkk_annex share the DB_* database
+	sources, err := selectSources(cfg, "")
+	if err != nil {
+		t.Fatalf("selectSources() error = %v", err)
+	}
+	if len(sources) != 2 || sources[0].DBHost != "localhost" || sources[1].DBHost != "cnx-db" {
+		t.Errorf("selectSources() = %d databases, want localhost and cnx-db", len(sources))
+	}
+
+	if sources, err = selectSources(cfg, "cnx"); err != nil || len(sources) != 1 || sources[0].DBHost != "cnx-db" {
+		t.Errorf("selectSources(cnx) = %v, %v", sources, err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"migrate", "status", "-source", "hkt"}, &stdout, &stderr); code != exitUsage {
+		t.Errorf("migrate with an unknown source = %d, want %d", code, exitUsage)
+	}
+	if !strings.Contains(stderr.String(), `unknown branch source "hkt"`) {
+		t.Errorf("stderr = %q, want the unknown source error", stderr.String())
+	}
+}
+
+func TestReceiverConfig(t *testing.T) {
+	setConfig(t)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"migrate", "status", "-receiver"}, &stdout, &stderr); code != exitError {
+		t.Errorf("migrate -receiver without RECEIVER_AUTHORIZATIONS = %d, want %d", code, exitError)
+	}
+	if !strings.Contains(stderr.String(), "RECEIVER_AUTHORIZATIONS is required") {
+		t.Errorf("stderr = %q, want the validation error", stderr.String())
+	}
+
+	t.Setenv("RECEIVER_AUTHORIZATIONS", "Basic dXNlcjpwYXNz")
+	cfg, err := loadReceiverConfig("")
+	if err != nil {
+		t.Fatalf("loadReceiverConfig() error = %v", err)
+	}
+	if cfg.Port != "8085" || cfg.Database().DBName != "stockdb" {
+		t.Errorf("loadReceiverConfig() = %v", cfg)
+	}
+}
+
+func TestReplayDryRun(t *testing.T) {
+	setConfig(t)
+
+	valid := `{"id":"7f0c0c4e-6a41-4d7e-9a55-1d2f8f2c3b10","product_id":1,"branch_id":2,"quantity":10,"reserved":2,` +
+		`"created_at":"2024-01-01T10:00:00Z","updated_at":"2024-01-01T10:00:00Z"}`
+	invalid := `{"id":"7f0c0c4e-6a41-4d7e-9a55-1d2f8f2c3b11","product_id":1,"branch_id":2,"quantity":1,"reserved":5,` +
+		`"created_at":"2024-01-01T10:00:00Z","updated_at":"2024-01-01T10:00:00Z"}`
+
+	file := filepath.Join(t.TempDir(), "changes.jsonl")
+	if err := os.WriteFile(file, []byte(valid+"\n\n"+valid+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"replay", "-dry-run", file}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("replay = %d, want %d (stderr %q)", code, exitOK, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "invalid 0") {
+		t.Errorf("stdout = %q, want a summary without invalid changes", stdout.String())
+	}
+
+	if err := os.WriteFile(file, []byte(valid+"\n"+invalid+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"replay", "-dry-run", file}, &stdout, &stderr); code != exitError {
+		t.Errorf("replay with an invalid change = %d, want %d", code, exitError)
+	}
+	if !strings.Contains(stderr.String(), "line 2:") {
+		t.Errorf("stderr = %q, want the invalid line reported", stderr.String())
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"stock-consolidation/internal/adapter/db/postgres"
+	"stock-consolidation/pkg/config"
+	"stock-consolidation/pkg/logger"
+)
+
+// runMigrate applies, reverts or lists the embedded schema migrations
+func runMigrate(c *cli, args []string) error {
+	flags, configFile := c.flagSet("migrate")
+	steps := flags.Int("steps", 1, "number of migrations to revert with down")
+	source := flags.String("source", "", "only migrate the database of this branch source")
+	receiver := flags.Bool("receiver", false, "migrate the HQ database of the receive command instead of the branch databases")
+	if err := c.parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return usagef("missing migrate command: up, down or status")
+	}
+	// Flags may also follow the migrate command, e.g. migrate down -steps 2
+	action := flags.Arg(0)
+	if err := c.parse(flags, flags.Args()[1:]); err != nil {
+		return err
+	}
+	switch {
+	case action != "up" && action != "down" && action != "status":
+		return usagef("unknown migrate command %q", action)
+	case flags.NArg() > 0:
+		return usagef("unexpected arguments %v", flags.Args())
+	case *steps <= 0:
+		return usagef("-steps must be positive")
+	case *receiver && *source != "":
+		return usagef("-receiver and -source cannot be combined")
+	}
+
+	if err := initConsoleLogging(); err != nil {
+		return err
+	}
+	if *receiver {
+		cfg, err := loadReceiverConfig(*configFile)
+		if err != nil {
+			return err
+		}
+		return migrate(c, cfg.Database(), postgres.NewConsolidationMigrator, action, *steps)
+	}
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+
+	sources, err := selectSources(cfg, *source)
+	if err != nil {
+		return err
+	}
+	for _, srcCfg := range sources {
+		if len(sources) > 1 {
+			fmt.Fprintf(c.stdout, "== %s:%s/%s\n", srcCfg.DBHost, srcCfg.DBPort, srcCfg.DBName)
+		}
+		if err := migrate(c, srcCfg, postgres.NewMigrator, action, *steps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migratorFunc creates the Migrator of a database, NewMigrator for a branch
+// database and NewConsolidationMigrator for the HQ database
+type migratorFunc func(db *sql.DB, opts ...postgres.MigratorOption) (*postgres.Migrator, error)
+
+// migrate runs a migrate command against the database of cfg
+func migrate(c *cli, cfg *config.Config, newMigrator migratorFunc, action string, steps int) error {
+	switch action {
+	case "up":
+		return migrateUp(cfg, newMigrator, c.stdout)
+	case "down":
+		return withMigrator(cfg, newMigrator, func(m *postgres.Migrator) error {
+			reverted, err := m.Down(context.Background(), steps)
+			printMigrations(c.stdout, "reverted", reverted)
+			return err
+		})
+	default:
+		return withMigrator(cfg, newMigrator, func(m *postgres.Migrator) error {
+			statuses, err := m.Status(context.Background())
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+			for _, s := range statuses {
+				status, appliedAt := "pending", ""
+				if s.Applied {
+					status, appliedAt = "applied", s.AppliedAt.UTC().Format("2006-01-02T15:04:05Z")
+				}
+				fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, status, appliedAt)
+			}
+			return w.Flush()
+		})
+	}
+}
+
+// migrateUp applies every pending migration
+func migrateUp(cfg *config.Config, newMigrator migratorFunc, out io.Writer) error {
+	return withMigrator(cfg, newMigrator, func(m *postgres.Migrator) error {
+		applied, err := m.Up(context.Background())
+		printMigrations(out, "applied", applied)
+		return err
+	})
+}
+
+// migrateSources applies every pending migration to each branch database
+func migrateSources(cfg *config.Config, out io.Writer) error {
+	sources, err := selectSources(cfg, "")
+	if err != nil {
+		return err
+	}
+	for _, srcCfg := range sources {
+		if err := migrateUp(srcCfg, postgres.NewMigrator, out); err != nil {
+			return fmt.Errorf("%s:%s/%s: %v", srcCfg.DBHost, srcCfg.DBPort, srcCfg.DBName, err)
+		}
+	}
+	return nil
+}
+
+// withMigrator opens the database of cfg for the duration of fn
+func withMigrator(cfg *config.Config, newMigrator migratorFunc, fn func(m *postgres.Migrator) error) error {
+	db, err := postgres.OpenDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			logger.Error("Error closing database: %v", err)
+		}
+	}()
+
+	migrator, err := newMigrator(db, postgres.WithBranchTimezone(cfg.BranchTimezone))
+	if err != nil {
+		return err
+	}
+	return fn(migrator)
+}
+
+func printMigrations(out io.Writer, verb string, migrations []postgres.Migration) {
+	if len(migrations) == 0 {
+		fmt.Fprintf(out, "No migrations %s\n", verb)
+		return
+	}
+	for _, m := range migrations {
+		fmt.Fprintf(out, "%s %04d_%s\n", verb, m.Version, m.Name)
+	}
+}
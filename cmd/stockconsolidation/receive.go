@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gofiber/fiber/v2"
+
+	"stock-consolidation/internal/adapter/db/postgres"
+	"stock-consolidation/internal/adapter/http"
+	"stock-consolidation/internal/adapter/rest/webhook"
+	"stock-consolidation/internal/service"
+	"stock-consolidation/pkg/auth"
+	"stock-consolidation/pkg/health"
+	"stock-consolidation/pkg/logger"
+	"stock-consolidation/pkg/tracing"
+)
+
+// runReceive runs the HQ receiver: it stores the stock changes the branches
+// send to HQ_END_POINT and serves the consolidated stock
+func runReceive(c *cli, args []string) error {
+	flags, configFile := c.flagSet("receive")
+	migrate := flags.Bool("migrate", false, "apply pending HQ database migrations before starting")
+	if err := c.parse(flags, args); err != nil {
+		return err
+	}
+
+	if err := logger.Init(); err != nil {
+		return fmt.Errorf("failed to initialize logger: %v", err)
+	}
+	defer logger.Close()
+
+	logger.Info("Starting HQ receiver...")
+
+	cfg, err := loadReceiverConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	if *migrate {
+		if err := migrateUp(cfg.Database(), postgres.NewConsolidationMigrator, c.stdout); err != nil {
+			return err
+		}
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error("Error shutting down tracing: %v", err)
+		}
+	}()
+
+	store, err := postgres.NewConsolidatedStore(cfg.Database())
+	if err != nil {
+		return fmt.Errorf("failed to connect to PostgreSQL: %v", err)
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			logger.Error("Error closing consolidated store: %v", err)
+		}
+	}()
+
+	// The branches authenticate with their HQ_BASIC_AUTHORIZATION; the read
+	// endpoints require an API key or JWT like those of the branch service
+	authenticator := auth.NewAuthenticator(cfg.APIKeys, cfg.JWT)
+	if !authenticator.Enabled() {
+		logger.Warn("No AUTH_API_KEYS or AUTH_JWT_SECRET configured, all authenticated endpoints will reject requests")
+	}
+
+	app := fiber.New(fiber.Config{
+		DisableStartupMessage: true,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var opts []service.ConsolidatorOption
+	if cfg.Alert.Enabled() {
+		alerter := service.NewAlerter(webhook.NewNotifier(cfg.Alert), cfg)
+		go alerter.Run(ctx)
+		opts = append(opts, service.WithStockMonitor(alerter))
+		logger.Info("Sending stock alerts to %d webhooks", len(cfg.Alert.Webhooks))
+	}
+
+	readiness := health.NewChecker()
+	readiness.Register("postgres", store.PingCheck())
+
+	http.SetupRoutes(app,
+		http.WithHealthCheckers(health.NewChecker(), readiness),
+		http.WithIngest(service.NewConsolidator(store, opts...), cfg.Authorizations),
+		http.WithAggregation(service.NewAggregator(store, cfg)),
+		http.WithStockReader(store),
+		http.WithAuth(authenticator),
+	)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		addr := fmt.Sprintf("0.0.0.0:%s", cfg.Port)
+		logger.Info("Starting HTTP server on %s", addr)
+		if err := app.Listen(addr); err != nil {
+			serverErr <- err
+		}
+	}()
+
+	select {
+	case <-quit:
+	case err := <-serverErr:
+		return fmt.Errorf("failed to start server: %v", err)
+	}
+
+	logger.Info("Shutting down server...")
+	if err := app.Shutdown(); err != nil {
+		return fmt.Errorf("error shutting down server: %v", err)
+	}
+	return nil
+}
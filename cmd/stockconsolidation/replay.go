@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"stock-consolidation/internal/adapter/rest/hqclient"
+	"stock-consolidation/internal/core/domain"
+
+	"golang.org/x/time/rate"
+)
+
+// maxReplayLine is the longest JSON line accepted by replay
+const maxReplayLine = 1 << 20
+
+// runReplay sends stock changes read as JSON lines, as written by snapshot and
+// tail or sent by the trigger, to HQ in order
+func runReplay(c *cli, args []string) error {
+	flags, configFile := c.flagSet("replay")
+	perSecond := flags.Float64("rate", 0, "maximum deliveries per second, 0 for unlimited")
+	dryRun := flags.Bool("dry-run", false, "only decode and validate the changes")
+	if err := c.parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		return usagef("replay takes at most one file")
+	}
+	if *perSecond < 0 {
+		return usagef("-rate must not be negative")
+	}
+	if err := initConsoleLogging(); err != nil {
+		return err
+	}
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if name := flags.Arg(0); name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", name, err)
+		}
+		defer func() { _ = f.Close() }()
+		in = f
+	}
+
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	if *perSecond > 0 {
+		limiter = rate.NewLimiter(rate.Limit(*perSecond), 1)
+	}
+	client := hqclient.NewHQClient(cfg)
+	ctx := context.Background()
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxReplayLine)
+	var line, sent, invalid, failed int
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		stock, err := domain.DecodeStock(data, cfg.BranchLocation())
+		if err == nil {
+			err = stock.Validate()
+		}
+		if err != nil {
+			invalid++
+			fmt.Fprintf(c.stderr, "line %d: %v\n", line, err)
+			continue
+		}
+		if *dryRun {
+			continue
+		}
+
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		if _, err := client.Send(ctx, stock); err != nil {
+			failed++
+			fmt.Fprintf(c.stderr, "line %d: failed to send %s: %v\n", line, stock.EventID(), err)
+			continue
+		}
+		sent++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read input: %v", err)
+	}
+
+	fmt.Fprintf(c.stdout, "sent %d, invalid %d, failed %d\n", sent, invalid, failed)
+	if invalid > 0 || failed > 0 {
+		return fmt.Errorf("%d changes were not sent", invalid+failed)
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gofiber/fiber/v2"
+
+	"stock-consolidation/internal/adapter/db/postgres"
+	"stock-consolidation/internal/adapter/http"
+	"stock-consolidation/internal/adapter/memory"
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/internal/service"
+	"stock-consolidation/pkg/auth"
+	"stock-consolidation/pkg/config"
+	"stock-consolidation/pkg/health"
+	"stock-consolidation/pkg/logger"
+	"stock-consolidation/pkg/tracing"
+)
+
+// runServe runs the service: it forwards stock changes to HQ and serves the HTTP API
+func runServe(c *cli, args []string) error {
+	flags, configFile := c.flagSet("serve")
+	migrate := flags.Bool("migrate", false, "apply pending database migrations before starting")
+	if err := c.parse(flags, args); err != nil {
+		return err
+	}
+
+	// Initialize logger
+	if err := logger.Init(); err != nil {
+		return fmt.Errorf("failed to initialize logger: %v", err)
+	}
+	defer logger.Close()
+
+	logger.Info("Starting Stock Consolidation Service...")
+
+	// Load configuration
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+
+	if *migrate {
+		if err := migrateSources(cfg, c.stdout); err != nil {
+			return err
+		}
+	}
+
+	// Initialize tracing
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error("Error shutting down tracing: %v", err)
+		}
+	}()
+
+	// Initialize the stock store of DB_* used by the query, adjustment and
+	// reservation APIs
+	store, err := postgres.NewStockStore(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to PostgreSQL: %v", err)
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			logger.Error("Error closing stock store: %v", err)
+		}
+	}()
+
+	// With leader election only the replica holding the lock forwards changes;
+	// standbys receive the same notifications and drop them
+	history := memory.NewDeliveryHistory(cfg.DeliveryHistorySize)
+	replicator := service.NewReplicator(cfg)
+	stockOpts := []service.Option{service.WithDeliveryRecorder(history), service.WithReplicator(replicator)}
+	var captureHandler port.ChangeHandler = replicator
+	var elector *postgres.LeaderElector
+	if cfg.LeaderLockID != 0 {
+		db, err := postgres.OpenDB(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to connect to PostgreSQL for leader election: %v", err)
+		}
+		defer func() {
+			if err := db.Close(); err != nil {
+				logger.Error("Error closing leader election database: %v", err)
+			}
+		}()
+		elector = postgres.NewLeaderElector(db, int64(cfg.LeaderLockID), cfg.LeaderElectionInterval)
+		stockOpts = append(stockOpts, service.WithLeadership(elector))
+		captureHandler = service.LeaderOnly(replicator, elector)
+
+		// Release the lock on shutdown so a standby takes over at once
+		electionCtx, stopElection := context.WithCancel(context.Background())
+		electionDone := make(chan struct{})
+		go func() {
+			defer close(electionDone)
+			elector.Run(electionCtx)
+		}()
+		defer func() {
+			stopElection()
+			<-electionDone
+		}()
+	}
+
+	// Changes that violate a stock invariant are quarantined instead of sent to HQ
+	quarantine := memory.NewQuarantine(cfg.QuarantineSize)
+	var listenerOpts []postgres.ListenerOption
+
+	// Capture the other tables that have an HQ endpoint configured, on each
+	// of their channels
+	captureChannels := map[string][]string{
+		domain.TypeProduct:       cfg.Channels.Product,
+		domain.TypeBranch:        cfg.Channels.Branch,
+		domain.TypeStockMovement: cfg.Channels.StockMovement,
+	}
+	for _, capture := range postgres.Captures() {
+		if !replicator.Replicates(capture.Type) {
+			continue
+		}
+		for _, channel := range captureChannels[capture.Type] {
+			listenerOpts = append(listenerOpts, postgres.WithCapture(capture.On(channel), captureHandler))
+		}
+	}
+
+	// Listen to every branch source; a source that fails is reconnected
+	// without affecting the others
+	supervisor := service.NewSupervisor(cfg.Sources, connectSource(cfg, quarantine, listenerOpts))
+
+	// Initialize services
+	stockService := service.NewStockService(supervisor, stockOpts...)
+
+	// Every route except the health probes requires an API key or JWT
+	authenticator := auth.NewAuthenticator(cfg.APIKeys, cfg.JWT)
+	if !authenticator.Enabled() {
+		logger.Warn("No AUTH_API_KEYS or AUTH_JWT_SECRET configured, all authenticated endpoints will reject requests")
+	}
+
+	// Reload delivery settings and credentials on SIGHUP or config file changes
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watcher := config.NewWatcher(cfg, config.DefaultReloadInterval)
+	watcher.Subscribe(stockService.ApplyConfig)
+	watcher.Subscribe(replicator.ApplyConfig)
+	watcher.Subscribe(func(cfg *config.Config) {
+		authenticator.Update(cfg.APIKeys, cfg.JWT)
+	})
+	go watcher.Run(ctx)
+
+	// Release reservations that were neither confirmed nor cancelled in time
+	go service.NewReservationExpirer(store, cfg.ReservationExpiryInterval).Run(ctx)
+
+	// Initialize Fiber app with custom config
+	app := fiber.New(fiber.Config{
+		DisableStartupMessage: true,
+	})
+
+	// Liveness only fails when the process needs a restart; readiness also
+	// covers the databases, HQ and the delivery backlog
+	liveness := health.NewChecker()
+	liveness.Register("listener", supervisor.RunningCheck())
+	readiness := health.NewChecker()
+	readiness.Register("listener", supervisor.RunningCheck())
+	readiness.Register("postgres", store.PingCheck())
+	for _, src := range cfg.Sources {
+		readiness.Register("source:"+src.Name, supervisor.SourceCheck(src.Name))
+	}
+	readiness.Register("hq", stockService.DeliveryHealthCheck(cfg.HealthHQFailureThreshold))
+	readiness.Register("backlog", supervisor.BacklogCheck(cfg.HealthMaxBacklog))
+	if elector != nil {
+		readiness.Register("leader", elector.HealthCheck())
+	}
+
+	// Setup routes
+	http.SetupRoutes(app,
+		http.WithHealthCheckers(liveness, readiness),
+		http.WithDeliveryHistory(history),
+		http.WithQuarantine(quarantine),
+		http.WithStockReader(store),
+		http.WithStockWriter(store),
+		http.WithReservations(store, cfg.ReservationTTL, cfg.ReservationMaxTTL),
+		http.WithAdmin(stockService),
+		http.WithAuth(authenticator),
+	)
+
+	// Start listening for stock changes in background
+	go func() {
+		defer func() {
+			if err := supervisor.Close(); err != nil {
+				logger.Error("Error closing listeners: %v", err)
+			}
+		}()
+		if err := stockService.ListenForChanges(); err != nil {
+			logger.Error("Error listening for changes: %v", err)
+		}
+	}()
+
+	// Set up graceful shutdown
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	// Start HTTP server in a goroutine
+	serverErr := make(chan error, 1)
+	go func() {
+		addr := fmt.Sprintf("0.0.0.0:%s", cfg.ServicePort)
+		logger.Info("Starting HTTP server on %s", addr)
+		if err := app.Listen(addr); err != nil {
+			serverErr <- err
+		}
+	}()
+
+	// Wait for interrupt signal
+	select {
+	case <-quit:
+	case err := <-serverErr:
+		return fmt.Errorf("failed to start server: %v", err)
+	}
+
+	// Graceful shutdown
+	logger.Info("Shutting down server...")
+	if err := app.Shutdown(); err != nil {
+		return fmt.Errorf("error shutting down server: %v", err)
+	}
+	return nil
+}
+
+// connectSource returns the factory of the listener of a branch source.
+// Timestamps without an offset are taken in the source's time zone and rows
+// notified by reference are fetched from the source's own database.
+func connectSource(cfg *config.Config, quarantine port.Quarantine, opts []postgres.ListenerOption) service.ListenerFactory {
+	return func(src config.BranchSource) (service.BranchListener, error) {
+		srcCfg := cfg.ForSource(src)
+		store, err := postgres.NewStockStore(srcCfg)
+		if err != nil {
+			return nil, err
+		}
+		listener, err := postgres.NewListener(srcCfg, append([]postgres.ListenerOption{
+			postgres.WithQuarantine(quarantine),
+			postgres.WithTimezone(srcCfg.BranchLocation()),
+			postgres.WithRowLookup(store),
+			postgres.WithSource(src.Name, src.BranchID),
+		}, opts...)...)
+		if err != nil {
+			_ = store.Close()
+			return nil, err
+		}
+		return &sourceListener{StockListener: listener, store: store}, nil
+	}
+}
+
+// sourceListener is the listener of a branch source with the store it looks
+// up rows in
+type sourceListener struct {
+	*postgres.StockListener
+	store *postgres.StockStore
+}
+
+// Close closes the listener and the store
+func (l *sourceListener) Close() error {
+	err := l.StockListener.Close()
+	if storeErr := l.store.Close(); err == nil {
+		err = storeErr
+	}
+	return err
+}
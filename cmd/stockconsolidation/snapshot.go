@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"stock-consolidation/internal/adapter/db/postgres"
+	"stock-consolidation/internal/adapter/rest/hqclient"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/config"
+	"stock-consolidation/pkg/logger"
+)
+
+// snapshotPageSize is the number of rows read per query
+const snapshotPageSize = 1000
+
+// runSnapshot writes every stock row as JSON lines and optionally sends each
+// row to HQ, e.g. to resynchronise HQ after an outage
+func runSnapshot(c *cli, args []string) error {
+	flags, configFile := c.flagSet("snapshot")
+	productID := flags.Int("product-id", 0, "only include this product")
+	branchID := flags.Int("branch-id", 0, "only include this branch")
+	out := flags.String("out", "-", "file to write the rows to, - for stdout")
+	send := flags.Bool("send", false, "also send every row to HQ")
+	source := flags.String("source", "", "only read the database of this branch source")
+	if err := c.parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return usagef("unexpected arguments %v", flags.Args())
+	}
+	if err := initConsoleLogging(); err != nil {
+		return err
+	}
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+
+	w := c.stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %v", *out, err)
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				logger.Error("Error closing %s: %v", *out, err)
+			}
+		}()
+		w = f
+	}
+
+	sources, err := selectSources(cfg, *source)
+	if err != nil {
+		return err
+	}
+
+	var client *hqclient.HQClient
+	if *send {
+		client = hqclient.NewHQClient(cfg)
+	}
+
+	enc := json.NewEncoder(w)
+	q := port.StockQuery{ProductID: *productID, BranchID: *branchID, Limit: snapshotPageSize}
+	var written, failed int
+	for _, srcCfg := range sources {
+		n, f, err := snapshotSource(srcCfg, q, enc, client, c.stderr)
+		written, failed = written+n, failed+f
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(c.stderr, "wrote %d rows\n", written)
+	if client != nil {
+		fmt.Fprintf(c.stderr, "sent %d of %d rows to HQ\n", written-failed, written)
+		if failed > 0 {
+			return fmt.Errorf("%d rows could not be sent to HQ", failed)
+		}
+	}
+	return nil
+}
+
+// snapshotSource writes the rows of one branch database matching q and sends
+// them with client when it is set. It returns the number of rows written and
+// the number that could not be sent.
+func snapshotSource(cfg *config.Config, q port.StockQuery, enc *json.Encoder, client *hqclient.HQClient, stderr io.Writer) (written, failed int, err error) {
+	store, err := postgres.NewStockStore(cfg)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			logger.Error("Error closing stock store: %v", err)
+		}
+	}()
+
+	ctx := context.Background()
+	for {
+		page, err := store.ListStocks(ctx, q)
+		if err != nil {
+			return written, failed, err
+		}
+		for _, stock := range page.Stocks {
+			if err := enc.Encode(stock); err != nil {
+				return written, failed, fmt.Errorf("failed to write stock: %v", err)
+			}
+			written++
+			if client == nil {
+				continue
+			}
+			if _, err := client.Send(ctx, stock); err != nil {
+				failed++
+				fmt.Fprintf(stderr, "failed to send %s: %v\n", stock.EventID(), err)
+			}
+		}
+		if len(page.Stocks) < q.Limit {
+			return written, failed, nil
+		}
+		q.Offset += q.Limit
+	}
+}
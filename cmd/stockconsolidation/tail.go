@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/service"
+	"stock-consolidation/pkg/config"
+	"stock-consolidation/pkg/logger"
+)
+
+// runTail prints decoded stock notifications as JSON lines until interrupted
+func runTail(c *cli, args []string) error {
+	flags, configFile := c.flagSet("tail")
+	productID := flags.Int("product-id", 0, "only print changes of this product")
+	branchID := flags.Int("branch-id", 0, "only print changes of this branch")
+	source := flags.String("source", "", "only listen to this branch source")
+	if err := c.parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return usagef("unexpected arguments %v", flags.Args())
+	}
+	if err := initConsoleLogging(); err != nil {
+		return err
+	}
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+
+	sources := cfg.Sources
+	if *source != "" {
+		src, ok := cfg.Source(*source)
+		if !ok {
+			return usagef("unknown branch source %q", *source)
+		}
+		sources = []config.BranchSource{src}
+	}
+	// Sources that cannot be reached are retried until interrupted
+	supervisor := service.NewSupervisor(sources, connectSource(cfg, quarantinePrinter{c.stderr}, nil))
+	defer func() {
+		if err := supervisor.Close(); err != nil {
+			logger.Error("Error closing listeners: %v", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	changes, err := supervisor.ListenForChanges(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.stderr, "listening for stock changes, press Ctrl+C to stop")
+
+	enc := json.NewEncoder(c.stdout)
+	for change := range changes {
+		stock := change.Stock
+		if (*productID != 0 && stock.ProductID != *productID) || (*branchID != 0 && stock.BranchID != *branchID) {
+			continue
+		}
+		if err := enc.Encode(stock); err != nil {
+			return fmt.Errorf("failed to write stock change: %v", err)
+		}
+	}
+	return nil
+}
+
+// quarantinePrinter reports changes that fail validation instead of storing them
+type quarantinePrinter struct {
+	w io.Writer
+}
+
+func (p quarantinePrinter) Quarantine(change domain.QuarantinedChange) {
+	fmt.Fprintf(p.w, "quarantined %s (%s): %s\n", change.EventID, strings.Join(change.Rules, ", "), change.Error)
+}
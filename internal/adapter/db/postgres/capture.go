@@ -0,0 +1,215 @@
+package postgres
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/logger"
+	"stock-consolidation/pkg/metrics"
+	"stock-consolidation/pkg/tracing"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Capture maps a notification channel to the entity type sent on it and the
+// decoder of its payloads
+type Capture struct {
+	Type    string
+	Channel string
+	Decode  domain.Decoder
+}
+
+// Captures of the tables created by the migrations. Stock changes are
+// delivered by ListenForChanges rather than dispatched to a handler, unless a
+// capture is registered for the stock channel.
+var (
+	StockCapture = Capture{Type: domain.TypeStock, Channel: "stock_changes",
+		Decode: func(data []byte, loc *time.Location) (domain.Entity, error) {
+			return domain.DecodeStock(data, loc)
+		}}
+
+	ProductCapture = Capture{Type: domain.TypeProduct, Channel: "product_changes",
+		Decode: func(data []byte, loc *time.Location) (domain.Entity, error) {
+			return domain.DecodeProduct(data, loc)
+		}}
+
+	BranchCapture = Capture{Type: domain.TypeBranch, Channel: "branch_changes",
+		Decode: func(data []byte, loc *time.Location) (domain.Entity, error) {
+			return domain.DecodeBranch(data, loc)
+		}}
+
+	StockMovementCapture = Capture{Type: domain.TypeStockMovement, Channel: "stock_movement_changes",
+		Decode: func(data []byte, loc *time.Location) (domain.Entity, error) {
+			return domain.DecodeStockMovement(data, loc)
+		}}
+)
+
+// On returns the capture for changes notified on channel instead
+func (c Capture) On(channel string) Capture {
+	c.Channel = channel
+	return c
+}
+
+// Captures returns the captures of every table besides stock that can be
+// replicated
+func Captures() []Capture {
+	return []Capture{ProductCapture, BranchCapture, StockMovementCapture}
+}
+
+// registration is a capture together with the handler of its changes
+type registration struct {
+	Capture
+	handler port.ChangeHandler
+	queue   chan port.Change
+}
+
+// WithCapture also listens on the capture's channel and dispatches its decoded
+// changes to handler. Each capture has its own queue, so a slow handler only
+// delays the changes of its own type until the queue is full.
+func WithCapture(capture Capture, handler port.ChangeHandler) ListenerOption {
+	return func(l *StockListener) {
+		if l.captures == nil {
+			l.captures = make(map[string]*registration)
+		}
+		l.captures[capture.Channel] = &registration{Capture: capture, handler: handler}
+	}
+}
+
+// Channels returns the channels the listener subscribes to, the stock
+// channels first
+func (l *StockListener) Channels() []string {
+	channels := append([]string(nil), l.channels...)
+	captured := make([]string, 0, len(l.captures))
+	for channel := range l.captures {
+		captured = append(captured, channel)
+	}
+	sort.Strings(captured)
+	return append(channels, captured...)
+}
+
+// startCaptures starts a goroutine per capture handing its queued changes to
+// its handler. The returned function closes the queues and waits for the
+// goroutines to finish.
+func (l *StockListener) startCaptures() func() {
+	var wg sync.WaitGroup
+	for _, reg := range l.captures {
+		reg.queue = make(chan port.Change, notificationBuffer)
+		wg.Add(1)
+		go func(reg *registration) {
+			defer wg.Done()
+			for change := range reg.queue {
+				l.handle(reg, change)
+			}
+		}(reg)
+	}
+	return func() {
+		for _, reg := range l.captures {
+			close(reg.queue)
+		}
+		wg.Wait()
+	}
+}
+
+// handleAttempts is how often a captured change is passed to its handler
+// before it is dropped
+const handleAttempts = 3
+
+// handle passes a change to the handler of its capture, retrying briefly so
+// that a short outage of HQ does not drop it. A change that still fails is
+// logged, counted as a failure and lost.
+func (l *StockListener) handle(reg *registration, change port.Change) {
+	log := logger.WithFields(change.Entity.LogFields()).WithFields(logger.Fields{"channel": change.Channel, "type": reg.Type})
+	ctx := change.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var err error
+attempts:
+	for attempt := 1; attempt <= handleAttempts; attempt++ {
+		if err = reg.handler.HandleChange(ctx, change); err == nil {
+			metrics.CapturedChanges.WithLabelValues(reg.Type, metrics.ResultSuccess).Inc()
+			log.Debug("Handled captured change")
+			return
+		}
+		log.WithFields(logger.Fields{"error": err, "attempt": attempt}).Warn("Failed to handle captured change")
+		if attempt == handleAttempts {
+			break
+		}
+
+		select {
+		case <-time.After(time.Duration(attempt) * 100 * time.Millisecond):
+		case <-ctx.Done():
+			err = ctx.Err()
+			break attempts
+		}
+	}
+	metrics.CapturedChanges.WithLabelValues(reg.Type, metrics.ResultFailure).Inc()
+	log.WithFields(logger.Fields{"error": err}).Error("Dropped captured change after failed attempts")
+}
+
+// dispatch decodes the notifications of captured channels in batch and queues
+// them for their handlers. It returns the remaining stock notifications, or
+// false when ctx was cancelled.
+func (l *StockListener) dispatch(ctx context.Context, batch []*pq.Notification) ([]*pq.Notification, bool) {
+	if len(l.captures) == 0 {
+		return batch, true
+	}
+	stock := batch[:0:0]
+	for _, n := range batch {
+		reg, ok := l.captures[n.Channel]
+		if !ok {
+			stock = append(stock, n)
+			continue
+		}
+		change, ok := l.decodeCaptured(ctx, reg, n)
+		if !ok {
+			continue
+		}
+		select {
+		case reg.queue <- change:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+	return stock, true
+}
+
+// decodeCaptured decodes and validates a notification of a captured channel
+// and returns false when it must be dropped
+func (l *StockListener) decodeCaptured(ctx context.Context, reg *registration, n *pq.Notification) (port.Change, bool) {
+	ctx, span := tracing.Tracer().Start(ctx, n.Channel+" receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("messaging.source.name", n.Channel),
+			attribute.Int("messaging.message.body.size", len(n.Extra)),
+			attribute.String("cdc.type", reg.Type),
+		))
+	defer span.End()
+	log := logger.WithFields(logger.Fields{"channel": n.Channel, "type": reg.Type})
+
+	entity, err := reg.Decode([]byte(n.Extra), l.location)
+	if err != nil {
+		metrics.DecodeErrors.WithLabelValues(n.Channel).Inc()
+		tracing.RecordError(span, err)
+		log.WithFields(logger.Fields{"error": err}).Error("Error unmarshaling notification")
+		return port.Change{}, false
+	}
+	span.SetAttributes(attribute.String("cdc.event_id", entity.EventID()))
+	if err := entity.Validate(); err != nil {
+		metrics.CapturedChanges.WithLabelValues(reg.Type, metrics.ResultInvalid).Inc()
+		tracing.RecordError(span, err)
+		log.WithFields(entity.LogFields()).WithFields(logger.Fields{"error": err}).Warn("Dropped invalid captured change")
+		return port.Change{}, false
+	}
+
+	log.WithFields(entity.LogFields()).Info("Received captured change notification")
+	return port.Change{Ctx: ctx, Channel: n.Channel, Type: reg.Type, Entity: entity}, true
+}
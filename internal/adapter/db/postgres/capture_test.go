@@ -0,0 +1,153 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/adapter/db/postgres"
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/metrics"
+
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// recordingHandler collects the changes dispatched to it
+type recordingHandler struct {
+	changes chan port.Change
+	err     error
+}
+
+func (h *recordingHandler) HandleChange(_ context.Context, change port.Change) error {
+	h.changes <- change
+	return h.err
+}
+
+func TestListenerCaptures(t *testing.T) {
+	mock := &mockPGListener{notifications: make(chan *pq.Notification, 10)}
+	products := &recordingHandler{changes: make(chan port.Change, 10)}
+	movements := &recordingHandler{changes: make(chan port.Change, 10), err: errors.New("HQ unavailable")}
+
+	listener := postgres.NewListenerWithPG(mock,
+		postgres.WithCapture(postgres.ProductCapture, products),
+		postgres.WithCapture(postgres.StockMovementCapture, movements),
+	)
+	defer closeListener(t, listener)
+
+	want := []string{"stock_changes", "product_changes", "stock_movement_changes"}
+	if got := listener.Channels(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Channels() = %v, want %v", got, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stockChan, err := listener.ListenForChanges(ctx)
+	if err != nil {
+		t.Fatalf("Failed to start listening: %v", err)
+	}
+
+	_, stockJSON := createTestStock()
+	mock.notifications <- &pq.Notification{Channel: "product_changes", Extra: `{"id":7,"sku":"","name":"Rice","updated_at":"2025-07-29T00:00:00Z"}`}
+	mock.notifications <- &pq.Notification{Channel: "product_changes", Extra: `{"id":7,"sku":"SKU-7","name":"Rice","updated_at":"2025-07-29T00:00:00Z"}`}
+	mock.notifications <- &pq.Notification{Channel: "stock_changes", Extra: stockJSON}
+	mock.notifications <- &pq.Notification{Channel: "stock_movement_changes", Extra: `{"id":42,"stock_id":"s","product_id":1,"branch_id":1,"reason":"sale","created_at":"2025-07-29T00:00:00Z"}`}
+
+	select {
+	case change := <-stockChan:
+		if change.Stock.ProductID != 1 {
+			t.Errorf("Received stock change %+v, want product 1", change.Stock)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for stock change")
+	}
+
+	select {
+	case change := <-products.changes:
+		product, ok := change.Entity.(domain.Product)
+		if !ok || product.SKU != "SKU-7" || change.Type != domain.TypeProduct || change.Channel != "product_changes" || change.Ctx == nil {
+			t.Errorf("Product handler got %+v, want the valid product change", change)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for product change")
+	}
+	select {
+	case change := <-products.changes:
+		t.Errorf("Product handler got %+v, the invalid product must be dropped", change)
+	default:
+	}
+
+	// A failing handler does not stop the listener
+	select {
+	case change := <-movements.changes:
+		if change.Entity.EventID() != "stock_movement/42" {
+			t.Errorf("Movement handler got %+v", change)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for stock movement change")
+	}
+	if !listener.Running() {
+		t.Error("Listener should keep running after a handler error")
+	}
+}
+
+// flakyHandler fails the first failures calls and counts every call
+type flakyHandler struct {
+	failures int
+	calls    chan port.Change
+}
+
+func (h *flakyHandler) HandleChange(_ context.Context, change port.Change) error {
+	h.calls <- change
+	if h.failures > 0 {
+		h.failures--
+		return errors.New("HQ unavailable")
+	}
+	return nil
+}
+
+func TestListenerCaptureRetries(t *testing.T) {
+	mock := &mockPGListener{notifications: make(chan *pq.Notification, 10)}
+	products := &flakyHandler{failures: 1, calls: make(chan port.Change, 10)}
+	branches := &flakyHandler{failures: 10, calls: make(chan port.Change, 10)}
+	failed := testutil.ToFloat64(metrics.CapturedChanges.WithLabelValues(domain.TypeBranch, metrics.ResultFailure))
+
+	listener := postgres.NewListenerWithPG(mock,
+		postgres.WithCapture(postgres.ProductCapture, products),
+		postgres.WithCapture(postgres.BranchCapture, branches),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := listener.ListenForChanges(ctx); err != nil {
+		t.Fatalf("Failed to start listening: %v", err)
+	}
+
+	mock.notifications <- &pq.Notification{Channel: "product_changes", Extra: `{"id":7,"sku":"SKU-7","name":"Rice","updated_at":"2025-07-29T00:00:00Z"}`}
+	mock.notifications <- &pq.Notification{Channel: "branch_changes", Extra: `{"id":3,"code":"BKK","name":"Bangkok","updated_at":"2025-07-29T00:00:00Z"}`}
+
+	calls := func(h *flakyHandler) int {
+		n := 0
+		for {
+			select {
+			case <-h.calls:
+				n++
+			case <-time.After(500 * time.Millisecond):
+				return n
+			}
+		}
+	}
+	if n := calls(products); n != 2 {
+		t.Errorf("Product handler called %d times, want a retry after the failure", n)
+	}
+	if n := calls(branches); n != 3 {
+		t.Errorf("Branch handler called %d times, want 3 attempts", n)
+	}
+	// The branch change is lost after its last attempt
+	closeListener(t, listener)
+	if got := testutil.ToFloat64(metrics.CapturedChanges.WithLabelValues(domain.TypeBranch, metrics.ResultFailure)); got != failed+1 {
+		t.Errorf("captured branch failures = %v, want %v", got, failed+1)
+	}
+}
@@ -0,0 +1,287 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/config"
+	"stock-consolidation/pkg/health"
+	"stock-consolidation/pkg/logger"
+
+	"github.com/lib/pq"
+)
+
+// ConsolidatedStore keeps the latest stock of every product at every branch
+// in the consolidated_stock table of the HQ database
+type ConsolidatedStore struct {
+	db *sql.DB
+}
+
+// NewConsolidatedStoreWithDB creates a new ConsolidatedStore using an existing connection pool
+func NewConsolidatedStoreWithDB(db *sql.DB) *ConsolidatedStore {
+	return &ConsolidatedStore{db: db}
+}
+
+// NewConsolidatedStore opens a connection pool to the HQ database
+func NewConsolidatedStore(cfg *config.Config) (*ConsolidatedStore, error) {
+	db, err := OpenDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Successfully connected to PostgreSQL for consolidated stock")
+	return NewConsolidatedStoreWithDB(db), nil
+}
+
+// ApplyStock stores stock unless the stored row of its product and branch was
+// updated at the same time or later. Branches resend changes after failures
+// and deliver them concurrently, so an older change can arrive last. The
+// stored row is locked before it is replaced so that the returned previous
+// stock is the one the change replaced.
+func (s *ConsolidatedStore) ApplyStock(ctx context.Context, stock domain.Stock) (port.ApplyResult, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return port.ApplyResult{}, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback is a no-op once the transaction is committed
+		_ = tx.Rollback()
+	}()
+
+	stored := domain.Stock{ProductID: stock.ProductID, BranchID: stock.BranchID}
+	err = tx.QueryRowContext(ctx,
+		"SELECT id, quantity, reserved, updated_at FROM consolidated_stock WHERE product_id = $1 AND branch_id = $2 FOR UPDATE",
+		stock.ProductID, stock.BranchID,
+	).Scan(&stored.ID, &stored.Quantity, &stored.Reserved, &stored.UpdatedAt)
+	exists := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		return port.ApplyResult{}, fmt.Errorf("failed to read consolidated stock: %v", err)
+	}
+	if exists && !stored.UpdatedAt.Before(stock.UpdatedAt) {
+		return notApplied(stock, stored)
+	}
+
+	// A row inserted concurrently since the lookup is only replaced when older
+	var id string
+	err = tx.QueryRowContext(ctx, `INSERT INTO consolidated_stock
+  (id, product_id, branch_id, quantity, reserved, created_at, updated_at, received_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, now())
+ON CONFLICT (product_id, branch_id) DO UPDATE SET
+  id = EXCLUDED.id, quantity = EXCLUDED.quantity, reserved = EXCLUDED.reserved,
+  created_at = EXCLUDED.created_at, updated_at = EXCLUDED.updated_at, received_at = now()
+WHERE consolidated_stock.updated_at < EXCLUDED.updated_at
+RETURNING id`,
+		stock.ID, stock.ProductID, stock.BranchID, stock.Quantity, stock.Reserved, stock.CreatedAt, stock.UpdatedAt,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		if err := tx.QueryRowContext(ctx,
+			"SELECT id, quantity, reserved, updated_at FROM consolidated_stock WHERE product_id = $1 AND branch_id = $2",
+			stock.ProductID, stock.BranchID,
+		).Scan(&stored.ID, &stored.Quantity, &stored.Reserved, &stored.UpdatedAt); err != nil {
+			return port.ApplyResult{}, fmt.Errorf("failed to read consolidated stock: %v", err)
+		}
+		return notApplied(stock, stored)
+	}
+	if err != nil {
+		return port.ApplyResult{}, fmt.Errorf("failed to write consolidated stock: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return port.ApplyResult{}, fmt.Errorf("failed to commit consolidated stock: %v", err)
+	}
+
+	result := port.ApplyResult{Result: port.IngestApplied}
+	if exists {
+		result.Previous = &stored
+	}
+	return result, nil
+}
+
+// notApplied reports whether stock, which did not replace the stored row, is
+// the stored change resent or a stale one
+func notApplied(stock, stored domain.Stock) (port.ApplyResult, error) {
+	if stored.EventID() == stock.EventID() && stored.Quantity == stock.Quantity && stored.Reserved == stock.Reserved {
+		return port.ApplyResult{Result: port.IngestDuplicate}, nil
+	}
+	return port.ApplyResult{}, port.ErrStaleStock
+}
+
+// ListStocks returns one page of consolidated stock rows matching q and the total number of matches
+func (s *ConsolidatedStore) ListStocks(ctx context.Context, q port.StockQuery) (port.StockPage, error) {
+	return listStocks(ctx, s.db, "consolidated_stock", q)
+}
+
+// ProductTotals returns one page of per-product totals ordered by product and
+// the total number of products matching q
+func (s *ConsolidatedStore) ProductTotals(ctx context.Context, q port.TotalsQuery) (port.TotalsPage, error) {
+	where, args := consolidatedFilter("", q.ProductID, q.BranchIDs, 0)
+
+	var page port.TotalsPage
+	if err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(DISTINCT product_id) FROM consolidated_stock"+where, args...,
+	).Scan(&page.Total); err != nil {
+		return page, fmt.Errorf("failed to count products: %v", err)
+	}
+
+	query := "SELECT product_id, COUNT(*), SUM(quantity), SUM(reserved), MAX(updated_at) FROM consolidated_stock" +
+		where + " GROUP BY product_id ORDER BY product_id" +
+		fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	rows, err := s.db.QueryContext(ctx, query, append(args, q.Limit, q.Offset)...)
+	if err != nil {
+		return page, fmt.Errorf("failed to query product totals: %v", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.WithFields(logger.Fields{"error": err}).Warn("Failed to close product total rows")
+		}
+	}()
+
+	page.Totals = []domain.ProductTotal{}
+	for rows.Next() {
+		var total domain.ProductTotal
+		if err := rows.Scan(&total.ProductID, &total.Branches, &total.Quantity, &total.Reserved, &total.UpdatedAt); err != nil {
+			return page, fmt.Errorf("failed to scan product total: %v", err)
+		}
+		total.Available = total.Quantity - total.Reserved
+		page.Totals = append(page.Totals, total)
+	}
+	if err := rows.Err(); err != nil {
+		return page, fmt.Errorf("failed to read product totals: %v", err)
+	}
+	return page, nil
+}
+
+// safetyStockLevels computes the safety stock of every row from the product
+// settings ($1, $2), the branch settings ($3, $4) and the default ($5)
+const safetyStockLevels = `WITH product_safety (product_id, units) AS (SELECT * FROM unnest($1::int[], $2::int[])),
+branch_safety (branch_id, units) AS (SELECT * FROM unnest($3::int[], $4::int[])),
+levels AS (
+  SELECT s.product_id, s.branch_id, s.quantity, s.reserved, s.updated_at,
+    COALESCE(p.units, b.units, $5) AS safety_stock
+  FROM consolidated_stock s
+  LEFT JOIN product_safety p ON p.product_id = s.product_id
+  LEFT JOIN branch_safety b ON b.branch_id = s.branch_id
+)
+`
+
+// Shortages returns one page of the branch stock with fewer available units
+// than its safety stock, largest shortfall first, and the total number of
+// such rows
+func (s *ConsolidatedStore) Shortages(ctx context.Context, q port.ShortageQuery) (port.ShortagePage, error) {
+	productIDs, productUnits := safetyArrays(q.SafetyStock.Products)
+	branchIDs, branchUnits := safetyArrays(q.SafetyStock.Branches)
+	args := []interface{}{productIDs, productUnits, branchIDs, branchUnits, q.SafetyStock.Default}
+	where, filterArgs := consolidatedFilter("quantity - reserved < safety_stock", q.ProductID, q.BranchIDs, len(args))
+	args = append(args, filterArgs...)
+
+	var page port.ShortagePage
+	if err := s.db.QueryRowContext(ctx,
+		safetyStockLevels+"SELECT COUNT(*) FROM levels"+where, args...,
+	).Scan(&page.Total); err != nil {
+		return page, fmt.Errorf("failed to count shortages: %v", err)
+	}
+
+	query := safetyStockLevels + "SELECT product_id, branch_id, quantity, reserved, updated_at, safety_stock FROM levels" +
+		where + " ORDER BY safety_stock - (quantity - reserved) DESC, product_id, branch_id" +
+		fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	rows, err := s.db.QueryContext(ctx, query, append(args, q.Limit, q.Offset)...)
+	if err != nil {
+		return page, fmt.Errorf("failed to query shortages: %v", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.WithFields(logger.Fields{"error": err}).Warn("Failed to close shortage rows")
+		}
+	}()
+
+	page.Shortages = []domain.BranchStock{}
+	for rows.Next() {
+		var (
+			stock       domain.Stock
+			safetyStock int
+		)
+		if err := rows.Scan(&stock.ProductID, &stock.BranchID, &stock.Quantity, &stock.Reserved,
+			&stock.UpdatedAt, &safetyStock); err != nil {
+			return page, fmt.Errorf("failed to scan shortage: %v", err)
+		}
+		page.Shortages = append(page.Shortages, domain.NewBranchStock(stock, safetyStock))
+	}
+	if err := rows.Err(); err != nil {
+		return page, fmt.Errorf("failed to read shortages: %v", err)
+	}
+	return page, nil
+}
+
+// consolidatedFilter builds the WHERE clause of condition and the product and
+// branch filters. Its placeholders are numbered after the first skip arguments.
+func consolidatedFilter(condition string, productID int, branchIDs []int, skip int) (string, []interface{}) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	if condition != "" {
+		conditions = append(conditions, condition)
+	}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, skip+len(args)))
+	}
+
+	if productID != 0 {
+		add("product_id = $%d", productID)
+	}
+	if len(branchIDs) > 0 {
+		add("branch_id = ANY($%d)", pq.Array(int64s(branchIDs)))
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// safetyArrays returns the ids and units of settings as parallel arrays,
+// ordered by id
+func safetyArrays(settings map[int]int) (interface{}, interface{}) {
+	ids := make([]int, 0, len(settings))
+	for id := range settings {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	units := make([]int64, len(ids))
+	for i, id := range ids {
+		units[i] = int64(settings[id])
+	}
+	return pq.Array(int64s(ids)), pq.Array(units)
+}
+
+func int64s(values []int) []int64 {
+	result := make([]int64, len(values))
+	for i, v := range values {
+		result[i] = int64(v)
+	}
+	return result
+}
+
+// Ping verifies the database connection
+func (s *ConsolidatedStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the connection pool
+func (s *ConsolidatedStore) Close() error {
+	return s.db.Close()
+}
+
+// PingCheck returns a health check that pings the HQ database
+func (s *ConsolidatedStore) PingCheck() health.CheckFunc {
+	return func(ctx context.Context) (health.Details, error) {
+		if err := s.Ping(ctx); err != nil {
+			return nil, fmt.Errorf("ping failed: %v", err)
+		}
+		return nil, nil
+	}
+}
@@ -0,0 +1,322 @@
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/adapter/db/postgres"
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/config"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+func TestConsolidatedStore_ApplyStock(t *testing.T) {
+	updated := time.Date(2025, 7, 29, 10, 0, 0, 0, time.UTC)
+	stock := domain.Stock{ID: "a", ProductID: 1, BranchID: 2, Quantity: 10, Reserved: 3, CreatedAt: updated, UpdatedAt: updated}
+	upsert := regexp.QuoteMeta("WHERE consolidated_stock.updated_at < EXCLUDED.updated_at")
+	locked := regexp.QuoteMeta("SELECT id, quantity, reserved, updated_at FROM consolidated_stock WHERE product_id = $1 AND branch_id = $2 FOR UPDATE")
+	stored := regexp.QuoteMeta("SELECT id, quantity, reserved, updated_at FROM consolidated_stock WHERE product_id = $1 AND branch_id = $2")
+	storedRow := func(id string, quantity int, updatedAt time.Time) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "quantity", "reserved", "updated_at"}).AddRow(id, quantity, 3, updatedAt)
+	}
+
+	tests := []struct {
+		name    string
+		setup   func(mock sqlmock.Sqlmock)
+		want    port.ApplyResult
+		wantErr error
+	}{
+		{
+			name: "new row is applied",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(locked).WithArgs(1, 2).WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(upsert).
+					WithArgs("a", 1, 2, 10, 3, updated, updated).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("a"))
+				mock.ExpectCommit()
+			},
+			want: port.ApplyResult{Result: port.IngestApplied},
+		},
+		{
+			name: "newer change returns the replaced stock",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(locked).WithArgs(1, 2).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "quantity", "reserved", "updated_at"}).AddRow("z", 40, 5, updated.Add(-time.Hour)))
+				mock.ExpectQuery(upsert).
+					WithArgs("a", 1, 2, 10, 3, updated, updated).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("a"))
+				mock.ExpectCommit()
+			},
+			want: port.ApplyResult{Result: port.IngestApplied, Previous: &domain.Stock{
+				ID: "z", ProductID: 1, BranchID: 2, Quantity: 40, Reserved: 5, UpdatedAt: updated.Add(-time.Hour),
+			}},
+		},
+		{
+			name: "resent change is a duplicate",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(locked).WithArgs(1, 2).WillReturnRows(storedRow("a", 10, updated))
+				mock.ExpectRollback()
+			},
+			want: port.ApplyResult{Result: port.IngestDuplicate},
+		},
+		{
+			name: "older change is stale",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(locked).WithArgs(1, 2).WillReturnRows(storedRow("a", 12, updated.Add(time.Minute)))
+				mock.ExpectRollback()
+			},
+			wantErr: port.ErrStaleStock,
+		},
+		{
+			name: "different change with the same timestamp is stale",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(locked).WithArgs(1, 2).WillReturnRows(storedRow("a", 11, updated))
+				mock.ExpectRollback()
+			},
+			wantErr: port.ErrStaleStock,
+		},
+		{
+			name: "newer row inserted concurrently wins",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(locked).WithArgs(1, 2).WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(upsert).WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(stored).WithArgs(1, 2).WillReturnRows(storedRow("b", 12, updated.Add(time.Minute)))
+				mock.ExpectRollback()
+			},
+			wantErr: port.ErrStaleStock,
+		},
+		{
+			name: "database errors are returned",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(locked).WithArgs(1, 2).WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(upsert).WillReturnError(errors.New("connection reset"))
+				mock.ExpectRollback()
+			},
+			wantErr: errors.New("failed to write consolidated stock: connection reset"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New() error = %v", err)
+			}
+			defer db.Close()
+			tt.setup(mock)
+
+			got, err := postgres.NewConsolidatedStoreWithDB(db).ApplyStock(context.Background(), stock)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("ApplyStock() error = %v", err)
+			case tt.wantErr != nil && (err == nil || err.Error() != tt.wantErr.Error()):
+				t.Fatalf("ApplyStock() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ApplyStock() = %+v, want %+v", got, tt.want)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestConsolidatedStore_ApplyStockDatabase(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping real database test in short mode")
+	}
+	db, err := postgres.OpenDB(&config.Config{
+		DBHost:     "localhost",
+		DBPort:     "5432",
+		DBUser:     "admin",
+		DBPassword: "admin123",
+		DBName:     "stockdb",
+	})
+	if err != nil {
+		t.Skipf("Skipping real database test due to connection error: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	migrator, err := postgres.NewConsolidationMigrator(db)
+	if err != nil {
+		t.Fatalf("NewConsolidationMigrator() error = %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	// A product of its own keeps the test apart from other rows
+	productID := int(time.Now().UnixNano()%1_000_000_000) + 1_000_000_000
+	defer func() {
+		if _, err := db.Exec("DELETE FROM consolidated_stock WHERE product_id = $1", productID); err != nil {
+			t.Errorf("Failed to remove test stock: %v", err)
+		}
+	}()
+
+	store := postgres.NewConsolidatedStoreWithDB(db)
+	updated := time.Date(2025, 7, 29, 10, 0, 0, 0, time.UTC)
+	first := domain.Stock{ID: "first", ProductID: productID, BranchID: 2, Quantity: 40, Reserved: 5, CreatedAt: updated, UpdatedAt: updated}
+	second := domain.Stock{ID: "second", ProductID: productID, BranchID: 2, Quantity: 10, Reserved: 3, CreatedAt: updated, UpdatedAt: updated.Add(time.Minute)}
+
+	if got, err := store.ApplyStock(ctx, first); err != nil || got.Result != port.IngestApplied || got.Previous != nil {
+		t.Fatalf("ApplyStock(first) = %+v, %v, want applied without previous stock", got, err)
+	}
+	got, err := store.ApplyStock(ctx, second)
+	if err != nil || got.Result != port.IngestApplied || got.Previous == nil {
+		t.Fatalf("ApplyStock(second) = %+v, %v, want applied replacing the first", got, err)
+	}
+	if got.Previous.Quantity != 40 || got.Previous.Reserved != 5 || !got.Previous.UpdatedAt.Equal(updated) {
+		t.Errorf("ApplyStock(second) previous = %+v, want the first change", got.Previous)
+	}
+	if got, err := store.ApplyStock(ctx, second); err != nil || got.Result != port.IngestDuplicate {
+		t.Errorf("ApplyStock(second) again = %+v, %v, want duplicate", got, err)
+	}
+	if _, err := store.ApplyStock(ctx, first); !errors.Is(err, port.ErrStaleStock) {
+		t.Errorf("ApplyStock(first) again error = %v, want ErrStaleStock", err)
+	}
+}
+
+func TestConsolidatedStore_ListStocks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	defer db.Close()
+	testTime := time.Date(2025, 7, 29, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM consolidated_stock WHERE product_id = $1")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM consolidated_stock WHERE product_id = $1 ORDER BY product_id ASC, product_id, branch_id LIMIT $2 OFFSET $3")).
+		WithArgs(1, 50, 0).
+		WillReturnRows(sqlmock.NewRows(stockColumns).
+			AddRow("a", 1, 1, 10, 0, testTime, testTime).
+			AddRow("b", 1, 2, 20, 5, testTime, testTime))
+
+	page, err := postgres.NewConsolidatedStoreWithDB(db).ListStocks(context.Background(), port.StockQuery{ProductID: 1, Limit: 50})
+	if err != nil {
+		t.Fatalf("ListStocks() error = %v", err)
+	}
+	if page.Total != 2 || len(page.Stocks) != 2 || page.Stocks[1].BranchID != 2 {
+		t.Errorf("ListStocks() = %+v", page)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConsolidatedStore_ProductTotals(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	defer db.Close()
+	testTime := time.Date(2025, 7, 29, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(DISTINCT product_id) FROM consolidated_stock")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM consolidated_stock GROUP BY product_id ORDER BY product_id LIMIT $1 OFFSET $2")).
+		WithArgs(2, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"product_id", "count", "quantity", "reserved", "updated_at"}).
+			AddRow(1, 2, 30, 5, testTime).
+			AddRow(2, 1, 7, 7, testTime))
+
+	page, err := postgres.NewConsolidatedStoreWithDB(db).ProductTotals(context.Background(), port.TotalsQuery{Limit: 2})
+	if err != nil {
+		t.Fatalf("ProductTotals() error = %v", err)
+	}
+	want := domain.ProductTotal{ProductID: 1, Branches: 2, Quantity: 30, Reserved: 5, Available: 25, UpdatedAt: testTime}
+	if page.Total != 3 || len(page.Totals) != 2 || page.Totals[0] != want || page.Totals[1].Available != 0 {
+		t.Errorf("ProductTotals() = %+v", page)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConsolidatedStore_ProductTotalsOfBranches(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(DISTINCT product_id) FROM consolidated_stock WHERE product_id = $1 AND branch_id = ANY($2)")).
+		WithArgs(42, pq.Array([]int64{1, 2})).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM consolidated_stock WHERE product_id = $1 AND branch_id = ANY($2) GROUP BY product_id ORDER BY product_id LIMIT $3 OFFSET $4")).
+		WithArgs(42, pq.Array([]int64{1, 2}), 50, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"product_id", "count", "quantity", "reserved", "updated_at"}))
+
+	page, err := postgres.NewConsolidatedStoreWithDB(db).ProductTotals(context.Background(),
+		port.TotalsQuery{ProductID: 42, BranchIDs: []int{1, 2}, Limit: 50})
+	if err != nil {
+		t.Fatalf("ProductTotals() error = %v", err)
+	}
+	if page.Totals == nil || len(page.Totals) != 0 {
+		t.Errorf("ProductTotals() totals = %#v, want empty slice", page.Totals)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConsolidatedStore_Shortages(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	defer db.Close()
+	testTime := time.Date(2025, 7, 29, 0, 0, 0, 0, time.UTC)
+
+	safetyArgs := []driver.Value{pq.Array([]int64{42, 43}), pq.Array([]int64{25, 0}), pq.Array([]int64{3}), pq.Array([]int64{5}), 10}
+	mock.ExpectQuery(regexp.QuoteMeta("COALESCE(p.units, b.units, $5) AS safety_stock") +
+		".*" + regexp.QuoteMeta("SELECT COUNT(*) FROM levels WHERE quantity - reserved < safety_stock AND branch_id = ANY($6)")).
+		WithArgs(append(safetyArgs, pq.Array([]int64{2, 3}))...).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM levels WHERE quantity - reserved < safety_stock AND branch_id = ANY($6) " +
+		"ORDER BY safety_stock - (quantity - reserved) DESC, product_id, branch_id LIMIT $7 OFFSET $8")).
+		WithArgs(append(safetyArgs, pq.Array([]int64{2, 3}), 50, 0)...).
+		WillReturnRows(sqlmock.NewRows([]string{"product_id", "branch_id", "quantity", "reserved", "updated_at", "safety_stock"}).
+			AddRow(42, 2, 10, 5, testTime, 25).
+			AddRow(7, 3, 4, 0, testTime, 5))
+
+	page, err := postgres.NewConsolidatedStoreWithDB(db).Shortages(context.Background(), port.ShortageQuery{
+		BranchIDs: []int{2, 3},
+		SafetyStock: domain.StockLevels{
+			Default:  10,
+			Products: map[int]int{43: 0, 42: 25},
+			Branches: map[int]int{3: 5},
+		},
+		Limit: 50,
+	})
+	if err != nil {
+		t.Fatalf("Shortages() error = %v", err)
+	}
+	if page.Total != 2 || len(page.Shortages) != 2 {
+		t.Fatalf("Shortages() = %+v", page)
+	}
+	if got := page.Shortages[0]; got.Available != 5 || got.SafetyStock != 25 || got.Shortfall != 20 {
+		t.Errorf("Shortages()[0] = %+v, want 20 units short of 25", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"stock-consolidation/pkg/health"
+)
+
+// PingCheck returns a health check that pings the PostgreSQL connection
+func (l *StockListener) PingCheck() health.CheckFunc {
+	return func(_ context.Context) (health.Details, error) {
+		if err := l.Ping(); err != nil {
+			return nil, fmt.Errorf("ping failed: %v", err)
+		}
+		return nil, nil
+	}
+}
+
+// PingCheck returns a health check that pings the database of the store
+func (s *StockStore) PingCheck() health.CheckFunc {
+	return func(ctx context.Context) (health.Details, error) {
+		if err := s.Ping(ctx); err != nil {
+			return nil, fmt.Errorf("ping failed: %v", err)
+		}
+		return nil, nil
+	}
+}
+
+// RunningCheck returns a health check that fails once the notification goroutine has stopped
+func (l *StockListener) RunningCheck() health.CheckFunc {
+	return func(_ context.Context) (health.Details, error) {
+		if !l.Running() {
+			return nil, fmt.Errorf("listener is not running")
+		}
+		return nil, nil
+	}
+}
+
+// BacklogCheck returns a health check that fails when more than max changes wait for delivery
+func (l *StockListener) BacklogCheck(max int) health.CheckFunc {
+	return func(_ context.Context) (health.Details, error) {
+		depth := l.QueueDepth()
+		details := health.Details{"queue_depth": depth, "max": max}
+		if depth > max {
+			return details, fmt.Errorf("delivery backlog of %d exceeds %d", depth, max)
+		}
+		return details, nil
+	}
+}
@@ -0,0 +1,15 @@
+-- Create the consolidated stock table holding the latest stock of every
+-- product at every branch, as received from the branches
+CREATE TABLE IF NOT EXISTS consolidated_stock (
+  id TEXT NOT NULL,
+  product_id INTEGER NOT NULL,
+  branch_id INTEGER NOT NULL,
+  quantity INTEGER NOT NULL,
+  reserved INTEGER NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL,
+  received_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (product_id, branch_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_consolidated_stock_branch ON consolidated_stock (branch_id);
@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+	"time"
+
+	"stock-consolidation/pkg/health"
+	"stock-consolidation/pkg/logger"
+	"stock-consolidation/pkg/metrics"
+)
+
+// Roles reported by the LeaderElector
+const (
+	RoleLeader  = "leader"
+	RoleStandby = "standby"
+)
+
+// releaseTimeout bounds the unlock on shutdown
+const releaseTimeout = 5 * time.Second
+
+// LeaderElector elects one leader among the replicas sharing a database with
+// a session-level advisory lock. The lock is held on a dedicated connection,
+// so PostgreSQL releases it as soon as the leader's session drops and a
+// standby takes it on its next attempt.
+type LeaderElector struct {
+	db       *sql.DB
+	lockID   int64
+	interval time.Duration
+
+	// conn holds the session the lock is taken on. It is only used by Run.
+	conn *sql.Conn
+
+	mu      sync.Mutex
+	leader  bool
+	since   time.Time
+	lastErr error
+}
+
+// NewLeaderElector creates a LeaderElector competing for lockID every interval
+func NewLeaderElector(db *sql.DB, lockID int64, interval time.Duration) *LeaderElector {
+	return &LeaderElector{
+		db:       db,
+		lockID:   lockID,
+		interval: interval,
+		since:    time.Now(),
+	}
+}
+
+// Run tries to become the leader, and while leading checks that the session
+// holding the lock is alive, every interval until ctx is done. The lock is
+// released on return.
+func (e *LeaderElector) Run(ctx context.Context) {
+	metrics.Leader.Set(0)
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		e.elect(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			e.release()
+			return
+		}
+	}
+}
+
+// elect takes the lock when it is free, or verifies that it is still held
+func (e *LeaderElector) elect(ctx context.Context) {
+	if e.conn == nil {
+		conn, err := e.db.Conn(ctx)
+		if err != nil {
+			e.setLeader(false, fmt.Errorf("failed to open session: %v", err))
+			return
+		}
+		e.conn = conn
+	}
+
+	if e.IsLeader() {
+		if err := e.conn.PingContext(ctx); err != nil {
+			e.drop(fmt.Errorf("lost session holding the lock: %v", err))
+		}
+		return
+	}
+
+	var acquired bool
+	if err := e.conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", e.lockID).Scan(&acquired); err != nil {
+		e.drop(fmt.Errorf("failed to try the lock: %v", err))
+		return
+	}
+	e.setLeader(acquired, nil)
+}
+
+// drop closes the session, releasing the lock if it is still held. The
+// connection is discarded rather than returned to the pool, where it would
+// keep holding the lock.
+func (e *LeaderElector) drop(err error) {
+	_ = e.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	if closeErr := e.conn.Close(); closeErr != nil {
+		logger.Debug("Error closing leader election session: %v", closeErr)
+	}
+	e.conn = nil
+	e.setLeader(false, err)
+}
+
+// release unlocks and closes the session on shutdown, so a standby can take
+// over without waiting for the connection to time out
+func (e *LeaderElector) release() {
+	if e.conn == nil {
+		return
+	}
+	if e.IsLeader() {
+		ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+		defer cancel()
+		if _, err := e.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", e.lockID); err != nil {
+			logger.Warn("Failed to release leader lock: %v", err)
+		}
+	}
+	e.drop(nil)
+}
+
+// setLeader records the outcome of an election attempt
+func (e *LeaderElector) setLeader(leader bool, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lastErr = err
+	if err != nil {
+		logger.WithFields(logger.Fields{"lock_id": e.lockID, "error": err}).Warn("Leader election failed")
+	}
+	if leader == e.leader {
+		return
+	}
+	e.leader = leader
+	e.since = time.Now()
+	if leader {
+		metrics.Leader.Set(1)
+		logger.WithFields(logger.Fields{"lock_id": e.lockID}).Info("Became leader, forwarding changes")
+	} else {
+		metrics.Leader.Set(0)
+		logger.WithFields(logger.Fields{"lock_id": e.lockID}).Warn("Lost leadership, standing by")
+	}
+}
+
+// IsLeader reports whether this instance holds the lock
+func (e *LeaderElector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// Role returns RoleLeader or RoleStandby
+func (e *LeaderElector) Role() string {
+	if e.IsLeader() {
+		return RoleLeader
+	}
+	return RoleStandby
+}
+
+// HealthCheck returns a health check reporting the role of this instance. A
+// standby is healthy; the check only fails while the lock cannot be tried.
+func (e *LeaderElector) HealthCheck() health.CheckFunc {
+	return func(_ context.Context) (health.Details, error) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		role := RoleStandby
+		if e.leader {
+			role = RoleLeader
+		}
+		details := health.Details{"role": role, "since": e.since, "lock_id": e.lockID}
+		if e.lastErr != nil {
+			return details, fmt.Errorf("leader election failing: %v", e.lastErr)
+		}
+		return details, nil
+	}
+}
@@ -0,0 +1,99 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/adapter/db/postgres"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// runElector runs e until the returned function is called
+func runElector(e *postgres.LeaderElector) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Run(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// waitRole waits until e reports role
+func waitRole(t *testing.T, e *postgres.LeaderElector, role string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for e.Role() != role {
+		if time.Now().After(deadline) {
+			t.Fatalf("Role() = %s, want %s", e.Role(), role)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLeaderElector(t *testing.T) {
+	tryLock := regexp.QuoteMeta("SELECT pg_try_advisory_lock($1)")
+
+	t.Run("standby takes over once the lock is free", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock.New() error = %v", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery(tryLock).WithArgs(int64(42)).WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(false))
+		mock.ExpectQuery(tryLock).WithArgs(int64(42)).WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(true))
+		mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_unlock($1)")).WithArgs(int64(42)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		elector := postgres.NewLeaderElector(db, 42, 5*time.Millisecond)
+		if elector.IsLeader() {
+			t.Fatal("IsLeader() = true before the first election")
+		}
+		stop := runElector(elector)
+		waitRole(t, elector, postgres.RoleLeader)
+
+		details, err := elector.HealthCheck()(context.Background())
+		if err != nil || details["role"] != postgres.RoleLeader {
+			t.Errorf("HealthCheck() = %v, %v, want role leader", details, err)
+		}
+
+		stop()
+		if elector.IsLeader() {
+			t.Error("IsLeader() = true after Run returned")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("leader steps down when its session drops", func(t *testing.T) {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Fatalf("sqlmock.New() error = %v", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery(tryLock).WithArgs(int64(7)).WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(true))
+		mock.ExpectPing().WillReturnError(errors.New("connection reset by peer"))
+
+		elector := postgres.NewLeaderElector(db, 7, 5*time.Millisecond)
+		stop := runElector(elector)
+		defer stop()
+		waitRole(t, elector, postgres.RoleLeader)
+		waitRole(t, elector, postgres.RoleStandby)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		if _, err := elector.HealthCheck()(context.Background()); err == nil {
+			t.Error("HealthCheck() error = nil after losing the session")
+		}
+	})
+}
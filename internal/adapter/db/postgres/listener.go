@@ -3,14 +3,20 @@ package postgres
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"sync/atomic"
+	"time"
 
 	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
 	"stock-consolidation/pkg/config"
 	"stock-consolidation/pkg/logger"
+	"stock-consolidation/pkg/metrics"
+	"stock-consolidation/pkg/tracing"
 
 	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // PGListener defines the interface for PostgreSQL listener operations
@@ -21,23 +27,83 @@ type PGListener interface {
 	NotificationChannel() <-chan *pq.Notification
 }
 
-// StockListener handles PostgreSQL notifications for stock changes
+// notificationBuffer is the number of decoded changes that can wait for delivery
+// before the listener stops reading notifications
+const notificationBuffer = 100
+
+// StockListener handles PostgreSQL notifications: stock changes are decoded
+// and queued for delivery, the changes of other captured tables are dispatched
+// to the handler registered for their channel
 type StockListener struct {
 	listener PGListener
-	channel  string
+	// channels are the channels stock changes are notified on
+	channels   []string
+	quarantine port.Quarantine
+	location   *time.Location
+	lookup     *StockStore
+	// source names the branch database and branchID, when set, is the only
+	// branch it may send stock for
+	source   string
+	branchID int
+	// captures holds the registered captures by channel
+	captures map[string]*registration
+
+	running atomic.Bool
+	queue   atomic.Pointer[chan port.StockChange]
+}
+
+// ListenerOption configures optional dependencies of the StockListener
+type ListenerOption func(*StockListener)
+
+// WithQuarantine stores changes that fail validation in quarantine. Without
+// it invalid changes are only logged and dropped.
+func WithQuarantine(quarantine port.Quarantine) ListenerOption {
+	return func(l *StockListener) {
+		l.quarantine = quarantine
+	}
+}
+
+// WithStockChannels listens for stock changes on channels instead of
+// stock_changes, e.g. one channel per branch schema in a shared database
+func WithStockChannels(channels ...string) ListenerOption {
+	return func(l *StockListener) {
+		l.channels = channels
+	}
+}
+
+// WithSource tags changes with the name of the branch source they were read
+// from. When branchID is not zero, stock of any other branch is quarantined.
+func WithSource(name string, branchID int) ListenerOption {
+	return func(l *StockListener) {
+		l.source = name
+		l.branchID = branchID
+	}
+}
+
+// WithTimezone interprets notification timestamps without a UTC offset in loc,
+// the time zone of the branch database. The default is UTC.
+func WithTimezone(loc *time.Location) ListenerOption {
+	return func(l *StockListener) {
+		l.location = loc
+	}
 }
 
 // NewListenerWithPG creates a new StockListener with a custom PGListener
-func NewListenerWithPG(listener PGListener) *StockListener {
-	return &StockListener{
+func NewListenerWithPG(listener PGListener, opts ...ListenerOption) *StockListener {
+	l := &StockListener{
 		listener: listener,
-		channel:  "stock_changes",
+		channels: []string{StockCapture.Channel},
+		location: time.UTC,
+	}
+	for _, opt := range opts {
+		opt(l)
 	}
+	return l
 }
 
-// NewListener creates a new StockListener with PostgreSQL connection
-func NewListener(cfg *config.Config) (*StockListener, error) {
-	connStr := fmt.Sprintf(
+// connString builds the PostgreSQL connection string from the configuration
+func connString(cfg *config.Config) string {
+	return fmt.Sprintf(
 		"host=%s port=%s dbname=%s user=%s password=%s sslmode=disable",
 		cfg.DBHost,
 		cfg.DBPort,
@@ -45,58 +111,88 @@ func NewListener(cfg *config.Config) (*StockListener, error) {
 		cfg.DBUser,
 		cfg.DBPassword,
 	)
+}
 
-	reportProblem := func(_ pq.ListenerEventType, err error) {
+// NewListener creates a new StockListener with PostgreSQL connection. It
+// listens for stock changes on the channels of cfg unless opts say otherwise.
+func NewListener(cfg *config.Config, opts ...ListenerOption) (*StockListener, error) {
+	connStr := connString(cfg)
+	if len(cfg.Channels.Stock) > 0 {
+		opts = append([]ListenerOption{WithStockChannels(cfg.Channels.Stock...)}, opts...)
+	}
+
+	// The options name the source the connection state is reported for
+	l := NewListenerWithPG(nil, opts...)
+	source := l.source
+	reportProblem := func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventConnected, pq.ListenerEventReconnected:
+			metrics.SetListenerConnected(source, true)
+		case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+			metrics.SetListenerConnected(source, false)
+		}
 		if err != nil {
-			logger.Error("Postgres listener error: %v", err)
+			logger.WithFields(logger.Fields{"error": err, "source": source}).Error("Postgres listener error")
 		}
 	}
 
 	listener := pq.NewListener(connStr, 10, 0, reportProblem)
-	if err := listener.Listen("stock_changes"); err != nil {
-		return nil, fmt.Errorf("failed to start listening: %v", err)
+	l.listener = listener
+	for _, channel := range l.Channels() {
+		if err := listener.Listen(channel); err != nil {
+			_ = listener.Close()
+			return nil, fmt.Errorf("failed to start listening on %s: %v", channel, err)
+		}
 	}
 
 	// Verify the connection
 	if err := listener.Ping(); err != nil {
+		_ = listener.Close()
 		return nil, fmt.Errorf("failed to ping PostgreSQL: %v", err)
 	}
+	metrics.SetListenerConnected(source, true)
 
-	logger.Info("Successfully connected to PostgreSQL and listening on channel: stock_changes")
+	logger.WithFields(logger.Fields{"channels": l.Channels()}).Info("Successfully connected to PostgreSQL and listening for notifications")
 
-	return &StockListener{
-		listener: listener,
-		channel:  "stock_changes",
-	}, nil
+	return l, nil
 }
 
-// ListenForChanges starts listening for stock change notifications
-func (l *StockListener) ListenForChanges(ctx context.Context) (<-chan domain.Stock, error) {
-	stockChan := make(chan domain.Stock)
+// ListenForChanges starts listening for notifications. Stock changes are
+// returned on the channel; changes of captured tables go to their handlers.
+func (l *StockListener) ListenForChanges(ctx context.Context) (<-chan port.StockChange, error) {
+	stockChan := make(chan port.StockChange, notificationBuffer)
+	l.queue.Store(&stockChan)
 
+	l.running.Store(true)
+	stopCaptures := l.startCaptures()
 	go func() {
 		defer close(stockChan)
-		logger.Info("Starting to listen for PostgreSQL notifications on channel: %s", l.channel)
+		defer l.running.Store(false)
+		defer stopCaptures()
+		log := logger.WithFields(logger.Fields{"channels": l.Channels()})
+		log.Info("Starting to listen for PostgreSQL notifications")
 
 		for {
 			select {
-			case n := <-l.listener.NotificationChannel():
-				logger.Info("Received notification: %+v", n)
-				if n == nil {
-					logger.Info("Received empty notification")
-					continue
+			case n, ok := <-l.listener.NotificationChannel():
+				if !ok {
+					log.Warn("Notification channel closed, stopping listener")
+					return
 				}
-
-				var stock domain.Stock
-				if err := json.Unmarshal([]byte(n.Extra), &stock); err != nil {
-					logger.Error("Error unmarshaling notification: %v", err)
-					continue
+				batch, open := l.collect(n)
+				batch, ok = l.dispatch(ctx, batch)
+				if !ok {
+					return
 				}
-				logger.Info("Received stock change notification for product %d in branch %d", stock.ProductID, stock.BranchID)
-
-				select {
-				case stockChan <- stock:
-				case <-ctx.Done():
+				for _, change := range l.decodeBatch(ctx, batch) {
+					select {
+					case stockChan <- change:
+					case <-ctx.Done():
+						return
+					}
+				}
+				if !open {
+					log.Warn("Notification channel closed, stopping listener")
 					return
 				}
 
@@ -109,6 +205,172 @@ func (l *StockListener) ListenForChanges(ctx context.Context) (<-chan domain.Sto
 	return stockChan, nil
 }
 
+// collect returns n together with the notifications that are already waiting,
+// up to lookupBatchSize, so that referenced rows can be fetched in one query.
+// It reports false when the notification channel was closed.
+func (l *StockListener) collect(n *pq.Notification) ([]*pq.Notification, bool) {
+	batch := make([]*pq.Notification, 0, 1)
+	add := func(n *pq.Notification) {
+		if n == nil {
+			// pq sends nil after re-establishing a lost connection
+			logger.Warn("Received empty notification")
+			return
+		}
+		logger.WithFields(logger.Fields{"channel": n.Channel, "be_pid": n.BePid}).Debug("Received notification: %s", n.Extra)
+		metrics.NotificationsReceived.WithLabelValues(n.Channel).Inc()
+		batch = append(batch, n)
+	}
+
+	add(n)
+	for len(batch) < lookupBatchSize {
+		select {
+		case next, ok := <-l.listener.NotificationChannel():
+			if !ok {
+				return batch, false
+			}
+			add(next)
+		default:
+			return batch, true
+		}
+	}
+	return batch, true
+}
+
+// received is a notification being decoded. Its context carries the
+// notification's trace span.
+type received struct {
+	ctx   context.Context
+	span  trace.Span
+	n     *pq.Notification
+	ref   *stockRef
+	stock domain.Stock
+	err   error
+	// skip explains why a notification is dropped without being an error
+	skip string
+	// invalid is set for a reference that cannot be looked up; it is
+	// quarantined without validating stock
+	invalid error
+}
+
+// decodeBatch turns notifications into StockChanges in order. Rows sent by
+// reference are fetched with a single query. Notifications that cannot be
+// decoded are dropped; stock that violates an invariant is quarantined.
+func (l *StockListener) decodeBatch(ctx context.Context, batch []*pq.Notification) []port.StockChange {
+	items := make([]*received, 0, len(batch))
+	for _, n := range batch {
+		itemCtx, span := tracing.Tracer().Start(ctx, n.Channel+" receive",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				attribute.String("db.system", "postgresql"),
+				attribute.String("messaging.source.name", n.Channel),
+				attribute.Int("messaging.message.body.size", len(n.Extra)),
+			))
+		item := &received{ctx: itemCtx, span: span, n: n}
+		if item.ref = parseStockRef(n.Extra); item.ref == nil {
+			_, decodeSpan := tracing.Tracer().Start(itemCtx, "decode stock")
+			item.stock, item.err = domain.DecodeStock([]byte(n.Extra), l.location)
+			if item.err != nil {
+				tracing.RecordError(decodeSpan, item.err)
+			}
+			decodeSpan.End()
+		}
+		items = append(items, item)
+	}
+	l.resolveRefs(ctx, items)
+
+	changes := make([]port.StockChange, 0, len(items))
+	for _, item := range items {
+		if change, ok := l.finish(item); ok {
+			changes = append(changes, change)
+		}
+		item.span.End()
+	}
+	return changes
+}
+
+// finish validates a decoded notification and returns false when it must not
+// be delivered
+func (l *StockListener) finish(item *received) (port.StockChange, bool) {
+	log := logger.WithFields(logger.Fields{"channel": item.n.Channel})
+	if l.source != "" {
+		log = log.WithFields(logger.Fields{"source": l.source})
+	}
+	if item.err != nil {
+		metrics.DecodeErrors.WithLabelValues(item.n.Channel).Inc()
+		tracing.RecordError(item.span, item.err)
+		log.WithFields(logger.Fields{"error": item.err}).Error("Error unmarshaling notification")
+		return port.StockChange{}, false
+	}
+	if item.skip != "" {
+		log.WithFields(logger.Fields{"stock_id": item.ref.ID, "op": item.ref.Op}).Debug("Skipping reference notification: %s", item.skip)
+		return port.StockChange{}, false
+	}
+	if item.invalid != nil {
+		l.quarantineChange(item.n.Channel, item.stock, item.invalid)
+		tracing.RecordError(item.span, item.invalid)
+		return port.StockChange{}, false
+	}
+
+	stock := item.stock
+	item.span.SetAttributes(
+		attribute.String("stock.event_id", stock.EventID()),
+		attribute.Int("stock.product_id", stock.ProductID),
+		attribute.Int("stock.branch_id", stock.BranchID),
+	)
+	err := stock.Validate()
+	if err == nil && l.branchID != 0 && stock.BranchID != l.branchID {
+		err = &domain.ValidationError{
+			Msg:   fmt.Sprintf("branch_id %d does not belong to source %s (branch %d)", stock.BranchID, l.source, l.branchID),
+			Rules: []string{domain.RuleBranchID},
+		}
+	}
+	if err != nil {
+		l.quarantineChange(item.n.Channel, stock, err)
+		tracing.RecordError(item.span, err)
+		return port.StockChange{}, false
+	}
+
+	log.WithFields(stock.LogFields()).Info("Received stock change notification")
+	return port.StockChange{Ctx: item.ctx, Channel: item.n.Channel, Source: l.source, Stock: stock}, true
+}
+
+// quarantineChange holds back a stock change that failed validation
+func (l *StockListener) quarantineChange(channel string, stock domain.Stock, err error) {
+	change := domain.NewQuarantinedChange(channel, stock, err, time.Now())
+	change.Source = l.source
+	for _, rule := range change.Rules {
+		metrics.QuarantinedChanges.WithLabelValues(rule).Inc()
+	}
+	logger.WithFields(stock.LogFields()).WithFields(logger.Fields{
+		"channel": channel,
+		"source":  l.source,
+		"rules":   change.Rules,
+		"error":   err,
+	}).Warn("Quarantined invalid stock change")
+
+	if l.quarantine != nil {
+		l.quarantine.Quarantine(change)
+	}
+}
+
+// Ping verifies the PostgreSQL connection
+func (l *StockListener) Ping() error {
+	return l.listener.Ping()
+}
+
+// Running reports whether the notification goroutine is running
+func (l *StockListener) Running() bool {
+	return l.running.Load()
+}
+
+// QueueDepth returns the number of decoded changes waiting for delivery
+func (l *StockListener) QueueDepth() int {
+	if queue := l.queue.Load(); queue != nil {
+		return len(*queue)
+	}
+	return 0
+}
+
 // Close closes the PostgreSQL listener
 func (l *StockListener) Close() error {
 	return l.listener.Close()
@@ -2,11 +2,14 @@ package postgres_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"stock-consolidation/internal/adapter/db/postgres"
+	"stock-consolidation/internal/adapter/memory"
 	"stock-consolidation/internal/core/domain"
 	"stock-consolidation/pkg/config"
 
@@ -51,6 +54,7 @@ func closeListener(t *testing.T, listener *postgres.StockListener) {
 func createTestStock() (domain.Stock, string) {
 	testTime := time.Date(2025, 7, 29, 0, 0, 0, 0, time.UTC)
 	stock := domain.Stock{
+		ID:        "123e4567-e89b-12d3-a456-426614174000",
 		ProductID: 1,
 		BranchID:  1,
 		Quantity:  10,
@@ -59,13 +63,14 @@ func createTestStock() (domain.Stock, string) {
 	}
 
 	stockJSON := fmt.Sprintf(`{
+		"id": "%s",
 		"product_id": %d,
 		"branch_id": %d,
 		"quantity": %d,
 		"reserved": 0,
 		"created_at": "%s",
 		"updated_at": "%s"
-	}`, stock.ProductID, stock.BranchID, stock.Quantity,
+	}`, stock.ID, stock.ProductID, stock.BranchID, stock.Quantity,
 		testTime.Format("2006-01-02T15:04:05.999999"),
 		testTime.Format("2006-01-02T15:04:05.999999"))
 
@@ -106,7 +111,10 @@ func TestPostgresListener(t *testing.T) {
 
 		select {
 		case received := <-stockChan:
-			assertReceivedStock(t, received, expectedStock)
+			assertReceivedStock(t, received.Stock, expectedStock)
+			if received.Ctx == nil {
+				t.Error("Received change should carry the notification context")
+			}
 		case <-time.After(1 * time.Second):
 			t.Fatal("Timeout waiting for stock notification")
 		}
@@ -138,6 +146,69 @@ func TestPostgresListener(t *testing.T) {
 		}
 	})
 
+	t.Run("invalid stock is quarantined", func(t *testing.T) {
+		mock := &mockPGListener{
+			notifications: make(chan *pq.Notification),
+		}
+		quarantine := memory.NewQuarantine(10)
+		listener := postgres.NewListenerWithPG(mock, postgres.WithQuarantine(quarantine))
+		defer closeListener(t, listener)
+
+		stockChan, err := listener.ListenForChanges(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to start listening: %v", err)
+		}
+
+		_, stockJSON := createTestStock()
+		go func() {
+			mock.notifications <- &pq.Notification{
+				Channel: "stock_changes",
+				Extra:   strings.Replace(stockJSON, `"reserved": 0`, `"reserved": 11`, 1),
+			}
+		}()
+
+		select {
+		case <-stockChan:
+			t.Error("Should not receive stock that violates an invariant")
+		case <-time.After(100 * time.Millisecond):
+		}
+		changes := quarantine.ListQuarantined(0)
+		if len(changes) != 1 || len(changes[0].Rules) != 1 || changes[0].Rules[0] != domain.RuleReserved {
+			t.Errorf("quarantine = %+v, want one change violating the reserved rule", changes)
+		}
+	})
+
+	t.Run("naive timestamps use the branch time zone", func(t *testing.T) {
+		mock := &mockPGListener{
+			notifications: make(chan *pq.Notification),
+		}
+		listener := postgres.NewListenerWithPG(mock, postgres.WithTimezone(time.FixedZone("ICT", 7*60*60)))
+		defer closeListener(t, listener)
+
+		stockChan, err := listener.ListenForChanges(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to start listening: %v", err)
+		}
+
+		expectedStock, stockJSON := createTestStock()
+		go func() {
+			mock.notifications <- &pq.Notification{
+				Channel: "stock_changes",
+				Extra:   stockJSON,
+			}
+		}()
+
+		select {
+		case received := <-stockChan:
+			want := expectedStock.UpdatedAt.Add(-7 * time.Hour)
+			if !received.Stock.UpdatedAt.Equal(want) || received.Stock.UpdatedAt.Location() != time.UTC {
+				t.Errorf("UpdatedAt = %v, want %v in UTC", received.Stock.UpdatedAt, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for stock notification")
+		}
+	})
+
 	t.Run("context cancellation", func(t *testing.T) {
 		mock := &mockPGListener{
 			notifications: make(chan *pq.Notification),
@@ -162,6 +233,34 @@ func TestPostgresListener(t *testing.T) {
 		}
 	})
 
+	t.Run("closed notification channel stops the listener", func(t *testing.T) {
+		mock := &mockPGListener{
+			notifications: make(chan *pq.Notification),
+		}
+		listener := postgres.NewListenerWithPG(mock)
+
+		stockChan, err := listener.ListenForChanges(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to start listening: %v", err)
+		}
+		if !listener.Running() {
+			t.Error("Running() should be true after ListenForChanges")
+		}
+		close(mock.notifications)
+
+		select {
+		case _, ok := <-stockChan:
+			if ok {
+				t.Error("Channel should be closed after the notification channel closes")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for channel to close")
+		}
+		if listener.Running() {
+			t.Error("Running() should be false after the listener stopped")
+		}
+	})
+
 	t.Run("real connection", func(t *testing.T) {
 		if testing.Short() {
 			t.Skip("Skipping real connection test in short mode")
@@ -196,3 +295,111 @@ func TestPostgresListener(t *testing.T) {
 		}
 	})
 }
+
+func TestListenerHealthChecks(t *testing.T) {
+	mock := &mockPGListener{
+		notifications: make(chan *pq.Notification),
+		pingError:     errors.New("no connection"),
+	}
+	listener := postgres.NewListenerWithPG(mock)
+	defer closeListener(t, listener)
+
+	if _, err := listener.PingCheck()(context.Background()); err == nil || !mock.pingCalled {
+		t.Errorf("PingCheck() error = %v, want ping failure", err)
+	}
+	if _, err := listener.RunningCheck()(context.Background()); err == nil {
+		t.Error("RunningCheck() expected error before ListenForChanges, got nil")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := listener.ListenForChanges(ctx); err != nil {
+		t.Fatalf("Failed to start listening: %v", err)
+	}
+	if _, err := listener.RunningCheck()(context.Background()); err != nil {
+		t.Errorf("RunningCheck() error = %v, want nil", err)
+	}
+
+	// Fill the queue without consuming it
+	_, stockJSON := createTestStock()
+	for i := 0; i < 3; i++ {
+		mock.notifications <- &pq.Notification{Channel: "stock_changes", Extra: stockJSON}
+	}
+	deadline := time.Now().Add(time.Second)
+	for listener.QueueDepth() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	details, err := listener.BacklogCheck(2)(context.Background())
+	if err == nil {
+		t.Error("BacklogCheck(2) expected error with 3 queued changes, got nil")
+	}
+	if details["queue_depth"] != 3 {
+		t.Errorf("BacklogCheck() details = %v, want queue_depth 3", details)
+	}
+	if _, err := listener.BacklogCheck(10)(context.Background()); err != nil {
+		t.Errorf("BacklogCheck(10) error = %v, want nil", err)
+	}
+}
+
+func TestListenerStockChannels(t *testing.T) {
+	mock := &mockPGListener{notifications: make(chan *pq.Notification, 2)}
+	listener := postgres.NewListenerWithPG(mock, postgres.WithStockChannels("branch1_stock_changes", "branch2_stock_changes"))
+	defer closeListener(t, listener)
+
+	if got := listener.Channels(); len(got) != 2 || got[0] != "branch1_stock_changes" || got[1] != "branch2_stock_changes" {
+		t.Errorf("Channels() = %v, want both branch channels", got)
+	}
+
+	stockChan, err := listener.ListenForChanges(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to start listening: %v", err)
+	}
+	_, stockJSON := createTestStock()
+	mock.notifications <- &pq.Notification{Channel: "branch2_stock_changes", Extra: stockJSON}
+	mock.notifications <- &pq.Notification{Channel: "branch1_stock_changes", Extra: stockJSON}
+
+	for _, want := range []string{"branch2_stock_changes", "branch1_stock_changes"} {
+		select {
+		case change := <-stockChan:
+			if change.Channel != want {
+				t.Errorf("Received change tagged %q, want %q", change.Channel, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for stock change")
+		}
+	}
+}
+
+func TestListenerSource(t *testing.T) {
+	mock := &mockPGListener{notifications: make(chan *pq.Notification, 2)}
+	quarantine := memory.NewQuarantine(10)
+	listener := postgres.NewListenerWithPG(mock, postgres.WithQuarantine(quarantine), postgres.WithSource("bkk", 2))
+	defer closeListener(t, listener)
+
+	stockChan, err := listener.ListenForChanges(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to start listening: %v", err)
+	}
+	_, otherBranch := createTestStock()
+	own := strings.Replace(otherBranch, `"branch_id": 1`, `"branch_id": 2`, 1)
+	mock.notifications <- &pq.Notification{Channel: "stock_changes", Extra: otherBranch}
+	mock.notifications <- &pq.Notification{Channel: "stock_changes", Extra: own}
+
+	select {
+	case change := <-stockChan:
+		if change.Source != "bkk" || change.Stock.BranchID != 2 {
+			t.Errorf("Received change of branch %d from %q, want branch 2 from bkk", change.Stock.BranchID, change.Source)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for stock change")
+	}
+
+	changes := quarantine.ListQuarantined(0)
+	if len(changes) != 1 {
+		t.Fatalf("Quarantined %d changes, want the change of branch 1", len(changes))
+	}
+	if changes[0].Source != "bkk" || len(changes[0].Rules) != 1 || changes[0].Rules[0] != domain.RuleBranchID {
+		t.Errorf("Quarantined change = %+v, want rule branch_id from bkk", changes[0])
+	}
+}
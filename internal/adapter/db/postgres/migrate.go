@@ -0,0 +1,303 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"stock-consolidation/pkg/logger"
+)
+
+//go:embed migrations/*.sql hq_migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the advisory lock held while migrating, so that several
+// instances starting together do not apply the same migration twice
+const migrationLockID = 72150042
+
+// Migration is one versioned schema change embedded in the binary
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator applies the embedded migrations of one database and records them
+// in its bookkeeping table
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	// table records the applied migrations
+	table string
+	// branchTimezone is the zone naive branch timestamps are converted from
+	branchTimezone string
+}
+
+// MigratorOption configures optional settings of the Migrator
+type MigratorOption func(*Migrator)
+
+// WithBranchTimezone converts TIMESTAMP columns to TIMESTAMPTZ reading their
+// values in the IANA time zone name. Without it, or with "", the session time
+// zone of the database is used.
+func WithBranchTimezone(name string) MigratorOption {
+	return func(m *Migrator) {
+		m.branchTimezone = name
+	}
+}
+
+// NewMigrator creates a Migrator for the branch database, recording the
+// applied migrations in schema_migrations
+func NewMigrator(db *sql.DB, opts ...MigratorOption) (*Migrator, error) {
+	return newMigrator(db, "migrations", "schema_migrations", opts)
+}
+
+// NewConsolidationMigrator creates a Migrator for the HQ database of the
+// receiver, recording the applied migrations in hq_schema_migrations so that
+// it can share a database with a branch
+func NewConsolidationMigrator(db *sql.DB, opts ...MigratorOption) (*Migrator, error) {
+	return newMigrator(db, "hq_migrations", "hq_schema_migrations", opts)
+}
+
+func newMigrator(db *sql.DB, dir, table string, opts []MigratorOption) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+	m := &Migrator{db: db, migrations: migrations, table: table}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m, nil
+}
+
+// loadMigrations reads <version>_<name>.up.sql and .down.sql pairs from dir
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %v", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+		version, name, found := strings.Cut(base, "_")
+		n, err := strconv.Atoi(version)
+		if !ok || !found || err != nil || n <= 0 || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %q", file)
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, file))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %v", file, err)
+		}
+
+		m := byVersion[n]
+		if m == nil {
+			m = &Migration{Version: n, Name: name}
+			byVersion[n] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", n, m.Name, name)
+		}
+		if direction == "up" {
+			m.up = string(data)
+		} else {
+			m.down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrations returns the embedded migrations in version order
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Status returns every embedded migration and whether it has been applied
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			appliedAt, ok := applied[migration.Version]
+			statuses = append(statuses, MigrationStatus{Migration: migration, Applied: ok, AppliedAt: appliedAt})
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// Up applies every pending migration in version order and returns the ones applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := apply(ctx, conn, migration.up,
+				"INSERT INTO "+m.table+" (version, name) VALUES ($1, $2)", migration.Version, migration.Name); err != nil {
+				return fmt.Errorf("migration %04d_%s failed: %v", migration.Version, migration.Name, err)
+			}
+			logger.WithFields(logger.Fields{"version": migration.Version, "name": migration.Name}).Info("Applied migration")
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns
+// the ones reverted
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	byVersion := make(map[int]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]int, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+		for _, version := range versions {
+			if len(done) >= steps {
+				break
+			}
+			migration, ok := byVersion[version]
+			if !ok {
+				return fmt.Errorf("migration %d is applied but unknown to this binary", version)
+			}
+			if err := apply(ctx, conn, migration.down,
+				"DELETE FROM "+m.table+" WHERE version = $1", migration.Version); err != nil {
+				return fmt.Errorf("reverting migration %04d_%s failed: %v", migration.Version, migration.Name, err)
+			}
+			logger.WithFields(logger.Fields{"version": migration.Version, "name": migration.Name}).Info("Reverted migration")
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// withLock runs fn on a single connection holding the migration lock, after
+// making sure the bookkeeping table exists
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %v", err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			logger.WithFields(logger.Fields{"error": err}).Warn("Failed to close migration connection")
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %v", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID); err != nil {
+			logger.WithFields(logger.Fields{"error": err}).Warn("Failed to release migration lock")
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+m.table+` (
+  version INTEGER PRIMARY KEY,
+  name TEXT NOT NULL,
+  applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`); err != nil {
+		return fmt.Errorf("failed to create %s: %v", m.table, err)
+	}
+	if m.branchTimezone != "" {
+		// Read by the migrations converting naive timestamps
+		if _, err := conn.ExecContext(ctx, "SELECT set_config('stock_consolidation.branch_timezone', $1, false)", m.branchTimezone); err != nil {
+			return fmt.Errorf("failed to set the branch time zone: %v", err)
+		}
+	}
+	return fn(conn)
+}
+
+// applied returns the applied versions and when they were applied
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM "+m.table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", m.table, err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.WithFields(logger.Fields{"error": err}).Warn("Failed to close %s rows", m.table)
+		}
+	}()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %v", m.table, err)
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", m.table, err)
+	}
+	return applied, nil
+}
+
+// apply runs a migration script and the bookkeeping statement in one transaction
+func apply(ctx context.Context, conn *sql.Conn, script, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return fmt.Errorf("failed to record migration: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit: %v", err)
+	}
+	return nil
+}
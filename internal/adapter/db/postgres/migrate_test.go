@@ -0,0 +1,180 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/adapter/db/postgres"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMigrator(t *testing.T) {
+	appliedAt := time.Date(2025, 7, 29, 0, 0, 0, 0, time.UTC)
+	lock := regexp.QuoteMeta("SELECT pg_advisory_lock($1)")
+	unlock := regexp.QuoteMeta("SELECT pg_advisory_unlock($1)")
+	schemaTable := regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS schema_migrations")
+	applied := regexp.QuoteMeta("SELECT version, applied_at FROM schema_migrations")
+
+	newMigrator := func(t *testing.T, versions ...int) (*postgres.Migrator, sqlmock.Sqlmock) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock.New() error = %v", err)
+		}
+		t.Cleanup(func() {
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+			db.Close()
+		})
+		migrator, err := postgres.NewMigrator(db)
+		if err != nil {
+			t.Fatalf("NewMigrator() error = %v", err)
+		}
+
+		rows := sqlmock.NewRows([]string{"version", "applied_at"})
+		for _, v := range versions {
+			rows.AddRow(v, appliedAt)
+		}
+		mock.ExpectExec(lock).WithArgs(72150042).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(schemaTable).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(applied).WillReturnRows(rows)
+		return migrator, mock
+	}
+
+	t.Run("embedded migrations are numbered consecutively", func(t *testing.T) {
+		migrator, err := postgres.NewMigrator(nil)
+		if err != nil {
+			t.Fatalf("NewMigrator() error = %v", err)
+		}
+		migrations := migrator.Migrations()
+		if len(migrations) < 4 {
+			t.Fatalf("found %d migrations, want at least 4", len(migrations))
+		}
+		for i, m := range migrations {
+			if m.Version != i+1 || m.Name == "" {
+				t.Errorf("migration %d = %04d_%s", i, m.Version, m.Name)
+			}
+		}
+	})
+
+	t.Run("up applies pending migrations in order", func(t *testing.T) {
+		migrator, mock := newMigrator(t, 1, 2)
+		for _, m := range migrator.Migrations()[2:] {
+			mock.ExpectBegin()
+			// Every up script creates, replaces or alters something
+			mock.ExpectExec("CREATE |ALTER ").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)")).
+				WithArgs(m.Version, m.Name).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+		}
+		mock.ExpectExec(unlock).WithArgs(72150042).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		done, err := migrator.Up(context.Background())
+		if err != nil || len(done) != len(migrator.Migrations())-2 || done[0].Version != 3 {
+			t.Errorf("Up() = %v, %v", done, err)
+		}
+	})
+
+	t.Run("failed migration is rolled back", func(t *testing.T) {
+		migrator, mock := newMigrator(t)
+		mock.ExpectBegin()
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS stock").WillReturnError(errors.New("permission denied"))
+		mock.ExpectRollback()
+		mock.ExpectExec(unlock).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		done, err := migrator.Up(context.Background())
+		if err == nil || len(done) != 0 {
+			t.Errorf("Up() = %v, %v, want error", done, err)
+		}
+	})
+
+	t.Run("down reverts the newest migrations", func(t *testing.T) {
+		migrator, mock := newMigrator(t, 1, 2, 3, 4)
+		for _, version := range []int{4, 3} {
+			mock.ExpectBegin()
+			mock.ExpectExec("DROP TABLE IF EXISTS").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM schema_migrations WHERE version = $1")).
+				WithArgs(version).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+		}
+		mock.ExpectExec(unlock).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		done, err := migrator.Down(context.Background(), 2)
+		if err != nil || len(done) != 2 || done[0].Version != 4 || done[1].Version != 3 {
+			t.Errorf("Down() = %v, %v", done, err)
+		}
+	})
+
+	t.Run("status reports applied migrations", func(t *testing.T) {
+		migrator, mock := newMigrator(t, 1)
+		mock.ExpectExec(unlock).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		statuses, err := migrator.Status(context.Background())
+		if err != nil {
+			t.Fatalf("Status() error = %v", err)
+		}
+		if !statuses[0].Applied || !statuses[0].AppliedAt.Equal(appliedAt) || statuses[1].Applied {
+			t.Errorf("Status() = %+v", statuses)
+		}
+	})
+
+	t.Run("branch time zone is passed to the migrations", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock.New() error = %v", err)
+		}
+		defer db.Close()
+		migrator, err := postgres.NewMigrator(db, postgres.WithBranchTimezone("Asia/Bangkok"))
+		if err != nil {
+			t.Fatalf("NewMigrator() error = %v", err)
+		}
+
+		mock.ExpectExec(lock).WithArgs(72150042).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(schemaTable).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("SELECT set_config('stock_consolidation.branch_timezone', $1, false)")).
+			WithArgs("Asia/Bangkok").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(applied).WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}))
+		mock.ExpectExec(unlock).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		if _, err := migrator.Status(context.Background()); err != nil {
+			t.Errorf("Status() error = %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("consolidation migrations are recorded separately", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock.New() error = %v", err)
+		}
+		defer db.Close()
+		migrator, err := postgres.NewConsolidationMigrator(db)
+		if err != nil {
+			t.Fatalf("NewConsolidationMigrator() error = %v", err)
+		}
+
+		mock.ExpectExec(lock).WithArgs(72150042).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS hq_schema_migrations")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT version, applied_at FROM hq_schema_migrations")).
+			WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}))
+		mock.ExpectBegin()
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS consolidated_stock").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO hq_schema_migrations (version, name) VALUES ($1, $2)")).
+			WithArgs(1, migrator.Migrations()[0].Name).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(unlock).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		if _, err := migrator.Up(context.Background()); err != nil {
+			t.Errorf("Up() error = %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,21 @@
+-- Create the stock table
+CREATE TABLE IF NOT EXISTS stock (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  product_id INTEGER NOT NULL,
+  branch_id INTEGER NOT NULL,
+  quantity INTEGER NOT NULL DEFAULT 0,
+  reserved INTEGER NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ DEFAULT now(),
+  updated_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_product_branch ON stock (product_id, branch_id);
+
+-- Reserved units can never exceed the units in stock
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'chk_stock_reserved') THEN
+    ALTER TABLE stock ADD CONSTRAINT chk_stock_reserved CHECK (reserved >= 0 AND reserved <= quantity);
+  END IF;
+END
+$$;
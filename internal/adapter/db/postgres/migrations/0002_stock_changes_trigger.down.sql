@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS stock_changes_trigger ON stock;
+DROP FUNCTION IF EXISTS notify_stock_changes();
@@ -0,0 +1,36 @@
+-- Notify the service of every INSERT and UPDATE. The full row is sent unless
+-- reference mode is enabled with
+--   ALTER DATABASE stockdb SET stock_consolidation.notify_mode = 'reference'
+-- or the row would exceed the 8000 byte pg_notify limit; then only the row ID
+-- and operation are sent and the service fetches the row itself.
+CREATE OR REPLACE FUNCTION notify_stock_changes() RETURNS trigger AS $$
+DECLARE
+    payload json;
+BEGIN
+    IF (TG_OP = 'INSERT' OR TG_OP = 'UPDATE') THEN
+        IF coalesce(current_setting('stock_consolidation.notify_mode', true), '') <> 'reference' THEN
+            payload := json_build_object(
+                'id', NEW.id,
+                'product_id', NEW.product_id,
+                'branch_id', NEW.branch_id,
+                'quantity', NEW.quantity,
+                'reserved', NEW.reserved,
+                'created_at', NEW.created_at,
+                'updated_at', NEW.updated_at
+            );
+        END IF;
+        IF payload IS NULL OR octet_length(payload::text) > 7900 THEN
+            payload := json_build_object('id', NEW.id, 'op', TG_OP);
+        END IF;
+        PERFORM pg_notify('stock_changes', payload::text);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS stock_changes_trigger ON stock;
+
+CREATE TRIGGER stock_changes_trigger
+    AFTER INSERT OR UPDATE ON stock
+    FOR EACH ROW
+    EXECUTE FUNCTION notify_stock_changes();
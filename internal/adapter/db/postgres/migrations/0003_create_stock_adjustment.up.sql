@@ -0,0 +1,15 @@
+-- Audit trail of adjustments made through the API
+CREATE TABLE IF NOT EXISTS stock_adjustment (
+  id BIGSERIAL PRIMARY KEY,
+  stock_id UUID NOT NULL REFERENCES stock (id),
+  product_id INTEGER NOT NULL,
+  branch_id INTEGER NOT NULL,
+  quantity_delta INTEGER NOT NULL,
+  reserved_delta INTEGER NOT NULL,
+  reason TEXT NOT NULL,
+  note TEXT NOT NULL DEFAULT '',
+  actor TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_adjustment_product_branch ON stock_adjustment (product_id, branch_id, created_at);
@@ -0,0 +1,16 @@
+-- Reservations hold reserved units until they are confirmed, cancelled or expire
+CREATE TABLE IF NOT EXISTS reservation (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  stock_id UUID NOT NULL REFERENCES stock (id),
+  product_id INTEGER NOT NULL,
+  branch_id INTEGER NOT NULL,
+  quantity INTEGER NOT NULL CHECK (quantity > 0),
+  status TEXT NOT NULL DEFAULT 'active',
+  reference TEXT NOT NULL DEFAULT '',
+  actor TEXT NOT NULL DEFAULT '',
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_reservation_active_expiry ON reservation (expires_at) WHERE status = 'active';
@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS stock_movement_changes_trigger ON stock_adjustment;
+DROP TRIGGER IF EXISTS branch_changes_trigger ON branch;
+DROP TRIGGER IF EXISTS product_changes_trigger ON product;
+DROP FUNCTION IF EXISTS notify_row_changes();
+DROP TABLE IF EXISTS branch;
+DROP TABLE IF EXISTS product;
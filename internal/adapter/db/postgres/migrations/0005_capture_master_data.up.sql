@@ -0,0 +1,53 @@
+-- Product master data and branch metadata replicated to HQ
+CREATE TABLE IF NOT EXISTS product (
+  id INTEGER PRIMARY KEY,
+  sku VARCHAR(64) NOT NULL UNIQUE,
+  name VARCHAR(255) NOT NULL,
+  unit VARCHAR(32) NOT NULL DEFAULT 'pcs',
+  active BOOLEAN NOT NULL DEFAULT true,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS branch (
+  id INTEGER PRIMARY KEY,
+  code VARCHAR(32) NOT NULL UNIQUE,
+  name VARCHAR(255) NOT NULL DEFAULT '',
+  timezone VARCHAR(64) NOT NULL DEFAULT '',
+  active BOOLEAN NOT NULL DEFAULT true,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Notify the channel given as the trigger argument of the new row. A row over
+-- the pg_notify payload limit is skipped with a warning rather than failing
+-- the write.
+CREATE OR REPLACE FUNCTION notify_row_changes() RETURNS trigger AS $$
+DECLARE
+    payload text := row_to_json(NEW)::text;
+BEGIN
+    IF octet_length(payload) > 7900 THEN
+        RAISE WARNING '% row % exceeds the notification limit and is not replicated', TG_TABLE_NAME, NEW.id;
+    ELSE
+        PERFORM pg_notify(TG_ARGV[0], payload);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS product_changes_trigger ON product;
+CREATE TRIGGER product_changes_trigger
+    AFTER INSERT OR UPDATE ON product
+    FOR EACH ROW
+    EXECUTE FUNCTION notify_row_changes('product_changes');
+
+DROP TRIGGER IF EXISTS branch_changes_trigger ON branch;
+CREATE TRIGGER branch_changes_trigger
+    AFTER INSERT OR UPDATE ON branch
+    FOR EACH ROW
+    EXECUTE FUNCTION notify_row_changes('branch_changes');
+
+-- Stock movements are the adjustments recorded in stock_adjustment
+DROP TRIGGER IF EXISTS stock_movement_changes_trigger ON stock_adjustment;
+CREATE TRIGGER stock_movement_changes_trigger
+    AFTER INSERT ON stock_adjustment
+    FOR EACH ROW
+    EXECUTE FUNCTION notify_row_changes('stock_movement_changes');
@@ -0,0 +1,25 @@
+-- Restore the trigger function of 0002_stock_changes_trigger
+CREATE OR REPLACE FUNCTION notify_stock_changes() RETURNS trigger AS $$
+DECLARE
+    payload json;
+BEGIN
+    IF (TG_OP = 'INSERT' OR TG_OP = 'UPDATE') THEN
+        IF coalesce(current_setting('stock_consolidation.notify_mode', true), '') <> 'reference' THEN
+            payload := json_build_object(
+                'id', NEW.id,
+                'product_id', NEW.product_id,
+                'branch_id', NEW.branch_id,
+                'quantity', NEW.quantity,
+                'reserved', NEW.reserved,
+                'created_at', NEW.created_at,
+                'updated_at', NEW.updated_at
+            );
+        END IF;
+        IF payload IS NULL OR octet_length(payload::text) > 7900 THEN
+            payload := json_build_object('id', NEW.id, 'op', TG_OP);
+        END IF;
+        PERFORM pg_notify('stock_changes', payload::text);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,31 @@
+-- Notify stock changes on the channel given as the trigger argument, so that
+-- several branch schemas in one database can each use their own channel:
+--   CREATE TRIGGER stock_changes_trigger AFTER INSERT OR UPDATE ON branch2.stock
+--     FOR EACH ROW EXECUTE FUNCTION public.notify_stock_changes('branch2_stock_changes');
+-- Without an argument the channel is stock_changes. References also carry the
+-- schema of the row so that the service fetches it from the right table.
+CREATE OR REPLACE FUNCTION notify_stock_changes() RETURNS trigger AS $$
+DECLARE
+    channel text := coalesce(TG_ARGV[0], 'stock_changes');
+    payload json;
+BEGIN
+    IF (TG_OP = 'INSERT' OR TG_OP = 'UPDATE') THEN
+        IF coalesce(current_setting('stock_consolidation.notify_mode', true), '') <> 'reference' THEN
+            payload := json_build_object(
+                'id', NEW.id,
+                'product_id', NEW.product_id,
+                'branch_id', NEW.branch_id,
+                'quantity', NEW.quantity,
+                'reserved', NEW.reserved,
+                'created_at', NEW.created_at,
+                'updated_at', NEW.updated_at
+            );
+        END IF;
+        IF payload IS NULL OR octet_length(payload::text) > 7900 THEN
+            payload := json_build_object('id', NEW.id, 'op', TG_OP, 'schema', TG_TABLE_SCHEMA);
+        END IF;
+        PERFORM pg_notify(channel, payload::text);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,19 @@
+-- Convert the stock timestamps back to TIMESTAMP in the branch time zone.
+-- Databases created with TIMESTAMPTZ columns, which the up migration left
+-- alone, are converted as well.
+DO $$
+DECLARE
+  zone text := coalesce(nullif(current_setting('stock_consolidation.branch_timezone', true), ''), current_setting('TimeZone'));
+  col text;
+BEGIN
+  FOREACH col IN ARRAY ARRAY['created_at', 'updated_at'] LOOP
+    IF EXISTS (
+      SELECT 1 FROM pg_attribute
+      WHERE attrelid = 'stock'::regclass AND attname = col
+        AND atttypid = 'timestamp with time zone'::regtype
+    ) THEN
+      EXECUTE format('ALTER TABLE stock ALTER COLUMN %I TYPE TIMESTAMP USING %I AT TIME ZONE %L', col, col, zone);
+    END IF;
+  END LOOP;
+END
+$$;
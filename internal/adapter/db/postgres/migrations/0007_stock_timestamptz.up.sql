@@ -0,0 +1,20 @@
+-- Convert the stock timestamps of databases created before they were
+-- TIMESTAMPTZ. The naive values are read in the branch time zone, which the
+-- migrator sets from BRANCH_TIMEZONE, or else in the session time zone.
+-- Databases created with TIMESTAMPTZ columns are left as they are.
+DO $$
+DECLARE
+  zone text := coalesce(nullif(current_setting('stock_consolidation.branch_timezone', true), ''), current_setting('TimeZone'));
+  col text;
+BEGIN
+  FOREACH col IN ARRAY ARRAY['created_at', 'updated_at'] LOOP
+    IF EXISTS (
+      SELECT 1 FROM pg_attribute
+      WHERE attrelid = 'stock'::regclass AND attname = col
+        AND atttypid = 'timestamp without time zone'::regtype
+    ) THEN
+      EXECUTE format('ALTER TABLE stock ALTER COLUMN %I TYPE TIMESTAMPTZ USING %I AT TIME ZONE %L', col, col, zone);
+    END IF;
+  END LOOP;
+END
+$$;
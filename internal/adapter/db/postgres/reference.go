@@ -0,0 +1,182 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/pkg/logger"
+	"stock-consolidation/pkg/tracing"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// lookupBatchSize is the maximum number of notifications decoded together and
+// so the maximum number of rows fetched by one query
+const lookupBatchSize = 100
+
+// lookupAttempts is how often fetching referenced rows is tried before the
+// changes are dropped
+const lookupAttempts = 3
+
+// stockRef is the payload the trigger sends instead of the full row in
+// reference mode, or when the row would exceed the pg_notify payload limit.
+// Schema names the schema of the stock table; older triggers omit it.
+type stockRef struct {
+	ID     string `json:"id"`
+	Op     string `json:"op"`
+	Schema string `json:"schema"`
+}
+
+// key identifies the referenced row across schemas
+func (r stockRef) key() string {
+	return r.Schema + "." + r.ID
+}
+
+// parseStockRef returns the reference carried by payload, or nil when the
+// payload is a full row
+func parseStockRef(payload string) *stockRef {
+	var ref stockRef
+	if err := json.Unmarshal([]byte(payload), &ref); err != nil || ref.Op == "" || ref.ID == "" {
+		return nil
+	}
+	return &ref
+}
+
+// WithRowLookup fetches the rows of reference notifications from store.
+// Without it reference notifications cannot be decoded.
+func WithRowLookup(store *StockStore) ListenerOption {
+	return func(l *StockListener) {
+		l.lookup = store
+	}
+}
+
+// resolveRefs fetches the rows of every reference notification in items with
+// one query per schema. A row referenced more than once is delivered once, as
+// all references resolve to the same current row. A reference whose id is not
+// a UUID is rejected before the query, which it would otherwise fail.
+func (l *StockListener) resolveRefs(ctx context.Context, items []*received) {
+	ids := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, item := range items {
+		if item.ref == nil {
+			continue
+		}
+		if _, err := uuid.Parse(item.ref.ID); err != nil {
+			item.stock = domain.Stock{ID: item.ref.ID}
+			item.invalid = &domain.ValidationError{
+				Msg:   fmt.Sprintf("referenced id %q is not a UUID", item.ref.ID),
+				Rules: []string{domain.RuleID},
+			}
+			continue
+		}
+		if seen[item.ref.key()] {
+			item.skip = "row already fetched in this batch"
+			continue
+		}
+		seen[item.ref.key()] = true
+		ids[item.ref.Schema] = append(ids[item.ref.Schema], item.ref.ID)
+	}
+
+	rows := make(map[string][]byte)
+	errs := make(map[string]error)
+	for schema, schemaIDs := range ids {
+		found, err := l.fetchRows(ctx, schema, schemaIDs)
+		if err != nil {
+			errs[schema] = err
+			continue
+		}
+		for id, row := range found {
+			rows[stockRef{ID: id, Schema: schema}.key()] = row
+		}
+	}
+
+	for _, item := range items {
+		if item.ref == nil || item.skip != "" || item.invalid != nil {
+			continue
+		}
+		if err := errs[item.ref.Schema]; err != nil {
+			item.err = err
+			continue
+		}
+		row, ok := rows[item.ref.key()]
+		if !ok {
+			item.skip = fmt.Sprintf("stock row %s no longer exists", item.ref.ID)
+			continue
+		}
+		item.stock, item.err = domain.DecodeStock(row, l.location)
+	}
+}
+
+// fetchRows looks up the referenced rows, retrying briefly so that a short
+// database hiccup does not drop the changes
+func (l *StockListener) fetchRows(ctx context.Context, schema string, ids []string) (map[string][]byte, error) {
+	if l.lookup == nil {
+		return nil, fmt.Errorf("received reference notifications but no row lookup is configured")
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "fetch stock rows", trace.WithAttributes(
+		attribute.Int("stock.rows_requested", len(ids)),
+		attribute.String("db.schema", schema),
+	))
+	defer span.End()
+
+	var err error
+	for attempt := 1; attempt <= lookupAttempts; attempt++ {
+		var rows map[string][]byte
+		if rows, err = l.lookup.stockRows(ctx, schema, ids); err == nil {
+			span.SetAttributes(attribute.Int("stock.rows_found", len(rows)))
+			return rows, nil
+		}
+		logger.WithFields(logger.Fields{"error": err, "attempt": attempt, "rows": len(ids), "schema": schema}).Warn("Failed to fetch referenced stock rows")
+		if attempt == lookupAttempts {
+			break
+		}
+
+		select {
+		case <-time.After(time.Duration(attempt) * 100 * time.Millisecond):
+		case <-ctx.Done():
+			tracing.RecordError(span, ctx.Err())
+			return nil, ctx.Err()
+		}
+	}
+	tracing.RecordError(span, err)
+	return nil, err
+}
+
+// stockRows returns the rows with the given IDs encoded like the trigger's
+// full payload, keyed by ID. The stock table of schema is read, or the one on
+// the search path when schema is empty.
+func (s *StockStore) stockRows(ctx context.Context, schema string, ids []string) (map[string][]byte, error) {
+	table := "stock"
+	if schema != "" {
+		table = pq.QuoteIdentifier(schema) + ".stock"
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT id, row_to_json(stock)::text FROM "+table+" WHERE id = ANY($1::uuid[])", pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stock rows: %v", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.WithFields(logger.Fields{"error": err}).Warn("Failed to close stock rows")
+		}
+	}()
+
+	result := make(map[string][]byte, len(ids))
+	for rows.Next() {
+		var id, payload string
+		if err := rows.Scan(&id, &payload); err != nil {
+			return nil, fmt.Errorf("failed to scan stock row: %v", err)
+		}
+		result[id] = []byte(payload)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stock rows: %v", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,215 @@
+package postgres_test
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/adapter/db/postgres"
+	"stock-consolidation/internal/adapter/memory"
+	"stock-consolidation/internal/core/domain"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+func TestListenerReferenceNotifications(t *testing.T) {
+	const (
+		idA = "11111111-1111-1111-1111-111111111111"
+		idC = "33333333-3333-3333-3333-333333333333"
+	)
+	rowJSON := func(id string, productID int) string {
+		return fmt.Sprintf(`{"id":%q,"product_id":%d,"branch_id":1,"quantity":5,"reserved":0,`+
+			`"created_at":"2025-07-29T00:00:00+00:00","updated_at":"2025-07-29T00:00:01+00:00","note":"extra column"}`, id, productID)
+	}
+	_, fullJSON := createTestStock()
+
+	t.Run("referenced rows are fetched in one batch", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock.New() error = %v", err)
+		}
+		defer db.Close()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, row_to_json(stock)::text FROM stock WHERE id = ANY($1::uuid[])")).
+			WithArgs(sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "row"}).
+				AddRow(idC, rowJSON(idC, 3)).
+				AddRow(idA, rowJSON(idA, 2)))
+
+		// The notifications are already waiting when the listener starts, so
+		// they are decoded together
+		pg := &mockPGListener{notifications: make(chan *pq.Notification, 4)}
+		for _, payload := range []string{
+			`{"id":"` + idA + `","op":"UPDATE"}`,
+			fullJSON,
+			`{"id":"` + idC + `","op":"INSERT"}`,
+			`{"id":"` + idA + `","op":"UPDATE"}`,
+		} {
+			pg.notifications <- &pq.Notification{Channel: "stock_changes", Extra: payload}
+		}
+		listener := postgres.NewListenerWithPG(pg, postgres.WithRowLookup(postgres.NewStockStoreWithDB(db)))
+		defer closeListener(t, listener)
+
+		stockChan, err := listener.ListenForChanges(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to start listening: %v", err)
+		}
+
+		var got []int
+		for len(got) < 3 {
+			select {
+			case change := <-stockChan:
+				got = append(got, change.Stock.ProductID)
+			case <-time.After(time.Second):
+				t.Fatalf("Timeout waiting for stock changes, got product IDs %v", got)
+			}
+		}
+		if got[0] != 2 || got[1] != 1 || got[2] != 3 {
+			t.Errorf("product IDs = %v, want [2 1 3] in notification order", got)
+		}
+		select {
+		case change := <-stockChan:
+			t.Errorf("unexpected duplicate change for product %d", change.Stock.ProductID)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("references are fetched from the schema of the row", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock.New() error = %v", err)
+		}
+		defer db.Close()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, row_to_json(stock)::text FROM "branch2".stock WHERE id = ANY($1::uuid[])`)).
+			WithArgs(sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "row"}).AddRow(idA, rowJSON(idA, 2)))
+
+		pg := &mockPGListener{notifications: make(chan *pq.Notification, 1)}
+		pg.notifications <- &pq.Notification{Channel: "branch2_stock_changes", Extra: `{"id":"` + idA + `","op":"UPDATE","schema":"branch2"}`}
+		listener := postgres.NewListenerWithPG(pg,
+			postgres.WithStockChannels("branch2_stock_changes"),
+			postgres.WithRowLookup(postgres.NewStockStoreWithDB(db)),
+		)
+		defer closeListener(t, listener)
+
+		stockChan, err := listener.ListenForChanges(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to start listening: %v", err)
+		}
+		select {
+		case change := <-stockChan:
+			if change.Stock.ProductID != 2 || change.Channel != "branch2_stock_changes" {
+				t.Errorf("Received %+v on %s, want product 2 on branch2_stock_changes", change.Stock, change.Channel)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for stock change")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("a reference that is not a UUID is quarantined alone", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock.New() error = %v", err)
+		}
+		defer db.Close()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, row_to_json(stock)::text FROM stock WHERE id = ANY($1::uuid[])")).
+			WithArgs(pq.Array([]string{idA})).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "row"}).AddRow(idA, rowJSON(idA, 2)))
+
+		pg := &mockPGListener{notifications: make(chan *pq.Notification, 2)}
+		pg.notifications <- &pq.Notification{Channel: "stock_changes", Extra: `{"id":"not-a-uuid","op":"UPDATE"}`}
+		pg.notifications <- &pq.Notification{Channel: "stock_changes", Extra: `{"id":"` + idA + `","op":"UPDATE"}`}
+		quarantine := memory.NewQuarantine(10)
+		listener := postgres.NewListenerWithPG(pg,
+			postgres.WithRowLookup(postgres.NewStockStoreWithDB(db)),
+			postgres.WithQuarantine(quarantine),
+		)
+		defer closeListener(t, listener)
+
+		stockChan, err := listener.ListenForChanges(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to start listening: %v", err)
+		}
+		select {
+		case change := <-stockChan:
+			if change.Stock.ProductID != 2 {
+				t.Errorf("Received %+v, want product 2", change.Stock)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for stock change")
+		}
+		changes := quarantine.ListQuarantined(0)
+		if len(changes) != 1 || changes[0].Stock.ID != "not-a-uuid" || len(changes[0].Rules) != 1 || changes[0].Rules[0] != domain.RuleID {
+			t.Errorf("quarantine = %+v, want the reference violating the id rule", changes)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("failed lookups do not wait after the last attempt", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock.New() error = %v", err)
+		}
+		defer db.Close()
+		query := regexp.QuoteMeta("SELECT id, row_to_json(stock)::text FROM stock WHERE id = ANY($1::uuid[])")
+		for i := 0; i < 3; i++ {
+			mock.ExpectQuery(query).WillReturnError(fmt.Errorf("connection reset"))
+		}
+
+		// The full row is decoded in the same batch and delivered once the
+		// lookup gave up
+		pg := &mockPGListener{notifications: make(chan *pq.Notification, 2)}
+		pg.notifications <- &pq.Notification{Channel: "stock_changes", Extra: `{"id":"` + idA + `","op":"UPDATE"}`}
+		pg.notifications <- &pq.Notification{Channel: "stock_changes", Extra: fullJSON}
+		listener := postgres.NewListenerWithPG(pg, postgres.WithRowLookup(postgres.NewStockStoreWithDB(db)))
+		defer closeListener(t, listener)
+
+		start := time.Now()
+		stockChan, err := listener.ListenForChanges(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to start listening: %v", err)
+		}
+		select {
+		case <-stockChan:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timeout waiting for stock change")
+		}
+		// The attempts wait 100ms and 200ms in between, but not 300ms after the last
+		if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+			t.Errorf("lookups took %v, want less than 500ms", elapsed)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("references are dropped without a row lookup", func(t *testing.T) {
+		mock := &mockPGListener{notifications: make(chan *pq.Notification)}
+		listener := postgres.NewListenerWithPG(mock)
+		defer closeListener(t, listener)
+
+		stockChan, err := listener.ListenForChanges(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to start listening: %v", err)
+		}
+		go func() {
+			mock.notifications <- &pq.Notification{Channel: "stock_changes", Extra: `{"id":"` + idA + `","op":"UPDATE"}`}
+		}()
+
+		select {
+		case <-stockChan:
+			t.Error("Should not receive stock for an unresolved reference")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
@@ -0,0 +1,256 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/logger"
+)
+
+const reservationColumns = "id, stock_id, product_id, branch_id, quantity, status, reference, actor, expires_at, created_at, updated_at"
+
+// errStockMissing is returned by transition when the stock row of a
+// reservation was deleted
+var errStockMissing = errors.New("stock of the reservation no longer exists")
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanReservation(row rowScanner) (domain.Reservation, error) {
+	var r domain.Reservation
+	err := row.Scan(&r.ID, &r.StockID, &r.ProductID, &r.BranchID, &r.Quantity, &r.Status,
+		&r.Reference, &r.Actor, &r.ExpiresAt, &r.CreatedAt, &r.UpdatedAt)
+	return r, err
+}
+
+// CreateReservation reserves units of the stock row and stores the reservation
+// in the same transaction
+func (s *StockStore) CreateReservation(ctx context.Context, r domain.Reservation) (domain.Reservation, error) {
+	if err := r.Validate(); err != nil {
+		return r, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return r, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	stock, exists, err := lockStock(ctx, tx, r.ProductID, r.BranchID)
+	if err != nil {
+		return r, err
+	}
+	if !exists {
+		return r, &domain.ValidationError{Msg: fmt.Sprintf("no stock of product %d in branch %d", r.ProductID, r.BranchID)}
+	}
+	next, err := r.Reserve(stock)
+	if err != nil {
+		return r, err
+	}
+	if err := updateLevels(ctx, tx, next); err != nil {
+		return r, err
+	}
+
+	r.StockID = stock.ID
+	r.Status = domain.ReservationActive
+	if err := tx.QueryRowContext(ctx,
+		`INSERT INTO reservation (stock_id, product_id, branch_id, quantity, status, reference, actor, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at, updated_at`,
+		r.StockID, r.ProductID, r.BranchID, r.Quantity, r.Status, r.Reference, r.Actor, r.ExpiresAt,
+	).Scan(&r.ID, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		return r, fmt.Errorf("failed to store reservation: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return r, fmt.Errorf("failed to commit reservation: %v", err)
+	}
+	logger.WithFields(reservationFields(r)).Info("Created reservation of %d units", r.Quantity)
+	return r, nil
+}
+
+// GetReservation returns the reservation with the given ID
+func (s *StockStore) GetReservation(ctx context.Context, id string) (domain.Reservation, error) {
+	r, err := scanReservation(s.db.QueryRowContext(ctx, "SELECT "+reservationColumns+" FROM reservation WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return r, port.ErrReservationNotFound
+	}
+	if err != nil {
+		return r, fmt.Errorf("failed to read reservation: %v", err)
+	}
+	return r, nil
+}
+
+// ConfirmReservation takes the reserved units out of stock
+func (s *StockStore) ConfirmReservation(ctx context.Context, id string) (domain.Reservation, error) {
+	return s.closeReservation(ctx, id, domain.ReservationConfirmed, domain.Reservation.Confirm)
+}
+
+// CancelReservation makes the reserved units available again
+func (s *StockStore) CancelReservation(ctx context.Context, id string) (domain.Reservation, error) {
+	return s.closeReservation(ctx, id, domain.ReservationCancelled, domain.Reservation.Release)
+}
+
+// closeReservation moves an active reservation to status and applies the
+// matching stock change. A reservation that expired is released instead and
+// ErrReservationClosed is returned.
+func (s *StockStore) closeReservation(ctx context.Context, id string, status domain.ReservationStatus,
+	apply func(domain.Reservation, domain.Stock) (domain.Stock, error)) (domain.Reservation, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Reservation{}, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	r, err := scanReservation(tx.QueryRowContext(ctx, "SELECT "+reservationColumns+" FROM reservation WHERE id = $1 FOR UPDATE", id))
+	if err == sql.ErrNoRows {
+		return r, port.ErrReservationNotFound
+	}
+	if err != nil {
+		return r, fmt.Errorf("failed to read reservation: %v", err)
+	}
+	if r.Status != domain.ReservationActive {
+		return r, port.ErrReservationClosed
+	}
+
+	expired := r.Expired(time.Now())
+	if expired {
+		status, apply = domain.ReservationExpired, domain.Reservation.Release
+	}
+	if r, err = transition(ctx, tx, r, status, apply); err != nil {
+		return r, err
+	}
+	if err := tx.Commit(); err != nil {
+		return r, fmt.Errorf("failed to commit reservation: %v", err)
+	}
+
+	logger.WithFields(reservationFields(r)).Info("Reservation %s", r.Status)
+	if expired {
+		return r, port.ErrReservationClosed
+	}
+	return r, nil
+}
+
+// ReleaseExpired releases active reservations that expired before now, oldest
+// first. Reservations locked by another transaction are skipped, and so is a
+// reservation that fails to be released, so it does not hold up the others.
+func (s *StockStore) ReleaseExpired(ctx context.Context, now time.Time, limit int) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	rows, err := tx.QueryContext(ctx,
+		"SELECT "+reservationColumns+" FROM reservation WHERE status = $1 AND expires_at <= $2 ORDER BY expires_at LIMIT $3 FOR UPDATE SKIP LOCKED",
+		domain.ReservationActive, now, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query expired reservations: %v", err)
+	}
+	var expired []domain.Reservation
+	for rows.Next() {
+		r, err := scanReservation(rows)
+		if err != nil {
+			_ = rows.Close()
+			return 0, fmt.Errorf("failed to scan reservation: %v", err)
+		}
+		expired = append(expired, r)
+	}
+	if err := rows.Close(); err != nil {
+		return 0, fmt.Errorf("failed to read expired reservations: %v", err)
+	}
+
+	released := expired[:0]
+	for _, r := range expired {
+		// A failed statement aborts the transaction, so every reservation is
+		// released under a savepoint that is rolled back when it fails
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT release_reservation"); err != nil {
+			return 0, fmt.Errorf("failed to create savepoint: %v", err)
+		}
+		r, err := expire(ctx, tx, r)
+		if err != nil {
+			logger.WithFields(reservationFields(r)).Error("Failed to release expired reservation, skipping it: %v", err)
+			if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT release_reservation"); err != nil {
+				return 0, fmt.Errorf("failed to roll back to savepoint: %v", err)
+			}
+			continue
+		}
+		released = append(released, r)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit expired reservations: %v", err)
+	}
+
+	for _, r := range released {
+		logger.WithFields(reservationFields(r)).Info("Released expired reservation of %d units", r.Quantity)
+	}
+	return len(released), nil
+}
+
+// expire releases the units of an expired reservation and marks it expired
+func expire(ctx context.Context, tx *sql.Tx, r domain.Reservation) (domain.Reservation, error) {
+	next, err := transition(ctx, tx, r, domain.ReservationExpired, domain.Reservation.Release)
+	var validationErr *domain.ValidationError
+	if errors.As(err, &validationErr) || errors.Is(err, errStockMissing) {
+		// The reserved units were already taken out by a manual adjustment or
+		// the stock row is gone. Expire the reservation anyway so it is not
+		// retried forever.
+		logger.WithFields(reservationFields(r)).Warn("Expiring reservation without releasing units: %v", err)
+		return setStatus(ctx, tx, r, domain.ReservationExpired)
+	}
+	return next, err
+}
+
+// transition applies the stock change for a reservation and stores its new status
+func transition(ctx context.Context, tx *sql.Tx, r domain.Reservation, status domain.ReservationStatus,
+	apply func(domain.Reservation, domain.Stock) (domain.Stock, error)) (domain.Reservation, error) {
+	stock, exists, err := lockStock(ctx, tx, r.ProductID, r.BranchID)
+	if err != nil {
+		return r, err
+	}
+	if !exists {
+		return r, fmt.Errorf("%w (reservation %s)", errStockMissing, r.ID)
+	}
+	next, err := apply(r, stock)
+	if err != nil {
+		return r, err
+	}
+	if err := updateLevels(ctx, tx, next); err != nil {
+		return r, err
+	}
+
+	return setStatus(ctx, tx, r, status)
+}
+
+// setStatus stores the new status of a locked reservation
+func setStatus(ctx context.Context, tx *sql.Tx, r domain.Reservation, status domain.ReservationStatus) (domain.Reservation, error) {
+	if err := tx.QueryRowContext(ctx,
+		"UPDATE reservation SET status = $1, updated_at = now() WHERE id = $2 RETURNING updated_at",
+		status, r.ID,
+	).Scan(&r.UpdatedAt); err != nil {
+		return r, fmt.Errorf("failed to update reservation: %v", err)
+	}
+	r.Status = status
+	return r, nil
+}
+
+func reservationFields(r domain.Reservation) logger.Fields {
+	return logger.Fields{
+		"reservation_id": r.ID,
+		"product_id":     r.ProductID,
+		"branch_id":      r.BranchID,
+		"status":         r.Status,
+	}
+}
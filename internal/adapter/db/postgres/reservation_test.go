@@ -0,0 +1,169 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/adapter/db/postgres"
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var reservationRowColumns = []string{"id", "stock_id", "product_id", "branch_id", "quantity", "status", "reference", "actor", "expires_at", "created_at", "updated_at"}
+
+func TestStockStore_Reservations(t *testing.T) {
+	now := time.Date(2025, 7, 29, 10, 0, 0, 0, time.UTC)
+	lockStock := regexp.QuoteMeta("SELECT id, quantity, reserved, created_at, updated_at FROM stock WHERE product_id = $1 AND branch_id = $2 FOR UPDATE")
+	updateStock := regexp.QuoteMeta("UPDATE stock SET quantity = $1, reserved = $2, updated_at = now() WHERE id = $3")
+	lockReservation := regexp.QuoteMeta("FROM reservation WHERE id = $1 FOR UPDATE")
+	updateReservation := regexp.QuoteMeta("UPDATE reservation SET status = $1, updated_at = now() WHERE id = $2 RETURNING updated_at")
+
+	stockRow := func(quantity, reserved int) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "quantity", "reserved", "created_at", "updated_at"}).
+			AddRow("stock-1", quantity, reserved, now, now)
+	}
+	reservationRow := func(status domain.ReservationStatus, expiresAt time.Time) *sqlmock.Rows {
+		return sqlmock.NewRows(reservationRowColumns).
+			AddRow("res-1", "stock-1", 1, 2, 3, string(status), "order-9", "till-1", expiresAt, now, now)
+	}
+	newMock := func(t *testing.T) (*postgres.StockStore, sqlmock.Sqlmock) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock.New() error = %v", err)
+		}
+		t.Cleanup(func() {
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+			db.Close()
+		})
+		return postgres.NewStockStoreWithDB(db), mock
+	}
+
+	t.Run("create reserves units", func(t *testing.T) {
+		store, mock := newMock(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockStock).WithArgs(1, 2).WillReturnRows(stockRow(10, 4))
+		mock.ExpectExec(updateStock).WithArgs(10, 7, "stock-1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO reservation")).
+			WithArgs("stock-1", 1, 2, 3, domain.ReservationActive, "order-9", "till-1", now.Add(time.Hour)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow("res-1", now, now))
+		mock.ExpectCommit()
+
+		r, err := store.CreateReservation(context.Background(), domain.Reservation{
+			ProductID: 1, BranchID: 2, Quantity: 3, Reference: "order-9", Actor: "till-1", ExpiresAt: now.Add(time.Hour),
+		})
+		if err != nil || r.ID != "res-1" || r.Status != domain.ReservationActive {
+			t.Errorf("CreateReservation() = %+v, %v", r, err)
+		}
+	})
+
+	t.Run("create fails when not enough units are available", func(t *testing.T) {
+		store, mock := newMock(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockStock).WithArgs(1, 2).WillReturnRows(stockRow(10, 8))
+		mock.ExpectRollback()
+
+		_, err := store.CreateReservation(context.Background(), domain.Reservation{ProductID: 1, BranchID: 2, Quantity: 3, ExpiresAt: now})
+		var validationErr *domain.ValidationError
+		if !errors.As(err, &validationErr) {
+			t.Errorf("CreateReservation() error = %v, want a ValidationError", err)
+		}
+	})
+
+	t.Run("confirm takes units out of stock", func(t *testing.T) {
+		store, mock := newMock(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockReservation).WithArgs("res-1").WillReturnRows(reservationRow(domain.ReservationActive, time.Now().Add(time.Hour)))
+		mock.ExpectQuery(lockStock).WithArgs(1, 2).WillReturnRows(stockRow(10, 7))
+		mock.ExpectExec(updateStock).WithArgs(7, 4, "stock-1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(updateReservation).WithArgs(domain.ReservationConfirmed, "res-1").
+			WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(now))
+		mock.ExpectCommit()
+
+		r, err := store.ConfirmReservation(context.Background(), "res-1")
+		if err != nil || r.Status != domain.ReservationConfirmed {
+			t.Errorf("ConfirmReservation() = %+v, %v", r, err)
+		}
+	})
+
+	t.Run("confirming an expired reservation releases it", func(t *testing.T) {
+		store, mock := newMock(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockReservation).WithArgs("res-1").WillReturnRows(reservationRow(domain.ReservationActive, now))
+		mock.ExpectQuery(lockStock).WithArgs(1, 2).WillReturnRows(stockRow(10, 7))
+		mock.ExpectExec(updateStock).WithArgs(10, 4, "stock-1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(updateReservation).WithArgs(domain.ReservationExpired, "res-1").
+			WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(now))
+		mock.ExpectCommit()
+
+		r, err := store.ConfirmReservation(context.Background(), "res-1")
+		if !errors.Is(err, port.ErrReservationClosed) || r.Status != domain.ReservationExpired {
+			t.Errorf("ConfirmReservation() = %+v, %v, want expired and ErrReservationClosed", r, err)
+		}
+	})
+
+	t.Run("cancel of a closed reservation", func(t *testing.T) {
+		store, mock := newMock(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(lockReservation).WithArgs("res-1").WillReturnRows(reservationRow(domain.ReservationConfirmed, now))
+		mock.ExpectRollback()
+
+		if _, err := store.CancelReservation(context.Background(), "res-1"); !errors.Is(err, port.ErrReservationClosed) {
+			t.Errorf("CancelReservation() error = %v, want ErrReservationClosed", err)
+		}
+	})
+
+	t.Run("get unknown reservation", func(t *testing.T) {
+		store, mock := newMock(t)
+		mock.ExpectQuery(regexp.QuoteMeta("FROM reservation WHERE id = $1")).WithArgs("res-2").
+			WillReturnRows(sqlmock.NewRows(reservationRowColumns))
+
+		if _, err := store.GetReservation(context.Background(), "res-2"); !errors.Is(err, port.ErrReservationNotFound) {
+			t.Errorf("GetReservation() error = %v, want ErrReservationNotFound", err)
+		}
+	})
+
+	t.Run("release expired", func(t *testing.T) {
+		store, mock := newMock(t)
+		savepoint := regexp.QuoteMeta("SAVEPOINT release_reservation")
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("FROM reservation WHERE status = $1 AND expires_at <= $2 ORDER BY expires_at LIMIT $3 FOR UPDATE SKIP LOCKED")).
+			WithArgs(domain.ReservationActive, now, 100).
+			WillReturnRows(sqlmock.NewRows(reservationRowColumns).
+				AddRow("res-1", "stock-1", 1, 2, 3, "active", "order-9", "till-1", now.Add(-3*time.Minute), now, now).
+				AddRow("res-2", "stock-2", 1, 3, 3, "active", "order-9", "till-1", now.Add(-2*time.Minute), now, now).
+				AddRow("res-3", "stock-3", 1, 4, 3, "active", "order-9", "till-1", now.Add(-time.Minute), now, now).
+				AddRow("res-4", "stock-4", 1, 5, 3, "active", "order-9", "till-1", now.Add(-time.Minute), now, now))
+		// The units were already taken out manually, so only the status changes
+		mock.ExpectExec(savepoint).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(lockStock).WithArgs(1, 2).WillReturnRows(stockRow(10, 1))
+		mock.ExpectQuery(updateReservation).WithArgs(domain.ReservationExpired, "res-1").
+			WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(now))
+		// The stock row is gone, so there are no units to release
+		mock.ExpectExec(savepoint).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(lockStock).WithArgs(1, 3).WillReturnRows(sqlmock.NewRows([]string{"id", "quantity", "reserved", "created_at", "updated_at"}))
+		mock.ExpectQuery(updateReservation).WithArgs(domain.ReservationExpired, "res-2").
+			WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(now))
+		// A failing reservation is skipped
+		mock.ExpectExec(savepoint).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(lockStock).WithArgs(1, 4).WillReturnError(errors.New("deadlock detected"))
+		mock.ExpectExec(regexp.QuoteMeta("ROLLBACK TO SAVEPOINT release_reservation")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(savepoint).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(lockStock).WithArgs(1, 5).WillReturnRows(stockRow(10, 4))
+		mock.ExpectExec(updateStock).WithArgs(10, 1, "stock-1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(updateReservation).WithArgs(domain.ReservationExpired, "res-4").
+			WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(now))
+		mock.ExpectCommit()
+
+		n, err := store.ReleaseExpired(context.Background(), now, 100)
+		if err != nil || n != 3 {
+			t.Errorf("ReleaseExpired() = %d, %v, want 3", n, err)
+		}
+	})
+}
@@ -0,0 +1,265 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/config"
+	"stock-consolidation/pkg/logger"
+
+	"github.com/lib/pq"
+)
+
+// sortColumns maps the sort fields of a StockQuery to SQL expressions
+var sortColumns = map[string]string{
+	port.SortProductID: "product_id",
+	port.SortBranchID:  "branch_id",
+	port.SortQuantity:  "quantity",
+	port.SortReserved:  "reserved",
+	port.SortAvailable: "quantity - reserved",
+	port.SortUpdatedAt: "updated_at",
+}
+
+// StockStore reads stock rows from the branch database
+type StockStore struct {
+	db *sql.DB
+}
+
+// NewStockStoreWithDB creates a new StockStore using an existing connection pool
+func NewStockStoreWithDB(db *sql.DB) *StockStore {
+	return &StockStore{db: db}
+}
+
+// NewStockStore opens a connection pool to the branch database
+func NewStockStore(cfg *config.Config) (*StockStore, error) {
+	db, err := OpenDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Successfully connected to PostgreSQL for stock queries")
+	return NewStockStoreWithDB(db), nil
+}
+
+// OpenDB opens and verifies a connection pool to the branch database
+func OpenDB(cfg *config.Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", connString(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to ping PostgreSQL: %v", err)
+	}
+	return db, nil
+}
+
+// ListStocks returns one page of stock rows matching q and the total number of matches
+func (s *StockStore) ListStocks(ctx context.Context, q port.StockQuery) (port.StockPage, error) {
+	return listStocks(ctx, s.db, "stock", q)
+}
+
+// listStocks queries table, which has the columns of the stock table
+func listStocks(ctx context.Context, db *sql.DB, table string, q port.StockQuery) (port.StockPage, error) {
+	var page port.StockPage
+	order, err := stockOrder(q)
+	if err != nil {
+		return page, err
+	}
+
+	where, args := stockFilter(q)
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table+where, args...).Scan(&page.Total); err != nil {
+		return page, fmt.Errorf("failed to count stock: %v", err)
+	}
+	query := "SELECT id, product_id, branch_id, quantity, reserved, created_at, updated_at FROM " + table +
+		where + order + fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	rows, err := db.QueryContext(ctx, query, append(args, q.Limit, q.Offset)...)
+	if err != nil {
+		return page, fmt.Errorf("failed to query stock: %v", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.WithFields(logger.Fields{"error": err}).Warn("Failed to close stock rows")
+		}
+	}()
+
+	page.Stocks = []domain.Stock{}
+	for rows.Next() {
+		var stock domain.Stock
+		if err := rows.Scan(&stock.ID, &stock.ProductID, &stock.BranchID, &stock.Quantity,
+			&stock.Reserved, &stock.CreatedAt, &stock.UpdatedAt); err != nil {
+			return page, fmt.Errorf("failed to scan stock: %v", err)
+		}
+		page.Stocks = append(page.Stocks, stock)
+	}
+	if err := rows.Err(); err != nil {
+		return page, fmt.Errorf("failed to read stock: %v", err)
+	}
+	return page, nil
+}
+
+// stockFilter builds the WHERE clause and its arguments for q
+func stockFilter(q port.StockQuery) (string, []interface{}) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if q.ProductID != 0 {
+		add("product_id = $%d", q.ProductID)
+	}
+	if q.BranchID != 0 {
+		add("branch_id = $%d", q.BranchID)
+	}
+	if q.MinAvailable != nil {
+		add("quantity - reserved >= $%d", *q.MinAvailable)
+	}
+	if !q.UpdatedSince.IsZero() {
+		add("updated_at >= $%d", q.UpdatedSince)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// stockOrder builds the ORDER BY clause for q. Ties are broken by product and
+// branch so pages are stable.
+func stockOrder(q port.StockQuery) (string, error) {
+	if q.Sort == "" {
+		q.Sort = port.SortProductID
+	}
+	column, ok := sortColumns[q.Sort]
+	if !ok {
+		return "", fmt.Errorf("invalid sort field %q", q.Sort)
+	}
+	direction := " ASC"
+	if q.Desc {
+		direction = " DESC"
+	}
+	return " ORDER BY " + column + direction + ", product_id, branch_id", nil
+}
+
+// lockStock reads the stock row of a product in a branch and locks it until
+// the transaction ends. It reports false if the row does not exist.
+func lockStock(ctx context.Context, tx *sql.Tx, productID, branchID int) (domain.Stock, bool, error) {
+	stock := domain.Stock{ProductID: productID, BranchID: branchID}
+	err := tx.QueryRowContext(ctx,
+		"SELECT id, quantity, reserved, created_at, updated_at FROM stock WHERE product_id = $1 AND branch_id = $2 FOR UPDATE",
+		productID, branchID,
+	).Scan(&stock.ID, &stock.Quantity, &stock.Reserved, &stock.CreatedAt, &stock.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return stock, false, nil
+	}
+	if err != nil {
+		return stock, false, fmt.Errorf("failed to read stock: %v", err)
+	}
+	return stock, true, nil
+}
+
+// updateLevels writes the quantity and reserved units of a locked stock row
+func updateLevels(ctx context.Context, tx *sql.Tx, stock domain.Stock) error {
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE stock SET quantity = $1, reserved = $2, updated_at = now() WHERE id = $3",
+		stock.Quantity, stock.Reserved, stock.ID,
+	); err != nil {
+		return fmt.Errorf("failed to write stock: %v", err)
+	}
+	return nil
+}
+
+// Ping verifies the database connection
+func (s *StockStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the connection pool
+func (s *StockStore) Close() error {
+	return s.db.Close()
+}
+
+// AdjustStock applies adj in a transaction that locks the stock row and
+// records the adjustment in stock_adjustment
+func (s *StockStore) AdjustStock(ctx context.Context, adj domain.Adjustment) (domain.Stock, error) {
+	if err := adj.Validate(); err != nil {
+		return domain.Stock{}, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Stock{}, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback is a no-op once the transaction is committed
+		_ = tx.Rollback()
+	}()
+
+	current, exists, err := lockStock(ctx, tx, adj.ProductID, adj.BranchID)
+	if err != nil {
+		return domain.Stock{}, err
+	}
+
+	if adj.ExpectedUpdatedAt != nil && (!exists || !current.UpdatedAt.Equal(*adj.ExpectedUpdatedAt)) {
+		return current, port.ErrStockConflict
+	}
+
+	next, err := adj.Apply(current)
+	if err != nil {
+		return current, err
+	}
+
+	if exists {
+		err = tx.QueryRowContext(ctx,
+			"UPDATE stock SET quantity = $1, reserved = $2, updated_at = now() WHERE id = $3 RETURNING updated_at",
+			next.Quantity, next.Reserved, next.ID,
+		).Scan(&next.UpdatedAt)
+	} else {
+		err = tx.QueryRowContext(ctx,
+			"INSERT INTO stock (product_id, branch_id, quantity, reserved) VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at",
+			next.ProductID, next.BranchID, next.Quantity, next.Reserved,
+		).Scan(&next.ID, &next.CreatedAt, &next.UpdatedAt)
+	}
+	if isUniqueViolation(err) {
+		// A concurrent adjustment created the row first; the caller retries
+		return current, port.ErrStockConflict
+	}
+	if err != nil {
+		return current, fmt.Errorf("failed to write stock: %v", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO stock_adjustment (stock_id, product_id, branch_id, quantity_delta, reserved_delta, reason, note, actor)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		next.ID, next.ProductID, next.BranchID,
+		next.Quantity-current.Quantity, next.Reserved-current.Reserved,
+		string(adj.Reason), adj.Note, adj.Actor,
+	); err != nil {
+		return current, fmt.Errorf("failed to record adjustment: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return current, fmt.Errorf("failed to commit adjustment: %v", err)
+	}
+
+	logger.WithFields(next.LogFields()).WithFields(logger.Fields{
+		"reason": adj.Reason,
+		"actor":  adj.Actor,
+	}).Info("Adjusted stock: quantity %d -> %d, reserved %d -> %d", current.Quantity, next.Quantity, current.Reserved, next.Reserved)
+	return next, nil
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique_violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
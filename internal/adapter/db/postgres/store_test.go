@@ -0,0 +1,227 @@
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/adapter/db/postgres"
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+var stockColumns = []string{"id", "product_id", "branch_id", "quantity", "reserved", "created_at", "updated_at"}
+
+func TestStockStore_ListStocks(t *testing.T) {
+	testTime := time.Date(2025, 7, 29, 0, 0, 0, 0, time.UTC)
+
+	t.Run("filters, sorts and paginates", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock.New() error = %v", err)
+		}
+		defer db.Close()
+
+		minAvailable := 5
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM stock WHERE branch_id = $1 AND quantity - reserved >= $2")).
+			WithArgs(2, 5).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+		mock.ExpectQuery(regexp.QuoteMeta("FROM stock WHERE branch_id = $1 AND quantity - reserved >= $2 ORDER BY quantity - reserved DESC, product_id, branch_id LIMIT $3 OFFSET $4")).
+			WithArgs(2, 5, 2, 1).
+			WillReturnRows(sqlmock.NewRows(stockColumns).
+				AddRow("a", 1, 2, 50, 5, testTime, testTime).
+				AddRow("b", 3, 2, 20, 10, testTime, testTime))
+
+		store := postgres.NewStockStoreWithDB(db)
+		page, err := store.ListStocks(context.Background(), port.StockQuery{
+			BranchID:     2,
+			MinAvailable: &minAvailable,
+			Sort:         port.SortAvailable,
+			Desc:         true,
+			Limit:        2,
+			Offset:       1,
+		})
+		if err != nil {
+			t.Fatalf("ListStocks() error = %v", err)
+		}
+		if page.Total != 3 || len(page.Stocks) != 2 || page.Stocks[0].ID != "a" || page.Stocks[1].Reserved != 10 {
+			t.Errorf("ListStocks() = %+v", page)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("default order without filters", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock.New() error = %v", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM stock")).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectQuery(regexp.QuoteMeta("FROM stock ORDER BY product_id ASC, product_id, branch_id LIMIT $1 OFFSET $2")).
+			WithArgs(50, 0).
+			WillReturnRows(sqlmock.NewRows(stockColumns))
+
+		page, err := postgres.NewStockStoreWithDB(db).ListStocks(context.Background(), port.StockQuery{Limit: 50})
+		if err != nil {
+			t.Fatalf("ListStocks() error = %v", err)
+		}
+		if page.Stocks == nil || len(page.Stocks) != 0 {
+			t.Errorf("ListStocks() stocks = %#v, want empty slice", page.Stocks)
+		}
+	})
+
+	t.Run("invalid sort field", func(t *testing.T) {
+		db, _, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock.New() error = %v", err)
+		}
+		defer db.Close()
+
+		// The sort field is rejected before the stock is counted
+		_, err = postgres.NewStockStoreWithDB(db).ListStocks(context.Background(), port.StockQuery{Sort: "id; DROP TABLE stock"})
+		if err == nil || err.Error() != `invalid sort field "id; DROP TABLE stock"` {
+			t.Errorf("ListStocks() error = %v, want invalid sort field", err)
+		}
+	})
+
+	t.Run("query error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock.New() error = %v", err)
+		}
+		defer db.Close()
+		mock.ExpectQuery("SELECT COUNT").WillReturnError(errors.New("connection refused"))
+
+		if _, err := postgres.NewStockStoreWithDB(db).ListStocks(context.Background(), port.StockQuery{}); err == nil {
+			t.Error("ListStocks() expected error, got nil")
+		}
+	})
+}
+
+func TestStockStore_AdjustStock(t *testing.T) {
+	updatedAt := time.Date(2025, 7, 29, 0, 0, 0, 0, time.UTC)
+	selectStock := regexp.QuoteMeta("SELECT id, quantity, reserved, created_at, updated_at FROM stock WHERE product_id = $1 AND branch_id = $2 FOR UPDATE")
+	insertAdjustment := regexp.QuoteMeta("INSERT INTO stock_adjustment")
+
+	newMock := func(t *testing.T) (*postgres.StockStore, sqlmock.Sqlmock) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock.New() error = %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return postgres.NewStockStoreWithDB(db), mock
+	}
+
+	t.Run("updates an existing row and records the adjustment", func(t *testing.T) {
+		store, mock := newMock(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectStock).WithArgs(1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "quantity", "reserved", "created_at", "updated_at"}).
+				AddRow("a", 10, 2, updatedAt, updatedAt))
+		mock.ExpectQuery(regexp.QuoteMeta("UPDATE stock SET quantity = $1, reserved = $2, updated_at = now() WHERE id = $3 RETURNING updated_at")).
+			WithArgs(7, 2, "a").
+			WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(updatedAt.Add(time.Second)))
+		mock.ExpectExec(insertAdjustment).
+			WithArgs("a", 1, 2, -3, 0, "sale", "", "till-1").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		stock, err := store.AdjustStock(context.Background(), domain.Adjustment{
+			ProductID: 1, BranchID: 2, QuantityDelta: -3, Reason: domain.ReasonSale, Actor: "till-1",
+			ExpectedUpdatedAt: &updatedAt,
+		})
+		if err != nil {
+			t.Fatalf("AdjustStock() error = %v", err)
+		}
+		if stock.Quantity != 7 || !stock.UpdatedAt.Equal(updatedAt.Add(time.Second)) {
+			t.Errorf("AdjustStock() = %+v", stock)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("creates a missing row", func(t *testing.T) {
+		store, mock := newMock(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectStock).WithArgs(1, 2).WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO stock (product_id, branch_id, quantity, reserved) VALUES ($1, $2, $3, $4)")).
+			WithArgs(1, 2, 20, 0).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow("new", updatedAt, updatedAt))
+		mock.ExpectExec(insertAdjustment).
+			WithArgs("new", 1, 2, 20, 0, "receipt", "", "").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		stock, err := store.AdjustStock(context.Background(), domain.Adjustment{ProductID: 1, BranchID: 2, QuantityDelta: 20, Reason: domain.ReasonReceipt})
+		if err != nil || stock.ID != "new" || stock.Quantity != 20 {
+			t.Errorf("AdjustStock() = %+v, %v", stock, err)
+		}
+	})
+
+	t.Run("reports a row created concurrently as a conflict", func(t *testing.T) {
+		store, mock := newMock(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectStock).WithArgs(1, 2).WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO stock (product_id, branch_id, quantity, reserved) VALUES ($1, $2, $3, $4)")).
+			WithArgs(1, 2, 20, 0).
+			WillReturnError(&pq.Error{Code: "23505", Constraint: "uniq_product_branch"})
+		mock.ExpectRollback()
+
+		_, err := store.AdjustStock(context.Background(), domain.Adjustment{ProductID: 1, BranchID: 2, QuantityDelta: 20, Reason: domain.ReasonReceipt})
+		if !errors.Is(err, port.ErrStockConflict) {
+			t.Errorf("AdjustStock() error = %v, want ErrStockConflict", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("rejects a stale version", func(t *testing.T) {
+		store, mock := newMock(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectStock).WithArgs(1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "quantity", "reserved", "created_at", "updated_at"}).
+				AddRow("a", 10, 2, updatedAt, updatedAt.Add(time.Minute)))
+		mock.ExpectRollback()
+
+		_, err := store.AdjustStock(context.Background(), domain.Adjustment{
+			ProductID: 1, BranchID: 2, Quantity: intPtr(5), Reason: domain.ReasonCount, ExpectedUpdatedAt: &updatedAt,
+		})
+		if !errors.Is(err, port.ErrStockConflict) {
+			t.Errorf("AdjustStock() error = %v, want ErrStockConflict", err)
+		}
+	})
+
+	t.Run("rejects an adjustment breaking the stock rules", func(t *testing.T) {
+		store, mock := newMock(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectStock).WithArgs(1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "quantity", "reserved", "created_at", "updated_at"}).
+				AddRow("a", 10, 8, updatedAt, updatedAt))
+		mock.ExpectRollback()
+
+		_, err := store.AdjustStock(context.Background(), domain.Adjustment{ProductID: 1, BranchID: 2, QuantityDelta: -5, Reason: domain.ReasonDamage})
+		var validationErr *domain.ValidationError
+		if !errors.As(err, &validationErr) {
+			t.Errorf("AdjustStock() error = %v, want a ValidationError", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func intPtr(n int) *int {
+	return &n
+}
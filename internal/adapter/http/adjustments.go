@@ -0,0 +1,110 @@
+package http
+
+import (
+	"errors"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/auth"
+	"stock-consolidation/pkg/logger"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// WithStockWriter enables the endpoints adjusting stock levels
+func WithStockWriter(writer port.StockWriter) Option {
+	return func(r *routes) {
+		r.writer = writer
+	}
+}
+
+// adjustmentRequest is the body of POST /stocks/:product_id/branches/:branch_id/adjustments
+type adjustmentRequest struct {
+	QuantityDelta     int        `json:"quantity_delta"`
+	ReservedDelta     int        `json:"reserved_delta"`
+	Reason            string     `json:"reason"`
+	Note              string     `json:"note"`
+	ExpectedUpdatedAt *time.Time `json:"expected_updated_at"`
+}
+
+// updateRequest is the body of PATCH /stocks/:product_id/branches/:branch_id
+type updateRequest struct {
+	Quantity          *int       `json:"quantity"`
+	Reserved          *int       `json:"reserved"`
+	Reason            string     `json:"reason"`
+	Note              string     `json:"note"`
+	ExpectedUpdatedAt *time.Time `json:"expected_updated_at"`
+}
+
+func (r *routes) setupAdjustments(app *fiber.App) {
+	if r.writer == nil {
+		return
+	}
+	app.Post("/stocks/:product_id/branches/:branch_id/adjustments", r.require(auth.RoleOperator), r.adjustStock)
+	app.Patch("/stocks/:product_id/branches/:branch_id", r.require(auth.RoleOperator), r.updateStock)
+}
+
+// adjustStock changes quantity and reserved by the given deltas. The
+// expected_updated_at field is optional because deltas can be applied to any version.
+func (r *routes) adjustStock(c *fiber.Ctx) error {
+	var req adjustmentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body: " + err.Error()})
+	}
+	return r.applyAdjustment(c, domain.Adjustment{
+		QuantityDelta:     req.QuantityDelta,
+		ReservedDelta:     req.ReservedDelta,
+		Reason:            domain.AdjustmentReason(req.Reason),
+		Note:              req.Note,
+		ExpectedUpdatedAt: req.ExpectedUpdatedAt,
+	})
+}
+
+// updateStock sets quantity and/or reserved to absolute values. It requires
+// expected_updated_at so that a concurrent change is not silently overwritten.
+func (r *routes) updateStock(c *fiber.Ctx) error {
+	var req updateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body: " + err.Error()})
+	}
+	if req.ExpectedUpdatedAt == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "expected_updated_at is required, use the updated_at returned by GET /stocks"})
+	}
+	return r.applyAdjustment(c, domain.Adjustment{
+		Quantity:          req.Quantity,
+		Reserved:          req.Reserved,
+		Reason:            domain.AdjustmentReason(req.Reason),
+		Note:              req.Note,
+		ExpectedUpdatedAt: req.ExpectedUpdatedAt,
+	})
+}
+
+// applyAdjustment fills in the product, branch and actor and maps errors to
+// status codes: 422 for rule violations and 409 for concurrent changes
+func (r *routes) applyAdjustment(c *fiber.Ctx, adj domain.Adjustment) error {
+	var err error
+	if adj.ProductID, err = pathOrQueryInt(c, "product_id"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if adj.BranchID, err = pathOrQueryInt(c, "branch_id"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	adj.Actor = principalName(c)
+
+	stock, err := r.writer.AdjustStock(c.UserContext(), adj)
+	var validationErr *domain.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": validationErr.Error()})
+	case errors.Is(err, port.ErrStockConflict):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   err.Error(),
+			"current": newStockResponse(stock),
+		})
+	case err != nil:
+		logger.WithFields(logger.Fields{"error": err, "path": c.Path()}).Error("Failed to adjust stock")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to adjust stock"})
+	}
+	return c.JSON(newStockResponse(stock))
+}
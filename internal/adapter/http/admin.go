@@ -0,0 +1,62 @@
+package http
+
+import (
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/auth"
+	"stock-consolidation/pkg/logger"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// WithAdmin enables the /admin endpoints controlling the delivery pipeline.
+// Reading the state requires the reader role, changing it the operator role.
+func WithAdmin(pipeline port.PipelineController) Option {
+	return func(r *routes) {
+		r.pipeline = pipeline
+	}
+}
+
+// rateLimitRequest is the body of PUT /admin/pipeline/rate-limit
+type rateLimitRequest struct {
+	PerSecond *float64 `json:"per_second"`
+}
+
+func (r *routes) setupAdmin(app *fiber.App) {
+	if r.pipeline == nil {
+		return
+	}
+
+	admin := app.Group("/admin")
+	admin.Get("/pipeline", r.require(auth.RoleReader), r.pipelineState)
+	admin.Post("/pipeline/pause", r.require(auth.RoleOperator), r.pausePipeline)
+	admin.Post("/pipeline/resume", r.require(auth.RoleOperator), r.resumePipeline)
+	admin.Put("/pipeline/rate-limit", r.require(auth.RoleOperator), r.setRateLimit)
+}
+
+func (r *routes) pipelineState(c *fiber.Ctx) error {
+	return c.JSON(r.pipeline.PipelineState())
+}
+
+func (r *routes) pausePipeline(c *fiber.Ctx) error {
+	logger.WithFields(logger.Fields{"principal": principalName(c), "remote": c.IP()}).Info("Admin request to pause delivery")
+	r.pipeline.Pause()
+	return c.JSON(r.pipeline.PipelineState())
+}
+
+func (r *routes) resumePipeline(c *fiber.Ctx) error {
+	logger.WithFields(logger.Fields{"principal": principalName(c), "remote": c.IP()}).Info("Admin request to resume delivery")
+	r.pipeline.Resume()
+	return c.JSON(r.pipeline.PipelineState())
+}
+
+func (r *routes) setRateLimit(c *fiber.Ctx) error {
+	var req rateLimitRequest
+	if err := c.BodyParser(&req); err != nil || req.PerSecond == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": `body must be {"per_second": <number>}`})
+	}
+	logger.WithFields(logger.Fields{"principal": principalName(c), "remote": c.IP()}).Info("Admin request to set rate limit to %v", *req.PerSecond)
+	if err := r.pipeline.SetRateLimit(*req.PerSecond); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(r.pipeline.PipelineState())
+}
@@ -0,0 +1,188 @@
+package http
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/auth"
+	"stock-consolidation/pkg/logger"
+	"stock-consolidation/pkg/tracing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithIngest enables POST /stock, which accepts the stock changes sent by the
+// branches. Requests must carry one of authorizations as their Authorization
+// header, i.e. the HQ_BASIC_AUTHORIZATION of a branch.
+func WithIngest(ingester port.StockIngester, authorizations []string) Option {
+	return func(r *routes) {
+		r.ingester = ingester
+		r.ingestAuthorizations = authorizations
+	}
+}
+
+// WithAggregation enables the endpoints aggregating the consolidated stock:
+// /totals, /shortages and /regions
+func WithAggregation(aggregator port.InventoryAggregator) Option {
+	return func(r *routes) {
+		r.aggregator = aggregator
+	}
+}
+
+func (r *routes) setupConsolidation(app *fiber.App) {
+	if r.ingester != nil {
+		app.Post("/stock", r.requireIngest, r.ingestStock)
+	}
+	if r.aggregator != nil {
+		app.Get("/regions", r.require(auth.RoleReader), r.listRegions)
+		app.Get("/totals", r.require(auth.RoleReader), r.listTotals)
+		app.Get("/totals/:product_id", r.require(auth.RoleReader), r.getProductBreakdown)
+		app.Get("/shortages", r.require(auth.RoleReader), r.listShortages)
+	}
+}
+
+// requireIngest rejects requests whose Authorization header is not one of the
+// configured branch credentials
+func (r *routes) requireIngest(c *fiber.Ctx) error {
+	header := []byte(c.Get(fiber.HeaderAuthorization))
+	for _, accepted := range r.ingestAuthorizations {
+		if subtle.ConstantTimeCompare(header, []byte(accepted)) == 1 {
+			return c.Next()
+		}
+	}
+	logger.WithFields(logger.Fields{"path": c.Path(), "remote": c.IP()}).Warn("Rejected stock change with invalid authorization")
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+}
+
+// ingestStock stores a stock change sent by a branch. It continues the trace
+// of the branch and maps errors to status codes: 422 for invalid stock. A
+// change older than the stored version is acknowledged as stale, so the branch
+// does not count it as a failed delivery.
+func (r *routes) ingestStock(c *fiber.Ctx) error {
+	ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), propagation.HeaderCarrier(c.GetReqHeaders()))
+	ctx, span := tracing.Tracer().Start(ctx, "POST /stock", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	var stock domain.Stock
+	if err := c.BodyParser(&stock); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body: " + err.Error()})
+	}
+	span.SetAttributes(attribute.String("cdc.event_id", stock.EventID()))
+
+	result, err := r.ingester.IngestStock(ctx, stock)
+	var validationErr *domain.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": validationErr.Error(), "rules": validationErr.Rules})
+	case errors.Is(err, port.ErrStaleStock):
+		span.SetAttributes(attribute.String("cdc.result", port.IngestStale))
+		return c.JSON(fiber.Map{"result": port.IngestStale, "event_id": stock.EventID()})
+	case err != nil:
+		tracing.RecordError(span, err)
+		logger.WithFields(stock.LogFields()).WithFields(logger.Fields{"error": err}).Error("Failed to store stock change")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to store stock"})
+	}
+	span.SetAttributes(attribute.String("cdc.result", result))
+	return c.JSON(fiber.Map{"result": result, "event_id": stock.EventID()})
+}
+
+// listRegions returns the configured regions
+func (r *routes) listRegions(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"items": r.aggregator.Regions()})
+}
+
+// listTotals handles the product total queries
+//
+// Query parameters: product_id, region, limit and offset
+func (r *routes) listTotals(c *fiber.Ctx) error {
+	q, err := parseAggregateQuery(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	page, err := r.aggregator.ProductTotals(c.UserContext(), q)
+	if err != nil {
+		return aggregationError(c, err, "failed to query product totals")
+	}
+	return c.JSON(fiber.Map{
+		"items":  page.Totals,
+		"total":  page.Total,
+		"limit":  q.Limit,
+		"offset": q.Offset,
+	})
+}
+
+// getProductBreakdown returns the total of a product with its breakdown by
+// region and branch
+func (r *routes) getProductBreakdown(c *fiber.Ctx) error {
+	productID, err := pathOrQueryInt(c, "product_id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	breakdown, ok, err := r.aggregator.ProductBreakdown(c.UserContext(), productID)
+	if err != nil {
+		return aggregationError(c, err, "failed to query product stock")
+	}
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": fmt.Sprintf("no stock found for product %d", productID)})
+	}
+	return c.JSON(breakdown)
+}
+
+// listShortages handles the queries of branch stock below its safety stock
+//
+// Query parameters: product_id, region, limit and offset
+func (r *routes) listShortages(c *fiber.Ctx) error {
+	q, err := parseAggregateQuery(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	page, err := r.aggregator.Shortages(c.UserContext(), q)
+	if err != nil {
+		return aggregationError(c, err, "failed to query shortages")
+	}
+	return c.JSON(fiber.Map{
+		"items":  page.Shortages,
+		"total":  page.Total,
+		"limit":  q.Limit,
+		"offset": q.Offset,
+	})
+}
+
+func parseAggregateQuery(c *fiber.Ctx) (port.AggregateQuery, error) {
+	q := port.AggregateQuery{Limit: defaultStockLimit, Region: c.Query("region")}
+	var err error
+	if q.ProductID, err = queryInt(c, "product_id"); err != nil {
+		return q, err
+	}
+	if limit, err := queryInt(c, "limit"); err != nil {
+		return q, err
+	} else if limit > 0 {
+		q.Limit = limit
+	}
+	if q.Limit > maxStockLimit {
+		q.Limit = maxStockLimit
+	}
+	if q.Offset, err = queryInt(c, "offset"); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+// aggregationError responds 400 for unknown regions and 500 otherwise
+func aggregationError(c *fiber.Ctx, err error, msg string) error {
+	if errors.Is(err, port.ErrUnknownRegion) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	logger.WithFields(logger.Fields{"error": err, "path": c.Path()}).Error("Failed to aggregate stock")
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": msg})
+}
@@ -0,0 +1,145 @@
+package http
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Limits for the number of deliveries returned by one query
+const (
+	defaultDeliveryLimit = 100
+	maxDeliveryLimit     = 1000
+)
+
+// WithDeliveryHistory enables the /deliveries endpoints backed by history
+func WithDeliveryHistory(history port.DeliveryHistory) Option {
+	return func(r *routes) {
+		r.history = history
+	}
+}
+
+// WithQuarantine enables the /quarantine endpoint listing invalid stock changes
+func WithQuarantine(quarantine port.QuarantineStore) Option {
+	return func(r *routes) {
+		r.quarantine = quarantine
+	}
+}
+
+// listQuarantined handles GET /quarantine?limit=
+func (r *routes) listQuarantined(c *fiber.Ctx) error {
+	limit, err := queryInt(c, "limit")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if limit == 0 {
+		limit = defaultDeliveryLimit
+	}
+	if limit > maxDeliveryLimit {
+		limit = maxDeliveryLimit
+	}
+
+	changes := r.quarantine.ListQuarantined(limit)
+	return c.JSON(fiber.Map{
+		"count":   len(changes),
+		"changes": changes,
+	})
+}
+
+// listDeliveries handles GET /deliveries?product_id=&branch_id=&channel=&source=&status=&from=&to=&limit=
+func (r *routes) listDeliveries(c *fiber.Ctx) error {
+	q, err := parseDeliveryQuery(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	deliveries := r.history.QueryDeliveries(q)
+	return c.JSON(fiber.Map{
+		"count":      len(deliveries),
+		"deliveries": deliveries,
+	})
+}
+
+// getDelivery handles GET /deliveries/:event_id and returns every attempt for the event
+func (r *routes) getDelivery(c *fiber.Ctx) error {
+	eventID := c.Params("event_id")
+	deliveries := r.history.QueryDeliveries(port.DeliveryQuery{EventID: eventID})
+	if len(deliveries) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "no deliveries recorded for event " + eventID})
+	}
+	return c.JSON(fiber.Map{
+		"event_id": eventID,
+		"status":   deliveries[0].Status,
+		"attempts": deliveries,
+	})
+}
+
+func parseDeliveryQuery(c *fiber.Ctx) (port.DeliveryQuery, error) {
+	q := port.DeliveryQuery{Limit: defaultDeliveryLimit}
+	var err error
+
+	if q.ProductID, err = queryInt(c, "product_id"); err != nil {
+		return q, err
+	}
+	if q.BranchID, err = queryInt(c, "branch_id"); err != nil {
+		return q, err
+	}
+	q.Channel = c.Query("channel")
+	q.Source = c.Query("source")
+
+	// status is either success/failure or an HTTP status code
+	switch status := c.Query("status"); status {
+	case "", domain.DeliverySucceeded, domain.DeliveryFailed:
+		q.Status = status
+	default:
+		if q.StatusCode, err = strconv.Atoi(status); err != nil {
+			return q, fmt.Errorf("status must be success, failure or an HTTP status code")
+		}
+	}
+
+	if q.From, err = queryTime(c, "from"); err != nil {
+		return q, err
+	}
+	if q.To, err = queryTime(c, "to"); err != nil {
+		return q, err
+	}
+
+	if limit, err := queryInt(c, "limit"); err != nil {
+		return q, err
+	} else if limit > 0 {
+		q.Limit = limit
+	}
+	if q.Limit > maxDeliveryLimit {
+		q.Limit = maxDeliveryLimit
+	}
+	return q, nil
+}
+
+func queryInt(c *fiber.Ctx, key string) (int, error) {
+	value := c.Query(key)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", key)
+	}
+	return n, nil
+}
+
+func queryTime(c *fiber.Ctx, key string) (time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp", key)
+	}
+	return t, nil
+}
@@ -2,19 +2,95 @@
 package http
 
 import (
+	"time"
+
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/auth"
+	"stock-consolidation/pkg/health"
 	"stock-consolidation/pkg/logger"
+	"stock-consolidation/pkg/metrics"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 )
 
+// Option configures the dependencies of the HTTP routes
+type Option func(*routes)
+
+// routes holds the dependencies used by the handlers
+type routes struct {
+	liveness   *health.Checker
+	readiness  *health.Checker
+	history    port.DeliveryHistory
+	quarantine port.QuarantineStore
+
+	pipeline port.PipelineController
+	stocks   port.StockReader
+	writer   port.StockWriter
+
+	reservations      port.ReservationStore
+	reservationTTL    time.Duration
+	reservationMaxTTL time.Duration
+
+	ingester             port.StockIngester
+	ingestAuthorizations []string
+	aggregator           port.InventoryAggregator
+
+	auth *auth.Authenticator
+}
+
+// WithHealthCheckers sets the checkers backing the /livez and /readyz probes
+func WithHealthCheckers(liveness, readiness *health.Checker) Option {
+	return func(r *routes) {
+		r.liveness = liveness
+		r.readiness = readiness
+	}
+}
+
 // SetupRoutes configures the HTTP routes for the application
-func SetupRoutes(app *fiber.App) {
+func SetupRoutes(app *fiber.App, opts ...Option) {
+	r := &routes{
+		liveness:  health.NewChecker(),
+		readiness: health.NewChecker(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
 	app.Get("/health", healthCheck)
+	app.Get("/livez", probe(r.liveness))
+	app.Get("/readyz", probe(r.readiness))
+	app.Get("/metrics", r.require(auth.RoleReader), adaptor.HTTPHandler(metrics.Handler()))
+
+	if r.history != nil {
+		app.Get("/deliveries", r.require(auth.RoleReader), r.listDeliveries)
+		app.Get("/deliveries/:event_id", r.require(auth.RoleReader), r.getDelivery)
+	}
+	if r.quarantine != nil {
+		app.Get("/quarantine", r.require(auth.RoleReader), r.listQuarantined)
+	}
+	r.setupStocks(app)
+	r.setupAdjustments(app)
+	r.setupReservations(app)
+	r.setupAdmin(app)
+	r.setupConsolidation(app)
 }
 
 func healthCheck(c *fiber.Ctx) error {
-	logger.Info("Health check endpoint accessed")
+	logger.Debug("Health check endpoint accessed")
 	return c.JSON(fiber.Map{
 		"status": "healthy",
 	})
 }
+
+// probe runs the checker and responds 503 when any component is down
+func probe(checker *health.Checker) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		report := checker.Run(c.UserContext())
+		if report.Status != health.StatusUp {
+			logger.WithFields(logger.Fields{"path": c.Path()}).Warn("Probe failed: %+v", report.Components)
+			return c.Status(fiber.StatusServiceUnavailable).JSON(report)
+		}
+		return c.JSON(report)
+	}
+}
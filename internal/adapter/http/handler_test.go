@@ -1,13 +1,25 @@
 package http_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"io"
+	nethttp "net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"stock-consolidation/internal/adapter/http"
+	"stock-consolidation/internal/adapter/memory"
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/auth"
+	"stock-consolidation/pkg/health"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -26,6 +38,17 @@ func TestHealthHandler(t *testing.T) {
 		assert.Equal(t, `{"status":"healthy"}`, string(body))
 	})
 
+	t.Run("metrics endpoint returns prometheus format", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.True(t, strings.Contains(string(body), "stock_consolidation_queue_depth"))
+	})
+
 	t.Run("not found endpoint returns 404", func(t *testing.T) {
 		req := httptest.NewRequest("GET", "/not-exist", nil)
 		resp, err := app.Test(req)
@@ -33,3 +56,787 @@ func TestHealthHandler(t *testing.T) {
 		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
 	})
 }
+
+func TestProbes(t *testing.T) {
+	liveness := health.NewChecker()
+	liveness.Register("listener", func(context.Context) (health.Details, error) {
+		return nil, nil
+	})
+	readiness := health.NewChecker()
+	readiness.Register("postgres", func(context.Context) (health.Details, error) {
+		return nil, errors.New("ping failed: no connection")
+	})
+
+	app := fiber.New()
+	http.SetupRoutes(app, http.WithHealthCheckers(liveness, readiness))
+
+	t.Run("livez returns 200 when all components are up", func(t *testing.T) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/livez", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		var report health.Report
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+		assert.Equal(t, health.StatusUp, report.Status)
+		assert.Equal(t, health.StatusUp, report.Components["listener"].Status)
+	})
+
+	t.Run("readyz returns 503 with component details", func(t *testing.T) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/readyz", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusServiceUnavailable, resp.StatusCode)
+
+		var report health.Report
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+		assert.Equal(t, health.StatusDown, report.Status)
+		assert.Equal(t, "ping failed: no connection", report.Components["postgres"].Error)
+	})
+
+	t.Run("probes without checkers are up", func(t *testing.T) {
+		app := fiber.New()
+		http.SetupRoutes(app)
+		resp, err := app.Test(httptest.NewRequest("GET", "/readyz", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestDeliveries(t *testing.T) {
+	history := memory.NewDeliveryHistory(10)
+	attemptedAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	history.RecordDelivery(domain.Delivery{EventID: "a@1", ProductID: 1, BranchID: 1, Status: domain.DeliveryFailed, StatusCode: 500, AttemptedAt: attemptedAt})
+	history.RecordDelivery(domain.Delivery{EventID: "a@1", ProductID: 1, BranchID: 1, Status: domain.DeliverySucceeded, StatusCode: 200, AttemptedAt: attemptedAt.Add(time.Second)})
+	history.RecordDelivery(domain.Delivery{EventID: "b@2", ProductID: 2, BranchID: 1, Status: domain.DeliverySucceeded, StatusCode: 200, AttemptedAt: attemptedAt.Add(time.Minute)})
+
+	app := fiber.New()
+	http.SetupRoutes(app, http.WithDeliveryHistory(history))
+
+	type listResponse struct {
+		Count      int               `json:"count"`
+		Deliveries []domain.Delivery `json:"deliveries"`
+	}
+
+	t.Run("list filters by query parameters", func(t *testing.T) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/deliveries?product_id=1&status=failure", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		var body listResponse
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, 1, body.Count)
+		assert.Equal(t, 500, body.Deliveries[0].StatusCode)
+	})
+
+	t.Run("list filters by status code and time range", func(t *testing.T) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/deliveries?status=200&from=2024-01-01T10:00:30Z", nil))
+		assert.NoError(t, err)
+
+		var body listResponse
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, 1, body.Count)
+		assert.Equal(t, "b@2", body.Deliveries[0].EventID)
+	})
+
+	t.Run("invalid parameters return 400", func(t *testing.T) {
+		for _, query := range []string{"product_id=abc", "status=unknown", "from=yesterday", "limit=-1"} {
+			resp, err := app.Test(httptest.NewRequest("GET", "/deliveries?"+query, nil))
+			assert.NoError(t, err)
+			assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode, query)
+		}
+	})
+
+	t.Run("event returns all attempts with latest status", func(t *testing.T) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/deliveries/a@1", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		var body struct {
+			Status   string            `json:"status"`
+			Attempts []domain.Delivery `json:"attempts"`
+		}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, domain.DeliverySucceeded, body.Status)
+		assert.Len(t, body.Attempts, 2)
+	})
+
+	t.Run("unknown event returns 404", func(t *testing.T) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/deliveries/missing", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("routes are not mounted without history", func(t *testing.T) {
+		app := fiber.New()
+		http.SetupRoutes(app)
+		resp, err := app.Test(httptest.NewRequest("GET", "/deliveries", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestQuarantine(t *testing.T) {
+	quarantine := memory.NewQuarantine(10)
+	at := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	for _, reserved := range []int{11, 12} {
+		stock := domain.Stock{ID: "a", ProductID: 1, BranchID: 1, Quantity: 10, Reserved: reserved, CreatedAt: at, UpdatedAt: at}
+		quarantine.Quarantine(domain.NewQuarantinedChange("stock_changes", stock, stock.Validate(), at))
+	}
+
+	app := fiber.New()
+	http.SetupRoutes(app, http.WithQuarantine(quarantine))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/quarantine?limit=1", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var body struct {
+		Count   int `json:"count"`
+		Changes []struct {
+			Rules []string               `json:"rules"`
+			Stock map[string]interface{} `json:"stock"`
+		} `json:"changes"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, 1, body.Count)
+	assert.Equal(t, []string{domain.RuleReserved}, body.Changes[0].Rules)
+	assert.Equal(t, 12.0, body.Changes[0].Stock["reserved"])
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/quarantine?limit=x", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+}
+
+type fakePipeline struct {
+	state port.PipelineState
+}
+
+func (p *fakePipeline) Pause()  { p.state.Paused = true }
+func (p *fakePipeline) Resume() { p.state.Paused = false }
+func (p *fakePipeline) SetRateLimit(perSecond float64) error {
+	if perSecond < 0 {
+		return errors.New("rate limit must be a non-negative number")
+	}
+	p.state.RateLimit = perSecond
+	return nil
+}
+func (p *fakePipeline) PipelineState() port.PipelineState { return p.state }
+
+func TestAdmin(t *testing.T) {
+	pipeline := &fakePipeline{}
+	authenticator := auth.NewAuthenticator([]auth.APIKey{
+		{Name: "dashboard", Role: auth.RoleReader, Key: "reader-key"},
+		{Name: "ops", Role: auth.RoleOperator, Key: "operator-key"},
+	}, auth.JWTConfig{})
+	app := fiber.New()
+	http.SetupRoutes(app, http.WithAdmin(pipeline), http.WithAuth(authenticator))
+
+	request := func(method, path, token, body string) *nethttp.Response {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	t.Run("requests without a valid key are rejected", func(t *testing.T) {
+		assert.Equal(t, fiber.StatusUnauthorized, request("GET", "/admin/pipeline", "", "").StatusCode)
+		assert.Equal(t, fiber.StatusUnauthorized, request("POST", "/admin/pipeline/pause", "wrong", "").StatusCode)
+		assert.False(t, pipeline.state.Paused)
+	})
+
+	t.Run("readers cannot change the pipeline", func(t *testing.T) {
+		assert.Equal(t, fiber.StatusOK, request("GET", "/admin/pipeline", "reader-key", "").StatusCode)
+		assert.Equal(t, fiber.StatusForbidden, request("POST", "/admin/pipeline/pause", "reader-key", "").StatusCode)
+		assert.False(t, pipeline.state.Paused)
+	})
+
+	t.Run("pause and resume", func(t *testing.T) {
+		resp := request("POST", "/admin/pipeline/pause", "operator-key", "")
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		var state port.PipelineState
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&state))
+		assert.True(t, state.Paused)
+
+		resp = request("POST", "/admin/pipeline/resume", "operator-key", "")
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.False(t, pipeline.state.Paused)
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		resp := request("PUT", "/admin/pipeline/rate-limit", "operator-key", `{"per_second": 5}`)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, 5.0, pipeline.state.RateLimit)
+
+		assert.Equal(t, fiber.StatusBadRequest, request("PUT", "/admin/pipeline/rate-limit", "operator-key", `{"per_second": -1}`).StatusCode)
+		assert.Equal(t, fiber.StatusBadRequest, request("PUT", "/admin/pipeline/rate-limit", "operator-key", `{}`).StatusCode)
+	})
+
+	t.Run("state", func(t *testing.T) {
+		resp := request("GET", "/admin/pipeline", "reader-key", "")
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"paused":false,"rate_limit":5,"buffered":0}`, string(body))
+	})
+}
+
+func TestAuth(t *testing.T) {
+	const secret = "jwt-secret"
+	authenticator := auth.NewAuthenticator([]auth.APIKey{
+		{Name: "prometheus", Role: auth.RoleReader, Key: "scrape-key"},
+	}, auth.JWTConfig{Secret: secret})
+	app := fiber.New()
+	http.SetupRoutes(app,
+		http.WithAuth(authenticator),
+		http.WithDeliveryHistory(memory.NewDeliveryHistory(10)),
+		http.WithStockReader(&fakeStockReader{}),
+	)
+
+	get := func(path string, header, value string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	t.Run("health probes are open", func(t *testing.T) {
+		for _, path := range []string{"/health", "/livez", "/readyz"} {
+			assert.Equal(t, fiber.StatusOK, get(path, "", ""), path)
+		}
+	})
+
+	t.Run("other routes require credentials", func(t *testing.T) {
+		for _, path := range []string{"/metrics", "/deliveries", "/stocks", "/branches/1/stocks"} {
+			assert.Equal(t, fiber.StatusUnauthorized, get(path, "", ""), path)
+		}
+	})
+
+	t.Run("api key in X-API-Key header", func(t *testing.T) {
+		assert.Equal(t, fiber.StatusOK, get("/metrics", "X-API-Key", "scrape-key"))
+	})
+
+	t.Run("jwt bearer token", func(t *testing.T) {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub":  "alice",
+			"role": "reader",
+			"exp":  time.Now().Add(time.Hour).Unix(),
+		}).SignedString([]byte(secret))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, get("/deliveries", "Authorization", "Bearer "+token))
+
+		forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub":  "mallory",
+			"role": "admin",
+			"exp":  time.Now().Add(time.Hour).Unix(),
+		}).SignedString([]byte("other-secret"))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusUnauthorized, get("/deliveries", "Authorization", "Bearer "+forged))
+	})
+}
+
+type fakeStockReader struct {
+	stocks []domain.Stock
+	query  port.StockQuery
+}
+
+func (f *fakeStockReader) ListStocks(_ context.Context, q port.StockQuery) (port.StockPage, error) {
+	f.query = q
+	var page port.StockPage
+	for _, s := range f.stocks {
+		if (q.ProductID == 0 || s.ProductID == q.ProductID) && (q.BranchID == 0 || s.BranchID == q.BranchID) {
+			page.Stocks = append(page.Stocks, s)
+		}
+	}
+	page.Total = len(page.Stocks)
+	return page, nil
+}
+
+func TestStocks(t *testing.T) {
+	reader := &fakeStockReader{stocks: []domain.Stock{
+		{ID: "a", ProductID: 1, BranchID: 1, Quantity: 10, Reserved: 4},
+		{ID: "b", ProductID: 1, BranchID: 2, Quantity: 5},
+		{ID: "c", ProductID: 2, BranchID: 2, Quantity: 7, Reserved: 7},
+	}}
+	app := fiber.New()
+	http.SetupRoutes(app, http.WithStockReader(reader))
+
+	type listResponse struct {
+		Items []struct {
+			ID        string `json:"id"`
+			Available int    `json:"available"`
+		} `json:"items"`
+		Total  int `json:"total"`
+		Limit  int `json:"limit"`
+		Offset int `json:"offset"`
+	}
+	get := func(path string) (*nethttp.Response, listResponse) {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		assert.NoError(t, err)
+		var body listResponse
+		if resp.StatusCode == fiber.StatusOK {
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		}
+		return resp, body
+	}
+
+	t.Run("list with pagination and sorting", func(t *testing.T) {
+		resp, body := get("/stocks?sort=-available&limit=2&offset=1&min_available=0&updated_since=2024-01-01T00:00:00Z")
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, 3, body.Total)
+		assert.Equal(t, 2, body.Limit)
+		assert.Equal(t, 1, body.Offset)
+		assert.Equal(t, port.SortAvailable, reader.query.Sort)
+		assert.True(t, reader.query.Desc)
+		assert.NotNil(t, reader.query.MinAvailable)
+		assert.Equal(t, 6, body.Items[0].Available)
+	})
+
+	t.Run("product stock across branches", func(t *testing.T) {
+		resp, body := get("/stocks/1")
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, 2, body.Total)
+		assert.Equal(t, 50, reader.query.Limit)
+
+		resp, _ = get("/stocks/99")
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("branch stock", func(t *testing.T) {
+		resp, body := get("/branches/2/stocks")
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, 2, body.Total)
+		assert.Equal(t, 0, body.Items[1].Available)
+	})
+
+	t.Run("invalid parameters return 400", func(t *testing.T) {
+		for _, path := range []string{"/stocks/abc", "/branches/0/stocks", "/stocks?sort=price", "/stocks?offset=-1", "/stocks?min_available=many"} {
+			resp, _ := get(path)
+			assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode, path)
+		}
+	})
+}
+
+type fakeStockWriter struct {
+	stock domain.Stock
+	last  domain.Adjustment
+}
+
+func (f *fakeStockWriter) AdjustStock(_ context.Context, adj domain.Adjustment) (domain.Stock, error) {
+	f.last = adj
+	if adj.ExpectedUpdatedAt != nil && !adj.ExpectedUpdatedAt.Equal(f.stock.UpdatedAt) {
+		return f.stock, port.ErrStockConflict
+	}
+	next, err := adj.Apply(f.stock)
+	if err != nil {
+		return f.stock, err
+	}
+	next.UpdatedAt = next.UpdatedAt.Add(time.Second)
+	f.stock = next
+	return next, nil
+}
+
+func TestAdjustments(t *testing.T) {
+	updatedAt := time.Date(2025, 7, 29, 0, 0, 0, 0, time.UTC)
+	writer := &fakeStockWriter{stock: domain.Stock{ID: "a", ProductID: 1, BranchID: 2, Quantity: 10, Reserved: 2, UpdatedAt: updatedAt}}
+	app := fiber.New()
+	http.SetupRoutes(app,
+		http.WithStockWriter(writer),
+		http.WithAuth(auth.NewAuthenticator([]auth.APIKey{
+			{Name: "dashboard", Role: auth.RoleReader, Key: "reader-key"},
+			{Name: "till-1", Role: auth.RoleOperator, Key: "operator-key"},
+		}, auth.JWTConfig{})),
+	)
+
+	send := func(method, path, key, body string) (*nethttp.Response, map[string]interface{}) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		var decoded map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&decoded)
+		return resp, decoded
+	}
+
+	t.Run("readers cannot adjust stock", func(t *testing.T) {
+		resp, _ := send("POST", "/stocks/1/branches/2/adjustments", "reader-key", `{"quantity_delta": 1, "reason": "receipt"}`)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("adjust by delta", func(t *testing.T) {
+		resp, body := send("POST", "/stocks/1/branches/2/adjustments", "operator-key", `{"quantity_delta": -3, "reason": "sale", "note": "order 42"}`)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, 7.0, body["quantity"])
+		assert.Equal(t, 5.0, body["available"])
+		assert.Equal(t, "till-1", writer.last.Actor)
+		assert.Equal(t, 1, writer.last.ProductID)
+		assert.Equal(t, 2, writer.last.BranchID)
+	})
+
+	t.Run("patch requires the expected version", func(t *testing.T) {
+		resp, _ := send("PATCH", "/stocks/1/branches/2", "operator-key", `{"quantity": 5, "reason": "count"}`)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+
+		resp, body := send("PATCH", "/stocks/1/branches/2", "operator-key", `{"quantity": 5, "reason": "count", "expected_updated_at": "2025-07-29T00:00:00Z"}`)
+		assert.Equal(t, fiber.StatusConflict, resp.StatusCode)
+		assert.NotNil(t, body["current"])
+
+		resp, body = send("PATCH", "/stocks/1/branches/2", "operator-key", `{"quantity": 5, "reason": "count", "expected_updated_at": "2025-07-29T00:00:01Z"}`)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, 5.0, body["quantity"])
+	})
+
+	t.Run("rule violations return 422", func(t *testing.T) {
+		resp, body := send("POST", "/stocks/1/branches/2/adjustments", "operator-key", `{"reserved_delta": 10, "reason": "correction"}`)
+		assert.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+		assert.Contains(t, body["error"], "exceed")
+
+		resp, _ = send("POST", "/stocks/1/branches/2/adjustments", "operator-key", `{"quantity_delta": 1, "reason": "gift"}`)
+		assert.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	})
+
+	t.Run("invalid requests return 400", func(t *testing.T) {
+		resp, _ := send("POST", "/stocks/x/branches/2/adjustments", "operator-key", `{"quantity_delta": 1, "reason": "receipt"}`)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+		resp, _ = send("POST", "/stocks/1/branches/2/adjustments", "operator-key", `{"quantity_delta": "one"}`)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+type fakeReservationStore struct {
+	stock        domain.Stock
+	reservations map[string]domain.Reservation
+}
+
+func (f *fakeReservationStore) CreateReservation(_ context.Context, r domain.Reservation) (domain.Reservation, error) {
+	if err := r.Validate(); err != nil {
+		return r, err
+	}
+	next, err := r.Reserve(f.stock)
+	if err != nil {
+		return r, err
+	}
+	f.stock = next
+	r.ID = "6f1c2a1e-6a4c-4d3e-9c4b-6a2f0c7d8e91"
+	r.Status = domain.ReservationActive
+	f.reservations[r.ID] = r
+	return r, nil
+}
+
+func (f *fakeReservationStore) GetReservation(_ context.Context, id string) (domain.Reservation, error) {
+	r, ok := f.reservations[id]
+	if !ok {
+		return r, port.ErrReservationNotFound
+	}
+	return r, nil
+}
+
+func (f *fakeReservationStore) ConfirmReservation(ctx context.Context, id string) (domain.Reservation, error) {
+	return f.close(id, domain.ReservationConfirmed)
+}
+
+func (f *fakeReservationStore) CancelReservation(ctx context.Context, id string) (domain.Reservation, error) {
+	return f.close(id, domain.ReservationCancelled)
+}
+
+func (f *fakeReservationStore) close(id string, status domain.ReservationStatus) (domain.Reservation, error) {
+	r, ok := f.reservations[id]
+	if !ok {
+		return r, port.ErrReservationNotFound
+	}
+	if r.Status != domain.ReservationActive {
+		return r, port.ErrReservationClosed
+	}
+	r.Status = status
+	f.reservations[id] = r
+	return r, nil
+}
+
+func (f *fakeReservationStore) ReleaseExpired(context.Context, time.Time, int) (int, error) {
+	return 0, nil
+}
+
+func TestReservations(t *testing.T) {
+	store := &fakeReservationStore{
+		stock:        domain.Stock{ID: "a", ProductID: 1, BranchID: 2, Quantity: 10, Reserved: 2},
+		reservations: map[string]domain.Reservation{},
+	}
+	app := fiber.New()
+	http.SetupRoutes(app,
+		http.WithReservations(store, 15*time.Minute, time.Hour),
+		http.WithAuth(auth.NewAuthenticator([]auth.APIKey{
+			{Name: "dashboard", Role: auth.RoleReader, Key: "reader-key"},
+			{Name: "till-1", Role: auth.RoleOperator, Key: "operator-key"},
+		}, auth.JWTConfig{})),
+	)
+
+	send := func(method, path, key, body string) (*nethttp.Response, map[string]interface{}) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		var decoded map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&decoded)
+		return resp, decoded
+	}
+
+	t.Run("readers cannot reserve", func(t *testing.T) {
+		resp, _ := send("POST", "/reservations", "reader-key", `{"product_id": 1, "branch_id": 2, "quantity": 1}`)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+	})
+
+	var id string
+	t.Run("create, read and confirm", func(t *testing.T) {
+		before := time.Now()
+		resp, body := send("POST", "/reservations", "operator-key", `{"product_id": 1, "branch_id": 2, "quantity": 3, "ttl": "30m", "reference": "order-9"}`)
+		assert.Equal(t, fiber.StatusCreated, resp.StatusCode)
+		assert.Equal(t, "active", body["status"])
+		assert.Equal(t, "till-1", body["actor"])
+		assert.Equal(t, 5, store.stock.Reserved)
+		id, _ = body["id"].(string)
+		r := store.reservations[id]
+		assert.WithinDuration(t, before.Add(30*time.Minute), r.ExpiresAt, 5*time.Second)
+
+		resp, body = send("GET", "/reservations/"+id, "reader-key", "")
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, "order-9", body["reference"])
+
+		resp, body = send("POST", "/reservations/"+id+"/confirm", "operator-key", "")
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, "confirmed", body["status"])
+	})
+
+	t.Run("closed reservations return 409", func(t *testing.T) {
+		resp, body := send("POST", "/reservations/"+id+"/cancel", "operator-key", "")
+		assert.Equal(t, fiber.StatusConflict, resp.StatusCode)
+		assert.NotNil(t, body["reservation"])
+	})
+
+	t.Run("unknown reservations return 404", func(t *testing.T) {
+		resp, _ := send("GET", "/reservations/not-a-uuid", "reader-key", "")
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+		resp, _ = send("POST", "/reservations/0b6e0a52-1f4e-4f7a-9d8a-2d6f3b1c5e70/confirm", "operator-key", "")
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("ttl is bounded", func(t *testing.T) {
+		resp, _ := send("POST", "/reservations", "operator-key", `{"product_id": 1, "branch_id": 2, "quantity": 1, "ttl": "2h"}`)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+		resp, _ = send("POST", "/reservations", "operator-key", `{"product_id": 1, "branch_id": 2, "quantity": 1, "ttl": "soon"}`)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("reserving more than is available returns 422", func(t *testing.T) {
+		resp, _ := send("POST", "/reservations", "operator-key", `{"product_id": 1, "branch_id": 2, "quantity": 6}`)
+		assert.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	})
+}
+
+// fakeIngester accepts the first version of every event and rejects older ones
+type fakeIngester struct {
+	applied map[string]bool
+	latest  time.Time
+}
+
+func (f *fakeIngester) IngestStock(_ context.Context, stock domain.Stock) (string, error) {
+	if err := stock.Validate(); err != nil {
+		return "", err
+	}
+	switch {
+	case f.applied[stock.EventID()]:
+		return port.IngestDuplicate, nil
+	case stock.UpdatedAt.Before(f.latest):
+		return "", port.ErrStaleStock
+	}
+	f.applied[stock.EventID()] = true
+	f.latest = stock.UpdatedAt
+	return port.IngestApplied, nil
+}
+
+type fakeAggregator struct {
+	totals    []domain.ProductTotal
+	shortages []domain.BranchStock
+	query     port.AggregateQuery
+}
+
+func (f *fakeAggregator) Regions() []domain.Region {
+	return []domain.Region{{Name: "north", BranchIDs: []int{1, 2}}}
+}
+
+func (f *fakeAggregator) ProductTotals(_ context.Context, q port.AggregateQuery) (port.TotalsPage, error) {
+	f.query = q
+	if q.Region != "" && q.Region != "north" {
+		return port.TotalsPage{}, port.ErrUnknownRegion
+	}
+	page := port.TotalsPage{Totals: []domain.ProductTotal{}}
+	for _, total := range f.totals {
+		if q.ProductID == 0 || q.ProductID == total.ProductID {
+			page.Totals = append(page.Totals, total)
+		}
+	}
+	page.Total = len(page.Totals)
+	return page, nil
+}
+
+func (f *fakeAggregator) ProductBreakdown(_ context.Context, productID int) (domain.ProductBreakdown, bool, error) {
+	for _, total := range f.totals {
+		if total.ProductID == productID {
+			return domain.ProductBreakdown{
+				ProductTotal: total,
+				ByRegion:     []domain.RegionTotal{{Region: "north", Branches: total.Branches, Available: total.Available}},
+				ByBranch:     []domain.BranchStock{},
+			}, true, nil
+		}
+	}
+	return domain.ProductBreakdown{}, false, nil
+}
+
+func (f *fakeAggregator) Shortages(_ context.Context, q port.AggregateQuery) (port.ShortagePage, error) {
+	f.query = q
+	return port.ShortagePage{Shortages: f.shortages, Total: len(f.shortages)}, nil
+}
+
+func TestConsolidation(t *testing.T) {
+	ingester := &fakeIngester{applied: map[string]bool{}}
+	aggregator := &fakeAggregator{
+		totals: []domain.ProductTotal{
+			{ProductID: 1, Branches: 2, Quantity: 30, Reserved: 5, Available: 25},
+			{ProductID: 2, Branches: 1, Quantity: 7, Reserved: 7},
+		},
+		shortages: []domain.BranchStock{{ProductID: 2, BranchID: 1, Region: "north", Quantity: 7, Reserved: 7, SafetyStock: 5, Shortfall: 5}},
+	}
+	authenticator := auth.NewAuthenticator([]auth.APIKey{{Name: "dashboard", Key: "reader-key", Role: auth.RoleReader}}, auth.JWTConfig{})
+	app := fiber.New()
+	http.SetupRoutes(app,
+		http.WithAuth(authenticator),
+		http.WithIngest(ingester, []string{"Basic YnJhbmNoOnNlY3JldA=="}),
+		http.WithAggregation(aggregator),
+	)
+
+	updated := time.Date(2025, 7, 29, 10, 0, 0, 0, time.UTC)
+	post := func(authorization string, stock domain.Stock) *nethttp.Response {
+		body, err := json.Marshal(stock)
+		assert.NoError(t, err)
+		req := httptest.NewRequest("POST", "/stock", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", authorization)
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp
+	}
+	stock := domain.Stock{ID: "a", ProductID: 1, BranchID: 2, Quantity: 10, CreatedAt: updated, UpdatedAt: updated}
+
+	t.Run("ingest requires the branch authorization", func(t *testing.T) {
+		assert.Equal(t, fiber.StatusUnauthorized, post("Basic d3Jvbmc=", stock).StatusCode)
+		assert.Equal(t, fiber.StatusUnauthorized, post("Bearer reader-key", stock).StatusCode)
+	})
+
+	t.Run("ingest applies, deduplicates and ignores stale changes", func(t *testing.T) {
+		resp := post("Basic YnJhbmNoOnNlY3JldA==", stock)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		var body struct {
+			Result  string `json:"result"`
+			EventID string `json:"event_id"`
+		}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, port.IngestApplied, body.Result)
+		assert.Equal(t, stock.EventID(), body.EventID)
+
+		resp = post("Basic YnJhbmNoOnNlY3JldA==", stock)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, port.IngestDuplicate, body.Result)
+
+		older := stock
+		older.UpdatedAt = updated.Add(-time.Minute)
+		older.CreatedAt = older.UpdatedAt
+		resp = post("Basic YnJhbmNoOnNlY3JldA==", older)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, port.IngestStale, body.Result)
+
+		invalid := stock
+		invalid.Quantity = -1
+		assert.Equal(t, fiber.StatusUnprocessableEntity, post("Basic YnJhbmNoOnNlY3JldA==", invalid).StatusCode)
+	})
+
+	t.Run("totals require the reader role", func(t *testing.T) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/totals", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+
+		req := httptest.NewRequest("GET", "/totals?limit=1000", nil)
+		req.Header.Set("X-API-Key", "reader-key")
+		resp, err = app.Test(req)
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		var body struct {
+			Items []domain.ProductTotal `json:"items"`
+			Total int                   `json:"total"`
+		}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, 2, body.Total)
+		assert.Equal(t, 25, body.Items[0].Available)
+		assert.Equal(t, 500, aggregator.query.Limit)
+	})
+
+	get := func(path string) *nethttp.Response {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-API-Key", "reader-key")
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	t.Run("product breakdown", func(t *testing.T) {
+		resp := get("/totals/2")
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		var breakdown domain.ProductBreakdown
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&breakdown))
+		assert.Equal(t, 7, breakdown.Reserved)
+		assert.Equal(t, "north", breakdown.ByRegion[0].Region)
+
+		assert.Equal(t, fiber.StatusNotFound, get("/totals/99").StatusCode)
+	})
+
+	t.Run("regional totals", func(t *testing.T) {
+		assert.Equal(t, fiber.StatusOK, get("/totals?region=north&product_id=1").StatusCode)
+		assert.Equal(t, "north", aggregator.query.Region)
+		assert.Equal(t, 1, aggregator.query.ProductID)
+
+		assert.Equal(t, fiber.StatusBadRequest, get("/totals?region=east").StatusCode)
+		assert.Equal(t, fiber.StatusBadRequest, get("/totals?product_id=x").StatusCode)
+	})
+
+	t.Run("shortages", func(t *testing.T) {
+		resp := get("/shortages?region=north&limit=10")
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		var body struct {
+			Items []domain.BranchStock `json:"items"`
+			Total int                  `json:"total"`
+		}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, 1, body.Total)
+		assert.Equal(t, 5, body.Items[0].Shortfall)
+		assert.Equal(t, 10, aggregator.query.Limit)
+	})
+
+	t.Run("regions", func(t *testing.T) {
+		resp := get("/regions")
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		var body struct {
+			Items []domain.Region `json:"items"`
+		}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, []int{1, 2}, body.Items[0].BranchIDs)
+	})
+}
@@ -0,0 +1,124 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/auth"
+	"stock-consolidation/pkg/logger"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// WithReservations enables the /reservations endpoints. Reservations created
+// without a ttl expire after defaultTTL; no reservation may last longer than maxTTL.
+func WithReservations(store port.ReservationStore, defaultTTL, maxTTL time.Duration) Option {
+	return func(r *routes) {
+		r.reservations = store
+		r.reservationTTL = defaultTTL
+		r.reservationMaxTTL = maxTTL
+	}
+}
+
+// reservationRequest is the body of POST /reservations
+type reservationRequest struct {
+	ProductID int `json:"product_id"`
+	BranchID  int `json:"branch_id"`
+	Quantity  int `json:"quantity"`
+	// TTL is a duration such as "30m"
+	TTL       string `json:"ttl"`
+	Reference string `json:"reference"`
+}
+
+func (r *routes) setupReservations(app *fiber.App) {
+	if r.reservations == nil {
+		return
+	}
+	app.Post("/reservations", r.require(auth.RoleOperator), r.createReservation)
+	app.Get("/reservations/:id", r.require(auth.RoleReader), r.getReservation)
+	app.Post("/reservations/:id/confirm", r.require(auth.RoleOperator), r.confirmReservation)
+	app.Post("/reservations/:id/cancel", r.require(auth.RoleOperator), r.cancelReservation)
+}
+
+func (r *routes) createReservation(c *fiber.Ctx) error {
+	var req reservationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body: " + err.Error()})
+	}
+
+	ttl := r.reservationTTL
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ttl must be a positive duration such as 30m"})
+		}
+	}
+	if r.reservationMaxTTL > 0 && ttl > r.reservationMaxTTL {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("ttl must not exceed %s", r.reservationMaxTTL)})
+	}
+
+	reservation, err := r.reservations.CreateReservation(c.UserContext(), domain.Reservation{
+		ProductID: req.ProductID,
+		BranchID:  req.BranchID,
+		Quantity:  req.Quantity,
+		Reference: req.Reference,
+		Actor:     principalName(c),
+		ExpiresAt: time.Now().Add(ttl).UTC(),
+	})
+	if err != nil {
+		return reservationError(c, reservation, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(reservation)
+}
+
+func (r *routes) getReservation(c *fiber.Ctx) error {
+	return r.withReservation(c, r.reservations.GetReservation)
+}
+
+func (r *routes) confirmReservation(c *fiber.Ctx) error {
+	logger.WithFields(logger.Fields{"principal": principalName(c), "reservation_id": c.Params("id")}).Info("Confirming reservation")
+	return r.withReservation(c, r.reservations.ConfirmReservation)
+}
+
+func (r *routes) cancelReservation(c *fiber.Ctx) error {
+	logger.WithFields(logger.Fields{"principal": principalName(c), "reservation_id": c.Params("id")}).Info("Cancelling reservation")
+	return r.withReservation(c, r.reservations.CancelReservation)
+}
+
+// withReservation calls fn with the reservation ID from the path
+func (r *routes) withReservation(c *fiber.Ctx, fn func(ctx context.Context, id string) (domain.Reservation, error)) error {
+	id := c.Params("id")
+	if _, err := uuid.Parse(id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": port.ErrReservationNotFound.Error()})
+	}
+	reservation, err := fn(c.UserContext(), id)
+	if err != nil {
+		return reservationError(c, reservation, err)
+	}
+	return c.JSON(reservation)
+}
+
+// reservationError maps reservation errors to status codes: 404 when the
+// reservation does not exist, 409 when it is no longer active and 422 for
+// rule violations such as reserving more than is available
+func reservationError(c *fiber.Ctx, reservation domain.Reservation, err error) error {
+	var validationErr *domain.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": validationErr.Error()})
+	case errors.Is(err, port.ErrReservationNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, port.ErrReservationClosed):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":       fmt.Sprintf("%v: %s", err, reservation.Status),
+			"reservation": reservation,
+		})
+	}
+	logger.WithFields(logger.Fields{"error": err, "path": c.Path()}).Error("Reservation request failed")
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "reservation request failed"})
+}
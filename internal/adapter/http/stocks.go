@@ -0,0 +1,159 @@
+package http
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/auth"
+	"stock-consolidation/pkg/logger"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Limits for the number of stock rows returned by one query
+const (
+	defaultStockLimit = 50
+	maxStockLimit     = 500
+)
+
+// WithStockReader enables the /stocks and /branches/:branch_id/stocks endpoints
+func WithStockReader(reader port.StockReader) Option {
+	return func(r *routes) {
+		r.stocks = reader
+	}
+}
+
+// stockResponse is a stock row with its computed available quantity
+type stockResponse struct {
+	ID        string    `json:"id"`
+	ProductID int       `json:"product_id"`
+	BranchID  int       `json:"branch_id"`
+	Quantity  int       `json:"quantity"`
+	Reserved  int       `json:"reserved"`
+	Available int       `json:"available"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newStockResponse(s domain.Stock) stockResponse {
+	return stockResponse{
+		ID:        s.ID,
+		ProductID: s.ProductID,
+		BranchID:  s.BranchID,
+		Quantity:  s.Quantity,
+		Reserved:  s.Reserved,
+		Available: s.Available(),
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+	}
+}
+
+func (r *routes) setupStocks(app *fiber.App) {
+	if r.stocks == nil {
+		return
+	}
+	app.Get("/stocks", r.require(auth.RoleReader), r.listStocks)
+	app.Get("/stocks/:product_id", r.require(auth.RoleReader), r.listStocks)
+	app.Get("/branches/:branch_id/stocks", r.require(auth.RoleReader), r.listStocks)
+}
+
+// listStocks handles the stock queries. The product or branch from the path
+// takes precedence over the query parameter of the same name.
+//
+// Query parameters: product_id, branch_id, min_available, updated_since,
+// sort (a field, prefixed with - for descending order), limit and offset
+func (r *routes) listStocks(c *fiber.Ctx) error {
+	q, err := parseStockQuery(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	page, err := r.stocks.ListStocks(c.UserContext(), q)
+	if err != nil {
+		logger.WithFields(logger.Fields{"error": err, "path": c.Path()}).Error("Failed to query stock")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to query stock"})
+	}
+	if c.Params("product_id") != "" && page.Total == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": fmt.Sprintf("no stock found for product %d", q.ProductID)})
+	}
+
+	items := make([]stockResponse, len(page.Stocks))
+	for i, stock := range page.Stocks {
+		items[i] = newStockResponse(stock)
+	}
+	return c.JSON(fiber.Map{
+		"items":  items,
+		"total":  page.Total,
+		"limit":  q.Limit,
+		"offset": q.Offset,
+	})
+}
+
+func parseStockQuery(c *fiber.Ctx) (port.StockQuery, error) {
+	q := port.StockQuery{Limit: defaultStockLimit}
+	var err error
+
+	if q.ProductID, err = pathOrQueryInt(c, "product_id"); err != nil {
+		return q, err
+	}
+	if q.BranchID, err = pathOrQueryInt(c, "branch_id"); err != nil {
+		return q, err
+	}
+	if value := c.Query("min_available"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return q, fmt.Errorf("min_available must be an integer")
+		}
+		q.MinAvailable = &n
+	}
+	if q.UpdatedSince, err = queryTime(c, "updated_since"); err != nil {
+		return q, err
+	}
+
+	if sort := c.Query("sort"); sort != "" {
+		q.Sort = strings.TrimPrefix(sort, "-")
+		q.Desc = strings.HasPrefix(sort, "-")
+		if !validSortField(q.Sort) {
+			return q, fmt.Errorf("sort must be one of %s, optionally prefixed with -", strings.Join(port.StockSortFields, ", "))
+		}
+	}
+
+	if limit, err := queryInt(c, "limit"); err != nil {
+		return q, err
+	} else if limit > 0 {
+		q.Limit = limit
+	}
+	if q.Limit > maxStockLimit {
+		q.Limit = maxStockLimit
+	}
+	if q.Offset, err = queryInt(c, "offset"); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+// pathOrQueryInt reads key from the route parameters, falling back to the query string
+func pathOrQueryInt(c *fiber.Ctx, key string) (int, error) {
+	value := c.Params(key)
+	if value == "" {
+		return queryInt(c, key)
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s must be a positive integer", key)
+	}
+	return n, nil
+}
+
+func validSortField(field string) bool {
+	for _, f := range port.StockSortFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
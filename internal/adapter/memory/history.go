@@ -0,0 +1,49 @@
+// Package memory provides in-memory adapters for the application
+package memory
+
+import (
+	"sync"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+)
+
+// DeliveryHistory keeps the most recent delivery attempts in a ring buffer
+type DeliveryHistory struct {
+	mu      sync.RWMutex
+	entries *ring[domain.Delivery]
+}
+
+// NewDeliveryHistory creates a DeliveryHistory holding at most size attempts
+func NewDeliveryHistory(size int) *DeliveryHistory {
+	return &DeliveryHistory{entries: newRing[domain.Delivery](size)}
+}
+
+// RecordDelivery stores d, evicting the oldest attempt when the buffer is full
+func (h *DeliveryHistory) RecordDelivery(d domain.Delivery) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries.add(d)
+}
+
+// QueryDeliveries returns the attempts matching q, newest first
+func (h *DeliveryHistory) QueryDeliveries(q port.DeliveryQuery) []domain.Delivery {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	result := []domain.Delivery{}
+	h.entries.each(func(d domain.Delivery) bool {
+		if q.Matches(d) {
+			result = append(result, d)
+		}
+		return q.Limit <= 0 || len(result) < q.Limit
+	})
+	return result
+}
+
+// Len returns the number of stored attempts
+func (h *DeliveryHistory) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.entries.len()
+}
@@ -0,0 +1,74 @@
+package memory_test
+
+import (
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/adapter/memory"
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+)
+
+func delivery(productID, branchID, statusCode int, attemptedAt time.Time) domain.Delivery {
+	status := domain.DeliverySucceeded
+	if statusCode >= 300 {
+		status = domain.DeliveryFailed
+	}
+	return domain.Delivery{
+		EventID:     "stock-1@1",
+		ProductID:   productID,
+		BranchID:    branchID,
+		Status:      status,
+		StatusCode:  statusCode,
+		AttemptedAt: attemptedAt,
+	}
+}
+
+func TestDeliveryHistory(t *testing.T) {
+	base := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("evicts the oldest attempts", func(t *testing.T) {
+		h := memory.NewDeliveryHistory(2)
+		for i := 1; i <= 3; i++ {
+			h.RecordDelivery(delivery(i, 1, 200, base.Add(time.Duration(i)*time.Minute)))
+		}
+
+		got := h.QueryDeliveries(port.DeliveryQuery{})
+		if h.Len() != 2 || len(got) != 2 {
+			t.Fatalf("history holds %d attempts (%d returned), want 2", h.Len(), len(got))
+		}
+		if got[0].ProductID != 3 || got[1].ProductID != 2 {
+			t.Errorf("QueryDeliveries() products = %d, %d, want newest first 3, 2", got[0].ProductID, got[1].ProductID)
+		}
+	})
+
+	t.Run("filters and limits", func(t *testing.T) {
+		h := memory.NewDeliveryHistory(10)
+		h.RecordDelivery(delivery(1, 1, 200, base))
+		h.RecordDelivery(delivery(1, 2, 500, base.Add(time.Minute)))
+		h.RecordDelivery(delivery(2, 1, 503, base.Add(2*time.Minute)))
+		h.RecordDelivery(delivery(1, 1, 200, base.Add(3*time.Minute)))
+
+		tests := []struct {
+			name  string
+			query port.DeliveryQuery
+			want  int
+		}{
+			{"product", port.DeliveryQuery{ProductID: 1}, 3},
+			{"product and branch", port.DeliveryQuery{ProductID: 1, BranchID: 1}, 2},
+			{"failures", port.DeliveryQuery{Status: domain.DeliveryFailed}, 2},
+			{"status code", port.DeliveryQuery{StatusCode: 503}, 1},
+			{"time range", port.DeliveryQuery{From: base.Add(time.Minute), To: base.Add(2 * time.Minute)}, 2},
+			{"limit", port.DeliveryQuery{Limit: 1}, 1},
+			{"no match", port.DeliveryQuery{ProductID: 99}, 0},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got := h.QueryDeliveries(tt.query)
+				if got == nil || len(got) != tt.want {
+					t.Errorf("QueryDeliveries(%+v) returned %d attempts, want %d", tt.query, len(got), tt.want)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"sync"
+
+	"stock-consolidation/internal/core/domain"
+)
+
+// Quarantine keeps the most recent stock changes that failed validation
+type Quarantine struct {
+	mu      sync.RWMutex
+	entries *ring[domain.QuarantinedChange]
+}
+
+// NewQuarantine creates a Quarantine holding at most size changes
+func NewQuarantine(size int) *Quarantine {
+	return &Quarantine{entries: newRing[domain.QuarantinedChange](size)}
+}
+
+// Quarantine stores change, evicting the oldest change when the buffer is full
+func (q *Quarantine) Quarantine(change domain.QuarantinedChange) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.entries.add(change)
+}
+
+// ListQuarantined returns at most limit changes, newest first. A limit of
+// zero returns every change.
+func (q *Quarantine) ListQuarantined(limit int) []domain.QuarantinedChange {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	result := []domain.QuarantinedChange{}
+	q.entries.each(func(change domain.QuarantinedChange) bool {
+		result = append(result, change)
+		return limit <= 0 || len(result) < limit
+	})
+	return result
+}
+
+// Len returns the number of quarantined changes
+func (q *Quarantine) Len() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.entries.len()
+}
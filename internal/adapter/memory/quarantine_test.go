@@ -0,0 +1,39 @@
+package memory_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/adapter/memory"
+	"stock-consolidation/internal/core/domain"
+)
+
+func TestQuarantine(t *testing.T) {
+	base := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	q := memory.NewQuarantine(2)
+	for i := 1; i <= 3; i++ {
+		stock := domain.Stock{ID: "stock-1", ProductID: i, BranchID: 1, Quantity: -1, CreatedAt: base, UpdatedAt: base}
+		q.Quarantine(domain.NewQuarantinedChange("stock_changes", stock, stock.Validate(), base))
+	}
+
+	got := q.ListQuarantined(0)
+	if q.Len() != 2 || len(got) != 2 {
+		t.Fatalf("quarantine holds %d changes (%d returned), want 2", q.Len(), len(got))
+	}
+	if got[0].Stock.ProductID != 3 || got[1].Stock.ProductID != 2 {
+		t.Errorf("ListQuarantined() product IDs = %d, %d, want newest first", got[0].Stock.ProductID, got[1].Stock.ProductID)
+	}
+	if len(got[0].Rules) != 2 || got[0].Rules[0] != domain.RuleQuantity || got[0].Rules[1] != domain.RuleReserved {
+		t.Errorf("ListQuarantined() rules = %v, want quantity and reserved", got[0].Rules)
+	}
+
+	if got := q.ListQuarantined(1); len(got) != 1 {
+		t.Errorf("ListQuarantined(1) returned %d changes", len(got))
+	}
+
+	change := domain.NewQuarantinedChange("stock_changes", domain.Stock{}, errors.New("boom"), base)
+	if change.Rules == nil || change.Error != "boom" {
+		t.Errorf("NewQuarantinedChange() = %+v", change)
+	}
+}
@@ -0,0 +1,42 @@
+package memory
+
+// ring is a fixed-size buffer that overwrites its oldest entry when full.
+// It is not safe for concurrent use.
+type ring[T any] struct {
+	entries []T
+	next    int
+	full    bool
+}
+
+func newRing[T any](size int) *ring[T] {
+	if size <= 0 {
+		size = 1
+	}
+	return &ring[T]{entries: make([]T, size)}
+}
+
+// add stores v, evicting the oldest entry when the buffer is full
+func (r *ring[T]) add(v T) {
+	r.entries[r.next] = v
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// len returns the number of stored entries
+func (r *ring[T]) len() int {
+	if r.full {
+		return len(r.entries)
+	}
+	return r.next
+}
+
+// each calls fn for every entry, newest first, until fn returns false
+func (r *ring[T]) each(fn func(T) bool) {
+	for i := 1; i <= r.len(); i++ {
+		if !fn(r.entries[(r.next-i+len(r.entries))%len(r.entries)]) {
+			return
+		}
+	}
+}
@@ -8,59 +8,151 @@ import (
 	"fmt"
 	"net/http"
 	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
 	"stock-consolidation/pkg/config"
 	"stock-consolidation/pkg/logger"
+	"stock-consolidation/pkg/metrics"
+	"stock-consolidation/pkg/tracing"
+	"sync/atomic"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // HQClient handles communication with the HQ endpoint
 type HQClient struct {
+	settings   atomic.Pointer[settings]
+	httpClient *http.Client
+	state      deliveryState
+}
+
+// settings holds the delivery settings that can be swapped at runtime
+type settings struct {
 	endpoint   string
 	authHeader string
-	httpClient *http.Client
 }
 
 // NewHQClient creates a new HQClient instance
 func NewHQClient(cfg *config.Config) *HQClient {
-	return &HQClient{
-		endpoint:   cfg.HQEndPoint,
-		authHeader: cfg.HQBasicAuthorization,
+	c := &HQClient{
 		httpClient: &http.Client{
 			Timeout: 5 * time.Second, // Add timeout to prevent long delays
 		},
 	}
+	c.Update(cfg)
+	return c
+}
+
+// Update atomically replaces the endpoint and authorization header used for
+// subsequent requests. Requests already in flight keep the previous settings.
+func (c *HQClient) Update(cfg *config.Config) {
+	c.settings.Store(&settings{
+		endpoint:   cfg.HQEndPoint,
+		authHeader: cfg.HQBasicAuthorization,
+	})
+}
+
+// StatusError is returned when the HQ endpoint responds with an error status
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HQ endpoint returned error status: %d", e.StatusCode)
+}
+
+// Result describes a completed request to the HQ endpoint
+type Result struct {
+	// StatusCode is 0 when no response was received
+	StatusCode int
+	Latency    time.Duration
 }
 
 // SendStockChange sends a stock change notification to the HQ endpoint
 func (c *HQClient) SendStockChange(ctx context.Context, stock domain.Stock) error {
+	_, err := c.Send(ctx, stock)
+	return err
+}
+
+// Send sends a stock change notification to the HQ endpoint and reports the
+// response status and latency alongside any error
+func (c *HQClient) Send(ctx context.Context, stock domain.Stock) (Result, error) {
 	payload, err := json.Marshal(stock)
 	if err != nil {
-		return fmt.Errorf("failed to marshal stock: %v", err)
+		return Result{}, fmt.Errorf("failed to marshal stock: %v", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewBuffer(payload))
+	s := c.settings.Load()
+	log := logger.WithFields(stock.LogFields()).WithFields(logger.Fields{"endpoint": s.endpoint})
+	log.Debug("Sending stock update to HQ")
+
+	result, err := c.post(ctx, s, s.endpoint, payload, log, attribute.String("stock.event_id", stock.EventID()))
+	metrics.ObserveDelivery(result.StatusCode, err)
+	c.state.record(err)
+	return result, err
+}
+
+// SendChange sends a change of a captured table other than stock to endpoint.
+// Its outcome is not part of the stock delivery metrics or health.
+func (c *HQClient) SendChange(ctx context.Context, endpoint string, change port.Change) (Result, error) {
+	payload, err := json.Marshal(change.Entity)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+		return Result{}, fmt.Errorf("failed to marshal %s: %v", change.Type, err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", c.authHeader)
+	log := logger.WithFields(change.Entity.LogFields()).WithFields(logger.Fields{"endpoint": endpoint, "type": change.Type})
+	log.Debug("Sending captured change to HQ")
+	return c.post(ctx, c.settings.Load(), endpoint, payload, log,
+		attribute.String("cdc.type", change.Type),
+		attribute.String("cdc.event_id", change.Entity.EventID()),
+	)
+}
+
+// post sends payload to endpoint with the authorization header of s. attrs
+// identify the payload on the request span.
+func (c *HQClient) post(ctx context.Context, s *settings, endpoint string, payload []byte, log *logger.Entry, attrs ...attribute.KeyValue) (Result, error) {
+	var result Result
+	ctx, span := tracing.Tracer().Start(ctx, "POST HQ", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", "POST"),
+			attribute.String("url.full", endpoint),
+		),
+		trace.WithAttributes(attrs...))
+	defer span.End()
 
-	logger.Info("Sending stock update to HQ endpoint %s for product %d in branch %d", c.endpoint, stock.ProductID, stock.BranchID)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(payload))
+	if err != nil {
+		return result, fmt.Errorf("failed to create request: %v", err)
+	}
 
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", s.authHeader)
+	// Propagate the W3C trace context so HQ can continue the trace
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	start := time.Now()
 	resp, err := c.httpClient.Do(req)
+	result.Latency = time.Since(start)
+	metrics.HQRequestDuration.Observe(result.Latency.Seconds())
 	if err != nil {
-		return fmt.Errorf("failed to send request: %v", err)
+		tracing.RecordError(span, err)
+		return result, fmt.Errorf("failed to send request: %v", err)
 	}
+	result.StatusCode = resp.StatusCode
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			logger.Error("Failed to close response body: %v", err)
+			log.WithFields(logger.Fields{"error": err}).Warn("Failed to close response body")
 		}
 	}()
 
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("HQ endpoint returned error status: %d", resp.StatusCode)
+		err := &StatusError{StatusCode: resp.StatusCode}
+		tracing.RecordError(span, err)
+		return result, err
 	}
-
-	return nil
+	return result, nil
 }
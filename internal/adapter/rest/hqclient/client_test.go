@@ -3,6 +3,7 @@ package hqclient_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -12,7 +13,13 @@ import (
 
 	"stock-consolidation/internal/adapter/rest/hqclient"
 	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
 	"stock-consolidation/pkg/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestHQClient_SendStockChange(t *testing.T) {
@@ -113,6 +120,10 @@ func TestHQClient_SendStockChange(t *testing.T) {
 		if err == nil {
 			t.Error("SendStockChange() expected error for server error, got nil")
 		}
+		var statusErr *hqclient.StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+			t.Errorf("SendStockChange() error = %v, want StatusError with status 500", err)
+		}
 	})
 
 	t.Run("connection error", func(t *testing.T) {
@@ -138,4 +149,183 @@ func TestHQClient_SendStockChange(t *testing.T) {
 			t.Error("SendStockChange() expected error for invalid URL, got nil")
 		}
 	})
+
+	t.Run("update swaps endpoint and authorization", func(t *testing.T) {
+		var gotAuth string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotAuth = r.Header.Get("Authorization")
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		// Start with an unreachable endpoint
+		client := hqclient.NewHQClient(&config.Config{
+			HQEndPoint:           "http://invalid-url",
+			HQBasicAuthorization: "Basic b2xkOm9sZA==",
+		})
+
+		client.Update(&config.Config{
+			HQEndPoint:           server.URL,
+			HQBasicAuthorization: "Basic bmV3Om5ldw==",
+		})
+
+		stock := domain.Stock{ProductID: 1, BranchID: 1, Quantity: 10, CreatedAt: testTime, UpdatedAt: testTime}
+		if err := client.SendStockChange(context.Background(), stock); err != nil {
+			t.Errorf("SendStockChange() error = %v", err)
+		}
+		if gotAuth != "Basic bmV3Om5ldw==" {
+			t.Errorf("Expected updated Authorization header, got %s", gotAuth)
+		}
+	})
+}
+
+func TestHQClient_Send(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client := hqclient.NewHQClient(&config.Config{HQEndPoint: server.URL})
+	result, err := client.Send(context.Background(), domain.Stock{ProductID: 1, BranchID: 1})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if result.StatusCode != http.StatusAccepted || result.Latency <= 0 {
+		t.Errorf("Send() result = %+v, want status 202 and a positive latency", result)
+	}
+
+	server.Close()
+	if result, err = client.Send(context.Background(), domain.Stock{ProductID: 1, BranchID: 1}); err == nil || result.StatusCode != 0 {
+		t.Errorf("Send() = %+v, %v, want error without status code when HQ is unreachable", result, err)
+	}
+}
+
+func TestHQClient_SendChange(t *testing.T) {
+	var gotPath, gotAuth string
+	var gotBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := hqclient.NewHQClient(&config.Config{HQEndPoint: server.URL + "/stock", HQBasicAuthorization: "Basic dXNlcjpwYXNz"})
+	product := domain.Product{ID: 7, SKU: "SKU-7", Name: "Rice", UpdatedAt: time.Now()}
+	change := port.Change{Type: domain.TypeProduct, Entity: product}
+	if _, err := client.SendChange(context.Background(), server.URL+"/products", change); err != nil {
+		t.Fatalf("SendChange() error = %v", err)
+	}
+	if gotPath != "/products" || gotAuth != "Basic dXNlcjpwYXNz" {
+		t.Errorf("SendChange() sent to %s with %q, want /products with the HQ authorization", gotPath, gotAuth)
+	}
+	if gotBody["sku"] != "SKU-7" {
+		t.Errorf("SendChange() body = %v, want the product", gotBody)
+	}
+
+	// Failures of captured changes do not affect the stock delivery health
+	server.Close()
+	if _, err := client.SendChange(context.Background(), server.URL+"/products", change); err == nil {
+		t.Error("SendChange() expected error when HQ is unreachable, got nil")
+	}
+	if details, _ := client.HealthCheck(time.Minute)(context.Background()); details["consecutive_failures"] != 0 {
+		t.Errorf("HealthCheck() details = %v, want no stock delivery failures", details)
+	}
+}
+
+func TestHQClient_HealthCheck(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	client := hqclient.NewHQClient(&config.Config{HQEndPoint: server.URL, HQBasicAuthorization: "Basic dXNlcjpwYXNz"})
+	stock := domain.Stock{ProductID: 1, BranchID: 1, Quantity: 10}
+
+	if _, err := client.HealthCheck(time.Minute)(context.Background()); err != nil {
+		t.Errorf("HealthCheck() error = %v before any delivery, want nil", err)
+	}
+
+	_ = client.SendStockChange(context.Background(), stock)
+	details, err := client.HealthCheck(time.Minute)(context.Background())
+	if err != nil {
+		t.Errorf("HealthCheck() error = %v, failures within threshold should be tolerated", err)
+	}
+	if details["consecutive_failures"] != 1 {
+		t.Errorf("HealthCheck() details = %v, want 1 consecutive failure", details)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if _, err := client.HealthCheck(time.Millisecond)(context.Background()); err == nil {
+		t.Error("HealthCheck() expected error once failures exceed the threshold, got nil")
+	}
+
+	status = http.StatusOK
+	if err := client.SendStockChange(context.Background(), stock); err != nil {
+		t.Fatalf("SendStockChange() error = %v", err)
+	}
+	if _, err := client.HealthCheck(time.Millisecond)(context.Background()); err != nil {
+		t.Errorf("HealthCheck() error = %v after a successful delivery, want nil", err)
+	}
+}
+
+func TestHQClient_StaleChangeIsDelivered(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			_, _ = w.Write([]byte(`{"result": "stale"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := hqclient.NewHQClient(&config.Config{HQEndPoint: server.URL})
+	stock := domain.Stock{ProductID: 1, BranchID: 1, Quantity: 10}
+	_ = client.SendStockChange(context.Background(), stock)
+
+	// A replayed or out of order change that the receiver ignores ends the
+	// failure streak like any other delivery
+	status = http.StatusOK
+	if err := client.SendStockChange(context.Background(), stock); err != nil {
+		t.Fatalf("SendStockChange() error = %v for a stale change, want nil", err)
+	}
+	if details, err := client.HealthCheck(time.Millisecond)(context.Background()); err != nil || details["consecutive_failures"] != 0 {
+		t.Errorf("HealthCheck() = %v, %v, want no failures after a stale change", details, err)
+	}
+}
+
+func TestHQClient_TracePropagation(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := hqclient.NewHQClient(&config.Config{HQEndPoint: server.URL, HQBasicAuthorization: "Basic dXNlcjpwYXNz"})
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "deliver")
+	if err := client.SendStockChange(ctx, domain.Stock{ProductID: 1, BranchID: 1}); err != nil {
+		t.Fatalf("SendStockChange() error = %v", err)
+	}
+	parent.End()
+
+	traceID := parent.SpanContext().TraceID().String()
+	if !strings.Contains(traceparent, traceID) {
+		t.Errorf("traceparent header = %q, want trace ID %s", traceparent, traceID)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 || spans[0].Name() != "POST HQ" || spans[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("Expected a POST HQ child span, got %d spans", len(spans))
+	}
 }
@@ -0,0 +1,63 @@
+package hqclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"stock-consolidation/pkg/health"
+)
+
+// deliveryState tracks recent delivery outcomes to judge HQ reachability
+type deliveryState struct {
+	mu                  sync.Mutex
+	lastSuccess         time.Time
+	failingSince        time.Time
+	consecutiveFailures int
+	lastError           string
+}
+
+func (s *deliveryState) record(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if err == nil {
+		s.lastSuccess = now
+		s.failingSince = time.Time{}
+		s.consecutiveFailures = 0
+		s.lastError = ""
+		return
+	}
+	if s.consecutiveFailures == 0 {
+		s.failingSince = now
+	}
+	s.consecutiveFailures++
+	s.lastError = err.Error()
+}
+
+// HealthCheck returns a health check that fails once every delivery to HQ has
+// failed for longer than threshold
+func (c *HQClient) HealthCheck(threshold time.Duration) health.CheckFunc {
+	return func(_ context.Context) (health.Details, error) {
+		s := &c.state
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		details := health.Details{"consecutive_failures": s.consecutiveFailures}
+		if !s.lastSuccess.IsZero() {
+			details["last_success"] = s.lastSuccess.UTC()
+		}
+		if s.consecutiveFailures == 0 {
+			return details, nil
+		}
+
+		details["failing_since"] = s.failingSince.UTC()
+		details["last_error"] = s.lastError
+		if failing := time.Since(s.failingSince); failing > threshold {
+			return details, fmt.Errorf("HQ deliveries failing for %s", failing.Round(time.Second))
+		}
+		return details, nil
+	}
+}
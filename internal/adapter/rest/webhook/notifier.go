@@ -0,0 +1,107 @@
+// Package webhook posts stock alerts to HTTP webhooks
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/pkg/config"
+	"stock-consolidation/pkg/logger"
+	"stock-consolidation/pkg/metrics"
+)
+
+// Notifier posts every alert as JSON to each configured webhook
+type Notifier struct {
+	webhooks   []string
+	authHeader string
+	httpClient *http.Client
+}
+
+// NewNotifier creates a Notifier for the webhooks of cfg
+func NewNotifier(cfg config.AlertConfig) *Notifier {
+	return &Notifier{
+		webhooks:   cfg.Webhooks,
+		authHeader: cfg.WebhookAuthorization,
+		httpClient: &http.Client{
+			Timeout: 5 * time.Second,
+		},
+	}
+}
+
+// StatusError is returned when a webhook responds with an error status
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("webhook returned error status: %d", e.StatusCode)
+}
+
+// Notify posts alert to every webhook. A failing webhook does not keep the
+// alert from the others; the error reports how many failed.
+func (n *Notifier) Notify(ctx context.Context, alert domain.Alert) error {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %v", err)
+	}
+
+	failed := 0
+	var lastErr error
+	for _, webhook := range n.webhooks {
+		// Only the host is logged, webhook URLs often carry a token in their path
+		log := logger.WithFields(logger.Fields{"alert": alert.Key(), "webhook": host(webhook)})
+		if err := n.post(ctx, webhook, payload); err != nil {
+			metrics.AlertNotifications.WithLabelValues(metrics.ResultFailure).Inc()
+			log.WithFields(logger.Fields{"error": err}).Warn("Failed to send alert")
+			failed++
+			lastErr = err
+			continue
+		}
+		metrics.AlertNotifications.WithLabelValues(metrics.ResultSuccess).Inc()
+		log.Debug("Sent alert")
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to send alert to %d of %d webhooks: %v", failed, len(n.webhooks), lastErr)
+	}
+	return nil
+}
+
+func (n *Notifier) post(ctx context.Context, webhook string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", webhook, bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.authHeader != "" {
+		req.Header.Set("Authorization", n.authHeader)
+	}
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %v", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logger.WithFields(logger.Fields{"error": err}).Warn("Failed to close response body")
+		}
+	}()
+	if resp.StatusCode >= 400 {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// host returns the host of webhook for logging
+func host(webhook string) string {
+	u, err := url.Parse(webhook)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
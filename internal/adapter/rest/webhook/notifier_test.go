@@ -0,0 +1,84 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/adapter/rest/webhook"
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/pkg/config"
+)
+
+func TestNotifier_Notify(t *testing.T) {
+	stock := domain.Stock{ID: "a", ProductID: 1, BranchID: 2, Quantity: 3, Reserved: 1, UpdatedAt: time.Date(2025, 7, 29, 0, 0, 0, 0, time.UTC)}
+	alert := domain.NewAlert(domain.AlertLowStock, stock, 5, nil, time.Date(2025, 7, 29, 0, 0, 1, 0, time.UTC))
+
+	t.Run("alert is posted to every webhook", func(t *testing.T) {
+		received := make(chan map[string]interface{}, 2)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				t.Errorf("Expected POST request, got %s", r.Method)
+			}
+			if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+				t.Errorf("Expected Authorization header Bearer secret, got %s", got)
+			}
+			if got := r.Header.Get("Content-Type"); got != "application/json" {
+				t.Errorf("Expected Content-Type application/json, got %s", got)
+			}
+			var body map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("Failed to decode request body: %v", err)
+			}
+			received <- body
+		})
+		first, second := httptest.NewServer(handler), httptest.NewServer(handler)
+		defer first.Close()
+		defer second.Close()
+
+		notifier := webhook.NewNotifier(config.AlertConfig{
+			Webhooks:             []string{first.URL, second.URL + "/hooks/stock"},
+			WebhookAuthorization: "Bearer secret",
+		})
+		if err := notifier.Notify(context.Background(), alert); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+		for i := 0; i < 2; i++ {
+			body := <-received
+			if body["kind"] != "low_stock" || body["product_id"] != float64(1) || body["threshold"] != float64(5) ||
+				body["available"] != float64(2) || body["text"] != alert.Message || body["event_id"] != stock.EventID() {
+				t.Errorf("request body = %v", body)
+			}
+		}
+	})
+
+	t.Run("failing webhook does not stop the others", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer failing.Close()
+		delivered := make(chan struct{}, 1)
+		working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := r.Header["Authorization"]; ok {
+				t.Error("Expected no Authorization header")
+			}
+			delivered <- struct{}{}
+		}))
+		defer working.Close()
+
+		notifier := webhook.NewNotifier(config.AlertConfig{Webhooks: []string{failing.URL, working.URL}})
+		err := notifier.Notify(context.Background(), alert)
+		if err == nil || !strings.Contains(err.Error(), "1 of 2 webhooks") || !strings.Contains(err.Error(), "500") {
+			t.Errorf("Notify() error = %v, want 1 of 2 webhooks failing with 500", err)
+		}
+		select {
+		case <-delivered:
+		default:
+			t.Error("alert was not posted to the working webhook")
+		}
+	})
+}
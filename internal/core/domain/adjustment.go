@@ -0,0 +1,122 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+// AdjustmentReason explains why stock was adjusted
+type AdjustmentReason string
+
+// Valid adjustment reasons
+const (
+	ReasonReceipt    AdjustmentReason = "receipt"
+	ReasonSale       AdjustmentReason = "sale"
+	ReasonReturn     AdjustmentReason = "return"
+	ReasonDamage     AdjustmentReason = "damage"
+	ReasonTransfer   AdjustmentReason = "transfer"
+	ReasonCount      AdjustmentReason = "count"
+	ReasonCorrection AdjustmentReason = "correction"
+)
+
+// AdjustmentReasons lists every valid reason
+var AdjustmentReasons = []AdjustmentReason{
+	ReasonReceipt, ReasonSale, ReasonReturn, ReasonDamage, ReasonTransfer, ReasonCount, ReasonCorrection,
+}
+
+// Valid reports whether r is one of AdjustmentReasons
+func (r AdjustmentReason) Valid() bool {
+	for _, reason := range AdjustmentReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidationError is returned when a change would violate a stock rule
+type ValidationError struct {
+	Msg string
+	// Rules names the violated stock invariants, if any
+	Rules []string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Msg
+}
+
+func invalid(format string, args ...interface{}) error {
+	return &ValidationError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// Adjustment changes the quantity and reserved units of one product in one
+// branch, either by a delta or by setting absolute values
+type Adjustment struct {
+	ProductID int
+	BranchID  int
+
+	QuantityDelta int
+	ReservedDelta int
+	// Quantity and Reserved, when set, replace the current values and take
+	// precedence over the deltas
+	Quantity *int
+	Reserved *int
+
+	Reason AdjustmentReason
+	Note   string
+	// Actor identifies who made the adjustment
+	Actor string
+	// ExpectedUpdatedAt, when set, makes the adjustment fail if the stock was
+	// changed since it was read
+	ExpectedUpdatedAt *time.Time
+}
+
+// Validate checks the adjustment independently of the current stock
+func (a Adjustment) Validate() error {
+	switch {
+	case a.ProductID <= 0:
+		return invalid("product_id must be positive")
+	case a.BranchID <= 0:
+		return invalid("branch_id must be positive")
+	case !a.Reason.Valid():
+		return invalid("reason %q is not valid", a.Reason)
+	case a.Quantity == nil && a.Reserved == nil && a.QuantityDelta == 0 && a.ReservedDelta == 0:
+		return invalid("adjustment does not change quantity or reserved")
+	}
+	return nil
+}
+
+// Apply returns stock with the adjustment applied. It fails if the result
+// would have negative values or more units reserved than in stock.
+func (a Adjustment) Apply(stock Stock) (Stock, error) {
+	if err := a.Validate(); err != nil {
+		return stock, err
+	}
+
+	if a.Quantity != nil {
+		stock.Quantity = *a.Quantity
+	} else {
+		stock.Quantity += a.QuantityDelta
+	}
+	if a.Reserved != nil {
+		stock.Reserved = *a.Reserved
+	} else {
+		stock.Reserved += a.ReservedDelta
+	}
+
+	return stock, checkLevels(stock)
+}
+
+// checkLevels verifies that a changed stock has no negative values and does
+// not reserve more units than it holds
+func checkLevels(stock Stock) error {
+	switch {
+	case stock.Quantity < 0:
+		return invalid("quantity would become negative (%d)", stock.Quantity)
+	case stock.Reserved < 0:
+		return invalid("reserved would become negative (%d)", stock.Reserved)
+	case stock.Reserved > stock.Quantity:
+		return invalid("reserved (%d) would exceed quantity (%d)", stock.Reserved, stock.Quantity)
+	}
+	return nil
+}
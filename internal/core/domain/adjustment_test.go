@@ -0,0 +1,93 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+
+	"stock-consolidation/internal/core/domain"
+)
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestAdjustmentApply(t *testing.T) {
+	stock := domain.Stock{ProductID: 1, BranchID: 2, Quantity: 10, Reserved: 4}
+
+	tests := []struct {
+		name         string
+		adj          domain.Adjustment
+		wantQuantity int
+		wantReserved int
+		wantErr      bool
+	}{
+		{
+			name:         "deltas",
+			adj:          domain.Adjustment{QuantityDelta: 5, ReservedDelta: -2, Reason: domain.ReasonReceipt},
+			wantQuantity: 15,
+			wantReserved: 2,
+		},
+		{
+			name:         "absolute values take precedence",
+			adj:          domain.Adjustment{Quantity: intPtr(7), QuantityDelta: 100, Reason: domain.ReasonCount},
+			wantQuantity: 7,
+			wantReserved: 4,
+		},
+		{
+			name:    "negative quantity",
+			adj:     domain.Adjustment{QuantityDelta: -11, Reason: domain.ReasonSale},
+			wantErr: true,
+		},
+		{
+			name:    "reserved above quantity",
+			adj:     domain.Adjustment{ReservedDelta: 7, Reason: domain.ReasonCorrection},
+			wantErr: true,
+		},
+		{
+			name:    "negative reserved",
+			adj:     domain.Adjustment{Reserved: intPtr(-1), Reason: domain.ReasonCorrection},
+			wantErr: true,
+		},
+		{
+			name:    "unknown reason",
+			adj:     domain.Adjustment{QuantityDelta: 1, Reason: "gift"},
+			wantErr: true,
+		},
+		{
+			name:    "no change",
+			adj:     domain.Adjustment{Reason: domain.ReasonCount},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.adj.ProductID, tt.adj.BranchID = stock.ProductID, stock.BranchID
+			got, err := tt.adj.Apply(stock)
+			if tt.wantErr {
+				var validationErr *domain.ValidationError
+				if !errors.As(err, &validationErr) {
+					t.Errorf("Apply() error = %v, want a ValidationError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if got.Quantity != tt.wantQuantity || got.Reserved != tt.wantReserved {
+				t.Errorf("Apply() = %d/%d, want %d/%d", got.Quantity, got.Reserved, tt.wantQuantity, tt.wantReserved)
+			}
+		})
+	}
+}
+
+func TestAdjustmentValidate(t *testing.T) {
+	adj := domain.Adjustment{ProductID: 0, BranchID: 1, QuantityDelta: 1, Reason: domain.ReasonReceipt}
+	if err := adj.Validate(); err == nil {
+		t.Error("Validate() expected error for missing product, got nil")
+	}
+	adj.ProductID = 1
+	if err := adj.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
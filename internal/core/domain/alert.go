@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+// Alert kinds
+const (
+	// AlertLowStock is raised when the available units fall below the
+	// configured low stock level
+	AlertLowStock = "low_stock"
+	// AlertSuddenDrop is raised when a single change removes a large share of
+	// the available units
+	AlertSuddenDrop = "sudden_drop"
+	// AlertNegativeAvailable is raised when a branch reports more reserved
+	// units than it holds
+	AlertNegativeAvailable = "negative_available"
+)
+
+// Alert notifies about the stock of a product at a branch
+type Alert struct {
+	Kind      string `json:"kind"`
+	ProductID int    `json:"product_id"`
+	BranchID  int    `json:"branch_id"`
+	Region    string `json:"region,omitempty"`
+	Available int    `json:"available"`
+	// Threshold is the low stock level for AlertLowStock
+	Threshold int `json:"threshold,omitempty"`
+	// PreviousAvailable is the available units before the change for AlertSuddenDrop
+	PreviousAvailable *int   `json:"previous_available,omitempty"`
+	Message           string `json:"message"`
+	// Text repeats Message for chat webhooks such as Slack's
+	Text        string    `json:"text"`
+	EventID     string    `json:"event_id"`
+	TriggeredAt time.Time `json:"triggered_at"`
+}
+
+// NewAlert creates an alert of kind about stock and describes it in its message
+func NewAlert(kind string, stock Stock, threshold int, previous *Stock, now time.Time) Alert {
+	alert := Alert{
+		Kind:        kind,
+		ProductID:   stock.ProductID,
+		BranchID:    stock.BranchID,
+		Available:   stock.Available(),
+		EventID:     stock.EventID(),
+		TriggeredAt: now,
+	}
+	switch kind {
+	case AlertLowStock:
+		alert.Threshold = threshold
+		alert.Message = fmt.Sprintf("Low stock: product %d at branch %d has %d available units, below %d",
+			stock.ProductID, stock.BranchID, alert.Available, threshold)
+	case AlertSuddenDrop:
+		before := previous.Available()
+		alert.PreviousAvailable = &before
+		alert.Message = fmt.Sprintf("Sudden drop: available units of product %d at branch %d fell from %d to %d",
+			stock.ProductID, stock.BranchID, before, alert.Available)
+	case AlertNegativeAvailable:
+		alert.Message = fmt.Sprintf("Negative available stock: product %d at branch %d has %d units reserved of %d",
+			stock.ProductID, stock.BranchID, stock.Reserved, stock.Quantity)
+	}
+	alert.Text = alert.Message
+	return alert
+}
+
+// Key identifies the condition an alert reports, for deduplication
+func (a Alert) Key() string {
+	return fmt.Sprintf("%s:%d:%d", a.Kind, a.ProductID, a.BranchID)
+}
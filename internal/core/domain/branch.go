@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Branch is the metadata of a branch
+type Branch struct {
+	ID   int    `json:"id"`
+	Code string `json:"code"`
+	Name string `json:"name"`
+	// Timezone is the IANA time zone of the branch, empty if unknown
+	Timezone  string    `json:"timezone"`
+	Active    bool      `json:"active"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// EventID identifies a single change of the branch
+func (b Branch) EventID() string {
+	return fmt.Sprintf("branch/%d@%d", b.ID, b.UpdatedAt.UnixMicro())
+}
+
+// Validate checks that the branch can be replicated to HQ
+func (b Branch) Validate() error {
+	switch {
+	case b.ID <= 0:
+		return invalid("branch id must be positive (%d)", b.ID)
+	case strings.TrimSpace(b.Code) == "":
+		return invalid("branch %d has no code", b.ID)
+	case b.UpdatedAt.IsZero():
+		return invalid("branch %d has no updated_at", b.ID)
+	}
+	if b.Timezone != "" {
+		if _, err := time.LoadLocation(b.Timezone); err != nil {
+			return invalid("branch %d has an unknown timezone %q", b.ID, b.Timezone)
+		}
+	}
+	return nil
+}
+
+// LogFields returns the structured log fields identifying this branch change
+func (b Branch) LogFields() map[string]interface{} {
+	return map[string]interface{}{
+		"event_id":    b.EventID(),
+		"branch_id":   b.ID,
+		"branch_code": b.Code,
+	}
+}
+
+// DecodeBranch decodes a branch change notification payload. Timestamps
+// without an offset are interpreted in loc; all timestamps are returned in UTC.
+func DecodeBranch(data []byte, loc *time.Location) (Branch, error) {
+	var aux struct {
+		Branch
+		UpdatedAt string `json:"updated_at"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return Branch{}, err
+	}
+	updatedAt, err := ParseTimestamp(aux.UpdatedAt, loc)
+	if err != nil {
+		return Branch{}, err
+	}
+
+	branch := aux.Branch
+	branch.UpdatedAt = updatedAt
+	return branch, nil
+}
@@ -0,0 +1,31 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+)
+
+func TestDecodeBranch(t *testing.T) {
+	branch, err := domain.DecodeBranch([]byte(`{"id":2,"code":"BKK-01","name":"Bangkok","timezone":"Asia/Bangkok","active":true,"updated_at":"2025-07-29T07:00:00+07:00"}`), time.UTC)
+	if err != nil {
+		t.Fatalf("DecodeBranch() error = %v", err)
+	}
+	if branch.Code != "BKK-01" || branch.Timezone != "Asia/Bangkok" || !branch.UpdatedAt.Equal(time.Date(2025, 7, 29, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("DecodeBranch() = %+v", branch)
+	}
+	if err := branch.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	branch.Timezone = "Mars/Olympus_Mons"
+	if err := branch.Validate(); err == nil {
+		t.Error("Validate() expected error for an unknown timezone, got nil")
+	}
+	branch.Timezone = ""
+	branch.Code = " "
+	if err := branch.Validate(); err == nil {
+		t.Error("Validate() expected error for a missing code, got nil")
+	}
+}
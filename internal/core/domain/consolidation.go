@@ -0,0 +1,100 @@
+package domain
+
+import "time"
+
+// ProductTotal is the stock of a product summed over every branch that
+// reported it to HQ
+type ProductTotal struct {
+	ProductID int `json:"product_id"`
+	// Branches is the number of branches holding a stock row for the product
+	Branches  int `json:"branches"`
+	Quantity  int `json:"quantity"`
+	Reserved  int `json:"reserved"`
+	Available int `json:"available"`
+	// UpdatedAt is the most recent update of any branch
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Region is a named group of branches
+type Region struct {
+	Name      string `json:"name"`
+	BranchIDs []int  `json:"branch_ids"`
+}
+
+// StockLevels sets a number of available units per product, per branch and by
+// default, such as the safety stock. A product setting takes precedence over
+// a branch setting, which takes precedence over the default.
+type StockLevels struct {
+	Default  int
+	Products map[int]int
+	Branches map[int]int
+}
+
+// For returns the level of a product at a branch
+func (s StockLevels) For(productID, branchID int) int {
+	if units, ok := s.Products[productID]; ok {
+		return units
+	}
+	if units, ok := s.Branches[branchID]; ok {
+		return units
+	}
+	return s.Default
+}
+
+// BranchStock is the consolidated stock of a product at one branch, compared
+// to its safety stock
+type BranchStock struct {
+	ProductID   int    `json:"product_id"`
+	BranchID    int    `json:"branch_id"`
+	Region      string `json:"region,omitempty"`
+	Quantity    int    `json:"quantity"`
+	Reserved    int    `json:"reserved"`
+	Available   int    `json:"available"`
+	SafetyStock int    `json:"safety_stock"`
+	// Shortfall is the number of units missing to reach the safety stock
+	Shortfall int       `json:"shortfall"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NewBranchStock compares stock to safetyStock
+func NewBranchStock(stock Stock, safetyStock int) BranchStock {
+	b := BranchStock{
+		ProductID:   stock.ProductID,
+		BranchID:    stock.BranchID,
+		Quantity:    stock.Quantity,
+		Reserved:    stock.Reserved,
+		Available:   stock.Available(),
+		SafetyStock: safetyStock,
+		UpdatedAt:   stock.UpdatedAt,
+	}
+	if b.Available < safetyStock {
+		b.Shortfall = safetyStock - b.Available
+	}
+	return b
+}
+
+// BelowSafetyStock reports whether fewer units are available than the safety stock
+func (b BranchStock) BelowSafetyStock() bool {
+	return b.Shortfall > 0
+}
+
+// RegionTotal is the stock of a product summed over the branches of a region
+type RegionTotal struct {
+	Region    string `json:"region"`
+	Branches  int    `json:"branches"`
+	Quantity  int    `json:"quantity"`
+	Reserved  int    `json:"reserved"`
+	Available int    `json:"available"`
+	// BelowSafetyStock is the number of branches of the region below their safety stock
+	BelowSafetyStock int `json:"below_safety_stock"`
+}
+
+// ProductBreakdown is the total of a product with its breakdown by region and
+// by branch
+type ProductBreakdown struct {
+	ProductTotal
+	// BelowSafetyStock is the number of branches below their safety stock
+	BelowSafetyStock int           `json:"below_safety_stock"`
+	ByRegion         []RegionTotal `json:"by_region"`
+	ByBranch         []BranchStock `json:"by_branch"`
+}
@@ -0,0 +1,43 @@
+package domain_test
+
+import (
+	"testing"
+
+	"stock-consolidation/internal/core/domain"
+)
+
+func TestStockLevels(t *testing.T) {
+	safety := domain.StockLevels{
+		Default:  10,
+		Products: map[int]int{42: 25, 43: 0},
+		Branches: map[int]int{3: 5},
+	}
+	tests := []struct {
+		name                string
+		productID, branchID int
+		want                int
+	}{
+		{"product setting wins over branch", 42, 3, 25},
+		{"product setting of zero disables", 43, 1, 0},
+		{"branch setting", 1, 3, 5},
+		{"default", 1, 1, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := safety.For(tt.productID, tt.branchID); got != tt.want {
+				t.Errorf("For(%d, %d) = %d, want %d", tt.productID, tt.branchID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewBranchStock(t *testing.T) {
+	below := domain.NewBranchStock(domain.Stock{ProductID: 1, BranchID: 2, Quantity: 10, Reserved: 4}, 8)
+	if below.Available != 6 || below.Shortfall != 2 || !below.BelowSafetyStock() {
+		t.Errorf("NewBranchStock() = %+v, want 2 units short", below)
+	}
+	enough := domain.NewBranchStock(domain.Stock{ProductID: 1, BranchID: 2, Quantity: 10}, 10)
+	if enough.Shortfall != 0 || enough.BelowSafetyStock() {
+		t.Errorf("NewBranchStock() = %+v, want no shortfall", enough)
+	}
+}
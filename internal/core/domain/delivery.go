@@ -0,0 +1,43 @@
+package domain
+
+import "time"
+
+// Delivery statuses
+const (
+	DeliverySucceeded = "success"
+	DeliveryFailed    = "failure"
+)
+
+// Delivery records the outcome of one attempt to send a stock change to HQ
+type Delivery struct {
+	EventID     string    `json:"event_id"`
+	StockID     string    `json:"stock_id"`
+	ProductID   int       `json:"product_id"`
+	BranchID    int       `json:"branch_id"`
+	Channel     string    `json:"channel,omitempty"`
+	Source      string    `json:"source,omitempty"`
+	Status      string    `json:"status"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	LatencyMS   float64   `json:"latency_ms"`
+	Error       string    `json:"error,omitempty"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// NewDelivery builds the delivery record for an attempt to send stock
+func NewDelivery(stock Stock, statusCode int, latency time.Duration, err error, attemptedAt time.Time) Delivery {
+	d := Delivery{
+		EventID:     stock.EventID(),
+		StockID:     stock.ID,
+		ProductID:   stock.ProductID,
+		BranchID:    stock.BranchID,
+		Status:      DeliverySucceeded,
+		StatusCode:  statusCode,
+		LatencyMS:   float64(latency.Microseconds()) / 1000,
+		AttemptedAt: attemptedAt,
+	}
+	if err != nil {
+		d.Status = DeliveryFailed
+		d.Error = err.Error()
+	}
+	return d
+}
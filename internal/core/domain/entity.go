@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+// Types of the entities captured from the branch database
+const (
+	TypeStock         = "stock"
+	TypeProduct       = "product"
+	TypeBranch        = "branch"
+	TypeStockMovement = "stock_movement"
+)
+
+// Entity is a row of a table captured from the branch database, decoded into
+// its domain type
+type Entity interface {
+	// EventID identifies a single change of the row
+	EventID() string
+	// Validate returns a *ValidationError when the row must not be replicated
+	Validate() error
+	LogFields() map[string]interface{}
+}
+
+// Decoder decodes a change notification payload into an Entity. Timestamps
+// without an offset are interpreted in loc.
+type Decoder func(data []byte, loc *time.Location) (Entity, error)
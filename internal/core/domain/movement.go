@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StockMovement is a recorded adjustment of a stock row, as stored in the
+// stock_adjustment audit table
+type StockMovement struct {
+	ID            int64            `json:"id"`
+	StockID       string           `json:"stock_id"`
+	ProductID     int              `json:"product_id"`
+	BranchID      int              `json:"branch_id"`
+	QuantityDelta int              `json:"quantity_delta"`
+	ReservedDelta int              `json:"reserved_delta"`
+	Reason        AdjustmentReason `json:"reason"`
+	Note          string           `json:"note"`
+	Actor         string           `json:"actor"`
+	CreatedAt     time.Time        `json:"created_at"`
+}
+
+// EventID identifies the movement. Movements are never updated, so the row ID
+// is enough.
+func (m StockMovement) EventID() string {
+	return fmt.Sprintf("stock_movement/%d", m.ID)
+}
+
+// Validate checks that the movement can be replicated to HQ
+func (m StockMovement) Validate() error {
+	switch {
+	case m.ID <= 0:
+		return invalid("stock movement id must be positive (%d)", m.ID)
+	case strings.TrimSpace(m.StockID) == "":
+		return invalid("stock movement %d has no stock_id", m.ID)
+	case m.ProductID <= 0 || m.BranchID <= 0:
+		return invalid("stock movement %d must have a positive product_id and branch_id", m.ID)
+	case !m.Reason.Valid():
+		return invalid("stock movement %d has an invalid reason %q", m.ID, m.Reason)
+	case m.CreatedAt.IsZero():
+		return invalid("stock movement %d has no created_at", m.ID)
+	}
+	return nil
+}
+
+// LogFields returns the structured log fields identifying this movement
+func (m StockMovement) LogFields() map[string]interface{} {
+	return map[string]interface{}{
+		"event_id":   m.EventID(),
+		"product_id": m.ProductID,
+		"branch_id":  m.BranchID,
+		"reason":     m.Reason,
+	}
+}
+
+// DecodeStockMovement decodes a stock movement notification payload.
+// Timestamps without an offset are interpreted in loc; all timestamps are
+// returned in UTC.
+func DecodeStockMovement(data []byte, loc *time.Location) (StockMovement, error) {
+	var aux struct {
+		StockMovement
+		CreatedAt string `json:"created_at"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return StockMovement{}, err
+	}
+	createdAt, err := ParseTimestamp(aux.CreatedAt, loc)
+	if err != nil {
+		return StockMovement{}, err
+	}
+
+	movement := aux.StockMovement
+	movement.CreatedAt = createdAt
+	return movement, nil
+}
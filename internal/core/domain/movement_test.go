@@ -0,0 +1,31 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+)
+
+func TestDecodeStockMovement(t *testing.T) {
+	payload := `{"id":42,"stock_id":"123e4567-e89b-12d3-a456-426614174000","product_id":1,"branch_id":2,` +
+		`"quantity_delta":-3,"reserved_delta":0,"reason":"sale","note":"","actor":"pos-1","created_at":"2025-07-29T00:00:00.123456+00:00"}`
+	movement, err := domain.DecodeStockMovement([]byte(payload), time.UTC)
+	if err != nil {
+		t.Fatalf("DecodeStockMovement() error = %v", err)
+	}
+	if movement.ID != 42 || movement.QuantityDelta != -3 || movement.Reason != domain.ReasonSale || movement.CreatedAt.Nanosecond() != 123456000 {
+		t.Errorf("DecodeStockMovement() = %+v", movement)
+	}
+	if movement.EventID() != "stock_movement/42" {
+		t.Errorf("EventID() = %s, want stock_movement/42", movement.EventID())
+	}
+	if err := movement.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	movement.Reason = "theft"
+	if err := movement.Validate(); err == nil {
+		t.Error("Validate() expected error for an invalid reason, got nil")
+	}
+}
@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Product is the master data of a product sold by the branch
+type Product struct {
+	ID        int       `json:"id"`
+	SKU       string    `json:"sku"`
+	Name      string    `json:"name"`
+	Unit      string    `json:"unit"`
+	Active    bool      `json:"active"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// EventID identifies a single change of the product
+func (p Product) EventID() string {
+	return fmt.Sprintf("product/%d@%d", p.ID, p.UpdatedAt.UnixMicro())
+}
+
+// Validate checks that the product can be replicated to HQ
+func (p Product) Validate() error {
+	switch {
+	case p.ID <= 0:
+		return invalid("product id must be positive (%d)", p.ID)
+	case strings.TrimSpace(p.SKU) == "":
+		return invalid("product %d has no sku", p.ID)
+	case strings.TrimSpace(p.Name) == "":
+		return invalid("product %d has no name", p.ID)
+	case p.UpdatedAt.IsZero():
+		return invalid("product %d has no updated_at", p.ID)
+	}
+	return nil
+}
+
+// LogFields returns the structured log fields identifying this product change
+func (p Product) LogFields() map[string]interface{} {
+	return map[string]interface{}{
+		"event_id":   p.EventID(),
+		"product_id": p.ID,
+		"sku":        p.SKU,
+	}
+}
+
+// DecodeProduct decodes a product change notification payload. Timestamps
+// without an offset are interpreted in loc; all timestamps are returned in UTC.
+func DecodeProduct(data []byte, loc *time.Location) (Product, error) {
+	var aux struct {
+		Product
+		UpdatedAt string `json:"updated_at"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return Product{}, err
+	}
+	updatedAt, err := ParseTimestamp(aux.UpdatedAt, loc)
+	if err != nil {
+		return Product{}, err
+	}
+
+	product := aux.Product
+	product.UpdatedAt = updatedAt
+	return product, nil
+}
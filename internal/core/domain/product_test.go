@@ -0,0 +1,54 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+)
+
+func TestDecodeProduct(t *testing.T) {
+	bangkok, err := time.LoadLocation("Asia/Bangkok")
+	if err != nil {
+		t.Fatalf("Failed to load location: %v", err)
+	}
+
+	product, err := domain.DecodeProduct([]byte(`{"id":7,"sku":"SKU-7","name":"Rice 5kg","unit":"bag","active":true,"updated_at":"2025-07-29T07:00:00"}`), bangkok)
+	if err != nil {
+		t.Fatalf("DecodeProduct() error = %v", err)
+	}
+	want := time.Date(2025, 7, 29, 0, 0, 0, 0, time.UTC)
+	if product.ID != 7 || product.SKU != "SKU-7" || product.Unit != "bag" || !product.Active || !product.UpdatedAt.Equal(want) {
+		t.Errorf("DecodeProduct() = %+v, want product 7 updated at %s", product, want)
+	}
+	if product.EventID() != "product/7@1753747200000000" {
+		t.Errorf("EventID() = %s", product.EventID())
+	}
+	if err := product.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	if _, err := domain.DecodeProduct([]byte(`{"id":7,"updated_at":"yesterday"}`), time.UTC); err == nil {
+		t.Error("DecodeProduct() expected error for an invalid timestamp, got nil")
+	}
+}
+
+func TestProductValidate(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		product domain.Product
+	}{
+		{"missing id", domain.Product{SKU: "A", Name: "A", UpdatedAt: now}},
+		{"missing sku", domain.Product{ID: 1, Name: "A", UpdatedAt: now}},
+		{"missing name", domain.Product{ID: 1, SKU: "A", UpdatedAt: now}},
+		{"missing updated_at", domain.Product{ID: 1, SKU: "A", Name: "A"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.product.Validate(); err == nil {
+				t.Error("Validate() expected error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// QuarantinedChange is a stock change that failed validation and was held
+// back instead of being sent to HQ
+type QuarantinedChange struct {
+	EventID       string    `json:"event_id"`
+	Channel       string    `json:"channel"`
+	Source        string    `json:"source,omitempty"`
+	Stock         Stock     `json:"stock"`
+	Rules         []string  `json:"rules"`
+	Error         string    `json:"error"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+}
+
+// NewQuarantinedChange records stock as rejected by err on channel
+func NewQuarantinedChange(channel string, stock Stock, err error, quarantinedAt time.Time) QuarantinedChange {
+	q := QuarantinedChange{
+		EventID:       stock.EventID(),
+		Channel:       channel,
+		Stock:         stock,
+		Rules:         []string{},
+		Error:         err.Error(),
+		QuarantinedAt: quarantinedAt,
+	}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) && validationErr.Rules != nil {
+		q.Rules = validationErr.Rules
+	}
+	return q
+}
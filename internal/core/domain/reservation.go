@@ -0,0 +1,74 @@
+package domain
+
+import "time"
+
+// ReservationStatus is the lifecycle state of a reservation
+type ReservationStatus string
+
+// Reservation states. Only active reservations hold reserved units.
+const (
+	ReservationActive    ReservationStatus = "active"
+	ReservationConfirmed ReservationStatus = "confirmed"
+	ReservationCancelled ReservationStatus = "cancelled"
+	ReservationExpired   ReservationStatus = "expired"
+)
+
+// Reservation holds units of a product in a branch until it is confirmed,
+// cancelled or expires
+type Reservation struct {
+	ID        string            `json:"id"`
+	StockID   string            `json:"stock_id"`
+	ProductID int               `json:"product_id"`
+	BranchID  int               `json:"branch_id"`
+	Quantity  int               `json:"quantity"`
+	Status    ReservationStatus `json:"status"`
+	// Reference links the reservation to e.g. an order in the caller's system
+	Reference string    `json:"reference,omitempty"`
+	Actor     string    `json:"actor,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Validate checks a new reservation
+func (r Reservation) Validate() error {
+	switch {
+	case r.ProductID <= 0:
+		return invalid("product_id must be positive")
+	case r.BranchID <= 0:
+		return invalid("branch_id must be positive")
+	case r.Quantity <= 0:
+		return invalid("quantity must be positive")
+	case r.ExpiresAt.IsZero():
+		return invalid("expires_at is required")
+	}
+	return nil
+}
+
+// Expired reports whether an active reservation has passed its expiry at now
+func (r Reservation) Expired(now time.Time) bool {
+	return r.Status == ReservationActive && !now.Before(r.ExpiresAt)
+}
+
+// Reserve returns stock with the reservation's units reserved. It fails when
+// fewer units are available.
+func (r Reservation) Reserve(stock Stock) (Stock, error) {
+	if available := stock.Available(); r.Quantity > available {
+		return stock, invalid("only %d units available, cannot reserve %d", available, r.Quantity)
+	}
+	stock.Reserved += r.Quantity
+	return stock, checkLevels(stock)
+}
+
+// Confirm returns stock with the reserved units taken out of stock
+func (r Reservation) Confirm(stock Stock) (Stock, error) {
+	stock.Quantity -= r.Quantity
+	stock.Reserved -= r.Quantity
+	return stock, checkLevels(stock)
+}
+
+// Release returns stock with the reserved units made available again
+func (r Reservation) Release(stock Stock) (Stock, error) {
+	stock.Reserved -= r.Quantity
+	return stock, checkLevels(stock)
+}
@@ -0,0 +1,66 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+)
+
+func TestReservationLifecycle(t *testing.T) {
+	stock := domain.Stock{ProductID: 1, BranchID: 1, Quantity: 10, Reserved: 4}
+	r := domain.Reservation{ProductID: 1, BranchID: 1, Quantity: 5, ExpiresAt: time.Now().Add(time.Minute)}
+
+	if err := r.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	reserved, err := r.Reserve(stock)
+	if err != nil || reserved.Reserved != 9 || reserved.Quantity != 10 {
+		t.Fatalf("Reserve() = %+v, %v, want 9 of 10 reserved", reserved, err)
+	}
+	if _, err := r.Reserve(reserved); err == nil {
+		t.Error("Reserve() expected error when only 1 unit is available, got nil")
+	}
+
+	confirmed, err := r.Confirm(reserved)
+	if err != nil || confirmed.Quantity != 5 || confirmed.Reserved != 4 {
+		t.Errorf("Confirm() = %+v, %v, want 4 of 5 reserved", confirmed, err)
+	}
+
+	released, err := r.Release(reserved)
+	if err != nil || released.Quantity != 10 || released.Reserved != 4 {
+		t.Errorf("Release() = %+v, %v, want 4 of 10 reserved", released, err)
+	}
+	if _, err := r.Release(domain.Stock{Quantity: 10, Reserved: 2}); err == nil {
+		t.Error("Release() expected error when fewer units are reserved, got nil")
+	}
+}
+
+func TestReservationValidateAndExpired(t *testing.T) {
+	now := time.Now()
+	valid := domain.Reservation{ProductID: 1, BranchID: 1, Quantity: 1, ExpiresAt: now}
+	invalid := []domain.Reservation{
+		{BranchID: 1, Quantity: 1, ExpiresAt: now},
+		{ProductID: 1, Quantity: 1, ExpiresAt: now},
+		{ProductID: 1, BranchID: 1, ExpiresAt: now},
+		{ProductID: 1, BranchID: 1, Quantity: 1},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	for _, r := range invalid {
+		if err := r.Validate(); err == nil {
+			t.Errorf("Validate(%+v) expected error, got nil", r)
+		}
+	}
+
+	valid.Status = domain.ReservationActive
+	if !valid.Expired(now) || valid.Expired(now.Add(-time.Second)) {
+		t.Error("Expired() should be true from ExpiresAt on")
+	}
+	valid.Status = domain.ReservationConfirmed
+	if valid.Expired(now.Add(time.Hour)) {
+		t.Error("Expired() should be false for closed reservations")
+	}
+}
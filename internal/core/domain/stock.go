@@ -3,6 +3,7 @@ package domain
 
 import (
 	"encoding/json"
+	"fmt"
 	"strings"
 	"time"
 )
@@ -18,11 +19,146 @@ type Stock struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
-// Custom time format for PostgreSQL timestamps
+// EventID identifies a single change of a stock row. It combines the row ID with
+// the update timestamp so the same change always has the same ID.
+func (s Stock) EventID() string {
+	return fmt.Sprintf("%s@%d", s.ID, s.UpdatedAt.UnixMicro())
+}
+
+// Available returns the quantity that is not reserved
+func (s Stock) Available() int {
+	return s.Quantity - s.Reserved
+}
+
+// Names of the stock invariants checked by Validate
+const (
+	RuleID         = "id"
+	RuleProductID  = "product_id"
+	RuleBranchID   = "branch_id"
+	RuleQuantity   = "quantity"
+	RuleReserved   = "reserved"
+	RuleTimestamps = "timestamps"
+)
+
+// stockRule is an invariant every stock change must satisfy before it is sent
+// to HQ. check returns a description of the violation or "".
+type stockRule struct {
+	name  string
+	check func(Stock) string
+}
+
+var stockRules = []stockRule{
+	{RuleID, func(s Stock) string {
+		if strings.TrimSpace(s.ID) == "" {
+			return "id is empty"
+		}
+		return ""
+	}},
+	{RuleProductID, func(s Stock) string {
+		if s.ProductID <= 0 {
+			return fmt.Sprintf("product_id must be positive (%d)", s.ProductID)
+		}
+		return ""
+	}},
+	{RuleBranchID, func(s Stock) string {
+		if s.BranchID <= 0 {
+			return fmt.Sprintf("branch_id must be positive (%d)", s.BranchID)
+		}
+		return ""
+	}},
+	{RuleQuantity, func(s Stock) string {
+		if s.Quantity < 0 {
+			return fmt.Sprintf("quantity is negative (%d)", s.Quantity)
+		}
+		return ""
+	}},
+	{RuleReserved, func(s Stock) string {
+		switch {
+		case s.Reserved < 0:
+			return fmt.Sprintf("reserved is negative (%d)", s.Reserved)
+		case s.Reserved > s.Quantity:
+			return fmt.Sprintf("reserved (%d) exceeds quantity (%d)", s.Reserved, s.Quantity)
+		}
+		return ""
+	}},
+	{RuleTimestamps, func(s Stock) string {
+		switch {
+		case s.CreatedAt.IsZero() || s.UpdatedAt.IsZero():
+			return "created_at and updated_at are required"
+		case s.UpdatedAt.Before(s.CreatedAt):
+			return fmt.Sprintf("updated_at (%s) is before created_at (%s)",
+				s.UpdatedAt.Format(time.RFC3339Nano), s.CreatedAt.Format(time.RFC3339Nano))
+		}
+		return ""
+	}},
+}
+
+// Validate checks every stock invariant and returns a *ValidationError listing
+// all violations, or nil when the stock may be sent to HQ
+func (s Stock) Validate() error {
+	var rules, msgs []string
+	for _, rule := range stockRules {
+		if msg := rule.check(s); msg != "" {
+			rules = append(rules, rule.name)
+			msgs = append(msgs, msg)
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	return &ValidationError{Msg: strings.Join(msgs, "; "), Rules: rules}
+}
+
+// LogFields returns the structured log fields identifying this stock change
+func (s Stock) LogFields() map[string]interface{} {
+	return map[string]interface{}{
+		"event_id":   s.EventID(),
+		"product_id": s.ProductID,
+		"branch_id":  s.BranchID,
+	}
+}
+
+// Custom time format for PostgreSQL timestamps without time zone
 const pgTimeFormat = "2006-01-02T15:04:05.999999"
 
-// UnmarshalJSON implements custom JSON unmarshaling for Stock
-func (s *Stock) UnmarshalJSON(data []byte) error {
+// offsetTimeFormats are accepted for timestamps that carry a UTC offset, as
+// sent for timestamptz columns. PostgreSQL omits the minutes of whole-hour
+// offsets in its text output.
+var offsetTimeFormats = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999-07",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999-07",
+}
+
+// ParseTimestamp parses a timestamp from a change notification and returns it
+// in UTC. Timestamps with an offset (RFC 3339) are taken as is; legacy
+// timestamps without one are interpreted in loc, the branch's time zone.
+func ParseTimestamp(value string, loc *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range offsetTimeFormats {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+
+	if loc == nil {
+		loc = time.UTC
+	}
+	layout := pgTimeFormat
+	if len(value) > 10 && value[10] == ' ' {
+		layout = "2006-01-02 15:04:05.999999"
+	}
+	t, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q: expected RFC 3339 or %s", value, pgTimeFormat)
+	}
+	return t.UTC(), nil
+}
+
+// DecodeStock decodes a change notification payload. Timestamps without an
+// offset are interpreted in loc; all timestamps are returned in UTC.
+func DecodeStock(data []byte, loc *time.Location) (Stock, error) {
 	// Create an auxiliary type to avoid recursion
 	type Aux struct {
 		ID        string `json:"id"`
@@ -36,28 +172,48 @@ func (s *Stock) UnmarshalJSON(data []byte) error {
 
 	var aux Aux
 	if err := json.Unmarshal(data, &aux); err != nil {
-		return err
+		return Stock{}, err
 	}
 
 	// Parse time fields with custom format
-	createdAt, err := time.Parse(pgTimeFormat, strings.TrimSpace(aux.CreatedAt))
+	createdAt, err := ParseTimestamp(aux.CreatedAt, loc)
 	if err != nil {
-		return err
+		return Stock{}, err
 	}
 
-	updatedAt, err := time.Parse(pgTimeFormat, strings.TrimSpace(aux.UpdatedAt))
+	updatedAt, err := ParseTimestamp(aux.UpdatedAt, loc)
 	if err != nil {
-		return err
+		return Stock{}, err
 	}
 
-	// Assign values to the actual Stock struct
-	s.ID = aux.ID
-	s.ProductID = aux.ProductID
-	s.BranchID = aux.BranchID
-	s.Quantity = aux.Quantity
-	s.Reserved = aux.Reserved
-	s.CreatedAt = createdAt
-	s.UpdatedAt = updatedAt
+	return Stock{
+		ID:        aux.ID,
+		ProductID: aux.ProductID,
+		BranchID:  aux.BranchID,
+		Quantity:  aux.Quantity,
+		Reserved:  aux.Reserved,
+		CreatedAt: createdAt,
+		UpdatedAt: updatedAt,
+	}, nil
+}
 
+// UnmarshalJSON implements custom JSON unmarshaling for Stock. Timestamps
+// without an offset are taken as UTC.
+func (s *Stock) UnmarshalJSON(data []byte) error {
+	stock, err := DecodeStock(data, time.UTC)
+	if err != nil {
+		return err
+	}
+	*s = stock
 	return nil
 }
+
+// MarshalJSON encodes the stock with its timestamps in UTC, so HQ receives the
+// same representation regardless of the branch's time zone
+func (s Stock) MarshalJSON() ([]byte, error) {
+	type plain Stock
+	p := plain(s)
+	p.CreatedAt = s.CreatedAt.UTC()
+	p.UpdatedAt = s.UpdatedAt.UTC()
+	return json.Marshal(p)
+}
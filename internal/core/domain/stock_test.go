@@ -2,6 +2,8 @@ package domain_test
 
 import (
 	"encoding/json"
+	"errors"
+	"reflect"
 	"testing"
 	"time"
 
@@ -59,6 +61,28 @@ func TestStockUnmarshalJSON(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "timestamptz with offset",
+			json: `{
+				"id": "123e4567-e89b-12d3-a456-426614174000",
+				"product_id": 1,
+				"branch_id": 2,
+				"quantity": 100,
+				"reserved": 10,
+				"created_at": "2025-07-29T12:17:55.443242+07:00",
+				"updated_at": "2025-07-29T12:17:55.443242+07:00"
+			}`,
+			want: domain.Stock{
+				ID:        "123e4567-e89b-12d3-a456-426614174000",
+				ProductID: 1,
+				BranchID:  2,
+				Quantity:  100,
+				Reserved:  10,
+				CreatedAt: time.Date(2025, 7, 29, 5, 17, 55, 443242000, time.UTC),
+				UpdatedAt: time.Date(2025, 7, 29, 5, 17, 55, 443242000, time.UTC),
+			},
+			wantErr: false,
+		},
 		{
 			name: "invalid json",
 			json: `{
@@ -111,3 +135,119 @@ func TestStockUnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestParseTimestamp(t *testing.T) {
+	bangkok := time.FixedZone("ICT", 7*60*60)
+	want := time.Date(2025, 7, 29, 5, 17, 55, 443242000, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		loc   *time.Location
+	}{
+		{"naive in branch time zone", "2025-07-29T12:17:55.443242", bangkok},
+		{"naive with space separator", "2025-07-29 12:17:55.443242", bangkok},
+		{"naive without zone is UTC", "2025-07-29T05:17:55.443242", nil},
+		{"RFC 3339 ignores branch time zone", "2025-07-29T05:17:55.443242Z", bangkok},
+		{"RFC 3339 offset", "2025-07-29T07:17:55.443242+02:00", bangkok},
+		{"postgres short offset", "2025-07-29 10:17:55.443242+05", bangkok},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := domain.ParseTimestamp(tt.value, tt.loc)
+			if err != nil {
+				t.Fatalf("ParseTimestamp() error = %v", err)
+			}
+			if !got.Equal(want) || got.Location() != time.UTC {
+				t.Errorf("ParseTimestamp() = %v, want %v in UTC", got, want)
+			}
+		})
+	}
+
+	if _, err := domain.ParseTimestamp("yesterday", time.UTC); err == nil {
+		t.Error("ParseTimestamp() expected error, got nil")
+	}
+}
+
+func TestStockMarshalJSONEmitsUTC(t *testing.T) {
+	at := time.Date(2025, 7, 29, 12, 0, 0, 0, time.FixedZone("ICT", 7*60*60))
+	data, err := json.Marshal(domain.Stock{ID: "a", CreatedAt: at, UpdatedAt: at})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if got["created_at"] != "2025-07-29T05:00:00Z" || got["updated_at"] != "2025-07-29T05:00:00Z" {
+		t.Errorf("Marshal() timestamps = %v, %v, want UTC", got["created_at"], got["updated_at"])
+	}
+
+	var stock domain.Stock
+	if err := json.Unmarshal(data, &stock); err != nil || !stock.UpdatedAt.Equal(at) {
+		t.Errorf("round trip = %v, %v", stock.UpdatedAt, err)
+	}
+}
+
+func TestStockEventID(t *testing.T) {
+	updatedAt := time.Date(2025, 7, 29, 5, 17, 55, 443242000, time.UTC)
+	stock := domain.Stock{ID: "123e4567-e89b-12d3-a456-426614174000", UpdatedAt: updatedAt}
+
+	if got, want := stock.EventID(), "123e4567-e89b-12d3-a456-426614174000@1753766275443242"; got != want {
+		t.Errorf("Stock.EventID() = %v, want %v", got, want)
+	}
+
+	stock.UpdatedAt = updatedAt.Add(time.Microsecond)
+	if stock.EventID() == "123e4567-e89b-12d3-a456-426614174000@1753766275443242" {
+		t.Error("Stock.EventID() should change with UpdatedAt")
+	}
+}
+
+func TestStockAvailable(t *testing.T) {
+	stock := domain.Stock{Quantity: 100, Reserved: 30}
+	if got := stock.Available(); got != 70 {
+		t.Errorf("Available() = %d, want 70", got)
+	}
+}
+
+func TestStockValidate(t *testing.T) {
+	at := time.Date(2025, 7, 29, 5, 0, 0, 0, time.UTC)
+	valid := domain.Stock{ID: "a", ProductID: 1, BranchID: 2, Quantity: 10, Reserved: 10, CreatedAt: at, UpdatedAt: at}
+
+	tests := []struct {
+		name   string
+		modify func(*domain.Stock)
+		rules  []string
+	}{
+		{"valid", func(*domain.Stock) {}, nil},
+		{"missing id", func(s *domain.Stock) { s.ID = " " }, []string{domain.RuleID}},
+		{"invalid ids", func(s *domain.Stock) { s.ProductID, s.BranchID = 0, -1 }, []string{domain.RuleProductID, domain.RuleBranchID}},
+		{"negative quantity", func(s *domain.Stock) { s.Quantity, s.Reserved = -1, 0 }, []string{domain.RuleQuantity, domain.RuleReserved}},
+		{"negative reserved", func(s *domain.Stock) { s.Reserved = -1 }, []string{domain.RuleReserved}},
+		{"reserved exceeds quantity", func(s *domain.Stock) { s.Reserved = 11 }, []string{domain.RuleReserved}},
+		{"missing timestamp", func(s *domain.Stock) { s.CreatedAt = time.Time{} }, []string{domain.RuleTimestamps}},
+		{"updated before created", func(s *domain.Stock) { s.UpdatedAt = at.Add(-time.Second) }, []string{domain.RuleTimestamps}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stock := valid
+			tt.modify(&stock)
+			err := stock.Validate()
+			if tt.rules == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+
+			var validationErr *domain.ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Validate() error = %v, want a ValidationError", err)
+			}
+			if !reflect.DeepEqual(validationErr.Rules, tt.rules) {
+				t.Errorf("Validate() rules = %v, want %v", validationErr.Rules, tt.rules)
+			}
+		})
+	}
+}
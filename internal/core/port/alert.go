@@ -0,0 +1,18 @@
+package port
+
+import (
+	"context"
+
+	"stock-consolidation/internal/core/domain"
+)
+
+// AlertNotifier delivers alerts, e.g. to webhooks
+type AlertNotifier interface {
+	Notify(ctx context.Context, alert domain.Alert) error
+}
+
+// StockMonitor evaluates ingested stock changes and raises alerts. previous
+// is the stock the change replaced, nil when there was none.
+type StockMonitor interface {
+	Evaluate(stock domain.Stock, previous *domain.Stock)
+}
@@ -0,0 +1,23 @@
+package port
+
+import (
+	"context"
+
+	"stock-consolidation/internal/core/domain"
+)
+
+// Change is a change of a captured table other than stock, such as product
+// master data. Ctx carries the trace of the notification it was decoded from.
+type Change struct {
+	Ctx context.Context
+	// Channel is the notification channel the change was received on
+	Channel string
+	// Type is the entity type, e.g. domain.TypeProduct
+	Type   string
+	Entity domain.Entity
+}
+
+// ChangeHandler handles the decoded changes of one captured type
+type ChangeHandler interface {
+	HandleChange(ctx context.Context, change Change) error
+}
@@ -0,0 +1,110 @@
+package port
+
+import (
+	"context"
+	"errors"
+
+	"stock-consolidation/internal/core/domain"
+)
+
+// Results of ingesting a stock change at HQ
+const (
+	// IngestApplied means the change replaced the stored stock of its product and branch
+	IngestApplied = "applied"
+	// IngestDuplicate means the same change was already stored, e.g. after a retry
+	IngestDuplicate = "duplicate"
+	// IngestStale means a newer change is stored already and this one was ignored
+	IngestStale = "stale"
+)
+
+// ApplyResult is the outcome of storing a stock change
+type ApplyResult struct {
+	// Result is IngestApplied or IngestDuplicate
+	Result string
+	// Previous is the stock an applied change replaced, nil for a new row
+	Previous *domain.Stock
+}
+
+// ErrStaleStock is returned when HQ already stores a newer version of the
+// stock, or a different change with the same timestamp
+var ErrStaleStock = errors.New("a newer version of the stock is already stored")
+
+// TotalsQuery filters and paginates product totals. Zero values match everything.
+type TotalsQuery struct {
+	ProductID int
+	// BranchIDs restricts the totals to the stock of these branches
+	BranchIDs []int
+	Limit     int
+	Offset    int
+}
+
+// TotalsPage is one page of product totals and the total number of products
+type TotalsPage struct {
+	Totals []domain.ProductTotal
+	Total  int
+}
+
+// ShortageQuery selects the branch stock below its safety stock, largest
+// shortfall first. Zero values match everything.
+type ShortageQuery struct {
+	ProductID   int
+	BranchIDs   []int
+	SafetyStock domain.StockLevels
+	Limit       int
+	Offset      int
+}
+
+// ShortagePage is one page of branch stock below its safety stock and the
+// total number of such rows
+type ShortagePage struct {
+	Shortages []domain.BranchStock
+	Total     int
+}
+
+// TotalsReader sums the consolidated stock of every product over all branches
+type TotalsReader interface {
+	ProductTotals(ctx context.Context, q TotalsQuery) (TotalsPage, error)
+}
+
+// ConsolidatedStore keeps the latest stock of every product at every branch at HQ
+type ConsolidatedStore interface {
+	StockReader
+	TotalsReader
+	// ApplyStock stores stock unless a newer version is stored already. It
+	// returns ErrStaleStock when one is.
+	ApplyStock(ctx context.Context, stock domain.Stock) (ApplyResult, error)
+	// Shortages returns the branch stock below its safety stock
+	Shortages(ctx context.Context, q ShortageQuery) (ShortagePage, error)
+}
+
+// ErrUnknownRegion is returned for a region that is not configured
+var ErrUnknownRegion = errors.New("unknown region")
+
+// AggregateQuery filters and paginates the consolidated inventory. Region
+// restricts it to the branches of a configured region.
+type AggregateQuery struct {
+	ProductID int
+	Region    string
+	Limit     int
+	Offset    int
+}
+
+// InventoryAggregator aggregates the consolidated inventory of all branches
+type InventoryAggregator interface {
+	Regions() []domain.Region
+	// ProductTotals sums the stock of every product over the branches matching q
+	ProductTotals(ctx context.Context, q AggregateQuery) (TotalsPage, error)
+	// ProductBreakdown returns the total of a product by region and branch;
+	// it reports false when no branch holds the product
+	ProductBreakdown(ctx context.Context, productID int) (domain.ProductBreakdown, bool, error)
+	// Shortages returns the branch stock below its safety stock
+	Shortages(ctx context.Context, q AggregateQuery) (ShortagePage, error)
+}
+
+// StockIngester accepts the stock changes sent by the branches
+type StockIngester interface {
+	// IngestStock validates and stores stock. It returns a
+	// *domain.ValidationError for invalid stock and ErrStaleStock when a newer
+	// version is already stored.
+	IngestStock(ctx context.Context, stock domain.Stock) (string, error)
+}
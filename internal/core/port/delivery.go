@@ -0,0 +1,58 @@
+package port
+
+import (
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+)
+
+// DeliveryQuery filters the delivery history. Zero values match everything.
+type DeliveryQuery struct {
+	EventID    string
+	ProductID  int
+	BranchID   int
+	Channel    string
+	Source     string
+	Status     string
+	StatusCode int
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
+
+// Matches reports whether d satisfies every filter of the query
+func (q DeliveryQuery) Matches(d domain.Delivery) bool {
+	switch {
+	case q.EventID != "" && d.EventID != q.EventID:
+		return false
+	case q.ProductID != 0 && d.ProductID != q.ProductID:
+		return false
+	case q.BranchID != 0 && d.BranchID != q.BranchID:
+		return false
+	case q.Channel != "" && d.Channel != q.Channel:
+		return false
+	case q.Source != "" && d.Source != q.Source:
+		return false
+	case q.Status != "" && d.Status != q.Status:
+		return false
+	case q.StatusCode != 0 && d.StatusCode != q.StatusCode:
+		return false
+	case !q.From.IsZero() && d.AttemptedAt.Before(q.From):
+		return false
+	case !q.To.IsZero() && d.AttemptedAt.After(q.To):
+		return false
+	}
+	return true
+}
+
+// DeliveryRecorder records the outcome of delivery attempts
+type DeliveryRecorder interface {
+	RecordDelivery(d domain.Delivery)
+}
+
+// DeliveryHistory stores delivery attempts and answers queries about them
+type DeliveryHistory interface {
+	DeliveryRecorder
+	// QueryDeliveries returns matching attempts, newest first
+	QueryDeliveries(q DeliveryQuery) []domain.Delivery
+}
@@ -0,0 +1,7 @@
+package port
+
+// Leadership reports whether this instance is the replica that forwards
+// changes. Standby replicas receive the same notifications and drop them.
+type Leadership interface {
+	IsLeader() bool
+}
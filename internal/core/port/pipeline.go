@@ -0,0 +1,25 @@
+package port
+
+import "time"
+
+// PipelineState describes the delivery pipeline at a point in time
+type PipelineState struct {
+	Paused   bool       `json:"paused"`
+	PausedAt *time.Time `json:"paused_at,omitempty"`
+	// RateLimit is the maximum number of deliveries per second, 0 if unlimited
+	RateLimit float64 `json:"rate_limit"`
+	// Buffered is the number of changes held while delivery is paused
+	Buffered int `json:"buffered"`
+}
+
+// PipelineController pauses, resumes and throttles delivery to HQ
+type PipelineController interface {
+	// Pause stops delivery. Incoming changes are buffered until Resume.
+	Pause()
+	// Resume delivers the buffered changes and continues delivery
+	Resume()
+	// SetRateLimit changes the maximum number of deliveries per second.
+	// Zero removes the limit.
+	SetRateLimit(perSecond float64) error
+	PipelineState() PipelineState
+}
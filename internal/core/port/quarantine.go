@@ -0,0 +1,15 @@
+package port
+
+import "stock-consolidation/internal/core/domain"
+
+// Quarantine holds stock changes that failed validation so they are not sent to HQ
+type Quarantine interface {
+	Quarantine(change domain.QuarantinedChange)
+}
+
+// QuarantineStore is a Quarantine whose contents can be inspected
+type QuarantineStore interface {
+	Quarantine
+	// ListQuarantined returns at most limit changes, newest first
+	ListQuarantined(limit int) []domain.QuarantinedChange
+}
@@ -0,0 +1,31 @@
+package port
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+)
+
+// Errors returned by ReservationStore
+var (
+	ErrReservationNotFound = errors.New("reservation not found")
+	// ErrReservationClosed is returned when confirming or cancelling a
+	// reservation that is no longer active
+	ErrReservationClosed = errors.New("reservation is no longer active")
+)
+
+// ReservationStore manages reservations transactionally with the stock they reserve
+type ReservationStore interface {
+	// CreateReservation reserves r.Quantity units and stores the reservation
+	CreateReservation(ctx context.Context, r domain.Reservation) (domain.Reservation, error)
+	GetReservation(ctx context.Context, id string) (domain.Reservation, error)
+	// ConfirmReservation takes the reserved units out of stock
+	ConfirmReservation(ctx context.Context, id string) (domain.Reservation, error)
+	// CancelReservation makes the reserved units available again
+	CancelReservation(ctx context.Context, id string) (domain.Reservation, error)
+	// ReleaseExpired releases up to limit active reservations that expired
+	// before now and returns how many were released
+	ReleaseExpired(ctx context.Context, now time.Time, limit int) (int, error)
+}
@@ -3,7 +3,9 @@ package port
 
 import (
 	"context"
+	"errors"
 	"stock-consolidation/internal/core/domain"
+	"time"
 )
 
 // StockEventHandler defines the interface for handling stock events
@@ -11,8 +13,67 @@ type StockEventHandler interface {
 	HandleStockChange(ctx context.Context, stock domain.Stock) error
 }
 
+// StockChange is a stock change read from the repository. Ctx carries the
+// trace of the notification it was decoded from and may be nil.
+type StockChange struct {
+	Ctx context.Context
+	// Channel is the notification channel the change was received on
+	Channel string
+	// Source names the branch database the change was read from
+	Source string
+	Stock  domain.Stock
+}
+
 // StockRepository defines the interface for stock data operations
 type StockRepository interface {
-	ListenForChanges(ctx context.Context) (<-chan domain.Stock, error)
+	ListenForChanges(ctx context.Context) (<-chan StockChange, error)
 	Close() error
 }
+
+// Fields a StockQuery can be sorted by
+const (
+	SortProductID = "product_id"
+	SortBranchID  = "branch_id"
+	SortQuantity  = "quantity"
+	SortReserved  = "reserved"
+	SortAvailable = "available"
+	SortUpdatedAt = "updated_at"
+)
+
+// StockSortFields lists the valid values of StockQuery.Sort
+var StockSortFields = []string{SortProductID, SortBranchID, SortQuantity, SortReserved, SortAvailable, SortUpdatedAt}
+
+// StockQuery filters, sorts and paginates stock rows. Zero values match everything.
+type StockQuery struct {
+	ProductID    int
+	BranchID     int
+	MinAvailable *int
+	UpdatedSince time.Time
+	// Sort is one of StockSortFields; rows are ordered by product and branch by default
+	Sort   string
+	Desc   bool
+	Limit  int
+	Offset int
+}
+
+// StockPage is one page of stock rows and the total number of matching rows
+type StockPage struct {
+	Stocks []domain.Stock
+	Total  int
+}
+
+// StockReader reads the current stock levels from the branch database
+type StockReader interface {
+	ListStocks(ctx context.Context, q StockQuery) (StockPage, error)
+}
+
+// ErrStockConflict is returned when stock was changed after the version the caller expected
+var ErrStockConflict = errors.New("stock was modified since it was read")
+
+// StockWriter changes stock levels in the branch database. The stock trigger
+// then forwards the change to HQ like any other update.
+type StockWriter interface {
+	// AdjustStock applies adj and records it with its reason. Rows that do not
+	// exist yet are created from zero unless adj expects a previous version.
+	AdjustStock(ctx context.Context, adj domain.Adjustment) (domain.Stock, error)
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/config"
+)
+
+// breakdownPageSize is the number of branch rows read per query for a product breakdown
+const breakdownPageSize = 500
+
+// Aggregator aggregates the consolidated stock by product, region and branch
+// and compares it to the configured safety stock
+type Aggregator struct {
+	store    port.ConsolidatedStore
+	regions  []domain.Region
+	regionOf map[int]string
+	safety   domain.StockLevels
+}
+
+// NewAggregator creates an Aggregator over store with the regions and safety
+// stock of cfg
+func NewAggregator(store port.ConsolidatedStore, cfg *config.ReceiverConfig) *Aggregator {
+	a := &Aggregator{
+		store:    store,
+		regions:  []domain.Region{},
+		regionOf: make(map[int]string),
+		safety: domain.StockLevels{
+			Default:  cfg.SafetyStock.Default,
+			Products: cfg.SafetyStock.Products,
+			Branches: cfg.SafetyStock.Branches,
+		},
+	}
+	for _, region := range cfg.Regions {
+		a.regions = append(a.regions, domain.Region{Name: region.Name, BranchIDs: region.BranchIDs})
+		for _, id := range region.BranchIDs {
+			a.regionOf[id] = region.Name
+		}
+	}
+	return a
+}
+
+// Regions returns the configured regions
+func (a *Aggregator) Regions() []domain.Region {
+	return a.regions
+}
+
+// branchIDs returns the branches of the region called name, or nil for ""
+func (a *Aggregator) branchIDs(name string) ([]int, error) {
+	if name == "" {
+		return nil, nil
+	}
+	for _, region := range a.regions {
+		if region.Name == name {
+			return region.BranchIDs, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", port.ErrUnknownRegion, name)
+}
+
+// ProductTotals sums the stock of every product over all branches, or over
+// the branches of q.Region
+func (a *Aggregator) ProductTotals(ctx context.Context, q port.AggregateQuery) (port.TotalsPage, error) {
+	branchIDs, err := a.branchIDs(q.Region)
+	if err != nil {
+		return port.TotalsPage{}, err
+	}
+	return a.store.ProductTotals(ctx, port.TotalsQuery{
+		ProductID: q.ProductID,
+		BranchIDs: branchIDs,
+		Limit:     q.Limit,
+		Offset:    q.Offset,
+	})
+}
+
+// ProductBreakdown returns the total of a product with the stock of each
+// branch and the totals of each region holding it. It reports false when no
+// branch holds the product.
+func (a *Aggregator) ProductBreakdown(ctx context.Context, productID int) (domain.ProductBreakdown, bool, error) {
+	breakdown := domain.ProductBreakdown{
+		ProductTotal: domain.ProductTotal{ProductID: productID},
+		ByRegion:     []domain.RegionTotal{},
+		ByBranch:     []domain.BranchStock{},
+	}
+	q := port.StockQuery{ProductID: productID, Sort: port.SortBranchID, Limit: breakdownPageSize}
+	for {
+		page, err := a.store.ListStocks(ctx, q)
+		if err != nil {
+			return breakdown, false, err
+		}
+		for _, stock := range page.Stocks {
+			branch := domain.NewBranchStock(stock, a.safety.For(stock.ProductID, stock.BranchID))
+			branch.Region = a.regionOf[stock.BranchID]
+			breakdown.ByBranch = append(breakdown.ByBranch, branch)
+		}
+		q.Offset += len(page.Stocks)
+		if len(page.Stocks) == 0 || q.Offset >= page.Total {
+			break
+		}
+	}
+	if len(breakdown.ByBranch) == 0 {
+		return breakdown, false, nil
+	}
+
+	regionTotals := make(map[string]*domain.RegionTotal)
+	for _, branch := range breakdown.ByBranch {
+		breakdown.Branches++
+		breakdown.Quantity += branch.Quantity
+		breakdown.Reserved += branch.Reserved
+		breakdown.Available += branch.Available
+		if branch.UpdatedAt.After(breakdown.UpdatedAt) {
+			breakdown.UpdatedAt = branch.UpdatedAt
+		}
+		if branch.BelowSafetyStock() {
+			breakdown.BelowSafetyStock++
+		}
+
+		if branch.Region == "" {
+			continue
+		}
+		total, ok := regionTotals[branch.Region]
+		if !ok {
+			total = &domain.RegionTotal{Region: branch.Region}
+			regionTotals[branch.Region] = total
+		}
+		total.Branches++
+		total.Quantity += branch.Quantity
+		total.Reserved += branch.Reserved
+		total.Available += branch.Available
+		if branch.BelowSafetyStock() {
+			total.BelowSafetyStock++
+		}
+	}
+	// Regions are listed in configuration order
+	for _, region := range a.regions {
+		if total, ok := regionTotals[region.Name]; ok {
+			breakdown.ByRegion = append(breakdown.ByRegion, *total)
+		}
+	}
+	return breakdown, true, nil
+}
+
+// Shortages returns the branch stock below its safety stock, largest
+// shortfall first, in all branches or in those of q.Region
+func (a *Aggregator) Shortages(ctx context.Context, q port.AggregateQuery) (port.ShortagePage, error) {
+	branchIDs, err := a.branchIDs(q.Region)
+	if err != nil {
+		return port.ShortagePage{}, err
+	}
+	page, err := a.store.Shortages(ctx, port.ShortageQuery{
+		ProductID:   q.ProductID,
+		BranchIDs:   branchIDs,
+		SafetyStock: a.safety,
+		Limit:       q.Limit,
+		Offset:      q.Offset,
+	})
+	for i := range page.Shortages {
+		page.Shortages[i].Region = a.regionOf[page.Shortages[i].BranchID]
+	}
+	return page, err
+}
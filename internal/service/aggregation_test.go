@@ -0,0 +1,97 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/internal/service"
+	"stock-consolidation/pkg/config"
+)
+
+func newAggregator(t *testing.T, stocks ...domain.Stock) (*service.Aggregator, *fakeConsolidatedStore) {
+	t.Helper()
+	store := &fakeConsolidatedStore{stocks: map[[2]int]domain.Stock{}}
+	for _, stock := range stocks {
+		store.stocks[[2]int{stock.ProductID, stock.BranchID}] = stock
+	}
+	cfg := &config.ReceiverConfig{
+		Regions: []config.Region{
+			{Name: "north", BranchIDs: []int{1, 2}},
+			{Name: "south", BranchIDs: []int{3}},
+		},
+		SafetyStock: config.StockLevels{Default: 5, Products: map[int]int{42: 20}},
+	}
+	return service.NewAggregator(store, cfg), store
+}
+
+func TestAggregator_ProductBreakdown(t *testing.T) {
+	updated := time.Date(2025, 7, 29, 10, 0, 0, 0, time.UTC)
+	a, _ := newAggregator(t,
+		domain.Stock{ProductID: 42, BranchID: 1, Quantity: 30, Reserved: 5, UpdatedAt: updated},
+		domain.Stock{ProductID: 42, BranchID: 2, Quantity: 10, UpdatedAt: updated.Add(time.Hour)},
+		domain.Stock{ProductID: 42, BranchID: 4, Quantity: 8, Reserved: 8, UpdatedAt: updated},
+		domain.Stock{ProductID: 7, BranchID: 3, Quantity: 1, UpdatedAt: updated},
+	)
+
+	breakdown, ok, err := a.ProductBreakdown(context.Background(), 42)
+	if err != nil || !ok {
+		t.Fatalf("ProductBreakdown() = %v, %v", ok, err)
+	}
+	want := domain.ProductTotal{ProductID: 42, Branches: 3, Quantity: 48, Reserved: 13, Available: 35, UpdatedAt: updated.Add(time.Hour)}
+	if breakdown.ProductTotal != want {
+		t.Errorf("ProductTotal = %+v, want %+v", breakdown.ProductTotal, want)
+	}
+	if breakdown.BelowSafetyStock != 2 {
+		t.Errorf("BelowSafetyStock = %d, want branches 2 and 4", breakdown.BelowSafetyStock)
+	}
+	// Branch 4 has no region and only counts towards the product total
+	if len(breakdown.ByRegion) != 1 || breakdown.ByRegion[0] != (domain.RegionTotal{
+		Region: "north", Branches: 2, Quantity: 40, Reserved: 5, Available: 35, BelowSafetyStock: 1,
+	}) {
+		t.Errorf("ByRegion = %+v", breakdown.ByRegion)
+	}
+	if len(breakdown.ByBranch) != 3 || breakdown.ByBranch[1].Region != "north" || breakdown.ByBranch[1].Shortfall != 10 ||
+		breakdown.ByBranch[2].Region != "" || breakdown.ByBranch[2].SafetyStock != 20 {
+		t.Errorf("ByBranch = %+v", breakdown.ByBranch)
+	}
+
+	if _, ok, err := a.ProductBreakdown(context.Background(), 99); ok || err != nil {
+		t.Errorf("ProductBreakdown() of an unknown product = %v, %v, want false", ok, err)
+	}
+}
+
+func TestAggregator_Regions(t *testing.T) {
+	a, store := newAggregator(t,
+		domain.Stock{ProductID: 7, BranchID: 3, Quantity: 1},
+		domain.Stock{ProductID: 7, BranchID: 1, Quantity: 9},
+	)
+	ctx := context.Background()
+
+	if _, err := a.ProductTotals(ctx, port.AggregateQuery{Region: "south", Limit: 10}); err != nil {
+		t.Fatalf("ProductTotals() error = %v", err)
+	}
+	if ids := store.totalsQuery.BranchIDs; len(ids) != 1 || ids[0] != 3 {
+		t.Errorf("totals of south queried branches %v, want [3]", ids)
+	}
+	if _, err := a.ProductTotals(ctx, port.AggregateQuery{Region: "east"}); !errors.Is(err, port.ErrUnknownRegion) {
+		t.Errorf("ProductTotals() of an unknown region error = %v, want ErrUnknownRegion", err)
+	}
+
+	page, err := a.Shortages(ctx, port.AggregateQuery{Region: "south"})
+	if err != nil {
+		t.Fatalf("Shortages() error = %v", err)
+	}
+	if store.shortageQuery.SafetyStock.Default != 5 || len(store.shortageQuery.BranchIDs) != 1 {
+		t.Errorf("shortage query = %+v", store.shortageQuery)
+	}
+	if page.Total != 1 || page.Shortages[0].Region != "south" || page.Shortages[0].Shortfall != 4 {
+		t.Errorf("Shortages() = %+v, want branch 3 of south 4 units short", page)
+	}
+	if regions := a.Regions(); len(regions) != 2 || regions[1].Name != "south" {
+		t.Errorf("Regions() = %+v", regions)
+	}
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/config"
+	"stock-consolidation/pkg/logger"
+	"stock-consolidation/pkg/metrics"
+)
+
+// alertQueueSize is the number of alerts waiting to be sent before new ones are dropped
+const alertQueueSize = 256
+
+// Alerter raises alerts for low, suddenly dropping and negative available
+// stock and sends them through a notifier. Low and negative stock are
+// conditions: they are reported once when they start and again only after
+// they recovered. No alert of the same kind for the same product and branch
+// is sent twice within the cooldown; a condition held back by the cooldown is
+// reported with the first change after it that still meets the condition.
+type Alerter struct {
+	notifier     port.AlertNotifier
+	lowStock     domain.StockLevels
+	dropPercent  int
+	dropMinUnits int
+	cooldown     time.Duration
+	regionOf     map[int]string
+	queue        chan domain.Alert
+
+	mu sync.Mutex
+	// active holds the keys of the conditions whose alert was queued
+	active   map[string]bool
+	lastSent map[string]time.Time
+}
+
+// NewAlerter creates an Alerter with the alert settings and regions of cfg
+func NewAlerter(notifier port.AlertNotifier, cfg *config.ReceiverConfig) *Alerter {
+	a := &Alerter{
+		notifier: notifier,
+		lowStock: domain.StockLevels{
+			Default:  cfg.Alert.LowStock.Default,
+			Products: cfg.Alert.LowStock.Products,
+			Branches: cfg.Alert.LowStock.Branches,
+		},
+		dropPercent:  cfg.Alert.DropPercent,
+		dropMinUnits: cfg.Alert.DropMinUnits,
+		cooldown:     cfg.Alert.Cooldown,
+		regionOf:     make(map[int]string),
+		queue:        make(chan domain.Alert, alertQueueSize),
+		active:       make(map[string]bool),
+		lastSent:     make(map[string]time.Time),
+	}
+	for _, region := range cfg.Regions {
+		for _, id := range region.BranchIDs {
+			a.regionOf[id] = region.Name
+		}
+	}
+	return a
+}
+
+// Evaluate checks a stock change against the alert thresholds and queues the
+// alerts it raises. previous is the stock the change replaced, nil when there
+// was none.
+func (a *Alerter) Evaluate(stock domain.Stock, previous *domain.Stock) {
+	now := time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Negative stock is rejected and not stored, so the other checks do not apply
+	if stock.Available() < 0 {
+		a.condition(domain.NewAlert(domain.AlertNegativeAvailable, stock, 0, nil, now), true)
+		return
+	}
+	a.condition(domain.NewAlert(domain.AlertNegativeAvailable, stock, 0, nil, now), false)
+
+	threshold := a.lowStock.For(stock.ProductID, stock.BranchID)
+	low := stock.Available() < threshold
+	a.condition(domain.NewAlert(domain.AlertLowStock, stock, threshold, nil, now), low)
+
+	if a.suddenDrop(stock, previous) {
+		a.raise(domain.NewAlert(domain.AlertSuddenDrop, stock, 0, previous, now))
+	}
+}
+
+// suddenDrop reports whether stock removed at least the configured share and
+// number of the available units of previous
+func (a *Alerter) suddenDrop(stock domain.Stock, previous *domain.Stock) bool {
+	if a.dropPercent == 0 || previous == nil || previous.Available() <= 0 {
+		return false
+	}
+	drop := previous.Available() - stock.Available()
+	return drop > 0 && drop >= a.dropMinUnits && drop*100 >= previous.Available()*a.dropPercent
+}
+
+// condition raises alert while its condition holds until the alert is queued,
+// and forgets it when it recovers. The caller holds a.mu.
+func (a *Alerter) condition(alert domain.Alert, holds bool) {
+	key := alert.Key()
+	if !holds {
+		delete(a.active, key)
+		return
+	}
+	if a.active[key] {
+		return
+	}
+	if a.raise(alert) {
+		a.active[key] = true
+	}
+}
+
+// raise queues alert unless one with the same key was sent within the
+// cooldown, and reports whether it was queued. The caller holds a.mu.
+func (a *Alerter) raise(alert domain.Alert) bool {
+	key := alert.Key()
+	if last, ok := a.lastSent[key]; ok && alert.TriggeredAt.Sub(last) < a.cooldown {
+		logger.WithFields(logger.Fields{"alert": key}).Debug("Suppressed alert within cooldown")
+		return false
+	}
+	alert.Region = a.regionOf[alert.BranchID]
+
+	metrics.AlertsRaised.WithLabelValues(alert.Kind).Inc()
+	select {
+	case a.queue <- alert:
+		// A dropped alert does not start the cooldown
+		a.lastSent[key] = alert.TriggeredAt
+		return true
+	default:
+		metrics.AlertNotifications.WithLabelValues(metrics.ResultDropped).Inc()
+		logger.WithFields(logger.Fields{"alert": key}).Warn("Dropped alert, the notification queue is full")
+		return false
+	}
+}
+
+// Run sends the queued alerts until ctx is cancelled
+func (a *Alerter) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case alert := <-a.queue:
+			if err := a.notifier.Notify(ctx, alert); err != nil {
+				logger.WithFields(logger.Fields{"alert": alert.Key(), "error": err}).Error("Failed to send alert")
+			}
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/service"
+	"stock-consolidation/pkg/config"
+)
+
+// channelNotifier passes the alerts it is sent to a channel
+type channelNotifier struct {
+	alerts chan domain.Alert
+	err    error
+}
+
+func (n *channelNotifier) Notify(_ context.Context, alert domain.Alert) error {
+	n.alerts <- alert
+	return n.err
+}
+
+// markerProductID identifies the alert raiseAll evaluates last
+const markerProductID = 999
+
+// raiseAll evaluates the batches of changes, each change against the one
+// before it of the same product and branch, and returns the alerts sent for
+// them. Each batch after the first is evaluated once the cooldown passed. A
+// negative stock marker evaluated last tells when all alerts were sent.
+func raiseAll(t *testing.T, cfg *config.ReceiverConfig, batches ...[]domain.Stock) []domain.Alert {
+	t.Helper()
+	notifier := &channelNotifier{alerts: make(chan domain.Alert, 16), err: errors.New("webhook down")}
+	alerter := service.NewAlerter(notifier, cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go alerter.Run(ctx)
+
+	stored := make(map[[2]int]domain.Stock)
+	for i, changes := range batches {
+		if i > 0 && len(changes) > 0 {
+			time.Sleep(cfg.Alert.Cooldown)
+		}
+		for _, stock := range changes {
+			key := [2]int{stock.ProductID, stock.BranchID}
+			var previous *domain.Stock
+			if before, ok := stored[key]; ok {
+				previous = &before
+			}
+			alerter.Evaluate(stock, previous)
+			if stock.Available() >= 0 {
+				stored[key] = stock
+			}
+		}
+	}
+	alerter.Evaluate(domain.Stock{ProductID: markerProductID, BranchID: 1, Reserved: 1}, nil)
+
+	var alerts []domain.Alert
+	for {
+		select {
+		case alert := <-notifier.alerts:
+			if alert.ProductID == markerProductID {
+				return alerts
+			}
+			alerts = append(alerts, alert)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for alerts, got %+v", alerts)
+		}
+	}
+}
+
+func stockAt(available, reserved int) domain.Stock {
+	return domain.Stock{ID: "a", ProductID: 1, BranchID: 2, Quantity: available + reserved, Reserved: reserved}
+}
+
+func kinds(alerts []domain.Alert) []string {
+	var kinds []string
+	for _, alert := range alerts {
+		kinds = append(kinds, alert.Kind)
+	}
+	return kinds
+}
+
+func TestAlerter(t *testing.T) {
+	tests := []struct {
+		name    string
+		alert   config.AlertConfig
+		changes []domain.Stock
+		// later are evaluated after the cooldown passed
+		later []domain.Stock
+		want  []string
+	}{
+		{
+			name:    "low stock is reported once while it lasts",
+			alert:   config.AlertConfig{LowStock: config.StockLevels{Default: 5}, Cooldown: time.Nanosecond},
+			changes: []domain.Stock{stockAt(10, 0), stockAt(4, 0), stockAt(3, 0), stockAt(8, 0), stockAt(2, 0)},
+			want:    []string{domain.AlertLowStock, domain.AlertLowStock},
+		},
+		{
+			name:    "recurring low stock waits for the cooldown",
+			alert:   config.AlertConfig{LowStock: config.StockLevels{Default: 5}, Cooldown: time.Hour},
+			changes: []domain.Stock{stockAt(4, 0), stockAt(8, 0), stockAt(2, 0)},
+			want:    []string{domain.AlertLowStock},
+		},
+		{
+			name:    "recurring low stock is reported once the cooldown passed",
+			alert:   config.AlertConfig{LowStock: config.StockLevels{Default: 5}, Cooldown: 50 * time.Millisecond},
+			changes: []domain.Stock{stockAt(4, 0), stockAt(8, 0), stockAt(2, 0)},
+			later:   []domain.Stock{stockAt(1, 0), stockAt(0, 0)},
+			want:    []string{domain.AlertLowStock, domain.AlertLowStock},
+		},
+		{
+			name: "product level overrides the default",
+			alert: config.AlertConfig{
+				LowStock: config.StockLevels{Default: 5, Products: map[int]int{1: 0}},
+				Cooldown: time.Hour,
+			},
+			changes: []domain.Stock{stockAt(1, 0)},
+		},
+		{
+			name:    "sudden drop",
+			alert:   config.AlertConfig{DropPercent: 50, DropMinUnits: 10, Cooldown: time.Nanosecond},
+			changes: []domain.Stock{stockAt(100, 0), stockAt(50, 0), stockAt(30, 0), stockAt(16, 0), stockAt(8, 0)},
+			want:    []string{domain.AlertSuddenDrop},
+		},
+		{
+			name:    "reserving units counts as a drop",
+			alert:   config.AlertConfig{DropPercent: 50, Cooldown: time.Nanosecond},
+			changes: []domain.Stock{stockAt(10, 0), stockAt(4, 6)},
+			want:    []string{domain.AlertSuddenDrop},
+		},
+		{
+			name:    "drops are disabled by default",
+			alert:   config.AlertConfig{Cooldown: time.Nanosecond},
+			changes: []domain.Stock{stockAt(100, 0), stockAt(0, 0)},
+		},
+		{
+			name:    "negative available stock only raises its own alert",
+			alert:   config.AlertConfig{LowStock: config.StockLevels{Default: 5}, DropPercent: 10, Cooldown: time.Hour},
+			changes: []domain.Stock{stockAt(10, 0), stockAt(-2, 4), stockAt(-3, 5)},
+			want:    []string{domain.AlertNegativeAvailable},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alerts := raiseAll(t, &config.ReceiverConfig{Alert: tt.alert}, tt.changes, tt.later)
+			got := kinds(alerts)
+			if len(got) != len(tt.want) {
+				t.Fatalf("alerts = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("alerts = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAlerter_AlertContent(t *testing.T) {
+	cfg := &config.ReceiverConfig{
+		Regions: []config.Region{{Name: "north", BranchIDs: []int{2}}},
+		Alert:   config.AlertConfig{LowStock: config.StockLevels{Default: 20}, DropPercent: 50, Cooldown: time.Hour},
+	}
+	alerts := raiseAll(t, cfg, []domain.Stock{stockAt(30, 0), stockAt(6, 4)})
+	if len(alerts) != 2 {
+		t.Fatalf("alerts = %+v, want low stock and sudden drop", alerts)
+	}
+
+	low, drop := alerts[0], alerts[1]
+	if low.Kind != domain.AlertLowStock || low.Available != 6 || low.Threshold != 20 || low.Region != "north" {
+		t.Errorf("low stock alert = %+v", low)
+	}
+	if drop.Kind != domain.AlertSuddenDrop || drop.PreviousAvailable == nil || *drop.PreviousAvailable != 30 {
+		t.Errorf("sudden drop alert = %+v", drop)
+	}
+	if drop.Message == "" || drop.Text != drop.Message || drop.Key() != "sudden_drop:1:2" {
+		t.Errorf("sudden drop alert = %+v, want a message repeated as text", drop)
+	}
+}
+
+func TestAlerter_DroppedAlertIsRaisedAgain(t *testing.T) {
+	notifier := &channelNotifier{alerts: make(chan domain.Alert, 512)}
+	alerter := service.NewAlerter(notifier, &config.ReceiverConfig{
+		Alert: config.AlertConfig{LowStock: config.StockLevels{Default: 5}, Cooldown: time.Hour},
+	})
+
+	// Fill the queue of 256 alerts before any is sent, so the next one is dropped
+	const queued = 256
+	for i := 0; i < queued; i++ {
+		alerter.Evaluate(domain.Stock{ProductID: 100 + i, BranchID: 2}, nil)
+	}
+	alerter.Evaluate(stockAt(1, 0), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go alerter.Run(ctx)
+	for i := 0; i < queued; i++ {
+		select {
+		case <-notifier.alerts:
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for the queued alerts, got %d", i)
+		}
+	}
+
+	// The dropped low stock is still pending and raised with the next change
+	alerter.Evaluate(stockAt(2, 0), nil)
+	select {
+	case alert := <-notifier.alerts:
+		if alert.Kind != domain.AlertLowStock || alert.ProductID != 1 {
+			t.Errorf("alert = %+v, want low stock of product 1", alert)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the dropped low stock alert was not raised again")
+	}
+}
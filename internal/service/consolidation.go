@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/logger"
+	"stock-consolidation/pkg/metrics"
+)
+
+// Consolidator stores the stock changes the branches send to HQ
+type Consolidator struct {
+	store   port.ConsolidatedStore
+	monitor port.StockMonitor
+}
+
+// ConsolidatorOption configures optional dependencies of the Consolidator
+type ConsolidatorOption func(*Consolidator)
+
+// WithStockMonitor has monitor evaluate every applied stock change and every
+// change rejected for negative available stock
+func WithStockMonitor(monitor port.StockMonitor) ConsolidatorOption {
+	return func(c *Consolidator) {
+		c.monitor = monitor
+	}
+}
+
+// NewConsolidator creates a Consolidator writing to store
+func NewConsolidator(store port.ConsolidatedStore, opts ...ConsolidatorOption) *Consolidator {
+	c := &Consolidator{store: store}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// IngestStock validates stock and stores it unless a newer version of the
+// same product and branch is stored already
+func (c *Consolidator) IngestStock(ctx context.Context, stock domain.Stock) (string, error) {
+	log := logger.WithFields(stock.LogFields())
+	if err := stock.Validate(); err != nil {
+		metrics.IngestedChanges.WithLabelValues(metrics.ResultInvalid).Inc()
+		log.WithFields(logger.Fields{"error": err}).Warn("Rejected invalid stock change")
+		if c.monitor != nil && stock.ProductID > 0 && stock.BranchID > 0 && stock.Available() < 0 {
+			c.monitor.Evaluate(stock, nil)
+		}
+		return "", err
+	}
+
+	applied, err := c.store.ApplyStock(ctx, stock)
+	switch {
+	case errors.Is(err, port.ErrStaleStock):
+		metrics.IngestedChanges.WithLabelValues(metrics.ResultStale).Inc()
+		log.Debug("Ignored stale stock change")
+		return "", err
+	case err != nil:
+		return "", err
+	}
+
+	metrics.IngestedChanges.WithLabelValues(applied.Result).Inc()
+	if applied.Result == port.IngestApplied {
+		metrics.IngestLag.Observe(time.Since(stock.UpdatedAt).Seconds())
+		log.Debug("Applied stock change")
+		if c.monitor != nil {
+			c.monitor.Evaluate(stock, applied.Previous)
+		}
+	}
+	return applied.Result, nil
+}
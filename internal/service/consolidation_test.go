@@ -0,0 +1,173 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/internal/service"
+)
+
+// fakeConsolidatedStore keeps the latest stock per product and branch
+type fakeConsolidatedStore struct {
+	stocks map[[2]int]domain.Stock
+	err    error
+
+	totalsQuery   port.TotalsQuery
+	shortageQuery port.ShortageQuery
+}
+
+func (f *fakeConsolidatedStore) ApplyStock(_ context.Context, stock domain.Stock) (port.ApplyResult, error) {
+	if f.err != nil {
+		return port.ApplyResult{}, f.err
+	}
+	key := [2]int{stock.ProductID, stock.BranchID}
+	stored, ok := f.stocks[key]
+	switch {
+	case ok && stored == stock:
+		return port.ApplyResult{Result: port.IngestDuplicate}, nil
+	case ok && !stored.UpdatedAt.Before(stock.UpdatedAt):
+		return port.ApplyResult{}, port.ErrStaleStock
+	}
+	f.stocks[key] = stock
+	result := port.ApplyResult{Result: port.IngestApplied}
+	if ok {
+		result.Previous = &stored
+	}
+	return result, nil
+}
+
+// ListStocks returns the stock of q.ProductID ordered by branch
+func (f *fakeConsolidatedStore) ListStocks(_ context.Context, q port.StockQuery) (port.StockPage, error) {
+	var matches []domain.Stock
+	for _, stock := range f.stocks {
+		if q.ProductID == 0 || stock.ProductID == q.ProductID {
+			matches = append(matches, stock)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].BranchID < matches[j].BranchID })
+
+	page := port.StockPage{Stocks: []domain.Stock{}, Total: len(matches)}
+	for i := q.Offset; i < len(matches) && i < q.Offset+q.Limit; i++ {
+		page.Stocks = append(page.Stocks, matches[i])
+	}
+	return page, nil
+}
+
+func (f *fakeConsolidatedStore) ProductTotals(_ context.Context, q port.TotalsQuery) (port.TotalsPage, error) {
+	f.totalsQuery = q
+	return port.TotalsPage{}, nil
+}
+
+func (f *fakeConsolidatedStore) Shortages(_ context.Context, q port.ShortageQuery) (port.ShortagePage, error) {
+	f.shortageQuery = q
+	page := port.ShortagePage{Shortages: []domain.BranchStock{}}
+	for _, stock := range f.stocks {
+		if len(q.BranchIDs) > 0 && !containsInt(q.BranchIDs, stock.BranchID) {
+			continue
+		}
+		branch := domain.NewBranchStock(stock, q.SafetyStock.For(stock.ProductID, stock.BranchID))
+		if branch.BelowSafetyStock() {
+			page.Shortages = append(page.Shortages, branch)
+		}
+	}
+	page.Total = len(page.Shortages)
+	return page, f.err
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func TestConsolidator_IngestStock(t *testing.T) {
+	updated := time.Date(2025, 7, 29, 10, 0, 0, 0, time.UTC)
+	stock := domain.Stock{ID: "a", ProductID: 1, BranchID: 2, Quantity: 10, CreatedAt: updated, UpdatedAt: updated}
+	store := &fakeConsolidatedStore{stocks: map[[2]int]domain.Stock{}}
+	c := service.NewConsolidator(store)
+	ctx := context.Background()
+
+	if result, err := c.IngestStock(ctx, stock); err != nil || result != port.IngestApplied {
+		t.Errorf("first IngestStock() = %q, %v, want applied", result, err)
+	}
+	if result, err := c.IngestStock(ctx, stock); err != nil || result != port.IngestDuplicate {
+		t.Errorf("resent IngestStock() = %q, %v, want duplicate", result, err)
+	}
+
+	older := stock
+	older.Quantity = 4
+	older.UpdatedAt = updated.Add(-time.Minute)
+	older.CreatedAt = older.UpdatedAt
+	if _, err := c.IngestStock(ctx, older); !errors.Is(err, port.ErrStaleStock) {
+		t.Errorf("older IngestStock() error = %v, want ErrStaleStock", err)
+	}
+
+	invalid := stock
+	invalid.Reserved = 20
+	var validationErr *domain.ValidationError
+	if _, err := c.IngestStock(ctx, invalid); !errors.As(err, &validationErr) {
+		t.Errorf("invalid IngestStock() error = %v, want *domain.ValidationError", err)
+	}
+	if got := store.stocks[[2]int{1, 2}]; got != stock {
+		t.Errorf("stored stock = %+v, want %+v", got, stock)
+	}
+
+	store.err = errors.New("connection reset")
+	if _, err := c.IngestStock(ctx, stock); err == nil {
+		t.Error("IngestStock() error = nil, want store error")
+	}
+}
+
+// evaluation is a stock change passed to a StockMonitor
+type evaluation struct {
+	stock    domain.Stock
+	previous *domain.Stock
+}
+
+// recordingMonitor records the stock changes it evaluates
+type recordingMonitor struct {
+	evaluations []evaluation
+}
+
+func (m *recordingMonitor) Evaluate(stock domain.Stock, previous *domain.Stock) {
+	m.evaluations = append(m.evaluations, evaluation{stock, previous})
+}
+
+func TestConsolidator_StockMonitor(t *testing.T) {
+	updated := time.Date(2025, 7, 29, 10, 0, 0, 0, time.UTC)
+	first := domain.Stock{ID: "a", ProductID: 1, BranchID: 2, Quantity: 10, Reserved: 3, CreatedAt: updated, UpdatedAt: updated}
+	second := first
+	second.Quantity = 4
+	second.UpdatedAt = updated.Add(time.Minute)
+	negative := second
+	negative.Reserved = 6
+	negative.UpdatedAt = updated.Add(2 * time.Minute)
+	noProduct := negative
+	noProduct.ProductID = 0
+
+	monitor := &recordingMonitor{}
+	c := service.NewConsolidator(&fakeConsolidatedStore{stocks: make(map[[2]int]domain.Stock)}, service.WithStockMonitor(monitor))
+	for _, stock := range []domain.Stock{first, first, second, first, negative, noProduct} {
+		_, _ = c.IngestStock(context.Background(), stock)
+	}
+
+	// Duplicates, stale changes and unidentifiable stock are not evaluated
+	want := []evaluation{{first, nil}, {second, &first}, {negative, nil}}
+	if len(monitor.evaluations) != len(want) {
+		t.Fatalf("evaluations = %+v, want %+v", monitor.evaluations, want)
+	}
+	for i, got := range monitor.evaluations {
+		if got.stock != want[i].stock || (got.previous == nil) != (want[i].previous == nil) ||
+			(got.previous != nil && *got.previous != *want[i].previous) {
+			t.Errorf("evaluation %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"context"
+
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/logger"
+	"stock-consolidation/pkg/metrics"
+)
+
+// leaderOnly passes changes to its handler only while this instance is the leader
+type leaderOnly struct {
+	handler port.ChangeHandler
+	leader  port.Leadership
+}
+
+// LeaderOnly wraps handler so that standby instances drop captured changes
+// instead of forwarding them a second time
+func LeaderOnly(handler port.ChangeHandler, leader port.Leadership) port.ChangeHandler {
+	return leaderOnly{handler: handler, leader: leader}
+}
+
+// HandleChange forwards change to the wrapped handler when this instance leads
+func (h leaderOnly) HandleChange(ctx context.Context, change port.Change) error {
+	if !h.leader.IsLeader() {
+		metrics.StandbySkippedChanges.WithLabelValues(change.Type).Inc()
+		logger.WithFields(change.Entity.LogFields()).Debug("Skipping captured change: standby instance")
+		return nil
+	}
+	return h.handler.HandleChange(ctx, change)
+}
@@ -0,0 +1,53 @@
+package service_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/internal/service"
+)
+
+// fakeLeadership is the leader while leader is set
+type fakeLeadership struct {
+	leader atomic.Bool
+}
+
+func (f *fakeLeadership) IsLeader() bool {
+	return f.leader.Load()
+}
+
+// countingHandler counts the changes it handles
+type countingHandler struct {
+	handled atomic.Int32
+}
+
+func (h *countingHandler) HandleChange(_ context.Context, _ port.Change) error {
+	h.handled.Add(1)
+	return nil
+}
+
+func TestLeaderOnly(t *testing.T) {
+	leader := &fakeLeadership{}
+	next := &countingHandler{}
+	handler := service.LeaderOnly(next, leader)
+	change := port.Change{Type: domain.TypeProduct, Entity: domain.Product{ID: 7, UpdatedAt: time.Now()}}
+
+	if err := handler.HandleChange(context.Background(), change); err != nil {
+		t.Fatalf("HandleChange() error = %v", err)
+	}
+	if next.handled.Load() != 0 {
+		t.Error("HandleChange() forwarded a change on a standby")
+	}
+
+	leader.leader.Store(true)
+	if err := handler.HandleChange(context.Background(), change); err != nil {
+		t.Fatalf("HandleChange() error = %v", err)
+	}
+	if next.handled.Load() != 1 {
+		t.Errorf("handled %d changes as leader, want 1", next.handled.Load())
+	}
+}
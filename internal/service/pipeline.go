@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/logger"
+	"stock-consolidation/pkg/metrics"
+
+	"golang.org/x/time/rate"
+)
+
+// pipeline holds the runtime controls of the delivery loop
+type pipeline struct {
+	mu       sync.Mutex
+	paused   bool
+	pausedAt time.Time
+	// resumed wakes the delivery loop so it flushes the buffered changes
+	resumed chan struct{}
+	// running is closed while delivery is not paused
+	running chan struct{}
+
+	limiter  *rate.Limiter
+	buffered atomic.Int64
+}
+
+func newPipeline(perSecond float64) *pipeline {
+	running := make(chan struct{})
+	close(running)
+	return &pipeline{
+		resumed: make(chan struct{}, 1),
+		running: running,
+		limiter: rate.NewLimiter(toLimit(perSecond), 1),
+	}
+}
+
+// toLimit converts a rate in deliveries per second to a rate.Limit, where 0
+// means unlimited
+func toLimit(perSecond float64) rate.Limit {
+	if perSecond <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(perSecond)
+}
+
+// Pause stops delivery to HQ. Changes keep being read and are buffered.
+func (s *StockService) Pause() {
+	p := s.pipeline
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paused {
+		return
+	}
+	p.paused = true
+	p.pausedAt = time.Now()
+	p.running = make(chan struct{})
+	metrics.SetDeliveryPaused(true)
+	logger.Warn("Delivery to HQ paused")
+}
+
+// Resume continues delivery, starting with the changes buffered while paused
+func (s *StockService) Resume() {
+	p := s.pipeline
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.paused {
+		return
+	}
+	p.paused = false
+	close(p.running)
+	metrics.SetDeliveryPaused(false)
+	logger.WithFields(logger.Fields{
+		"paused_for": time.Since(p.pausedAt).Round(time.Second).String(),
+		"buffered":   p.buffered.Load(),
+	}).Info("Delivery to HQ resumed")
+
+	select {
+	case p.resumed <- struct{}{}:
+	default:
+	}
+}
+
+// SetRateLimit changes the maximum number of deliveries per second. Zero
+// removes the limit.
+func (s *StockService) SetRateLimit(perSecond float64) error {
+	if perSecond < 0 || math.IsNaN(perSecond) || math.IsInf(perSecond, 0) {
+		return fmt.Errorf("rate limit must be a non-negative number, got %v", perSecond)
+	}
+	s.pipeline.limiter.SetLimit(toLimit(perSecond))
+	logger.WithFields(logger.Fields{"rate_limit": perSecond}).Info("Delivery rate limit changed")
+	return nil
+}
+
+// PipelineState returns the current pause state, rate limit and buffer size
+func (s *StockService) PipelineState() port.PipelineState {
+	p := s.pipeline
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state := port.PipelineState{
+		Paused:   p.paused,
+		Buffered: int(p.buffered.Load()),
+	}
+	if limit := p.limiter.Limit(); limit != rate.Inf {
+		state.RateLimit = float64(limit)
+	}
+	if p.paused {
+		pausedAt := p.pausedAt
+		state.PausedAt = &pausedAt
+	}
+	return state
+}
+
+func (p *pipeline) isPaused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
+
+// setBuffered records the number of changes waiting in the delivery loop
+func (p *pipeline) setBuffered(n int) {
+	p.buffered.Store(int64(n))
+	metrics.BufferedChanges.Set(float64(n))
+}
+
+// wait blocks until the rate limit allows the next delivery
+func (p *pipeline) wait(ctx context.Context) {
+	if err := p.limiter.Wait(ctx); err != nil {
+		logger.WithFields(logger.Fields{"error": err}).Warn("Rate limiter wait interrupted")
+	}
+}
+
+// await blocks while delivery is paused and then until the rate limit allows
+// the next delivery. It returns the error of ctx when ctx is done first.
+func (p *pipeline) await(ctx context.Context) error {
+	for {
+		p.mu.Lock()
+		running := p.running
+		p.mu.Unlock()
+		select {
+		case <-running:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if err := p.limiter.Wait(ctx); err != nil {
+			return err
+		}
+		// Delivery may have been paused again while waiting for the limiter
+		if !p.isPaused() {
+			return nil
+		}
+	}
+}
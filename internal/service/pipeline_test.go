@@ -0,0 +1,175 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/internal/service"
+	"stock-consolidation/pkg/config"
+)
+
+func TestStockService_PauseResume(t *testing.T) {
+	cleanup := setupTestEnv()
+	defer cleanup()
+
+	var (
+		mu       sync.Mutex
+		received []int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ProductID int `json:"product_id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		received = append(received, body.ProductID)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	delivered := func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int(nil), received...)
+	}
+
+	stockChan := make(chan port.StockChange)
+	mockRepo := &mockStockRepository{
+		ListenForChangesFunc: func(_ context.Context) (<-chan port.StockChange, error) {
+			return stockChan, nil
+		},
+	}
+
+	svc := service.NewStockService(mockRepo)
+	svc.ApplyConfig(&config.Config{HQEndPoint: server.URL})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := svc.ListenForChanges(); err != nil {
+			t.Errorf("ListenForChanges() error = %v", err)
+		}
+	}()
+
+	svc.Pause()
+	for id := 1; id <= 3; id++ {
+		stockChan <- port.StockChange{Stock: domain.Stock{ProductID: id, BranchID: 1}}
+	}
+
+	waitFor(t, func() bool { return svc.PipelineState().Buffered == 3 })
+	state := svc.PipelineState()
+	if !state.Paused || state.PausedAt == nil {
+		t.Errorf("PipelineState() = %+v, want paused", state)
+	}
+	if got := delivered(); len(got) != 0 {
+		t.Fatalf("HQ received %v while paused, want nothing", got)
+	}
+
+	svc.Resume()
+	stockChan <- port.StockChange{Stock: domain.Stock{ProductID: 4, BranchID: 1}}
+	close(stockChan)
+	<-done
+
+	got := delivered()
+	if len(got) != 4 || got[0] != 1 || got[1] != 2 || got[2] != 3 || got[3] != 4 {
+		t.Errorf("HQ received products %v, want buffered changes first in order [1 2 3 4]", got)
+	}
+	if state := svc.PipelineState(); state.Paused || state.Buffered != 0 {
+		t.Errorf("PipelineState() = %+v after resume, want running with an empty buffer", state)
+	}
+}
+
+func TestStockService_SetRateLimit(t *testing.T) {
+	cleanup := setupTestEnv()
+	defer cleanup()
+
+	svc := service.NewStockService(&mockStockRepository{})
+	if got := svc.PipelineState().RateLimit; got != 0 {
+		t.Errorf("PipelineState().RateLimit = %v, want 0 (unlimited) by default", got)
+	}
+
+	if err := svc.SetRateLimit(2.5); err != nil {
+		t.Fatalf("SetRateLimit() error = %v", err)
+	}
+	if got := svc.PipelineState().RateLimit; got != 2.5 {
+		t.Errorf("PipelineState().RateLimit = %v, want 2.5", got)
+	}
+
+	if err := svc.SetRateLimit(-1); err == nil {
+		t.Error("SetRateLimit(-1) expected error, got nil")
+	}
+
+	// A reload that does not change DELIVERY_RATE_LIMIT keeps the runtime limit
+	svc.ApplyConfig(&config.Config{HQEndPoint: "http://localhost:8085/stock"})
+	if got := svc.PipelineState().RateLimit; got != 2.5 {
+		t.Errorf("PipelineState().RateLimit = %v after reload, want 2.5", got)
+	}
+	svc.ApplyConfig(&config.Config{HQEndPoint: "http://localhost:8085/stock", DeliveryRateLimit: 10})
+	if got := svc.PipelineState().RateLimit; got != 10 {
+		t.Errorf("PipelineState().RateLimit = %v after changing DELIVERY_RATE_LIMIT, want 10", got)
+	}
+}
+
+func TestStockService_PausesReplication(t *testing.T) {
+	cleanup := setupTestEnv()
+	defer cleanup()
+
+	paths := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	replicator := service.NewReplicator(&config.Config{HQEndPoint: server.URL + "/stock", HQProductEndPoint: server.URL + "/products"})
+	svc := service.NewStockService(&mockStockRepository{}, service.WithReplicator(replicator))
+	change := port.Change{Type: domain.TypeProduct, Entity: domain.Product{ID: 7, SKU: "SKU-7", Name: "Rice", UpdatedAt: time.Now()}}
+
+	svc.Pause()
+	handled := make(chan error, 1)
+	go func() {
+		handled <- replicator.HandleChange(context.Background(), change)
+	}()
+	select {
+	case path := <-paths:
+		t.Fatalf("HQ received %s while paused, want nothing", path)
+	case err := <-handled:
+		t.Fatalf("HandleChange() = %v while paused, want it to wait", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	svc.Resume()
+	if err := <-handled; err != nil {
+		t.Fatalf("HandleChange() error = %v after resume", err)
+	}
+	if path := <-paths; path != "/products" {
+		t.Errorf("HandleChange() sent to %s, want /products", path)
+	}
+
+	// A change waiting while paused gives up when its context ends
+	svc.Pause()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := replicator.HandleChange(ctx, change); err == nil {
+		t.Error("HandleChange() expected error when the context ends while paused, got nil")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 2s")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
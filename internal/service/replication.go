@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"stock-consolidation/internal/adapter/rest/hqclient"
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/config"
+	"stock-consolidation/pkg/logger"
+	"stock-consolidation/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Replicator sends the captured changes of tables other than stock, such as
+// product master data, to the HQ endpoint configured for their type
+type Replicator struct {
+	client    *hqclient.HQClient
+	endpoints atomic.Pointer[map[string]string]
+	// pipeline, when set, holds changes back while delivery is paused
+	pipeline *pipeline
+}
+
+// NewReplicator creates a Replicator sending to the endpoints of cfg
+func NewReplicator(cfg *config.Config) *Replicator {
+	r := &Replicator{client: hqclient.NewHQClient(cfg)}
+	r.ApplyConfig(cfg)
+	return r
+}
+
+// captureEndpoints returns the configured HQ endpoint of every captured type
+func captureEndpoints(cfg *config.Config) map[string]string {
+	endpoints := make(map[string]string)
+	for typ, endpoint := range map[string]string{
+		domain.TypeProduct:       cfg.HQProductEndPoint,
+		domain.TypeBranch:        cfg.HQBranchEndPoint,
+		domain.TypeStockMovement: cfg.HQStockMovementEndPoint,
+	} {
+		if endpoint != "" {
+			endpoints[typ] = endpoint
+		}
+	}
+	return endpoints
+}
+
+// ApplyConfig swaps the endpoints and credentials of a running Replicator
+func (r *Replicator) ApplyConfig(cfg *config.Config) {
+	r.client.Update(cfg)
+	endpoints := captureEndpoints(cfg)
+	r.endpoints.Store(&endpoints)
+}
+
+// Replicates reports whether typ has an HQ endpoint and so should be captured
+func (r *Replicator) Replicates(typ string) bool {
+	_, ok := (*r.endpoints.Load())[typ]
+	return ok
+}
+
+// HandleChange sends a captured change to the HQ endpoint of its type
+func (r *Replicator) HandleChange(ctx context.Context, change port.Change) error {
+	endpoint, ok := (*r.endpoints.Load())[change.Type]
+	if !ok {
+		return fmt.Errorf("no HQ endpoint configured for %s changes", change.Type)
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "replicate "+change.Type+" change", trace.WithAttributes(
+		attribute.String("cdc.type", change.Type),
+		attribute.String("cdc.event_id", change.Entity.EventID()),
+	))
+	defer span.End()
+
+	if r.pipeline != nil {
+		if err := r.pipeline.await(ctx); err != nil {
+			tracing.RecordError(span, err)
+			return err
+		}
+	}
+	if _, err := r.client.SendChange(ctx, endpoint, change); err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+	logger.WithFields(change.Entity.LogFields()).WithFields(logger.Fields{"type": change.Type}).Info("Replicated captured change to HQ")
+	return nil
+}
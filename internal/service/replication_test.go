@@ -0,0 +1,55 @@
+package service_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/internal/service"
+	"stock-consolidation/pkg/config"
+)
+
+func TestReplicator(t *testing.T) {
+	paths := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		HQEndPoint:           server.URL + "/stock",
+		HQBasicAuthorization: "Basic dXNlcjpwYXNz",
+		HQProductEndPoint:    server.URL + "/products",
+	}
+	replicator := service.NewReplicator(cfg)
+	if !replicator.Replicates(domain.TypeProduct) || replicator.Replicates(domain.TypeBranch) {
+		t.Error("Replicates() should only report types with an endpoint")
+	}
+
+	product := domain.Product{ID: 7, SKU: "SKU-7", Name: "Rice", UpdatedAt: time.Now()}
+	if err := replicator.HandleChange(context.Background(), port.Change{Type: domain.TypeProduct, Entity: product}); err != nil {
+		t.Fatalf("HandleChange() error = %v", err)
+	}
+	if path := <-paths; path != "/products" {
+		t.Errorf("HandleChange() sent to %s, want /products", path)
+	}
+
+	branch := domain.Branch{ID: 1, Code: "B1", UpdatedAt: time.Now()}
+	if err := replicator.HandleChange(context.Background(), port.Change{Type: domain.TypeBranch, Entity: branch}); err == nil {
+		t.Error("HandleChange() expected error for a type without endpoint, got nil")
+	}
+
+	cfg.HQProductEndPoint = server.URL + "/v2/products"
+	replicator.ApplyConfig(cfg)
+	if err := replicator.HandleChange(context.Background(), port.Change{Type: domain.TypeProduct, Entity: product}); err != nil {
+		t.Fatalf("HandleChange() error = %v", err)
+	}
+	if path := <-paths; path != "/v2/products" {
+		t.Errorf("HandleChange() sent to %s after reload, want /v2/products", path)
+	}
+}
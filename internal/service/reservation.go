@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/logger"
+)
+
+// reservationBatchSize is the number of expired reservations released per transaction
+const reservationBatchSize = 100
+
+// ReservationExpirer periodically releases reservations that have expired
+type ReservationExpirer struct {
+	store    port.ReservationStore
+	interval time.Duration
+}
+
+// NewReservationExpirer creates a ReservationExpirer checking every interval
+func NewReservationExpirer(store port.ReservationStore, interval time.Duration) *ReservationExpirer {
+	return &ReservationExpirer{store: store, interval: interval}
+}
+
+// Run releases expired reservations every interval until ctx is done
+func (e *ReservationExpirer) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := e.ReleaseExpired(ctx); err != nil {
+				logger.Error("Failed to release expired reservations: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ReleaseExpired releases every reservation that has expired, in batches,
+// and returns how many were released
+func (e *ReservationExpirer) ReleaseExpired(ctx context.Context) (int, error) {
+	total := 0
+	now := time.Now()
+	for {
+		n, err := e.store.ReleaseExpired(ctx, now, reservationBatchSize)
+		total += n
+		if err != nil || n < reservationBatchSize {
+			if total > 0 {
+				logger.WithFields(logger.Fields{"released": total}).Info("Released expired reservations")
+			}
+			return total, err
+		}
+	}
+}
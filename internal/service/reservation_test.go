@@ -0,0 +1,83 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/service"
+)
+
+type mockReservationStore struct {
+	expired int
+	calls   int
+	err     error
+}
+
+func (m *mockReservationStore) CreateReservation(context.Context, domain.Reservation) (domain.Reservation, error) {
+	return domain.Reservation{}, nil
+}
+
+func (m *mockReservationStore) GetReservation(context.Context, string) (domain.Reservation, error) {
+	return domain.Reservation{}, nil
+}
+
+func (m *mockReservationStore) ConfirmReservation(context.Context, string) (domain.Reservation, error) {
+	return domain.Reservation{}, nil
+}
+
+func (m *mockReservationStore) CancelReservation(context.Context, string) (domain.Reservation, error) {
+	return domain.Reservation{}, nil
+}
+
+func (m *mockReservationStore) ReleaseExpired(_ context.Context, _ time.Time, limit int) (int, error) {
+	m.calls++
+	if m.err != nil {
+		return 0, m.err
+	}
+	n := limit
+	if m.expired < limit {
+		n = m.expired
+	}
+	m.expired -= n
+	return n, nil
+}
+
+func TestReservationExpirer(t *testing.T) {
+	t.Run("releases in batches until none are left", func(t *testing.T) {
+		store := &mockReservationStore{expired: 250}
+		n, err := service.NewReservationExpirer(store, time.Minute).ReleaseExpired(context.Background())
+		if err != nil || n != 250 {
+			t.Errorf("ReleaseExpired() = %d, %v, want 250", n, err)
+		}
+		if store.calls != 3 {
+			t.Errorf("store called %d times, want 3 batches", store.calls)
+		}
+	})
+
+	t.Run("returns store errors", func(t *testing.T) {
+		store := &mockReservationStore{err: errors.New("connection refused")}
+		if _, err := service.NewReservationExpirer(store, time.Minute).ReleaseExpired(context.Background()); err == nil {
+			t.Error("ReleaseExpired() expected error, got nil")
+		}
+	})
+
+	t.Run("run stops with the context", func(t *testing.T) {
+		store := &mockReservationStore{expired: 1}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			service.NewReservationExpirer(store, time.Millisecond).Run(ctx)
+		}()
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Run() did not stop after cancel")
+		}
+	})
+}
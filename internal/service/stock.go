@@ -4,29 +4,103 @@ package service
 import (
 	"context"
 	"fmt"
+	"math"
 	"stock-consolidation/internal/adapter/rest/hqclient"
+	"stock-consolidation/internal/core/domain"
 	"stock-consolidation/internal/core/port"
 	"stock-consolidation/pkg/config"
+	"stock-consolidation/pkg/health"
 	"stock-consolidation/pkg/logger"
+	"stock-consolidation/pkg/metrics"
+	"stock-consolidation/pkg/tracing"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // StockService handles stock change notifications and forwards them to HQ
 type StockService struct {
-	repo   port.StockRepository
-	client *hqclient.HQClient
+	repo     port.StockRepository
+	client   *hqclient.HQClient
+	filter   atomic.Pointer[config.DeliveryFilter]
+	recorder port.DeliveryRecorder
+	leader   port.Leadership
+
+	pipeline   *pipeline
+	bufferSize int
+	// rateLimit is the configured rate limit, used to detect changes on reload
+	rateLimit atomic.Uint64
+}
+
+// Option configures optional dependencies of the StockService
+type Option func(*StockService)
+
+// WithDeliveryRecorder records the outcome of every delivery attempt
+func WithDeliveryRecorder(recorder port.DeliveryRecorder) Option {
+	return func(s *StockService) {
+		s.recorder = recorder
+	}
+}
+
+// WithLeadership only forwards changes while leader reports this instance as
+// the leader. Standby instances drop them.
+func WithLeadership(leader port.Leadership) Option {
+	return func(s *StockService) {
+		s.leader = leader
+	}
+}
+
+// WithReplicator sends the captured changes of replicator through the
+// delivery pipeline, so they wait while delivery is paused and count against
+// the rate limit
+func WithReplicator(replicator *Replicator) Option {
+	return func(s *StockService) {
+		replicator.pipeline = s.pipeline
+	}
 }
 
 // NewStockService creates a new StockService instance
-func NewStockService(repo port.StockRepository) *StockService {
+func NewStockService(repo port.StockRepository, opts ...Option) *StockService {
 	cfg, err := config.Load()
 	if err != nil {
 		logger.Fatal("Failed to load config: %v", err)
 	}
 
-	return &StockService{
-		repo:   repo,
-		client: hqclient.NewHQClient(cfg),
+	s := &StockService{
+		repo:       repo,
+		client:     hqclient.NewHQClient(cfg),
+		pipeline:   newPipeline(cfg.DeliveryRateLimit),
+		bufferSize: cfg.DeliveryBufferSize,
+	}
+	s.filter.Store(&cfg.Filter)
+	s.rateLimit.Store(math.Float64bits(cfg.DeliveryRateLimit))
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
+}
+
+// ApplyConfig swaps the delivery settings and filter rules of a running service.
+// The rate limit is only applied when DELIVERY_RATE_LIMIT itself changed, so a
+// reload does not undo a limit set through the admin API.
+func (s *StockService) ApplyConfig(cfg *config.Config) {
+	s.client.Update(cfg)
+	filter := cfg.Filter
+	s.filter.Store(&filter)
+
+	if old := s.rateLimit.Swap(math.Float64bits(cfg.DeliveryRateLimit)); old != math.Float64bits(cfg.DeliveryRateLimit) {
+		if err := s.SetRateLimit(cfg.DeliveryRateLimit); err != nil {
+			logger.Error("Failed to apply rate limit: %v", err)
+		}
+	}
+}
+
+// DeliveryHealthCheck returns a health check that fails once deliveries to HQ
+// have been failing for longer than threshold
+func (s *StockService) DeliveryHealthCheck(threshold time.Duration) health.CheckFunc {
+	return s.client.HealthCheck(threshold)
 }
 
 // ListenForChanges starts listening for stock changes and forwards them to HQ
@@ -40,16 +114,105 @@ func (s *StockService) ListenForChanges() error {
 	}
 
 	logger.Info("Successfully started listening for stock changes")
-	for stock := range stockChan {
-		logger.Info("Processing stock change notification: ProductID=%d, BranchID=%d", stock.ProductID, stock.BranchID)
 
-		if err := s.client.SendStockChange(ctx, stock); err != nil {
-			logger.Error("Failed to send stock change to HQ: %v", err)
-			continue
+	// pending holds the changes read while delivery is paused. Once it is
+	// full the loop stops reading and the backlog stays in the repository.
+	var pending []port.StockChange
+	for {
+		in := stockChan
+		if len(pending) >= s.bufferSize && s.bufferSize > 0 {
+			in = nil
+		}
+
+		select {
+		case change, ok := <-in:
+			if !ok {
+				if len(pending) > 0 {
+					logger.Warn("Stopped with %d undelivered stock changes buffered", len(pending))
+				}
+				logger.Info("Stopped listening for stock changes")
+				return nil
+			}
+			pending = append(pending, change)
+		case <-s.pipeline.resumed:
 		}
 
-		logger.Info("Successfully sent stock change for product %d in branch %d", stock.ProductID, stock.BranchID)
+		pending = s.flush(ctx, pending)
+		s.pipeline.setBuffered(len(pending))
+	}
+}
+
+// flush delivers pending changes in order until delivery is paused and
+// returns the changes that are still pending
+func (s *StockService) flush(ctx context.Context, pending []port.StockChange) []port.StockChange {
+	for len(pending) > 0 && !s.pipeline.isPaused() {
+		change := pending[0]
+		pending[0] = port.StockChange{}
+		pending = pending[1:]
+
+		changeCtx := change.Ctx
+		if changeCtx == nil {
+			changeCtx = ctx
+		}
+		s.deliver(changeCtx, change)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	return pending
+}
+
+// deliver forwards a single stock change to HQ unless the filter excludes it
+func (s *StockService) deliver(ctx context.Context, change port.StockChange) {
+	stock := change.Stock
+	ctx, span := tracing.Tracer().Start(ctx, "deliver stock change", trace.WithAttributes(
+		attribute.String("stock.event_id", stock.EventID()),
+		attribute.Int("stock.product_id", stock.ProductID),
+		attribute.Int("stock.branch_id", stock.BranchID),
+		attribute.String("messaging.source.name", change.Channel),
+	))
+	defer span.End()
+
+	log := logger.WithFields(stock.LogFields())
+	if change.Channel != "" {
+		log = log.WithFields(logger.Fields{"channel": change.Channel})
+	}
+	if change.Source != "" {
+		span.SetAttributes(attribute.String("stock.source", change.Source))
+		log = log.WithFields(logger.Fields{"source": change.Source})
+	}
+	log.Debug("Processing stock change notification")
+
+	if s.leader != nil && !s.leader.IsLeader() {
+		span.SetAttributes(attribute.Bool("stock.standby", true))
+		metrics.StandbySkippedChanges.WithLabelValues(domain.TypeStock).Inc()
+		log.Debug("Skipping stock change: standby instance")
+		return
+	}
+
+	if !s.filter.Load().Allows(stock.ProductID, stock.BranchID) {
+		span.SetAttributes(attribute.Bool("stock.filtered", true))
+		log.Info("Skipping stock change: excluded by filter")
+		return
+	}
+
+	s.pipeline.wait(ctx)
+	attemptedAt := time.Now()
+	result, err := s.client.Send(ctx, stock)
+	if s.recorder != nil {
+		delivery := domain.NewDelivery(stock, result.StatusCode, result.Latency, err, attemptedAt)
+		delivery.Channel = change.Channel
+		delivery.Source = change.Source
+		s.recorder.RecordDelivery(delivery)
+	}
+	if err != nil {
+		tracing.RecordError(span, err)
+		log.WithFields(logger.Fields{"error": err}).Error("Failed to send stock change to HQ")
+		return
+	}
+
+	if !stock.UpdatedAt.IsZero() {
+		metrics.DeliveryLag.Observe(time.Since(stock.UpdatedAt).Seconds())
 	}
-	logger.Info("Stopped listening for stock changes")
-	return nil
+	log.Info("Successfully sent stock change to HQ")
 }
@@ -3,21 +3,27 @@ package service_test
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"stock-consolidation/internal/adapter/memory"
 	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
 	"stock-consolidation/internal/service"
+	"stock-consolidation/pkg/config"
 )
 
 type mockStockRepository struct {
-	ListenForChangesFunc func(ctx context.Context) (<-chan domain.Stock, error)
+	ListenForChangesFunc func(ctx context.Context) (<-chan port.StockChange, error)
 	CloseFunc            func() error
-	stockChan            chan domain.Stock
+	stockChan            chan port.StockChange
 }
 
-func (m *mockStockRepository) ListenForChanges(ctx context.Context) (<-chan domain.Stock, error) {
+func (m *mockStockRepository) ListenForChanges(ctx context.Context) (<-chan port.StockChange, error) {
 	if m.ListenForChangesFunc != nil {
 		return m.ListenForChangesFunc(ctx)
 	}
@@ -97,9 +103,9 @@ func TestStockService_ListenForChanges(t *testing.T) {
 	cleanup := setupTestEnv()
 	defer cleanup()
 	t.Run("success receive stock changes", func(t *testing.T) {
-		stockChan := make(chan domain.Stock)
+		stockChan := make(chan port.StockChange)
 		mockRepo := &mockStockRepository{
-			ListenForChangesFunc: func(_ context.Context) (<-chan domain.Stock, error) {
+			ListenForChangesFunc: func(_ context.Context) (<-chan port.StockChange, error) {
 				return stockChan, nil
 			},
 			stockChan: stockChan,
@@ -138,7 +144,7 @@ func TestStockService_ListenForChanges(t *testing.T) {
 		}
 
 		for _, tc := range testStocks {
-			mockRepo.stockChan <- tc
+			mockRepo.stockChan <- port.StockChange{Stock: tc}
 			// Allow some time for processing
 			time.Sleep(10 * time.Millisecond) // Reduced from 50ms
 		}
@@ -148,12 +154,12 @@ func TestStockService_ListenForChanges(t *testing.T) {
 
 	t.Run("repository close", func(t *testing.T) {
 		mockRepo := &mockStockRepository{
-			ListenForChangesFunc: func(_ context.Context) (<-chan domain.Stock, error) {
-				ch := make(chan domain.Stock)
+			ListenForChangesFunc: func(_ context.Context) (<-chan port.StockChange, error) {
+				ch := make(chan port.StockChange)
 				close(ch)
 				return ch, nil
 			},
-			stockChan: make(chan domain.Stock),
+			stockChan: make(chan port.StockChange),
 		}
 
 		service := service.NewStockService(mockRepo)
@@ -163,4 +169,123 @@ func TestStockService_ListenForChanges(t *testing.T) {
 			t.Errorf("ListenForChanges() error = %v", err)
 		}
 	})
+
+	t.Run("apply config swaps endpoint and filter", func(t *testing.T) {
+		var received atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			received.Add(1)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		stockChan := make(chan port.StockChange)
+		mockRepo := &mockStockRepository{
+			ListenForChangesFunc: func(_ context.Context) (<-chan port.StockChange, error) {
+				return stockChan, nil
+			},
+		}
+
+		svc := service.NewStockService(mockRepo)
+		svc.ApplyConfig(&config.Config{
+			HQEndPoint:           server.URL,
+			HQBasicAuthorization: "Basic dXNlcjpwYXNz",
+			Filter:               config.DeliveryFilter{BranchIDs: []int{1}},
+		})
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if err := svc.ListenForChanges(); err != nil {
+				t.Errorf("ListenForChanges() error = %v", err)
+			}
+		}()
+
+		stockChan <- port.StockChange{Stock: domain.Stock{ProductID: 1, BranchID: 1, Quantity: 10}}
+		stockChan <- port.StockChange{Stock: domain.Stock{ProductID: 1, BranchID: 2, Quantity: 10}}
+		close(stockChan)
+		<-done
+
+		if got := received.Load(); got != 1 {
+			t.Errorf("HQ received %d requests, want 1 (branch 2 is filtered out)", got)
+		}
+	})
+
+	t.Run("records every delivery attempt", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		stockChan := make(chan port.StockChange)
+		mockRepo := &mockStockRepository{
+			ListenForChangesFunc: func(_ context.Context) (<-chan port.StockChange, error) {
+				return stockChan, nil
+			},
+		}
+
+		history := memory.NewDeliveryHistory(10)
+		svc := service.NewStockService(mockRepo, service.WithDeliveryRecorder(history))
+		svc.ApplyConfig(&config.Config{HQEndPoint: server.URL})
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if err := svc.ListenForChanges(); err != nil {
+				t.Errorf("ListenForChanges() error = %v", err)
+			}
+		}()
+
+		stockChan <- port.StockChange{Channel: "branch2_stock_changes", Stock: domain.Stock{ID: "stock-1", ProductID: 1, BranchID: 1}}
+		close(stockChan)
+		<-done
+
+		got := history.QueryDeliveries(port.DeliveryQuery{})
+		if len(got) != 1 {
+			t.Fatalf("history holds %d attempts, want 1", len(got))
+		}
+		if got[0].Status != domain.DeliveryFailed || got[0].StatusCode != http.StatusBadGateway || got[0].Error == "" {
+			t.Errorf("recorded delivery = %+v, want failure with status 502", got[0])
+		}
+		if got[0].Channel != "branch2_stock_changes" {
+			t.Errorf("recorded delivery channel = %q, want the source channel", got[0].Channel)
+		}
+	})
+	t.Run("standby instances do not forward", func(t *testing.T) {
+		var received atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received.Add(1)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		stockChan := make(chan port.StockChange)
+		mockRepo := &mockStockRepository{
+			ListenForChangesFunc: func(_ context.Context) (<-chan port.StockChange, error) {
+				return stockChan, nil
+			},
+		}
+
+		leader := &fakeLeadership{}
+		svc := service.NewStockService(mockRepo, service.WithLeadership(leader))
+		svc.ApplyConfig(&config.Config{HQEndPoint: server.URL})
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if err := svc.ListenForChanges(); err != nil {
+				t.Errorf("ListenForChanges() error = %v", err)
+			}
+		}()
+
+		stock := domain.Stock{ID: "stock-1", ProductID: 1, BranchID: 1}
+		stockChan <- port.StockChange{Stock: stock}
+		leader.leader.Store(true)
+		stockChan <- port.StockChange{Stock: stock}
+		close(stockChan)
+		<-done
+
+		if got := received.Load(); got != 1 {
+			t.Errorf("HQ received %d requests, want 1 (the first change arrived on a standby)", got)
+		}
+	})
 }
@@ -0,0 +1,389 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/pkg/config"
+	"stock-consolidation/pkg/health"
+	"stock-consolidation/pkg/logger"
+	"stock-consolidation/pkg/metrics"
+)
+
+// BranchListener is the change stream of one branch database
+type BranchListener interface {
+	port.StockRepository
+	Ping() error
+	QueueDepth() int
+}
+
+// ListenerFactory connects to the database of a branch source
+type ListenerFactory func(src config.BranchSource) (BranchListener, error)
+
+// States of a branch source
+const (
+	SourceStarting   = "starting"
+	SourceRunning    = "running"
+	SourceRestarting = "restarting"
+	SourceStopped    = "stopped"
+)
+
+// SourceStatus describes the listener of a branch source
+type SourceStatus struct {
+	Name      string    `json:"name"`
+	BranchID  int       `json:"branch_id,omitempty"`
+	State     string    `json:"state"`
+	Since     time.Time `json:"since"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// supervisorBuffer is the number of changes from all sources that can wait
+// for delivery
+const supervisorBuffer = 100
+
+// Supervisor runs a listener per branch source and merges their changes into
+// one stream. A listener that stops or fails its pings is restarted with
+// exponential backoff without affecting the other sources.
+type Supervisor struct {
+	connect ListenerFactory
+	sources []*branchSource
+
+	minBackoff      time.Duration
+	maxBackoff      time.Duration
+	pingInterval    time.Duration
+	maxPingFailures int
+
+	changes chan port.StockChange
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	running atomic.Bool
+}
+
+// branchSource is the supervised state of one source
+type branchSource struct {
+	cfg config.BranchSource
+
+	mu       sync.Mutex
+	status   SourceStatus
+	listener BranchListener
+}
+
+// SupervisorOption configures optional settings of the Supervisor
+type SupervisorOption func(*Supervisor)
+
+// WithRestartBackoff waits min before the first restart of a failed listener,
+// doubling up to max while it keeps failing. The default is 1s to 1m.
+func WithRestartBackoff(min, max time.Duration) SupervisorOption {
+	return func(s *Supervisor) {
+		s.minBackoff = min
+		s.maxBackoff = max
+	}
+}
+
+// WithPingInterval pings running listeners every interval and restarts a
+// listener after failures consecutive failed pings. The default is every 30s,
+// restarting after 3 failures.
+func WithPingInterval(interval time.Duration, failures int) SupervisorOption {
+	return func(s *Supervisor) {
+		s.pingInterval = interval
+		s.maxPingFailures = failures
+	}
+}
+
+// NewSupervisor creates a Supervisor for sources, connecting to each with connect
+func NewSupervisor(sources []config.BranchSource, connect ListenerFactory, opts ...SupervisorOption) *Supervisor {
+	s := &Supervisor{
+		connect:         connect,
+		minBackoff:      time.Second,
+		maxBackoff:      time.Minute,
+		pingInterval:    30 * time.Second,
+		maxPingFailures: 3,
+	}
+	now := time.Now()
+	for _, src := range sources {
+		s.sources = append(s.sources, &branchSource{
+			cfg: src,
+			status: SourceStatus{
+				Name:     src.Name,
+				BranchID: src.BranchID,
+				State:    SourceStarting,
+				Since:    now,
+			},
+		})
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// ListenForChanges starts the listener of every source and returns their
+// merged changes. The channel is closed once ctx is cancelled or the
+// Supervisor is closed.
+func (s *Supervisor) ListenForChanges(ctx context.Context) (<-chan port.StockChange, error) {
+	if len(s.sources) == 0 {
+		return nil, fmt.Errorf("no branch sources configured")
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.changes = make(chan port.StockChange, supervisorBuffer)
+	metrics.SetQueueDepthFunc(s.QueueDepth)
+
+	s.running.Store(true)
+	for _, src := range s.sources {
+		s.wg.Add(1)
+		go func(src *branchSource) {
+			defer s.wg.Done()
+			s.supervise(ctx, src)
+		}(src)
+	}
+	go func() {
+		s.wg.Wait()
+		s.running.Store(false)
+		close(s.changes)
+	}()
+	return s.changes, nil
+}
+
+// supervise runs the listener of src until ctx is cancelled, restarting it
+// whenever it fails
+func (s *Supervisor) supervise(ctx context.Context, src *branchSource) {
+	log := logger.WithFields(logger.Fields{"source": src.cfg.Name})
+	backoff := s.minBackoff
+	for {
+		started := time.Now()
+		err := s.run(ctx, src)
+		metrics.BranchSourceUp.WithLabelValues(src.cfg.Name).Set(0)
+		if ctx.Err() != nil {
+			src.setState(SourceStopped, nil)
+			return
+		}
+
+		// A listener that ran for a while failed on its own, not because the
+		// database is still unreachable
+		if time.Since(started) > s.maxBackoff {
+			backoff = s.minBackoff
+		}
+		src.setState(SourceRestarting, err)
+		metrics.BranchSourceRestarts.WithLabelValues(src.cfg.Name).Inc()
+		log.WithFields(logger.Fields{"error": err, "backoff": backoff.String()}).Warn("Branch source listener failed, restarting")
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			src.setState(SourceStopped, nil)
+			return
+		}
+		if backoff *= 2; backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+}
+
+// run connects the listener of src and forwards its changes until it stops
+func (s *Supervisor) run(ctx context.Context, src *branchSource) error {
+	listener, err := s.connect(src.cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %v", err)
+	}
+	var closeOnce sync.Once
+	closeListener := func() {
+		closeOnce.Do(func() {
+			if err := listener.Close(); err != nil {
+				logger.WithFields(logger.Fields{"source": src.cfg.Name, "error": err}).Debug("Error closing branch source listener")
+			}
+		})
+	}
+	defer closeListener()
+
+	changes, err := listener.ListenForChanges(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %v", err)
+	}
+	src.setListener(listener)
+	defer src.setListener(nil)
+	src.setState(SourceRunning, nil)
+	metrics.BranchSourceUp.WithLabelValues(src.cfg.Name).Set(1)
+	logger.WithFields(logger.Fields{"source": src.cfg.Name, "branch_id": src.cfg.BranchID}).Info("Listening for changes of branch source")
+
+	// Closing the listener ends its change stream, so a failed ping loop
+	// stops the forwarding below
+	var pingErr atomic.Pointer[error]
+	stopPing := make(chan struct{})
+	defer close(stopPing)
+	go func() {
+		if err := s.watch(listener, stopPing); err != nil {
+			pingErr.Store(&err)
+			closeListener()
+		}
+	}()
+
+	for {
+		var change port.StockChange
+		var ok bool
+		select {
+		case change, ok = <-changes:
+		case <-ctx.Done():
+			return nil
+		}
+		if !ok {
+			break
+		}
+		if change.Source == "" {
+			change.Source = src.cfg.Name
+		}
+		select {
+		case s.changes <- change:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	if err := pingErr.Load(); err != nil {
+		return *err
+	}
+	return errors.New("listener stopped")
+}
+
+// watch pings listener until stop is closed and returns an error after too
+// many consecutive failures
+func (s *Supervisor) watch(listener BranchListener, stop <-chan struct{}) error {
+	ticker := time.NewTicker(s.pingInterval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+		err := listener.Ping()
+		if err == nil {
+			failures = 0
+			continue
+		}
+		if failures++; failures >= s.maxPingFailures {
+			return fmt.Errorf("ping failed %d times: %v", failures, err)
+		}
+	}
+}
+
+// setState records a state change of the source
+func (b *branchSource) setState(state string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if state == SourceRestarting {
+		b.status.Restarts++
+	}
+	if err != nil {
+		b.status.LastError = err.Error()
+	}
+	if b.status.State != state {
+		b.status.State = state
+		b.status.Since = time.Now()
+	}
+}
+
+func (b *branchSource) setListener(listener BranchListener) {
+	b.mu.Lock()
+	b.listener = listener
+	b.mu.Unlock()
+}
+
+func (b *branchSource) snapshot() (SourceStatus, BranchListener) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.status, b.listener
+}
+
+// Statuses returns the status of every source in configuration order
+func (s *Supervisor) Statuses() []SourceStatus {
+	statuses := make([]SourceStatus, 0, len(s.sources))
+	for _, src := range s.sources {
+		status, _ := src.snapshot()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Running reports whether any source is still supervised
+func (s *Supervisor) Running() bool {
+	return s.running.Load()
+}
+
+// QueueDepth returns the number of changes of all sources waiting for delivery
+func (s *Supervisor) QueueDepth() int {
+	depth := len(s.changes)
+	for _, src := range s.sources {
+		if _, listener := src.snapshot(); listener != nil {
+			depth += listener.QueueDepth()
+		}
+	}
+	return depth
+}
+
+// Close stops every listener and waits for the supervisors to return
+func (s *Supervisor) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	return nil
+}
+
+// SourceCheck returns a health check that fails while the listener of the
+// source called name is not running
+func (s *Supervisor) SourceCheck(name string) health.CheckFunc {
+	return func(_ context.Context) (health.Details, error) {
+		for _, src := range s.sources {
+			if src.cfg.Name != name {
+				continue
+			}
+			status, _ := src.snapshot()
+			details := health.Details{
+				"state":    status.State,
+				"since":    status.Since,
+				"restarts": status.Restarts,
+			}
+			if status.BranchID != 0 {
+				details["branch_id"] = status.BranchID
+			}
+			if status.LastError != "" {
+				details["last_error"] = status.LastError
+			}
+			if status.State != SourceRunning {
+				return details, fmt.Errorf("branch source %s is %s", name, status.State)
+			}
+			return details, nil
+		}
+		return nil, fmt.Errorf("unknown branch source %s", name)
+	}
+}
+
+// RunningCheck returns a health check that fails once the supervisor has stopped
+func (s *Supervisor) RunningCheck() health.CheckFunc {
+	return func(_ context.Context) (health.Details, error) {
+		if !s.Running() {
+			return nil, fmt.Errorf("supervisor is not running")
+		}
+		return nil, nil
+	}
+}
+
+// BacklogCheck returns a health check that fails when more than max changes
+// of all sources wait for delivery
+func (s *Supervisor) BacklogCheck(max int) health.CheckFunc {
+	return func(_ context.Context) (health.Details, error) {
+		depth := s.QueueDepth()
+		details := health.Details{"queue_depth": depth, "max": max}
+		if depth > max {
+			return details, fmt.Errorf("delivery backlog of %d exceeds %d", depth, max)
+		}
+		return details, nil
+	}
+}
@@ -0,0 +1,236 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
+	"stock-consolidation/internal/service"
+	"stock-consolidation/pkg/config"
+)
+
+// fakeBranchListener streams the changes sent on its channel until it is closed
+type fakeBranchListener struct {
+	changes chan port.StockChange
+	pingErr atomic.Pointer[error]
+	once    sync.Once
+}
+
+func newFakeBranchListener() *fakeBranchListener {
+	return &fakeBranchListener{changes: make(chan port.StockChange, 10)}
+}
+
+func (f *fakeBranchListener) ListenForChanges(ctx context.Context) (<-chan port.StockChange, error) {
+	return f.changes, nil
+}
+
+func (f *fakeBranchListener) Close() error {
+	f.once.Do(func() { close(f.changes) })
+	return nil
+}
+
+func (f *fakeBranchListener) Ping() error {
+	if err := f.pingErr.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+func (f *fakeBranchListener) QueueDepth() int {
+	return 0
+}
+
+// fakeFactory hands out a new listener per connection attempt and fails the
+// first failures attempts of each source
+type fakeFactory struct {
+	mu        sync.Mutex
+	failures  int
+	attempts  map[string]int
+	listeners map[string][]*fakeBranchListener
+	connected chan string
+}
+
+func newFakeFactory(failures int) *fakeFactory {
+	return &fakeFactory{
+		failures:  failures,
+		attempts:  make(map[string]int),
+		listeners: make(map[string][]*fakeBranchListener),
+		connected: make(chan string, 10),
+	}
+}
+
+func (f *fakeFactory) connect(src config.BranchSource) (service.BranchListener, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts[src.Name]++
+	if f.attempts[src.Name] <= f.failures {
+		return nil, errors.New("connection refused")
+	}
+	l := newFakeBranchListener()
+	f.listeners[src.Name] = append(f.listeners[src.Name], l)
+	f.connected <- src.Name
+	return l, nil
+}
+
+func (f *fakeFactory) latest(name string) *fakeBranchListener {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	listeners := f.listeners[name]
+	return listeners[len(listeners)-1]
+}
+
+func waitConnected(t *testing.T, f *fakeFactory, name string) {
+	t.Helper()
+	select {
+	case got := <-f.connected:
+		if got != name {
+			t.Fatalf("connected source = %s, want %s", got, name)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("source %s did not connect", name)
+	}
+}
+
+func sourceStatus(s *service.Supervisor, name string) service.SourceStatus {
+	for _, status := range s.Statuses() {
+		if status.Name == name {
+			return status
+		}
+	}
+	return service.SourceStatus{}
+}
+
+func TestSupervisor_MergesSources(t *testing.T) {
+	factory := newFakeFactory(0)
+	sources := []config.BranchSource{{Name: "bkk", BranchID: 1}, {Name: "cnx", BranchID: 2}}
+	s := service.NewSupervisor(sources, factory.connect)
+
+	changes, err := s.ListenForChanges(context.Background())
+	if err != nil {
+		t.Fatalf("ListenForChanges() error = %v", err)
+	}
+	<-factory.connected
+	<-factory.connected
+
+	factory.latest("bkk").changes <- port.StockChange{Stock: domain.Stock{ID: "1", BranchID: 1}}
+	factory.latest("cnx").changes <- port.StockChange{Stock: domain.Stock{ID: "2", BranchID: 2}}
+
+	got := map[string]string{}
+	for i := 0; i < 2; i++ {
+		select {
+		case change := <-changes:
+			got[change.Stock.ID] = change.Source
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for changes")
+		}
+	}
+	if got["1"] != "bkk" || got["2"] != "cnx" {
+		t.Errorf("sources = %v, want 1:bkk 2:cnx", got)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, ok := <-changes; ok {
+		t.Error("changes channel still open after Close()")
+	}
+	if status := sourceStatus(s, "bkk"); status.State != service.SourceStopped {
+		t.Errorf("state after Close() = %s, want %s", status.State, service.SourceStopped)
+	}
+}
+
+func TestSupervisor_RestartsFailedSource(t *testing.T) {
+	factory := newFakeFactory(2)
+	sources := []config.BranchSource{{Name: "bkk"}}
+	s := service.NewSupervisor(sources, factory.connect, service.WithRestartBackoff(time.Millisecond, 10*time.Millisecond))
+	defer s.Close()
+
+	changes, err := s.ListenForChanges(context.Background())
+	if err != nil {
+		t.Fatalf("ListenForChanges() error = %v", err)
+	}
+	waitConnected(t, factory, "bkk")
+	status := sourceStatus(s, "bkk")
+	if status.Restarts != 2 || status.LastError == "" {
+		t.Errorf("status after failed connects = %+v, want 2 restarts and an error", status)
+	}
+
+	// A listener whose stream ends is replaced
+	factory.latest("bkk").Close()
+	waitConnected(t, factory, "bkk")
+	factory.latest("bkk").changes <- port.StockChange{Stock: domain.Stock{ID: "1"}}
+	select {
+	case change := <-changes:
+		if change.Source != "bkk" {
+			t.Errorf("Source = %q, want bkk", change.Source)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no change from the restarted listener")
+	}
+
+	check := s.SourceCheck("bkk")
+	details, err := check(context.Background())
+	if err != nil {
+		t.Errorf("SourceCheck() error = %v, want nil while running", err)
+	}
+	if details["restarts"] != 3 {
+		t.Errorf("SourceCheck() restarts = %v, want 3", details["restarts"])
+	}
+}
+
+func TestSupervisor_RestartsOnPingFailure(t *testing.T) {
+	factory := newFakeFactory(0)
+	sources := []config.BranchSource{{Name: "bkk"}, {Name: "cnx"}}
+	s := service.NewSupervisor(sources, factory.connect,
+		service.WithRestartBackoff(time.Millisecond, 10*time.Millisecond),
+		service.WithPingInterval(time.Millisecond, 2),
+	)
+	defer s.Close()
+
+	if _, err := s.ListenForChanges(context.Background()); err != nil {
+		t.Fatalf("ListenForChanges() error = %v", err)
+	}
+	<-factory.connected
+	<-factory.connected
+
+	pingErr := errors.New("connection reset")
+	factory.latest("cnx").pingErr.Store(&pingErr)
+	waitConnected(t, factory, "cnx")
+
+	if status := sourceStatus(s, "cnx"); status.Restarts != 1 {
+		t.Errorf("cnx restarts = %d, want 1", status.Restarts)
+	}
+	if status := sourceStatus(s, "bkk"); status.Restarts != 0 || status.State != service.SourceRunning {
+		t.Errorf("bkk status = %+v, want running without restarts", status)
+	}
+}
+
+func TestSupervisor_SourceCheck(t *testing.T) {
+	factory := newFakeFactory(1000)
+	s := service.NewSupervisor([]config.BranchSource{{Name: "bkk"}}, factory.connect, service.WithRestartBackoff(time.Hour, time.Hour))
+	defer s.Close()
+
+	if _, err := s.ListenForChanges(context.Background()); err != nil {
+		t.Fatalf("ListenForChanges() error = %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for sourceStatus(s, "bkk").State != service.SourceRestarting && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	details, err := s.SourceCheck("bkk")(context.Background())
+	if err == nil {
+		t.Fatal("SourceCheck() error = nil, want error while restarting")
+	}
+	if details["last_error"] != "failed to connect: connection refused" {
+		t.Errorf("last_error = %v", details["last_error"])
+	}
+	if _, err := s.SourceCheck("cnx")(context.Background()); err == nil {
+		t.Error("SourceCheck() of an unknown source error = nil")
+	}
+}
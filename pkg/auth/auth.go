@@ -0,0 +1,202 @@
+// Package auth authenticates API requests with API keys or JWT bearer tokens
+// and defines the roles used to authorize them
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Role grants access to a set of endpoints. Each role includes the
+// permissions of the roles below it.
+type Role int
+
+// Roles in increasing order of privilege
+const (
+	RoleNone Role = iota
+	// RoleReader may read deliveries, metrics and the pipeline state
+	RoleReader
+	// RoleOperator may additionally pause, resume and throttle delivery
+	RoleOperator
+	// RoleAdmin may use every endpoint
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleReader:   "reader",
+	RoleOperator: "operator",
+	RoleAdmin:    "admin",
+}
+
+// String returns the name of the role as used in configuration and tokens
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return "none"
+}
+
+// Allows reports whether the role grants the permissions of required
+func (r Role) Allows(required Role) bool {
+	return r >= required
+}
+
+// ParseRole parses a role name. "read-only" is accepted as an alias of reader.
+func ParseRole(name string) (Role, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "reader", "read-only", "readonly":
+		return RoleReader, nil
+	case "operator":
+		return RoleOperator, nil
+	case "admin":
+		return RoleAdmin, nil
+	}
+	return RoleNone, fmt.Errorf("unknown role %q, expected reader, operator or admin", name)
+}
+
+// APIKey is a static key identifying a client
+type APIKey struct {
+	Name string
+	Role Role
+	Key  string
+}
+
+// JWTConfig configures the validation of JWT bearer tokens
+type JWTConfig struct {
+	// Secret is the HMAC key used to sign tokens. JWT authentication is
+	// disabled when it is empty.
+	Secret   string
+	Issuer   string
+	Audience string
+	// RoleClaim is the claim holding the role name or a list of role names
+	RoleClaim string
+}
+
+// Principal is an authenticated client
+type Principal struct {
+	Name string
+	Role Role
+	// Method is "api_key" or "jwt"
+	Method string
+}
+
+// ErrNoCredentials is returned by Authenticate when no token was sent
+var ErrNoCredentials = errors.New("missing credentials")
+
+// Authenticator validates API keys and JWT bearer tokens
+type Authenticator struct {
+	credentials atomic.Pointer[credentials]
+}
+
+// credentials holds the accepted keys and JWT settings that can be swapped at runtime
+type credentials struct {
+	keys []APIKey
+	jwt  JWTConfig
+}
+
+// NewAuthenticator creates an Authenticator accepting the given keys and, if
+// jwtCfg.Secret is set, JWTs signed with it
+func NewAuthenticator(keys []APIKey, jwtCfg JWTConfig) *Authenticator {
+	a := &Authenticator{}
+	a.Update(keys, jwtCfg)
+	return a
+}
+
+// Update atomically replaces the accepted keys and JWT settings, e.g. to rotate credentials
+func (a *Authenticator) Update(keys []APIKey, jwtCfg JWTConfig) {
+	if jwtCfg.RoleClaim == "" {
+		jwtCfg.RoleClaim = "role"
+	}
+	a.credentials.Store(&credentials{keys: keys, jwt: jwtCfg})
+}
+
+// Enabled reports whether any credentials are configured
+func (a *Authenticator) Enabled() bool {
+	c := a.credentials.Load()
+	return len(c.keys) > 0 || c.jwt.Secret != ""
+}
+
+// Authenticate validates a token taken from an Authorization bearer header or
+// an X-API-Key header. Tokens that look like a JWT are validated as such when
+// JWT authentication is enabled; everything else is looked up as an API key.
+func (a *Authenticator) Authenticate(token string) (Principal, error) {
+	if token == "" {
+		return Principal{}, ErrNoCredentials
+	}
+	c := a.credentials.Load()
+	if c.jwt.Secret != "" && strings.Count(token, ".") == 2 {
+		return c.authenticateJWT(token)
+	}
+	return c.authenticateKey(token)
+}
+
+func (c *credentials) authenticateKey(token string) (Principal, error) {
+	// Compare against every key so the time taken does not reveal a match
+	var found *APIKey
+	for i := range c.keys {
+		if subtle.ConstantTimeCompare([]byte(c.keys[i].Key), []byte(token)) == 1 {
+			found = &c.keys[i]
+		}
+	}
+	if found == nil {
+		return Principal{}, errors.New("invalid API key")
+	}
+	return Principal{Name: found.Name, Role: found.Role, Method: "api_key"}, nil
+}
+
+func (c *credentials) authenticateJWT(token string) (Principal, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}),
+		jwt.WithExpirationRequired(),
+	}
+	if c.jwt.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(c.jwt.Issuer))
+	}
+	if c.jwt.Audience != "" {
+		opts = append(opts, jwt.WithAudience(c.jwt.Audience))
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(c.jwt.Secret), nil
+	}, opts...)
+	if err != nil {
+		return Principal{}, fmt.Errorf("invalid token: %v", err)
+	}
+
+	role := highestRole(claims[c.jwt.RoleClaim])
+	if role == RoleNone {
+		return Principal{}, fmt.Errorf("invalid token: no valid %q claim", c.jwt.RoleClaim)
+	}
+	subject, _ := claims.GetSubject()
+	return Principal{Name: subject, Role: role, Method: "jwt"}, nil
+}
+
+// highestRole returns the most privileged role named by a claim holding a
+// single role name or a list of names. Unknown names are ignored.
+func highestRole(claim interface{}) Role {
+	var names []string
+	switch v := claim.(type) {
+	case string:
+		names = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			if name, ok := item.(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+
+	best := RoleNone
+	for _, name := range names {
+		if role, err := ParseRole(name); err == nil && role > best {
+			best = role
+		}
+	}
+	return best
+}
@@ -0,0 +1,124 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"stock-consolidation/pkg/auth"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func sign(t *testing.T, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+	return token
+}
+
+func TestParseRole(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    auth.Role
+		wantErr bool
+	}{
+		{"reader", auth.RoleReader, false},
+		{"read-only", auth.RoleReader, false},
+		{"Operator", auth.RoleOperator, false},
+		{"admin", auth.RoleAdmin, false},
+		{"root", auth.RoleNone, true},
+	}
+	for _, tt := range tests {
+		got, err := auth.ParseRole(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRole(%q) = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+
+	if !auth.RoleAdmin.Allows(auth.RoleOperator) || auth.RoleReader.Allows(auth.RoleOperator) {
+		t.Error("Allows() does not follow reader < operator < admin")
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	const secret = "jwt-secret"
+	a := auth.NewAuthenticator([]auth.APIKey{
+		{Name: "dashboard", Role: auth.RoleReader, Key: "reader-key"},
+	}, auth.JWTConfig{Secret: secret, Issuer: "sso", Audience: "stock-consolidation"})
+
+	valid := jwt.MapClaims{
+		"sub":   "alice",
+		"iss":   "sso",
+		"aud":   "stock-consolidation",
+		"roles": []string{"reader", "operator"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+
+	t.Run("api key", func(t *testing.T) {
+		p, err := a.Authenticate("reader-key")
+		if err != nil || p.Name != "dashboard" || p.Role != auth.RoleReader || p.Method != "api_key" {
+			t.Errorf("Authenticate() = %+v, %v", p, err)
+		}
+		if _, err := a.Authenticate("wrong-key"); err == nil {
+			t.Error("Authenticate() expected error for unknown key, got nil")
+		}
+		if _, err := a.Authenticate(""); err != auth.ErrNoCredentials {
+			t.Errorf("Authenticate(\"\") error = %v, want ErrNoCredentials", err)
+		}
+	})
+
+	t.Run("jwt uses the highest role claim", func(t *testing.T) {
+		claims := jwt.MapClaims{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		claims["role"] = []string{"reader", "operator"}
+		p, err := auth.NewAuthenticator(nil, auth.JWTConfig{Secret: secret}).Authenticate(sign(t, secret, claims))
+		if err != nil || p.Name != "alice" || p.Role != auth.RoleOperator || p.Method != "jwt" {
+			t.Errorf("Authenticate() = %+v, %v", p, err)
+		}
+	})
+
+	t.Run("jwt with custom role claim", func(t *testing.T) {
+		a := auth.NewAuthenticator(nil, auth.JWTConfig{Secret: secret, Issuer: "sso", Audience: "stock-consolidation", RoleClaim: "roles"})
+		p, err := a.Authenticate(sign(t, secret, valid))
+		if err != nil || p.Role != auth.RoleOperator {
+			t.Errorf("Authenticate() = %+v, %v", p, err)
+		}
+	})
+
+	t.Run("invalid jwts are rejected", func(t *testing.T) {
+		tests := map[string]jwt.MapClaims{
+			"expired":      {"sub": "alice", "iss": "sso", "aud": "stock-consolidation", "role": "admin", "exp": time.Now().Add(-time.Minute).Unix()},
+			"no expiry":    {"sub": "alice", "iss": "sso", "aud": "stock-consolidation", "role": "admin"},
+			"wrong issuer": {"sub": "alice", "iss": "other", "aud": "stock-consolidation", "role": "admin", "exp": time.Now().Add(time.Hour).Unix()},
+			"no role":      {"sub": "alice", "iss": "sso", "aud": "stock-consolidation", "exp": time.Now().Add(time.Hour).Unix()},
+		}
+		for name, claims := range tests {
+			if _, err := a.Authenticate(sign(t, secret, claims)); err == nil {
+				t.Errorf("Authenticate() expected error for %s token, got nil", name)
+			}
+		}
+
+		withRole := jwt.MapClaims{"role": "admin", "iss": "sso", "aud": "stock-consolidation", "exp": time.Now().Add(time.Hour).Unix()}
+		if _, err := a.Authenticate(sign(t, "other-secret", withRole)); err == nil {
+			t.Error("Authenticate() expected error for token signed with another secret, got nil")
+		}
+	})
+
+	t.Run("update rotates credentials", func(t *testing.T) {
+		a := auth.NewAuthenticator([]auth.APIKey{{Name: "old", Role: auth.RoleAdmin, Key: "old-key"}}, auth.JWTConfig{})
+		a.Update([]auth.APIKey{{Name: "new", Role: auth.RoleAdmin, Key: "new-key"}}, auth.JWTConfig{})
+		if _, err := a.Authenticate("old-key"); err == nil {
+			t.Error("Authenticate() accepted a rotated key")
+		}
+		if _, err := a.Authenticate("new-key"); err != nil {
+			t.Errorf("Authenticate() error = %v for the new key", err)
+		}
+		if !a.Enabled() || auth.NewAuthenticator(nil, auth.JWTConfig{}).Enabled() {
+			t.Error("Enabled() should report whether credentials are configured")
+		}
+	})
+}
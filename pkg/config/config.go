@@ -2,8 +2,29 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"stock-consolidation/pkg/auth"
+)
+
+// Defaults for optional settings
+const (
+	defaultHealthHQFailureThreshold = 5 * time.Minute
+	defaultHealthMaxBacklog         = 80
+	defaultDeliveryHistorySize      = 10000
+	defaultDeliveryBufferSize       = 100000
+	defaultQuarantineSize           = 1000
+	defaultReservationTTL           = 15 * time.Minute
+	defaultReservationMaxTTL        = 24 * time.Hour
+	defaultReservationExpiry        = 30 * time.Second
+	defaultLeaderElectionInterval   = 5 * time.Second
 )
 
 // Config holds the application configuration
@@ -16,19 +37,183 @@ type Config struct {
 	ServicePort          string
 	HQEndPoint           string
 	HQBasicAuthorization string
+	// HQProductEndPoint, HQBranchEndPoint and HQStockMovementEndPoint receive
+	// the captured changes of the product, branch and stock_adjustment tables.
+	// Tables without an endpoint are not captured.
+	HQProductEndPoint       string
+	HQBranchEndPoint        string
+	HQStockMovementEndPoint string
+	Filter                  DeliveryFilter
+	// Channels names the notification channels listened on for each captured table
+	Channels NotifyChannels
+	// Sources are the branch databases consolidated by this process. Without
+	// BRANCH_SOURCES it is the single database of DB_*.
+	Sources []BranchSource
+	// HealthHQFailureThreshold is how long HQ deliveries may keep failing
+	// before the service reports itself as not ready
+	HealthHQFailureThreshold time.Duration
+	// HealthMaxBacklog is the number of undelivered changes above which the
+	// service reports itself as not ready
+	HealthMaxBacklog int
+	// DeliveryHistorySize is the number of delivery attempts kept for the
+	// /deliveries API
+	DeliveryHistorySize int
+	// DeliveryRateLimit is the maximum number of deliveries per second.
+	// Zero disables the limit.
+	DeliveryRateLimit float64
+	// DeliveryBufferSize is the number of changes held in memory while
+	// delivery is paused before the service stops reading notifications
+	DeliveryBufferSize int
+	// BranchTimezone is the IANA time zone of the branch database. It is used
+	// for legacy timestamps sent without a UTC offset.
+	BranchTimezone string
+	// QuarantineSize is the number of invalid stock changes kept for the
+	// /quarantine API
+	QuarantineSize int
+	// ReservationTTL is the lifetime of reservations created without one
+	ReservationTTL time.Duration
+	// ReservationMaxTTL is the longest lifetime a reservation may request
+	ReservationMaxTTL time.Duration
+	// ReservationExpiryInterval is how often expired reservations are released
+	ReservationExpiryInterval time.Duration
+	// LeaderLockID is the PostgreSQL advisory lock replicas compete for; only
+	// the holder forwards changes. Zero disables leader election.
+	LeaderLockID int
+	// LeaderElectionInterval is how often a standby tries to take the lock
+	// and the leader checks that its session is still alive
+	LeaderElectionInterval time.Duration
+	// APIKeys are the static keys accepted by the HTTP API
+	APIKeys []auth.APIKey
+	// JWT configures the JWT bearer tokens accepted by the HTTP API
+	JWT auth.JWTConfig
+	// ConfigFile is an optional dotenv file whose values override the
+	// environment and which is watched for hot reloads
+	ConfigFile string
+}
+
+// NotifyChannels names the PostgreSQL notification channels of each captured
+// table. A table can be notified on several channels, e.g. one per branch
+// schema in a shared database.
+type NotifyChannels struct {
+	Stock         []string
+	Product       []string
+	Branch        []string
+	StockMovement []string
+}
+
+// All returns every channel, stock channels first
+func (c NotifyChannels) All() []string {
+	var all []string
+	for _, channels := range [][]string{c.Stock, c.Product, c.Branch, c.StockMovement} {
+		all = append(all, channels...)
+	}
+	return all
+}
+
+// defaultSource names the branch source of DB_* when BRANCH_SOURCES is unset
+const defaultSource = "default"
+
+// BranchSource is a branch database consolidated by this process. Its
+// settings default to DB_*, BRANCH_TIMEZONE and STOCK_CHANNELS.
+type BranchSource struct {
+	Name string
+	// BranchID, when set, is the only branch_id the source may send
+	BranchID      int
+	DBHost        string
+	DBPort        string
+	DBName        string
+	DBUser        string
+	DBPassword    string
+	Timezone      string
+	StockChannels []string
+}
+
+// DeliveryFilter restricts which stock changes are forwarded to HQ.
+// Empty lists allow every product or branch.
+type DeliveryFilter struct {
+	ProductIDs []int
+	BranchIDs  []int
 }
 
-// Load loads the configuration from environment variables
+// Allows reports whether a change for the given product and branch should be forwarded
+func (f DeliveryFilter) Allows(productID, branchID int) bool {
+	return containsOrEmpty(f.ProductIDs, productID) && containsOrEmpty(f.BranchIDs, branchID)
+}
+
+func containsOrEmpty(ids []int, id int) bool {
+	if len(ids) == 0 {
+		return true
+	}
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Load loads the configuration from environment variables, overridden by the
+// values of CONFIG_FILE when it is set
 func Load() (*Config, error) {
+	return load(os.Getenv("CONFIG_FILE"))
+}
+
+func load(configFile string) (*Config, error) {
+	env := &envReader{}
+	if configFile != "" {
+		values, err := readEnvFile(configFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %v", err)
+		}
+		env.file = values
+	}
+
 	cfg := &Config{
-		DBHost:               os.Getenv("DB_HOST"),
-		DBPort:               os.Getenv("DB_PORT"),
-		DBName:               os.Getenv("DB_NAME"),
-		DBUser:               os.Getenv("DB_USER"),
-		DBPassword:           os.Getenv("DB_PASSWORD"),
-		ServicePort:          os.Getenv("SERVICE_PORT"),
-		HQEndPoint:           os.Getenv("HQ_END_POINT"),
-		HQBasicAuthorization: os.Getenv("HQ_BASIC_AUTHORIZATION"),
+		DBHost:                  env.get("DB_HOST"),
+		DBPort:                  env.get("DB_PORT"),
+		DBName:                  env.get("DB_NAME"),
+		DBUser:                  env.get("DB_USER"),
+		DBPassword:              env.get("DB_PASSWORD"),
+		ServicePort:             env.get("SERVICE_PORT"),
+		HQEndPoint:              env.get("HQ_END_POINT"),
+		HQBasicAuthorization:    env.get("HQ_BASIC_AUTHORIZATION"),
+		HQProductEndPoint:       env.get("HQ_PRODUCT_END_POINT"),
+		HQBranchEndPoint:        env.get("HQ_BRANCH_END_POINT"),
+		HQStockMovementEndPoint: env.get("HQ_STOCK_MOVEMENT_END_POINT"),
+		Channels: NotifyChannels{
+			Stock:         env.getChannels("STOCK_CHANNELS", "stock_changes"),
+			Product:       env.getChannels("PRODUCT_CHANNELS", "product_changes"),
+			Branch:        env.getChannels("BRANCH_CHANNELS", "branch_changes"),
+			StockMovement: env.getChannels("STOCK_MOVEMENT_CHANNELS", "stock_movement_changes"),
+		},
+		Filter: DeliveryFilter{
+			ProductIDs: env.getIntList("FILTER_PRODUCT_IDS"),
+			BranchIDs:  env.getIntList("FILTER_BRANCH_IDS"),
+		},
+		HealthHQFailureThreshold:  env.getDuration("HEALTH_HQ_FAILURE_THRESHOLD", defaultHealthHQFailureThreshold),
+		HealthMaxBacklog:          env.getInt("HEALTH_MAX_BACKLOG", defaultHealthMaxBacklog),
+		DeliveryHistorySize:       env.getInt("DELIVERY_HISTORY_SIZE", defaultDeliveryHistorySize),
+		DeliveryRateLimit:         env.getFloat("DELIVERY_RATE_LIMIT", 0),
+		DeliveryBufferSize:        env.getInt("DELIVERY_BUFFER_SIZE", defaultDeliveryBufferSize),
+		BranchTimezone:            env.getTimezone("BRANCH_TIMEZONE"),
+		QuarantineSize:            env.getInt("QUARANTINE_SIZE", defaultQuarantineSize),
+		ReservationTTL:            env.getDuration("RESERVATION_TTL", defaultReservationTTL),
+		ReservationMaxTTL:         env.getDuration("RESERVATION_MAX_TTL", defaultReservationMaxTTL),
+		ReservationExpiryInterval: env.getDuration("RESERVATION_EXPIRY_INTERVAL", defaultReservationExpiry),
+		LeaderLockID:              env.getInt("LEADER_LOCK_ID", 0),
+		LeaderElectionInterval:    env.getDuration("LEADER_ELECTION_INTERVAL", defaultLeaderElectionInterval),
+		APIKeys:                   env.getAPIKeys("AUTH_API_KEYS"),
+		JWT: auth.JWTConfig{
+			Secret:    env.get("AUTH_JWT_SECRET"),
+			Issuer:    env.get("AUTH_JWT_ISSUER"),
+			Audience:  env.get("AUTH_JWT_AUDIENCE"),
+			RoleClaim: env.get("AUTH_JWT_ROLE_CLAIM"),
+		},
+		ConfigFile: configFile,
+	}
+	cfg.Sources = env.getSources("BRANCH_SOURCES", cfg)
+	if env.err != nil {
+		return nil, env.err
 	}
 
 	if err := cfg.validate(); err != nil {
@@ -38,6 +223,293 @@ func Load() (*Config, error) {
 	return cfg, nil
 }
 
+// BranchLocation returns the location of BranchTimezone, or UTC if it is unset
+func (c Config) BranchLocation() *time.Location {
+	loc, err := time.LoadLocation(c.BranchTimezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// ForSource returns a copy of the configuration that connects to the
+// database of src, for the constructors that read DB_* from a Config
+func (c Config) ForSource(src BranchSource) *Config {
+	c.DBHost = src.DBHost
+	c.DBPort = src.DBPort
+	c.DBName = src.DBName
+	c.DBUser = src.DBUser
+	c.DBPassword = src.DBPassword
+	c.BranchTimezone = src.Timezone
+	c.Channels.Stock = src.StockChannels
+	c.Sources = []BranchSource{src}
+	return &c
+}
+
+// Source returns the branch source called name
+func (c Config) Source(name string) (BranchSource, bool) {
+	for _, src := range c.Sources {
+		if src.Name == name {
+			return src, true
+		}
+	}
+	return BranchSource{}, false
+}
+
+// Redacted returns a copy of the configuration with secret values masked
+func (c Config) Redacted() Config {
+	c.DBPassword = redact(c.DBPassword)
+	if c.Sources != nil {
+		sources := make([]BranchSource, len(c.Sources))
+		for i, src := range c.Sources {
+			src.DBPassword = redact(src.DBPassword)
+			sources[i] = src
+		}
+		c.Sources = sources
+	}
+	c.HQBasicAuthorization = redact(c.HQBasicAuthorization)
+	c.JWT.Secret = redact(c.JWT.Secret)
+	c.APIKeys = redactKeys(c.APIKeys)
+	return c
+}
+
+// redactKeys returns a copy of keys with the key values masked
+func redactKeys(keys []auth.APIKey) []auth.APIKey {
+	if keys == nil {
+		return nil
+	}
+	redacted := make([]auth.APIKey, len(keys))
+	for i, key := range keys {
+		key.Key = redact(key.Key)
+		redacted[i] = key
+	}
+	return redacted
+}
+
+// String implements fmt.Stringer so that logging the config never leaks secrets
+func (c Config) String() string {
+	type plain Config
+	return fmt.Sprintf("%+v", plain(c.Redacted()))
+}
+
+// GoString implements fmt.GoStringer for the %#v verb
+func (c Config) GoString() string {
+	return "config.Config" + c.String()
+}
+
+// MarshalJSON encodes the configuration with secret values masked
+func (c Config) MarshalJSON() ([]byte, error) {
+	type plain Config
+	return json.Marshal(plain(c.Redacted()))
+}
+
+// envReader reads variables from the config file and the environment and
+// keeps the first error
+type envReader struct {
+	file map[string]string
+	err  error
+}
+
+func (r *envReader) getenv(key string) string {
+	if value, ok := r.file[key]; ok {
+		return value
+	}
+	return os.Getenv(key)
+}
+
+func (r *envReader) get(key string) string {
+	if r.err != nil {
+		return ""
+	}
+	value, err := lookupEnv(key, r.getenv)
+	if err != nil {
+		r.err = err
+		return ""
+	}
+	return value
+}
+
+func (r *envReader) getInt(key string, def int) int {
+	value := r.get(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		r.fail(fmt.Errorf("%s must be a non-negative integer", key))
+		return def
+	}
+	return n
+}
+
+func (r *envReader) getFloat(key string, def float64) float64 {
+	value := r.get(key)
+	if value == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 {
+		r.fail(fmt.Errorf("%s must be a non-negative number", key))
+		return def
+	}
+	return f
+}
+
+func (r *envReader) getDuration(key string, def time.Duration) time.Duration {
+	value := r.get(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		r.fail(fmt.Errorf("%s must be a positive duration such as 30s or 5m", key))
+		return def
+	}
+	return d
+}
+
+// getTimezone reads an IANA time zone name such as Asia/Bangkok, defaulting to UTC
+func (r *envReader) getTimezone(key string) string {
+	value := r.get(key)
+	if value == "" {
+		return "UTC"
+	}
+	if _, err := time.LoadLocation(value); err != nil {
+		r.fail(fmt.Errorf("%s must be an IANA time zone such as Asia/Bangkok: %v", key, err))
+		return "UTC"
+	}
+	return value
+}
+
+func (r *envReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *envReader) getIntList(key string) []int {
+	value := r.get(key)
+	if value == "" {
+		return nil
+	}
+
+	var ids []int
+	for _, part := range strings.Split(value, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			r.fail(fmt.Errorf("%s must be a comma-separated list of integers", key))
+			return nil
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// channelName matches the channel names accepted for LISTEN: lower case
+// PostgreSQL identifiers, so that the triggers can name them unquoted
+var channelName = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// getChannels parses a comma-separated list of notification channel names
+func (r *envReader) getChannels(key, def string) []string {
+	value := r.get(key)
+	if value == "" {
+		value = def
+	}
+
+	var channels []string
+	for _, part := range strings.Split(value, ",") {
+		channel := strings.TrimSpace(part)
+		if !channelName.MatchString(channel) {
+			r.fail(fmt.Errorf("%s: invalid channel name %q: use lower case letters, digits and underscores", key, channel))
+			return nil
+		}
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// sourceName matches the names accepted in BRANCH_SOURCES and REGIONS
+var sourceName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// getSources parses the comma-separated source names of key. The settings of
+// source <name> are read from BRANCH_SOURCE_<NAME>_<SETTING> and default to
+// those of cfg.
+func (r *envReader) getSources(key string, cfg *Config) []BranchSource {
+	value := r.get(key)
+	if value == "" {
+		return []BranchSource{{
+			Name:          defaultSource,
+			DBHost:        cfg.DBHost,
+			DBPort:        cfg.DBPort,
+			DBName:        cfg.DBName,
+			DBUser:        cfg.DBUser,
+			DBPassword:    cfg.DBPassword,
+			Timezone:      cfg.BranchTimezone,
+			StockChannels: cfg.Channels.Stock,
+		}}
+	}
+
+	orDefault := func(key, def string) string {
+		if value := r.get(key); value != "" {
+			return value
+		}
+		return def
+	}
+	var sources []BranchSource
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(value, ",") {
+		name := strings.TrimSpace(part)
+		if !sourceName.MatchString(name) || seen[name] {
+			r.fail(fmt.Errorf("%s: invalid or repeated source name %q: use lower case letters, digits and underscores", key, name))
+			return nil
+		}
+		seen[name] = true
+
+		prefix := "BRANCH_SOURCE_" + strings.ToUpper(name) + "_"
+		src := BranchSource{
+			Name:          name,
+			BranchID:      r.getInt(prefix+"BRANCH_ID", 0),
+			DBHost:        orDefault(prefix+"DB_HOST", cfg.DBHost),
+			DBPort:        orDefault(prefix+"DB_PORT", cfg.DBPort),
+			DBName:        orDefault(prefix+"DB_NAME", cfg.DBName),
+			DBUser:        orDefault(prefix+"DB_USER", cfg.DBUser),
+			DBPassword:    orDefault(prefix+"DB_PASSWORD", cfg.DBPassword),
+			Timezone:      orDefault(prefix+"TIMEZONE", cfg.BranchTimezone),
+			StockChannels: r.getChannels(prefix+"STOCK_CHANNELS", strings.Join(cfg.Channels.Stock, ",")),
+		}
+		if _, err := time.LoadLocation(src.Timezone); err != nil {
+			r.fail(fmt.Errorf("%sTIMEZONE: unknown time zone %q", prefix, src.Timezone))
+			return nil
+		}
+		sources = append(sources, src)
+	}
+	return sources
+}
+
+// getAPIKeys parses a comma-separated list of name:role:key entries
+func (r *envReader) getAPIKeys(key string) []auth.APIKey {
+	value := r.get(key)
+	if value == "" {
+		return nil
+	}
+
+	var keys []auth.APIKey
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			r.fail(fmt.Errorf("%s must be a comma-separated list of name:role:key entries", key))
+			return nil
+		}
+		role, err := auth.ParseRole(parts[1])
+		if err != nil {
+			r.fail(fmt.Errorf("%s: key %s: %v", key, parts[0], err))
+			return nil
+		}
+		keys = append(keys, auth.APIKey{Name: parts[0], Role: role, Key: parts[2]})
+	}
+	return keys
+}
+
 func (c *Config) validate() error {
 	if c.DBHost == "" {
 		return fmt.Errorf("DB_HOST is required")
@@ -60,8 +532,35 @@ func (c *Config) validate() error {
 	if c.HQEndPoint == "" {
 		return fmt.Errorf("HQ_END_POINT is required")
 	}
+	if !absoluteURL(c.HQEndPoint) {
+		return fmt.Errorf("HQ_END_POINT must be an absolute URL")
+	}
 	if c.HQBasicAuthorization == "" {
 		return fmt.Errorf("HQ_BASIC_AUTHORIZATION is required")
 	}
+	seen := make(map[string]bool)
+	for _, channel := range c.Channels.All() {
+		if seen[channel] {
+			return fmt.Errorf("notification channel %s is configured more than once", channel)
+		}
+		seen[channel] = true
+	}
+	if c.LeaderElectionInterval <= 0 {
+		return fmt.Errorf("LEADER_ELECTION_INTERVAL must be positive")
+	}
+	for _, endpoint := range []struct{ name, value string }{
+		{"HQ_PRODUCT_END_POINT", c.HQProductEndPoint},
+		{"HQ_BRANCH_END_POINT", c.HQBranchEndPoint},
+		{"HQ_STOCK_MOVEMENT_END_POINT", c.HQStockMovementEndPoint},
+	} {
+		if endpoint.value != "" && !absoluteURL(endpoint.value) {
+			return fmt.Errorf("%s must be an absolute URL", endpoint.name)
+		}
+	}
 	return nil
 }
+
+func absoluteURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
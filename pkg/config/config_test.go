@@ -2,8 +2,12 @@ package config_test
 
 import (
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"stock-consolidation/pkg/auth"
 	"stock-consolidation/pkg/config"
 )
 
@@ -123,3 +127,256 @@ func TestLoadConfig(t *testing.T) {
 		}
 	})
 }
+
+func TestHealthSettings(t *testing.T) {
+	setRequiredEnv(t)
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.HealthHQFailureThreshold != 5*time.Minute || cfg.HealthMaxBacklog != 80 {
+		t.Errorf("LoadConfig() health defaults = %v, %v", cfg.HealthHQFailureThreshold, cfg.HealthMaxBacklog)
+	}
+
+	setEnv(t, "HEALTH_HQ_FAILURE_THRESHOLD", "30s")
+	setEnv(t, "HEALTH_MAX_BACKLOG", "10")
+	if cfg, err = config.Load(); err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.HealthHQFailureThreshold != 30*time.Second || cfg.HealthMaxBacklog != 10 {
+		t.Errorf("LoadConfig() health settings = %v, %v", cfg.HealthHQFailureThreshold, cfg.HealthMaxBacklog)
+	}
+
+	if cfg.DeliveryHistorySize != 10000 {
+		t.Errorf("LoadConfig() DeliveryHistorySize = %d, want 10000", cfg.DeliveryHistorySize)
+	}
+	if cfg.DeliveryRateLimit != 0 || cfg.DeliveryBufferSize != 100000 {
+		t.Errorf("LoadConfig() delivery defaults = %v, %d", cfg.DeliveryRateLimit, cfg.DeliveryBufferSize)
+	}
+	if cfg.QuarantineSize != 1000 {
+		t.Errorf("LoadConfig() QuarantineSize = %d, want 1000", cfg.QuarantineSize)
+	}
+	if cfg.ReservationTTL != 15*time.Minute || cfg.ReservationMaxTTL != 24*time.Hour || cfg.ReservationExpiryInterval != 30*time.Second {
+		t.Errorf("LoadConfig() reservation defaults = %v, %v, %v", cfg.ReservationTTL, cfg.ReservationMaxTTL, cfg.ReservationExpiryInterval)
+	}
+
+	setEnv(t, "DELIVERY_RATE_LIMIT", "2.5")
+	if cfg, err = config.Load(); err != nil || cfg.DeliveryRateLimit != 2.5 {
+		t.Errorf("LoadConfig() DeliveryRateLimit = %v, %v, want 2.5", cfg, err)
+	}
+	setEnv(t, "DELIVERY_RATE_LIMIT", "-1")
+	if _, err := config.Load(); err == nil {
+		t.Error("LoadConfig() expected error for negative DELIVERY_RATE_LIMIT, got nil")
+	}
+	setEnv(t, "DELIVERY_RATE_LIMIT", "")
+
+	setEnv(t, "HEALTH_HQ_FAILURE_THRESHOLD", "soon")
+	if _, err := config.Load(); err == nil {
+		t.Error("LoadConfig() expected error for invalid HEALTH_HQ_FAILURE_THRESHOLD, got nil")
+	}
+}
+
+func TestBranchTimezone(t *testing.T) {
+	setRequiredEnv(t)
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.BranchTimezone != "UTC" || cfg.BranchLocation() != time.UTC {
+		t.Errorf("LoadConfig() BranchTimezone = %q, want UTC", cfg.BranchTimezone)
+	}
+
+	setEnv(t, "BRANCH_TIMEZONE", "Asia/Bangkok")
+	if cfg, err = config.Load(); err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.BranchLocation().String() != "Asia/Bangkok" {
+		t.Errorf("BranchLocation() = %v, want Asia/Bangkok", cfg.BranchLocation())
+	}
+
+	setEnv(t, "BRANCH_TIMEZONE", "Mars/Olympus_Mons")
+	if _, err := config.Load(); err == nil {
+		t.Error("LoadConfig() expected error for unknown BRANCH_TIMEZONE, got nil")
+	}
+}
+
+func TestCaptureEndpoints(t *testing.T) {
+	cfg, path := loadWithConfigFile(t, "HQ_PRODUCT_END_POINT=http://hq/products\nHQ_STOCK_MOVEMENT_END_POINT=http://hq/movements\n")
+	if cfg.HQProductEndPoint != "http://hq/products" || cfg.HQBranchEndPoint != "" || cfg.HQStockMovementEndPoint != "http://hq/movements" {
+		t.Errorf("LoadConfig() capture endpoints = %q, %q, %q", cfg.HQProductEndPoint, cfg.HQBranchEndPoint, cfg.HQStockMovementEndPoint)
+	}
+
+	writeConfigFile(t, path, "HQ_BRANCH_END_POINT=/branches\n")
+	if _, err := config.Load(); err == nil || err.Error() != "HQ_BRANCH_END_POINT must be an absolute URL" {
+		t.Errorf("LoadConfig() error = %v, want HQ_BRANCH_END_POINT error", err)
+	}
+}
+
+func TestNotifyChannels(t *testing.T) {
+	setRequiredEnv(t)
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	want := []string{"stock_changes", "product_changes", "branch_changes", "stock_movement_changes"}
+	if got := cfg.Channels.All(); !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadConfig() channels = %v, want defaults %v", got, want)
+	}
+
+	setEnv(t, "STOCK_CHANNELS", "branch1_stock_changes, branch2_stock_changes")
+	if cfg, err = config.Load(); err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if want := []string{"branch1_stock_changes", "branch2_stock_changes"}; !reflect.DeepEqual(cfg.Channels.Stock, want) {
+		t.Errorf("LoadConfig() Channels.Stock = %v, want %v", cfg.Channels.Stock, want)
+	}
+
+	setEnv(t, "STOCK_CHANNELS", "Stock-Changes")
+	if _, err := config.Load(); err == nil {
+		t.Error("LoadConfig() expected error for an invalid channel name, got nil")
+	}
+
+	setEnv(t, "STOCK_CHANNELS", "shared_changes")
+	setEnv(t, "PRODUCT_CHANNELS", "shared_changes")
+	if _, err := config.Load(); err == nil || err.Error() != "notification channel shared_changes is configured more than once" {
+		t.Errorf("LoadConfig() error = %v, want duplicate channel error", err)
+	}
+}
+
+func TestBranchSources(t *testing.T) {
+	setRequiredEnv(t)
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if len(cfg.Sources) != 1 || cfg.Sources[0].Name != "default" || cfg.Sources[0].DBHost != cfg.DBHost {
+		t.Errorf("LoadConfig() Sources = %+v, want the DB_* database as default", cfg.Sources)
+	}
+
+	setEnv(t, "BRANCH_TIMEZONE", "Asia/Bangkok")
+	setEnv(t, "BRANCH_SOURCES", "bkk, cnx")
+	setEnv(t, "BRANCH_SOURCE_BKK_BRANCH_ID", "1")
+	setEnv(t, "BRANCH_SOURCE_CNX_BRANCH_ID", "2")
+	setEnv(t, "BRANCH_SOURCE_CNX_DB_HOST", "cnx-db")
+	setEnv(t, "BRANCH_SOURCE_CNX_DB_PASSWORD", "cnx-secret")
+	setEnv(t, "BRANCH_SOURCE_CNX_TIMEZONE", "UTC")
+	setEnv(t, "BRANCH_SOURCE_CNX_STOCK_CHANNELS", "cnx_stock_changes")
+	if cfg, err = config.Load(); err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	want := []config.BranchSource{
+		{
+			Name: "bkk", BranchID: 1,
+			DBHost: cfg.DBHost, DBPort: cfg.DBPort, DBName: cfg.DBName, DBUser: cfg.DBUser, DBPassword: cfg.DBPassword,
+			Timezone: "Asia/Bangkok", StockChannels: []string{"stock_changes"},
+		},
+		{
+			Name: "cnx", BranchID: 2,
+			DBHost: "cnx-db", DBPort: cfg.DBPort, DBName: cfg.DBName, DBUser: cfg.DBUser, DBPassword: "cnx-secret",
+			Timezone: "UTC", StockChannels: []string{"cnx_stock_changes"},
+		},
+	}
+	if !reflect.DeepEqual(cfg.Sources, want) {
+		t.Errorf("LoadConfig() Sources = %+v, want %+v", cfg.Sources, want)
+	}
+
+	src, ok := cfg.Source("cnx")
+	if !ok {
+		t.Fatal("Source(cnx) not found")
+	}
+	srcCfg := cfg.ForSource(src)
+	if srcCfg.DBHost != "cnx-db" || srcCfg.BranchTimezone != "UTC" || !reflect.DeepEqual(srcCfg.Channels.Stock, src.StockChannels) {
+		t.Errorf("ForSource() = %+v", srcCfg)
+	}
+	if cfg.DBHost == "cnx-db" {
+		t.Error("ForSource() modified the original configuration")
+	}
+	if s := cfg.String(); strings.Contains(s, "cnx-secret") {
+		t.Errorf("String() leaks the source password: %s", s)
+	}
+	if cfg.Sources[1].DBPassword != "cnx-secret" {
+		t.Error("Redacted() modified the original sources")
+	}
+
+	for _, value := range []string{"bkk,bkk", "Bangkok", "bkk,"} {
+		setEnv(t, "BRANCH_SOURCES", value)
+		if _, err := config.Load(); err == nil {
+			t.Errorf("LoadConfig() with BRANCH_SOURCES=%q expected error, got nil", value)
+		}
+	}
+	setEnv(t, "BRANCH_SOURCES", "cnx")
+	setEnv(t, "BRANCH_SOURCE_CNX_TIMEZONE", "Mars/Olympus")
+	if _, err := config.Load(); err == nil {
+		t.Error("LoadConfig() expected error for an unknown source time zone, got nil")
+	}
+}
+
+func TestLeaderElectionSettings(t *testing.T) {
+	setRequiredEnv(t)
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.LeaderLockID != 0 || cfg.LeaderElectionInterval != 5*time.Second {
+		t.Errorf("LoadConfig() leader election = %d every %v, want disabled every 5s", cfg.LeaderLockID, cfg.LeaderElectionInterval)
+	}
+
+	setEnv(t, "LEADER_LOCK_ID", "7301")
+	setEnv(t, "LEADER_ELECTION_INTERVAL", "2s")
+	if cfg, err = config.Load(); err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.LeaderLockID != 7301 || cfg.LeaderElectionInterval != 2*time.Second {
+		t.Errorf("LoadConfig() leader election = %d every %v, want 7301 every 2s", cfg.LeaderLockID, cfg.LeaderElectionInterval)
+	}
+
+	setEnv(t, "LEADER_ELECTION_INTERVAL", "0s")
+	if _, err := config.Load(); err == nil {
+		t.Error("LoadConfig() expected error for a zero election interval, got nil")
+	}
+}
+
+func TestAuthSettings(t *testing.T) {
+	setRequiredEnv(t)
+	setEnv(t, "AUTH_API_KEYS", "dashboard:reader:key-1, ops:operator:key:2, root:admin:admin-key")
+	setEnv(t, "AUTH_JWT_SECRET", "jwt-secret")
+	defer func() {
+		for _, key := range []string{"AUTH_API_KEYS", "AUTH_JWT_SECRET"} {
+			_ = os.Unsetenv(key)
+		}
+	}()
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	want := []auth.APIKey{
+		{Name: "dashboard", Role: auth.RoleReader, Key: "key-1"},
+		{Name: "ops", Role: auth.RoleOperator, Key: "key:2"},
+		{Name: "root", Role: auth.RoleAdmin, Key: "admin-key"},
+	}
+	if !reflect.DeepEqual(cfg.APIKeys, want) {
+		t.Errorf("LoadConfig() APIKeys = %+v, want %+v", cfg.APIKeys, want)
+	}
+	if cfg.JWT.Secret != "jwt-secret" {
+		t.Errorf("LoadConfig() JWT.Secret = %q", cfg.JWT.Secret)
+	}
+	if s := cfg.String(); strings.Contains(s, "key-1") || strings.Contains(s, "jwt-secret") || strings.Contains(s, "admin-key") {
+		t.Errorf("String() leaks credentials: %s", s)
+	}
+	if cfg.APIKeys[0].Key != "key-1" {
+		t.Error("Redacted() modified the original API keys")
+	}
+
+	for _, invalid := range []string{"dashboard:reader", "dashboard:root:key", ":reader:key"} {
+		setEnv(t, "AUTH_API_KEYS", invalid)
+		if _, err := config.Load(); err == nil {
+			t.Errorf("LoadConfig() expected error for AUTH_API_KEYS=%q, got nil", invalid)
+		}
+	}
+}
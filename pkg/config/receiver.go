@@ -0,0 +1,309 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"stock-consolidation/pkg/auth"
+)
+
+// defaultReceiverPort is the port of the HQ receiver, matching the HQ
+// endpoint of the example configuration
+const defaultReceiverPort = "8085"
+
+// defaultAlertCooldown is the minimum time between two alerts of the same
+// kind for the same product and branch
+const defaultAlertCooldown = time.Hour
+
+// ReceiverConfig holds the configuration of the HQ receiver, which stores the
+// stock changes sent by the branches in the HQ database
+type ReceiverConfig struct {
+	DBHost     string
+	DBPort     string
+	DBName     string
+	DBUser     string
+	DBPassword string
+	// Port is the HTTP port the receiver listens on
+	Port string
+	// Authorizations are the Authorization header values accepted from the
+	// branches, i.e. their HQ_BASIC_AUTHORIZATION
+	Authorizations []string
+	// Regions group branches for the aggregation endpoints. A branch belongs
+	// to at most one region.
+	Regions []Region
+	// SafetyStock is the number of available units a branch should hold of
+	// each product
+	SafetyStock StockLevels
+	// Alert configures the alerts sent for low, dropping and negative stock
+	Alert AlertConfig
+	// APIKeys and JWT authenticate the read endpoints like they do for the
+	// branch service
+	APIKeys []auth.APIKey
+	JWT     auth.JWTConfig
+	// ConfigFile is an optional dotenv file whose values override the environment
+	ConfigFile string
+}
+
+// Region is a named group of branches
+type Region struct {
+	Name      string
+	BranchIDs []int
+}
+
+// StockLevels holds a number of available units per product, per branch and
+// by default, such as the safety stock. Zero values mean no minimum.
+type StockLevels struct {
+	Default  int
+	Products map[int]int
+	Branches map[int]int
+}
+
+// AlertConfig configures the alerts raised from the stock changes the receiver
+// ingests. Alerting is disabled when no webhook is configured.
+type AlertConfig struct {
+	// Webhooks are the URLs every alert is posted to
+	Webhooks []string
+	// WebhookAuthorization is sent as the Authorization header, if set
+	WebhookAuthorization string
+	// LowStock is the number of available units below which a low stock alert
+	// is raised. Zero values disable the alert.
+	LowStock StockLevels
+	// DropPercent is the share of the available units, in percent, a single
+	// change must remove to raise a sudden drop alert. Zero disables the alert.
+	DropPercent int
+	// DropMinUnits is the number of units a sudden drop must remove at least
+	DropMinUnits int
+	// Cooldown is the minimum time between two alerts of the same kind for
+	// the same product and branch
+	Cooldown time.Duration
+}
+
+// Enabled reports whether alerts are sent
+func (c AlertConfig) Enabled() bool {
+	return len(c.Webhooks) > 0
+}
+
+// LoadReceiver loads the receiver configuration from environment variables,
+// overridden by the values of CONFIG_FILE when it is set
+func LoadReceiver() (*ReceiverConfig, error) {
+	return loadReceiver(os.Getenv("CONFIG_FILE"))
+}
+
+func loadReceiver(configFile string) (*ReceiverConfig, error) {
+	env := &envReader{}
+	if configFile != "" {
+		values, err := readEnvFile(configFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %v", err)
+		}
+		env.file = values
+	}
+
+	cfg := &ReceiverConfig{
+		DBHost:     env.get("DB_HOST"),
+		DBPort:     env.get("DB_PORT"),
+		DBName:     env.get("DB_NAME"),
+		DBUser:     env.get("DB_USER"),
+		DBPassword: env.get("DB_PASSWORD"),
+		Port:       env.get("RECEIVER_PORT"),
+		APIKeys:    env.getAPIKeys("AUTH_API_KEYS"),
+		JWT: auth.JWTConfig{
+			Secret:    env.get("AUTH_JWT_SECRET"),
+			Issuer:    env.get("AUTH_JWT_ISSUER"),
+			Audience:  env.get("AUTH_JWT_AUDIENCE"),
+			RoleClaim: env.get("AUTH_JWT_ROLE_CLAIM"),
+		},
+		Regions: env.getRegions("REGIONS"),
+		SafetyStock: StockLevels{
+			Default:  env.getInt("SAFETY_STOCK", 0),
+			Products: env.getIntMap("SAFETY_STOCK_PRODUCTS"),
+			Branches: env.getIntMap("SAFETY_STOCK_BRANCHES"),
+		},
+		Alert: AlertConfig{
+			Webhooks:             env.getList("ALERT_WEBHOOKS"),
+			WebhookAuthorization: env.get("ALERT_WEBHOOK_AUTHORIZATION"),
+			LowStock: StockLevels{
+				Default:  env.getInt("ALERT_LOW_STOCK", 0),
+				Products: env.getIntMap("ALERT_LOW_STOCK_PRODUCTS"),
+				Branches: env.getIntMap("ALERT_LOW_STOCK_BRANCHES"),
+			},
+			DropPercent:  env.getInt("ALERT_DROP_PERCENT", 0),
+			DropMinUnits: env.getInt("ALERT_DROP_MIN_UNITS", 0),
+			Cooldown:     env.getDuration("ALERT_COOLDOWN", defaultAlertCooldown),
+		},
+		ConfigFile: configFile,
+	}
+	cfg.Authorizations = env.getList("RECEIVER_AUTHORIZATIONS")
+	if env.err != nil {
+		return nil, env.err
+	}
+	if cfg.Port == "" {
+		cfg.Port = defaultReceiverPort
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *ReceiverConfig) validate() error {
+	for _, required := range []struct{ name, value string }{
+		{"DB_HOST", c.DBHost},
+		{"DB_PORT", c.DBPort},
+		{"DB_NAME", c.DBName},
+		{"DB_USER", c.DBUser},
+		{"DB_PASSWORD", c.DBPassword},
+	} {
+		if required.value == "" {
+			return fmt.Errorf("%s is required", required.name)
+		}
+	}
+	if len(c.Authorizations) == 0 {
+		return fmt.Errorf("RECEIVER_AUTHORIZATIONS is required")
+	}
+	for _, webhook := range c.Alert.Webhooks {
+		if !absoluteURL(webhook) {
+			return fmt.Errorf("ALERT_WEBHOOKS must be a comma-separated list of absolute URLs")
+		}
+	}
+	if c.Alert.DropPercent > 100 {
+		return fmt.Errorf("ALERT_DROP_PERCENT must be at most 100")
+	}
+	return nil
+}
+
+// getList parses a comma-separated list, ignoring empty entries
+func (r *envReader) getList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(r.get(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getRegions parses a comma-separated list of region names, each with the
+// branches listed in REGION_<NAME>_BRANCH_IDS
+func (r *envReader) getRegions(key string) []Region {
+	value := r.get(key)
+	if value == "" {
+		return nil
+	}
+
+	var regions []Region
+	seen := make(map[string]bool)
+	regionOf := make(map[int]string)
+	for _, part := range strings.Split(value, ",") {
+		name := strings.TrimSpace(part)
+		if !sourceName.MatchString(name) || seen[name] {
+			r.fail(fmt.Errorf("%s: invalid or repeated region name %q: use lower case letters, digits and underscores", key, name))
+			return nil
+		}
+		seen[name] = true
+
+		branchKey := "REGION_" + strings.ToUpper(name) + "_BRANCH_IDS"
+		region := Region{Name: name, BranchIDs: r.getIntList(branchKey)}
+		if r.err != nil {
+			return nil
+		}
+		if len(region.BranchIDs) == 0 {
+			r.fail(fmt.Errorf("%s is required for region %s", branchKey, name))
+			return nil
+		}
+		for _, id := range region.BranchIDs {
+			if other, ok := regionOf[id]; ok {
+				r.fail(fmt.Errorf("%s: branch %d is already in region %s", branchKey, id, other))
+				return nil
+			}
+			regionOf[id] = name
+		}
+		regions = append(regions, region)
+	}
+	return regions
+}
+
+// getIntMap parses a comma-separated list of id:value entries with
+// non-negative values
+func (r *envReader) getIntMap(key string) map[int]int {
+	value := r.get(key)
+	if value == "" {
+		return nil
+	}
+
+	m := make(map[int]int)
+	for _, entry := range strings.Split(value, ",") {
+		id, n, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		k, idErr := strconv.Atoi(id)
+		v, valueErr := strconv.Atoi(n)
+		if !ok || idErr != nil || valueErr != nil || v < 0 {
+			r.fail(fmt.Errorf("%s must be a comma-separated list of id:units entries", key))
+			return nil
+		}
+		m[k] = v
+	}
+	return m
+}
+
+// Database returns the connection settings of the HQ database as a Config,
+// for the postgres constructors that read DB_* from one
+func (c ReceiverConfig) Database() *Config {
+	return &Config{
+		DBHost:     c.DBHost,
+		DBPort:     c.DBPort,
+		DBName:     c.DBName,
+		DBUser:     c.DBUser,
+		DBPassword: c.DBPassword,
+	}
+}
+
+// Redacted returns a copy of the configuration with secret values masked
+func (c ReceiverConfig) Redacted() ReceiverConfig {
+	c.DBPassword = redact(c.DBPassword)
+	if c.Authorizations != nil {
+		authorizations := make([]string, len(c.Authorizations))
+		for i, value := range c.Authorizations {
+			authorizations[i] = redact(value)
+		}
+		c.Authorizations = authorizations
+	}
+	if c.Alert.Webhooks != nil {
+		// Webhook URLs often carry their token in the path
+		webhooks := make([]string, len(c.Alert.Webhooks))
+		for i, webhook := range c.Alert.Webhooks {
+			webhooks[i] = redactURLPath(webhook)
+		}
+		c.Alert.Webhooks = webhooks
+	}
+	c.Alert.WebhookAuthorization = redact(c.Alert.WebhookAuthorization)
+	c.JWT.Secret = redact(c.JWT.Secret)
+	c.APIKeys = redactKeys(c.APIKeys)
+	return c
+}
+
+// redactURLPath masks everything of an absolute URL but its scheme and host
+func redactURLPath(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return redact(value)
+	}
+	return u.Scheme + "://" + u.Host + "/" + redactedValue
+}
+
+// String implements fmt.Stringer so that logging the config never leaks secrets
+func (c ReceiverConfig) String() string {
+	type plain ReceiverConfig
+	return fmt.Sprintf("%+v", plain(c.Redacted()))
+}
+
+// MarshalJSON encodes the configuration with secret values masked
+func (c ReceiverConfig) MarshalJSON() ([]byte, error) {
+	type plain ReceiverConfig
+	return json.Marshal(plain(c.Redacted()))
+}
@@ -0,0 +1,216 @@
+package config_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"stock-consolidation/pkg/auth"
+	"stock-consolidation/pkg/config"
+)
+
+func TestLoadReceiver(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		setRequiredEnv(t, "SERVICE_PORT", "HQ_END_POINT", "HQ_BASIC_AUTHORIZATION")
+		setEnv(t, "RECEIVER_AUTHORIZATIONS", "Basic YnJhbmNoMTpzZWNyZXQ=, Basic YnJhbmNoMjpzZWNyZXQ=")
+
+		cfg, err := config.LoadReceiver()
+		if err != nil {
+			t.Fatalf("LoadReceiver() error = %v", err)
+		}
+		if cfg.Port != "8085" {
+			t.Errorf("Port = %q, want 8085", cfg.Port)
+		}
+		if len(cfg.Authorizations) != 2 || cfg.Authorizations[1] != "Basic YnJhbmNoMjpzZWNyZXQ=" {
+			t.Errorf("Authorizations = %q", cfg.Authorizations)
+		}
+		if db := cfg.Database(); db.DBHost != "localhost" || db.DBPassword != "admin" {
+			t.Errorf("Database() = %+v", db)
+		}
+	})
+
+	t.Run("settings from the config file", func(t *testing.T) {
+		setRequiredEnv(t)
+		path := filepath.Join(t.TempDir(), "receiver.env")
+		writeConfigFile(t, path, "RECEIVER_PORT=9000\nRECEIVER_AUTHORIZATIONS=Basic abc\nAUTH_API_KEYS=root:admin:root-key\n")
+		setEnv(t, "CONFIG_FILE", path)
+
+		cfg, err := config.LoadReceiver()
+		if err != nil {
+			t.Fatalf("LoadReceiver() error = %v", err)
+		}
+		if cfg.Port != "9000" || cfg.ConfigFile != path {
+			t.Errorf("LoadReceiver() = %+v", cfg)
+		}
+		if len(cfg.APIKeys) != 1 || cfg.APIKeys[0].Role != auth.RoleAdmin {
+			t.Errorf("APIKeys = %+v, want the admin key", cfg.APIKeys)
+		}
+	})
+
+	t.Run("requires the branch authorizations and database", func(t *testing.T) {
+		setRequiredEnv(t)
+		if _, err := config.LoadReceiver(); err == nil || err.Error() != "RECEIVER_AUTHORIZATIONS is required" {
+			t.Errorf("LoadReceiver() error = %v, want RECEIVER_AUTHORIZATIONS error", err)
+		}
+
+		setRequiredEnv(t, "DB_NAME")
+		setEnv(t, "RECEIVER_AUTHORIZATIONS", "Basic abc")
+		if _, err := config.LoadReceiver(); err == nil || err.Error() != "DB_NAME is required" {
+			t.Errorf("LoadReceiver() error = %v, want DB_NAME error", err)
+		}
+	})
+
+	t.Run("secrets are redacted", func(t *testing.T) {
+		setRequiredEnv(t)
+		setEnv(t, "RECEIVER_AUTHORIZATIONS", "Basic YnJhbmNoOnNlY3JldA==")
+		setEnv(t, "AUTH_API_KEYS", "dashboard:reader:dashboard-key")
+		setEnv(t, "DB_PASSWORD", "hq-db-password")
+
+		cfg, err := config.LoadReceiver()
+		if err != nil {
+			t.Fatalf("LoadReceiver() error = %v", err)
+		}
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		for _, out := range []string{cfg.String(), fmt.Sprint(cfg), string(data)} {
+			for _, secret := range []string{"YnJhbmNoOnNlY3JldA==", "dashboard-key", "hq-db-password"} {
+				if strings.Contains(out, secret) {
+					t.Errorf("output leaks %q: %s", secret, out)
+				}
+			}
+		}
+		if cfg.Authorizations[0] != "Basic YnJhbmNoOnNlY3JldA==" {
+			t.Error("Redacted() modified the original configuration")
+		}
+	})
+}
+
+func TestReceiverAggregationSettings(t *testing.T) {
+	t.Run("regions and safety stock", func(t *testing.T) {
+		setRequiredEnv(t)
+		setEnv(t, "RECEIVER_AUTHORIZATIONS", "Basic abc")
+		setEnv(t, "REGIONS", "north, central")
+		setEnv(t, "REGION_NORTH_BRANCH_IDS", "1,2")
+		setEnv(t, "REGION_CENTRAL_BRANCH_IDS", "3")
+		setEnv(t, "SAFETY_STOCK", "10")
+		setEnv(t, "SAFETY_STOCK_PRODUCTS", "42:25, 43:0")
+		setEnv(t, "SAFETY_STOCK_BRANCHES", "3:5")
+
+		cfg, err := config.LoadReceiver()
+		if err != nil {
+			t.Fatalf("LoadReceiver() error = %v", err)
+		}
+		if len(cfg.Regions) != 2 || cfg.Regions[0].Name != "north" || len(cfg.Regions[0].BranchIDs) != 2 || cfg.Regions[1].BranchIDs[0] != 3 {
+			t.Errorf("Regions = %+v", cfg.Regions)
+		}
+		safety := cfg.SafetyStock
+		if safety.Default != 10 || safety.Products[42] != 25 || safety.Products[43] != 0 || safety.Branches[3] != 5 {
+			t.Errorf("SafetyStock = %+v", safety)
+		}
+	})
+
+	for _, tt := range []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{"region without branches", map[string]string{"REGIONS": "north"}, "REGION_NORTH_BRANCH_IDS is required for region north"},
+		{"branch in two regions", map[string]string{
+			"REGIONS": "north,south", "REGION_NORTH_BRANCH_IDS": "1", "REGION_SOUTH_BRANCH_IDS": "2,1",
+		}, "REGION_SOUTH_BRANCH_IDS: branch 1 is already in region north"},
+		{"invalid region name", map[string]string{"REGIONS": "North"}, `REGIONS: invalid or repeated region name "North": use lower case letters, digits and underscores`},
+		{"invalid safety stock", map[string]string{"SAFETY_STOCK_PRODUCTS": "42=25"}, "SAFETY_STOCK_PRODUCTS must be a comma-separated list of id:units entries"},
+		{"negative safety stock", map[string]string{"SAFETY_STOCK_BRANCHES": "3:-1"}, "SAFETY_STOCK_BRANCHES must be a comma-separated list of id:units entries"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequiredEnv(t)
+			setEnv(t, "RECEIVER_AUTHORIZATIONS", "Basic abc")
+			for key, value := range tt.env {
+				setEnv(t, key, value)
+			}
+			if _, err := config.LoadReceiver(); err == nil || err.Error() != tt.wantErr {
+				t.Errorf("LoadReceiver() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReceiverAlertSettings(t *testing.T) {
+	t.Run("disabled by default", func(t *testing.T) {
+		setRequiredEnv(t)
+		setEnv(t, "RECEIVER_AUTHORIZATIONS", "Basic abc")
+
+		cfg, err := config.LoadReceiver()
+		if err != nil {
+			t.Fatalf("LoadReceiver() error = %v", err)
+		}
+		if cfg.Alert.Enabled() || cfg.Alert.Cooldown != time.Hour || cfg.Alert.DropPercent != 0 {
+			t.Errorf("Alert = %+v, want disabled with a one hour cooldown", cfg.Alert)
+		}
+	})
+
+	t.Run("webhooks and thresholds", func(t *testing.T) {
+		setRequiredEnv(t)
+		setEnv(t, "RECEIVER_AUTHORIZATIONS", "Basic abc")
+		setEnv(t, "ALERT_WEBHOOKS", "https://hooks.example.com/services/T000/B000/XXXX, http://alerts.internal:9000/stock")
+		setEnv(t, "ALERT_WEBHOOK_AUTHORIZATION", "Bearer alert-token")
+		setEnv(t, "ALERT_LOW_STOCK", "5")
+		setEnv(t, "ALERT_LOW_STOCK_PRODUCTS", "42:20")
+		setEnv(t, "ALERT_LOW_STOCK_BRANCHES", "3:0")
+		setEnv(t, "ALERT_DROP_PERCENT", "50")
+		setEnv(t, "ALERT_DROP_MIN_UNITS", "10")
+		setEnv(t, "ALERT_COOLDOWN", "15m")
+
+		cfg, err := config.LoadReceiver()
+		if err != nil {
+			t.Fatalf("LoadReceiver() error = %v", err)
+		}
+		alert := cfg.Alert
+		if !alert.Enabled() || len(alert.Webhooks) != 2 || alert.Webhooks[1] != "http://alerts.internal:9000/stock" {
+			t.Errorf("Webhooks = %q", alert.Webhooks)
+		}
+		if alert.LowStock.Default != 5 || alert.LowStock.Products[42] != 20 || alert.LowStock.Branches[3] != 0 {
+			t.Errorf("LowStock = %+v", alert.LowStock)
+		}
+		if alert.DropPercent != 50 || alert.DropMinUnits != 10 || alert.Cooldown != 15*time.Minute {
+			t.Errorf("Alert = %+v", alert)
+		}
+
+		out := cfg.String()
+		for _, secret := range []string{"XXXX", "alert-token", "/stock"} {
+			if strings.Contains(out, secret) {
+				t.Errorf("output leaks %q: %s", secret, out)
+			}
+		}
+		if !strings.Contains(out, "https://hooks.example.com/") {
+			t.Errorf("output does not show the webhook host: %s", out)
+		}
+	})
+
+	for _, tt := range []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{"relative webhook", map[string]string{"ALERT_WEBHOOKS": "/hooks/stock"}, "ALERT_WEBHOOKS must be a comma-separated list of absolute URLs"},
+		{"drop above 100 percent", map[string]string{"ALERT_DROP_PERCENT": "150"}, "ALERT_DROP_PERCENT must be at most 100"},
+		{"invalid cooldown", map[string]string{"ALERT_COOLDOWN": "soon"}, "ALERT_COOLDOWN must be a positive duration such as 30s or 5m"},
+		{"invalid low stock", map[string]string{"ALERT_LOW_STOCK_BRANCHES": "3"}, "ALERT_LOW_STOCK_BRANCHES must be a comma-separated list of id:units entries"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequiredEnv(t)
+			setEnv(t, "RECEIVER_AUTHORIZATIONS", "Basic abc")
+			for key, value := range tt.env {
+				setEnv(t, key, value)
+			}
+			if _, err := config.LoadReceiver(); err == nil || err.Error() != tt.wantErr {
+				t.Errorf("LoadReceiver() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// redactedValue replaces secret values whenever the configuration is printed
+const redactedValue = "[REDACTED]"
+
+// SecretResolver resolves a secret reference such as "vault://kv/stock#password"
+// into the secret value. The reference passed to Resolve has the scheme removed.
+type SecretResolver interface {
+	Resolve(ref string) (string, error)
+}
+
+// SecretResolverFunc adapts an ordinary function to the SecretResolver interface
+type SecretResolverFunc func(ref string) (string, error)
+
+// Resolve calls f(ref)
+func (f SecretResolverFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+var (
+	resolversMu sync.RWMutex
+	resolvers   = map[string]SecretResolver{
+		"env":  SecretResolverFunc(resolveEnv),
+		"file": SecretResolverFunc(readSecretFile),
+	}
+)
+
+// RegisterSecretResolver registers a resolver for values of the form "<scheme>://<ref>".
+// Registering a scheme that already exists replaces the previous resolver.
+func RegisterSecretResolver(scheme string, resolver SecretResolver) {
+	resolversMu.Lock()
+	defer resolversMu.Unlock()
+	resolvers[scheme] = resolver
+}
+
+// lookupResolver returns the resolver registered for the scheme of value, if any
+func lookupResolver(value string) (SecretResolver, string, bool) {
+	scheme, ref, ok := strings.Cut(value, "://")
+	if !ok {
+		return nil, "", false
+	}
+
+	resolversMu.RLock()
+	defer resolversMu.RUnlock()
+	resolver, ok := resolvers[scheme]
+	return resolver, ref, ok
+}
+
+// lookupEnv reads key through getenv. A "<key>_FILE" variable takes the value
+// from a file (Docker/Kubernetes secrets), and values written as a registered
+// secret reference are resolved through their SecretResolver.
+func lookupEnv(key string, getenv func(string) string) (string, error) {
+	value := getenv(key)
+
+	if path := getenv(key + "_FILE"); path != "" {
+		if value != "" {
+			return "", fmt.Errorf("both %s and %s_FILE are set", key, key)
+		}
+		secret, err := readSecretFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s_FILE: %v", key, err)
+		}
+		value = secret
+	}
+
+	resolver, ref, ok := lookupResolver(value)
+	if !ok {
+		return value, nil
+	}
+
+	secret, err := resolver.Resolve(ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve secret reference for %s: %v", key, err)
+	}
+	return secret, nil
+}
+
+func resolveEnv(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	// Secret files are usually written with a trailing newline
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redactedValue
+}
@@ -0,0 +1,156 @@
+package config_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"stock-consolidation/pkg/config"
+)
+
+// setRequiredEnv sets every required variable except the ones listed in skip
+func setRequiredEnv(t *testing.T, skip ...string) {
+	os.Clearenv()
+	values := map[string]string{
+		"DB_HOST":                "localhost",
+		"DB_PORT":                "5432",
+		"DB_USER":                "admin",
+		"DB_PASSWORD":            "admin",
+		"DB_NAME":                "stockdb",
+		"SERVICE_PORT":           "3000",
+		"HQ_END_POINT":           "http://localhost:8080",
+		"HQ_BASIC_AUTHORIZATION": "Basic dXNlcjpwYXNz",
+	}
+	for _, key := range skip {
+		delete(values, key)
+	}
+	for key, value := range values {
+		setEnv(t, key, value)
+	}
+}
+
+func writeSecretFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+	return path
+}
+
+func TestLoadSecrets(t *testing.T) {
+	t.Run("password from _FILE variant", func(t *testing.T) {
+		setRequiredEnv(t, "DB_PASSWORD")
+		setEnv(t, "DB_PASSWORD_FILE", writeSecretFile(t, "s3cret\n"))
+
+		cfg, err := config.Load()
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+		if cfg.DBPassword != "s3cret" {
+			t.Errorf("LoadConfig() DBPassword = %v, want %v", cfg.DBPassword, "s3cret")
+		}
+	})
+
+	t.Run("both value and _FILE variant set", func(t *testing.T) {
+		setRequiredEnv(t)
+		setEnv(t, "DB_PASSWORD_FILE", writeSecretFile(t, "s3cret"))
+
+		_, err := config.Load()
+		if err == nil {
+			t.Fatal("LoadConfig() expected error when DB_PASSWORD and DB_PASSWORD_FILE are set, got nil")
+		}
+		if err.Error() != "both DB_PASSWORD and DB_PASSWORD_FILE are set" {
+			t.Errorf("LoadConfig() error = %v", err)
+		}
+	})
+
+	t.Run("missing _FILE target", func(t *testing.T) {
+		setRequiredEnv(t, "HQ_BASIC_AUTHORIZATION")
+		setEnv(t, "HQ_BASIC_AUTHORIZATION_FILE", filepath.Join(t.TempDir(), "missing"))
+
+		if _, err := config.Load(); err == nil {
+			t.Error("LoadConfig() expected error for missing secret file, got nil")
+		}
+	})
+
+	t.Run("env and file secret references", func(t *testing.T) {
+		setRequiredEnv(t, "DB_PASSWORD", "HQ_BASIC_AUTHORIZATION")
+		setEnv(t, "STOCK_DB_PASSWORD", "from-env")
+		setEnv(t, "DB_PASSWORD", "env://STOCK_DB_PASSWORD")
+		setEnv(t, "HQ_BASIC_AUTHORIZATION", "file://"+writeSecretFile(t, "Basic Zm9vOmJhcg=="))
+
+		cfg, err := config.Load()
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+		if cfg.DBPassword != "from-env" {
+			t.Errorf("LoadConfig() DBPassword = %v, want %v", cfg.DBPassword, "from-env")
+		}
+		if cfg.HQBasicAuthorization != "Basic Zm9vOmJhcg==" {
+			t.Errorf("LoadConfig() HQBasicAuthorization = %v, want %v", cfg.HQBasicAuthorization, "Basic Zm9vOmJhcg==")
+		}
+		if cfg.HQEndPoint != "http://localhost:8080" {
+			t.Errorf("LoadConfig() HQEndPoint = %v, unregistered schemes must be kept as is", cfg.HQEndPoint)
+		}
+	})
+
+	t.Run("custom secret resolver", func(t *testing.T) {
+		config.RegisterSecretResolver("vault", config.SecretResolverFunc(func(ref string) (string, error) {
+			if ref != "kv/stock#password" {
+				return "", fmt.Errorf("unknown secret %s", ref)
+			}
+			return "from-vault", nil
+		}))
+
+		setRequiredEnv(t, "DB_PASSWORD")
+		setEnv(t, "DB_PASSWORD", "vault://kv/stock#password")
+		cfg, err := config.Load()
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+		if cfg.DBPassword != "from-vault" {
+			t.Errorf("LoadConfig() DBPassword = %v, want %v", cfg.DBPassword, "from-vault")
+		}
+
+		setEnv(t, "DB_PASSWORD", "vault://kv/other")
+		if _, err := config.Load(); err == nil {
+			t.Error("LoadConfig() expected error for unresolvable secret reference, got nil")
+		}
+	})
+}
+
+func TestConfigRedaction(t *testing.T) {
+	cfg := &config.Config{
+		DBHost:               "localhost",
+		DBPassword:           "admin123",
+		HQBasicAuthorization: "Basic dXNlcjpwYXNz",
+	}
+
+	outputs := map[string]string{
+		"%v":  fmt.Sprintf("%v", cfg),
+		"%+v": fmt.Sprintf("%+v", cfg),
+		"%#v": fmt.Sprintf("%#v", cfg),
+		"%s":  cfg.String(),
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	outputs["json"] = string(data)
+
+	for name, out := range outputs {
+		if strings.Contains(out, "admin123") || strings.Contains(out, "dXNlcjpwYXNz") {
+			t.Errorf("%s output leaks a secret: %s", name, out)
+		}
+		if !strings.Contains(out, "localhost") {
+			t.Errorf("%s output is missing non-secret values: %s", name, out)
+		}
+	}
+
+	if cfg.DBPassword != "admin123" {
+		t.Error("Redacted() must not modify the original config")
+	}
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"stock-consolidation/pkg/logger"
+)
+
+// DefaultReloadInterval is how often the watcher checks the config file for changes
+const DefaultReloadInterval = 10 * time.Second
+
+// Watcher reloads the configuration on SIGHUP or when the config file changes
+// and hands every accepted configuration to its subscribers
+type Watcher struct {
+	current  atomic.Pointer[Config]
+	interval time.Duration
+
+	mu          sync.Mutex
+	subscribers []func(*Config)
+	modTime     time.Time
+}
+
+// NewWatcher creates a Watcher whose initial configuration is cfg
+func NewWatcher(cfg *Config, interval time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	w := &Watcher{interval: interval}
+	w.current.Store(cfg)
+	w.modTime = fileModTime(cfg.ConfigFile)
+	return w
+}
+
+// Current returns the configuration that is currently in effect
+func (w *Watcher) Current() *Config {
+	return w.current.Load()
+}
+
+// Subscribe registers fn to be called with every newly accepted configuration
+func (w *Watcher) Subscribe(fn func(*Config)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// Reload loads the configuration again and applies it. An invalid configuration,
+// or one that changes settings requiring a restart, is rejected and the running
+// configuration stays in effect.
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	old := w.current.Load()
+	w.modTime = fileModTime(old.ConfigFile)
+
+	cfg, err := load(old.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("rejected new config: %v", err)
+	}
+	if err := checkStatic(old, cfg); err != nil {
+		return fmt.Errorf("rejected new config: %v", err)
+	}
+	if reflect.DeepEqual(old, cfg) {
+		return nil
+	}
+
+	w.current.Store(cfg)
+	for _, fn := range w.subscribers {
+		fn(cfg)
+	}
+	logger.Info("Configuration reloaded: %v", cfg)
+	return nil
+}
+
+// Run reloads the configuration on SIGHUP and whenever the config file's
+// modification time changes, until ctx is done
+func (w *Watcher) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hup:
+			logger.Info("Received SIGHUP, reloading configuration")
+			w.reloadAndLog()
+		case <-ticker.C:
+			if w.fileChanged() {
+				logger.Info("Config file changed, reloading configuration")
+				w.reloadAndLog()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *Watcher) reloadAndLog() {
+	if err := w.Reload(); err != nil {
+		logger.Error("Configuration reload failed, keeping current config: %v", err)
+	}
+}
+
+func (w *Watcher) fileChanged() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	path := w.current.Load().ConfigFile
+	return path != "" && !fileModTime(path).Equal(w.modTime)
+}
+
+// checkStatic rejects changes to settings that are only read at startup
+func checkStatic(old, cfg *Config) error {
+	static := []struct {
+		name     string
+		old, new string
+	}{
+		{"DB_HOST", old.DBHost, cfg.DBHost},
+		{"DB_PORT", old.DBPort, cfg.DBPort},
+		{"DB_NAME", old.DBName, cfg.DBName},
+		{"DB_USER", old.DBUser, cfg.DBUser},
+		{"DB_PASSWORD", old.DBPassword, cfg.DBPassword},
+		{"SERVICE_PORT", old.ServicePort, cfg.ServicePort},
+		{"LEADER_LOCK_ID", strconv.Itoa(old.LeaderLockID), strconv.Itoa(cfg.LeaderLockID)},
+		{"LEADER_ELECTION_INTERVAL", old.LeaderElectionInterval.String(), cfg.LeaderElectionInterval.String()},
+		{"STOCK_CHANNELS", strings.Join(old.Channels.Stock, ","), strings.Join(cfg.Channels.Stock, ",")},
+		{"PRODUCT_CHANNELS", strings.Join(old.Channels.Product, ","), strings.Join(cfg.Channels.Product, ",")},
+		{"BRANCH_CHANNELS", strings.Join(old.Channels.Branch, ","), strings.Join(cfg.Channels.Branch, ",")},
+		{"STOCK_MOVEMENT_CHANNELS", strings.Join(old.Channels.StockMovement, ","), strings.Join(cfg.Channels.StockMovement, ",")},
+	}
+	for _, s := range static {
+		if s.old != s.new {
+			return fmt.Errorf("%s cannot be changed without a restart", s.name)
+		}
+	}
+
+	if !reflect.DeepEqual(old.Sources, cfg.Sources) {
+		return fmt.Errorf("BRANCH_SOURCES cannot be changed without a restart")
+	}
+
+	// The captured tables are subscribed to at startup, so their endpoints
+	// can be changed but not set or cleared
+	captured := []struct {
+		name     string
+		old, new string
+	}{
+		{"HQ_PRODUCT_END_POINT", old.HQProductEndPoint, cfg.HQProductEndPoint},
+		{"HQ_BRANCH_END_POINT", old.HQBranchEndPoint, cfg.HQBranchEndPoint},
+		{"HQ_STOCK_MOVEMENT_END_POINT", old.HQStockMovementEndPoint, cfg.HQStockMovementEndPoint},
+	}
+	for _, c := range captured {
+		if (c.old == "") != (c.new == "") {
+			return fmt.Errorf("%s cannot be set or cleared without a restart", c.name)
+		}
+	}
+	return nil
+}
+
+func fileModTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
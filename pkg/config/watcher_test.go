@@ -0,0 +1,143 @@
+package config_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"stock-consolidation/pkg/config"
+)
+
+func writeConfigFile(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+}
+
+func loadWithConfigFile(t *testing.T, content string) (*config.Config, string) {
+	setRequiredEnv(t)
+	path := filepath.Join(t.TempDir(), "stock.env")
+	writeConfigFile(t, path, content)
+	setEnv(t, "CONFIG_FILE", path)
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	return cfg, path
+}
+
+func TestConfigFile(t *testing.T) {
+	cfg, _ := loadWithConfigFile(t, `
+# HQ delivery settings
+HQ_END_POINT="http://hq.example.com/stock"
+FILTER_BRANCH_IDS=1, 3
+`)
+
+	if cfg.HQEndPoint != "http://hq.example.com/stock" {
+		t.Errorf("LoadConfig() HQEndPoint = %v, want value from config file", cfg.HQEndPoint)
+	}
+	if cfg.DBHost != "localhost" {
+		t.Errorf("LoadConfig() DBHost = %v, want value from environment", cfg.DBHost)
+	}
+	if !cfg.Filter.Allows(42, 3) || cfg.Filter.Allows(42, 2) {
+		t.Errorf("LoadConfig() Filter = %+v, want branches 1 and 3 only", cfg.Filter)
+	}
+
+	setEnv(t, "FILTER_PRODUCT_IDS", "1,x")
+	if _, err := config.Load(); err == nil {
+		t.Error("LoadConfig() expected error for invalid FILTER_PRODUCT_IDS, got nil")
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	t.Run("applies valid config", func(t *testing.T) {
+		cfg, path := loadWithConfigFile(t, "HQ_END_POINT=http://hq-a/stock\n")
+		watcher := config.NewWatcher(cfg, time.Minute)
+
+		var applied *config.Config
+		watcher.Subscribe(func(c *config.Config) { applied = c })
+
+		writeConfigFile(t, path, "HQ_END_POINT=http://hq-b/stock\nHQ_BASIC_AUTHORIZATION=Basic bmV3\n")
+		if err := watcher.Reload(); err != nil {
+			t.Fatalf("Reload() error = %v", err)
+		}
+
+		if applied == nil || applied.HQEndPoint != "http://hq-b/stock" || applied.HQBasicAuthorization != "Basic bmV3" {
+			t.Errorf("Subscriber got %v, want new HQ settings", applied)
+		}
+		if watcher.Current() != applied {
+			t.Error("Current() should return the reloaded config")
+		}
+	})
+
+	t.Run("rejects invalid config", func(t *testing.T) {
+		cfg, path := loadWithConfigFile(t, "HQ_END_POINT=http://hq-a/stock\n")
+		watcher := config.NewWatcher(cfg, time.Minute)
+		watcher.Subscribe(func(*config.Config) { t.Error("Subscriber must not be called for invalid config") })
+
+		writeConfigFile(t, path, "HQ_END_POINT=not a url\n")
+		if err := watcher.Reload(); err == nil {
+			t.Error("Reload() expected error for invalid HQ_END_POINT, got nil")
+		}
+		if watcher.Current() != cfg {
+			t.Error("Current() should keep the running config after a rejected reload")
+		}
+	})
+
+	t.Run("rejects changes requiring restart", func(t *testing.T) {
+		cfg, path := loadWithConfigFile(t, "")
+		watcher := config.NewWatcher(cfg, time.Minute)
+
+		writeConfigFile(t, path, "DB_HOST=other-db\n")
+		err := watcher.Reload()
+		if err == nil || err.Error() != "rejected new config: DB_HOST cannot be changed without a restart" {
+			t.Errorf("Reload() error = %v, want DB_HOST restart error", err)
+		}
+	})
+
+	t.Run("rejects enabling a captured table", func(t *testing.T) {
+		cfg, path := loadWithConfigFile(t, "HQ_BRANCH_END_POINT=http://hq-a/branches\n")
+		watcher := config.NewWatcher(cfg, time.Minute)
+
+		writeConfigFile(t, path, "HQ_BRANCH_END_POINT=http://hq-b/branches\n")
+		if err := watcher.Reload(); err != nil {
+			t.Errorf("Reload() error = %v, changing a capture endpoint should be allowed", err)
+		}
+
+		writeConfigFile(t, path, "HQ_BRANCH_END_POINT=http://hq-b/branches\nHQ_PRODUCT_END_POINT=http://hq-b/products\n")
+		err := watcher.Reload()
+		if err == nil || err.Error() != "rejected new config: HQ_PRODUCT_END_POINT cannot be set or cleared without a restart" {
+			t.Errorf("Reload() error = %v, want HQ_PRODUCT_END_POINT restart error", err)
+		}
+	})
+
+	t.Run("watches config file", func(t *testing.T) {
+		cfg, path := loadWithConfigFile(t, "HQ_END_POINT=http://hq-a/stock\n")
+		watcher := config.NewWatcher(cfg, 10*time.Millisecond)
+
+		applied := make(chan *config.Config, 1)
+		watcher.Subscribe(func(c *config.Config) { applied <- c })
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go watcher.Run(ctx)
+
+		writeConfigFile(t, path, "HQ_END_POINT=http://hq-c/stock\n")
+		future := time.Now().Add(time.Second)
+		if err := os.Chtimes(path, future, future); err != nil {
+			t.Fatalf("Failed to touch config file: %v", err)
+		}
+
+		select {
+		case c := <-applied:
+			if c.HQEndPoint != "http://hq-c/stock" {
+				t.Errorf("Subscriber got HQEndPoint = %v, want http://hq-c/stock", c.HQEndPoint)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for config reload")
+		}
+	})
+}
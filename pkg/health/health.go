@@ -0,0 +1,133 @@
+// Package health provides component health checks for liveness and readiness probes
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status is the health of a component or of the whole service
+type Status string
+
+// Possible health states
+const (
+	StatusUp   Status = "up"
+	StatusDown Status = "down"
+)
+
+// defaultTimeout bounds how long a single check may take
+const defaultTimeout = 2 * time.Second
+
+// Details carries additional information about a component, e.g. the backlog size
+type Details map[string]interface{}
+
+// CheckFunc checks a component. A non-nil error marks the component as down.
+type CheckFunc func(ctx context.Context) (Details, error)
+
+// ComponentStatus is the result of a single check
+type ComponentStatus struct {
+	Status  Status  `json:"status"`
+	Error   string  `json:"error,omitempty"`
+	Details Details `json:"details,omitempty"`
+}
+
+// Report is the combined result of all checks
+type Report struct {
+	Status     Status                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// Checker runs a set of named checks
+type Checker struct {
+	mu      sync.RWMutex
+	checks  map[string]CheckFunc
+	timeout time.Duration
+}
+
+// NewChecker creates an empty Checker
+func NewChecker() *Checker {
+	return &Checker{
+		checks:  make(map[string]CheckFunc),
+		timeout: defaultTimeout,
+	}
+}
+
+// Register adds a check under name, replacing any check with the same name
+func (c *Checker) Register(name string, check CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// Names returns the registered check names in sorted order
+func (c *Checker) Names() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run executes all checks concurrently. The report is up only if every component is up.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := make(map[string]CheckFunc, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		report = Report{Status: StatusUp, Components: make(map[string]ComponentStatus, len(checks))}
+	)
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check CheckFunc) {
+			defer wg.Done()
+			status := runCheck(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[name] = status
+			if status.Status != StatusUp {
+				report.Status = StatusDown
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// runCheck runs check and turns a timeout into a failed component
+func runCheck(ctx context.Context, check CheckFunc) ComponentStatus {
+	type result struct {
+		details Details
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		details, err := check(ctx)
+		done <- result{details, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return ComponentStatus{Status: StatusDown, Error: r.err.Error(), Details: r.details}
+		}
+		return ComponentStatus{Status: StatusUp, Details: r.details}
+	case <-ctx.Done():
+		return ComponentStatus{Status: StatusDown, Error: "check timed out"}
+	}
+}
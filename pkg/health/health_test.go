@@ -0,0 +1,64 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"stock-consolidation/pkg/health"
+)
+
+func TestChecker(t *testing.T) {
+	t.Run("no checks is up", func(t *testing.T) {
+		report := health.NewChecker().Run(context.Background())
+		if report.Status != health.StatusUp {
+			t.Errorf("Run() status = %v, want up", report.Status)
+		}
+	})
+
+	t.Run("one failing component marks the report down", func(t *testing.T) {
+		checker := health.NewChecker()
+		checker.Register("postgres", func(context.Context) (health.Details, error) {
+			return nil, nil
+		})
+		checker.Register("backlog", func(context.Context) (health.Details, error) {
+			return health.Details{"queue_depth": 120}, errors.New("too many pending changes")
+		})
+
+		report := checker.Run(context.Background())
+		if report.Status != health.StatusDown {
+			t.Errorf("Run() status = %v, want down", report.Status)
+		}
+		if report.Components["postgres"].Status != health.StatusUp {
+			t.Errorf("postgres = %+v, want up", report.Components["postgres"])
+		}
+		backlog := report.Components["backlog"]
+		if backlog.Status != health.StatusDown || backlog.Error != "too many pending changes" || backlog.Details["queue_depth"] != 120 {
+			t.Errorf("backlog = %+v, want down with details", backlog)
+		}
+		if names := checker.Names(); len(names) != 2 || names[0] != "backlog" {
+			t.Errorf("Names() = %v, want sorted names", names)
+		}
+	})
+
+	t.Run("hanging check times out", func(t *testing.T) {
+		checker := health.NewChecker()
+		checker.Register("hq", func(context.Context) (health.Details, error) {
+			time.Sleep(5 * time.Second)
+			return nil, nil
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		report := checker.Run(ctx)
+		if time.Since(start) > time.Second {
+			t.Error("Run() did not respect the context deadline")
+		}
+		if report.Components["hq"].Error != "check timed out" {
+			t.Errorf("hq = %+v, want timeout", report.Components["hq"])
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Level is the severity of a log entry
+type Level int
+
+// Supported log levels, in increasing severity
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelFatal
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+	LevelFatal: "fatal",
+}
+
+// String returns the lower case name of the level
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return "level(" + strconv.Itoa(int(l)) + ")"
+}
+
+// ParseLevel parses a level name; an empty string means info
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	case "fatal":
+		return LevelFatal, nil
+	}
+	return LevelInfo, fmt.Errorf("invalid LOG_LEVEL %q", s)
+}
+
+// Format selects how entries are encoded
+type Format int
+
+// Supported output formats
+const (
+	FormatText Format = iota
+	FormatJSON
+)
+
+// ParseFormat parses a format name; an empty string means text
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "text":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	}
+	return FormatText, fmt.Errorf("invalid LOG_FORMAT %q", s)
+}
+
+func (f Format) encode(t time.Time, level Level, msg string, fields Fields) []byte {
+	if f == FormatJSON {
+		return encodeJSON(t, level, msg, fields)
+	}
+	return encodeText(t, level, msg, fields)
+}
+
+// encodeJSON writes one JSON object per line with time, level and msg first
+func encodeJSON(t time.Time, level Level, msg string, fields Fields) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"time":`)
+	writeJSON(&b, t.UTC().Format(time.RFC3339Nano))
+	b.WriteString(`,"level":`)
+	writeJSON(&b, level.String())
+	b.WriteString(`,"msg":`)
+	writeJSON(&b, msg)
+	for _, k := range sortedKeys(fields) {
+		if k == "time" || k == "level" || k == "msg" {
+			continue
+		}
+		b.WriteByte(',')
+		writeJSON(&b, k)
+		b.WriteByte(':')
+		writeJSON(&b, fieldValue(fields[k]))
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+// encodeText writes "<time> LEVEL msg key=value ..." lines
+func encodeText(t time.Time, level Level, msg string, fields Fields) []byte {
+	var b bytes.Buffer
+	b.WriteString(t.Format("2006/01/02 15:04:05"))
+	b.WriteByte(' ')
+	b.WriteString(strings.ToUpper(level.String()))
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for _, k := range sortedKeys(fields) {
+		b.WriteByte(' ')
+		b.WriteString(k)
+		b.WriteByte('=')
+		s := fmt.Sprint(fieldValue(fields[k]))
+		if strings.ContainsAny(s, " =\"") {
+			s = strconv.Quote(s)
+		}
+		b.WriteString(s)
+	}
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+// fieldValue turns errors into their message so they encode usefully
+func fieldValue(v interface{}) interface{} {
+	if err, ok := v.(error); ok {
+		return err.Error()
+	}
+	return v
+}
+
+func writeJSON(b *bytes.Buffer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(data)
+}
+
+func sortedKeys(fields Fields) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -2,93 +2,300 @@
 package logger
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"path/filepath"
+	"strconv"
+	"sync"
 	"time"
 )
 
-var (
-	// LogFile is the file handle for logging
-	LogFile *os.File
-	// Logger is the logger instance
-	Logger *log.Logger
+// Defaults for settings that are not configured through the environment
+const (
+	defaultFlushInterval = time.Second
+	defaultMaxSizeMB     = 100
+	defaultMaxAgeDays    = 30
 )
 
-// Init initializes the logger with file output
+// Fields are key-value pairs attached to a log entry, e.g. product_id or branch_id
+type Fields map[string]interface{}
+
+// logger writes leveled entries to the console and a buffered log file
+type logger struct {
+	mu      sync.Mutex
+	level   Level
+	format  Format
+	console io.Writer
+	file    *rotator
+	buf     *bufio.Writer
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+var std = &logger{level: LevelInfo, format: FormatText, console: os.Stderr}
+
+// Init initializes the logger with file output. The level, format and flush
+// interval are read from LOG_LEVEL, LOG_FORMAT and LOG_FLUSH_INTERVAL, the
+// file location and rotation policy from LOG_DIR, LOG_MAX_SIZE_MB,
+// LOG_MAX_AGE_DAYS, LOG_MAX_BACKUPS and LOG_COMPRESS.
 func Init() error {
-	// Use relative path for tests, absolute path for production
-	logDir := "logs"
-	if os.Getenv("TESTING") == "" {
-		logDir = "/app/logs"
+	level, err := ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		return err
 	}
-
-	if err := os.MkdirAll(logDir, 0755); err != nil {
-		return fmt.Errorf("failed to create log directory: %v", err)
+	format, err := ParseFormat(os.Getenv("LOG_FORMAT"))
+	if err != nil {
+		return err
+	}
+	flushInterval := defaultFlushInterval
+	if v := os.Getenv("LOG_FLUSH_INTERVAL"); v != "" {
+		if flushInterval, err = time.ParseDuration(v); err != nil || flushInterval <= 0 {
+			return fmt.Errorf("invalid LOG_FLUSH_INTERVAL %q", v)
+		}
 	}
 
-	currentTime := time.Now().Format("2006-01-02")
-	logPath := filepath.Join(logDir, fmt.Sprintf("stock-consolidation-%s.log", currentTime))
+	rotation, err := rotationFromEnv()
+	if err != nil {
+		return err
+	}
 
-	file, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	file, err := newRotator(rotation)
 	if err != nil {
-		return fmt.Errorf("failed to open log file: %v", err)
+		return err
 	}
 
-	LogFile = file
-	Logger = log.New(file, "", log.LstdFlags)
+	Close()
+
+	std.mu.Lock()
+	std.level = level
+	std.format = format
+	std.file = file
+	std.buf = bufio.NewWriter(file)
+	std.stop = make(chan struct{})
+	std.done = make(chan struct{})
+	std.mu.Unlock()
+
+	go std.flushLoop(flushInterval, std.stop, std.done)
 
 	return nil
 }
 
-// Close closes the log file
+// Close flushes buffered output and closes the log file
 func Close() {
-	if LogFile != nil {
-		if err := LogFile.Close(); err != nil {
+	std.mu.Lock()
+	stop, done := std.stop, std.done
+	std.stop, std.done = nil, nil
+	std.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
+	std.mu.Lock()
+	defer std.mu.Unlock()
+	std.flushLocked()
+	if std.file != nil {
+		if err := std.file.Close(); err != nil {
 			log.Printf("Warning: Failed to close log file: %v", err)
 		}
+		std.file = nil
+		std.buf = nil
 	}
 }
 
-// Info logs an informational message
-func Info(format string, v ...interface{}) {
-	msg := fmt.Sprintf(format, v...)
-	log.Print(msg) // Console output
-	if Logger != nil {
-		Logger.Print(msg)                      // File output
-		if err := LogFile.Sync(); err != nil { // Force write to disk
-			log.Printf("Warning: Failed to sync log file: %v", err)
+// rotationFromEnv reads the log directory and rotation policy
+func rotationFromEnv() (rotationConfig, error) {
+	// Use relative path for tests, absolute path for production
+	cfg := rotationConfig{Dir: os.Getenv("LOG_DIR"), Compress: true}
+	if cfg.Dir == "" {
+		cfg.Dir = "logs"
+		if os.Getenv("TESTING") == "" {
+			cfg.Dir = "/app/logs"
 		}
 	}
+
+	maxSizeMB, err := intFromEnv("LOG_MAX_SIZE_MB", defaultMaxSizeMB)
+	if err != nil {
+		return cfg, err
+	}
+	maxAgeDays, err := intFromEnv("LOG_MAX_AGE_DAYS", defaultMaxAgeDays)
+	if err != nil {
+		return cfg, err
+	}
+	if cfg.MaxBackups, err = intFromEnv("LOG_MAX_BACKUPS", 0); err != nil {
+		return cfg, err
+	}
+	if v := os.Getenv("LOG_COMPRESS"); v != "" {
+		if cfg.Compress, err = strconv.ParseBool(v); err != nil {
+			return cfg, fmt.Errorf("invalid LOG_COMPRESS %q", v)
+		}
+	}
+
+	cfg.MaxSize = int64(maxSizeMB) * 1024 * 1024
+	cfg.MaxAge = time.Duration(maxAgeDays) * 24 * time.Hour
+	return cfg, nil
 }
 
-// Error logs an error message
-func Error(format string, v ...interface{}) {
-	msg := fmt.Sprintf(format, v...)
-	log.Print("ERROR: " + msg) // Console output
-	if Logger != nil {
-		Logger.Print("ERROR: " + msg)          // File output
-		if err := LogFile.Sync(); err != nil { // Force write to disk
-			log.Printf("Warning: Failed to sync log file: %v", err)
+func intFromEnv(key string, def int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q", key, v)
+	}
+	return n, nil
+}
+
+// SetLevel changes the minimum level that is written
+func SetLevel(level Level) {
+	std.mu.Lock()
+	defer std.mu.Unlock()
+	std.level = level
+}
+
+// Enabled reports whether entries at level are written
+func Enabled(level Level) bool {
+	std.mu.Lock()
+	defer std.mu.Unlock()
+	return level >= std.level
+}
+
+func (l *logger) flushLoop(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.mu.Lock()
+			l.flushLocked()
+			l.mu.Unlock()
+		case <-stop:
+			return
 		}
 	}
 }
 
-// Fatal logs a fatal message and exits the application
-func Fatal(format string, v ...interface{}) {
-	msg := fmt.Sprintf(format, v...)
-	if Logger != nil {
-		Logger.Print("FATAL: " + msg)          // File output
-		if err := LogFile.Sync(); err != nil { // Force write to disk
-			log.Printf("Warning: Failed to sync log file: %v", err)
+func (l *logger) flushLocked() {
+	if l.buf == nil {
+		return
+	}
+	if err := l.buf.Flush(); err != nil {
+		log.Printf("Warning: Failed to flush log file: %v", err)
+	}
+}
+
+func (l *logger) write(level Level, fields Fields, msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if level < l.level {
+		return
+	}
+
+	line := l.format.encode(time.Now(), level, msg, fields)
+	if _, err := l.console.Write(line); err != nil {
+		log.Printf("Warning: Failed to write log entry: %v", err)
+	}
+	if l.buf != nil {
+		if _, err := l.buf.Write(line); err != nil {
+			log.Printf("Warning: Failed to write log file: %v", err)
+		}
+		// Errors are flushed right away so they survive a crash
+		if level >= LevelError {
+			l.flushLocked()
 		}
 	}
+}
+
+// Entry is a log entry carrying structured fields
+type Entry struct {
+	fields Fields
+}
+
+// WithFields returns an entry that adds fields to every message it logs
+func WithFields(fields Fields) *Entry {
+	return (&Entry{}).WithFields(fields)
+}
+
+// WithFields returns a copy of the entry with additional fields
+func (e *Entry) WithFields(fields Fields) *Entry {
+	merged := make(Fields, len(e.fields)+len(fields))
+	for k, v := range e.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &Entry{fields: merged}
+}
+
+// Debug logs a debug message
+func (e *Entry) Debug(format string, v ...interface{}) {
+	e.log(LevelDebug, format, v...)
+}
+
+// Info logs an informational message
+func (e *Entry) Info(format string, v ...interface{}) {
+	e.log(LevelInfo, format, v...)
+}
+
+// Warn logs a warning message
+func (e *Entry) Warn(format string, v ...interface{}) {
+	e.log(LevelWarn, format, v...)
+}
+
+// Error logs an error message
+func (e *Entry) Error(format string, v ...interface{}) {
+	e.log(LevelError, format, v...)
+}
+
+// Fatal logs a fatal message and exits the application
+func (e *Entry) Fatal(format string, v ...interface{}) {
+	e.log(LevelFatal, format, v...)
 
 	// Don't exit during tests
-	if os.Getenv("TESTING") != "" {
-		log.Print("FATAL: " + msg) // Console output without exit
-	} else {
-		log.Fatal("FATAL: " + msg) // Console output and exit
+	if os.Getenv("TESTING") == "" {
+		Close()
+		os.Exit(1)
+	}
+}
+
+func (e *Entry) log(level Level, format string, v ...interface{}) {
+	if !Enabled(level) {
+		return
 	}
+	std.write(level, e.fields, fmt.Sprintf(format, v...))
+}
+
+// Debug logs a debug message
+func Debug(format string, v ...interface{}) {
+	(&Entry{}).Debug(format, v...)
+}
+
+// Info logs an informational message
+func Info(format string, v ...interface{}) {
+	(&Entry{}).Info(format, v...)
+}
+
+// Warn logs a warning message
+func Warn(format string, v ...interface{}) {
+	(&Entry{}).Warn(format, v...)
+}
+
+// Error logs an error message
+func Error(format string, v ...interface{}) {
+	(&Entry{}).Error(format, v...)
+}
+
+// Fatal logs a fatal message and exits the application
+func Fatal(format string, v ...interface{}) {
+	(&Entry{}).Fatal(format, v...)
 }
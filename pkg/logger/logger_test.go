@@ -1,10 +1,13 @@
 package logger_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"stock-consolidation/pkg/logger"
 )
@@ -38,6 +41,17 @@ func setupLogDir() func() {
 	}
 }
 
+// readLogLines closes the logger to flush it and returns the lines of today's log file
+func readLogLines(t *testing.T) []string {
+	logger.Close()
+	path := filepath.Join("logs", fmt.Sprintf("stock-consolidation-%s.log", time.Now().Format("2006-01-02")))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
 func TestLogger(t *testing.T) {
 	cleanup := setupLogDir()
 	defer cleanup()
@@ -66,3 +80,71 @@ func TestLogger(t *testing.T) {
 		// No need to check file content for speed
 	})
 }
+
+func TestStructuredLogging(t *testing.T) {
+	cleanup := setupLogDir()
+	defer cleanup()
+
+	t.Setenv("LOG_LEVEL", "info")
+	t.Setenv("LOG_FORMAT", "json")
+	if err := logger.Init(); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer logger.Close()
+
+	logger.Debug("hidden debug message")
+	logger.WithFields(logger.Fields{"product_id": 42, "branch_id": 3}).
+		WithFields(logger.Fields{"error": fmt.Errorf("boom")}).
+		Warn("delivery %s", "failed")
+
+	lines := readLogLines(t)
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 log line, got %d: %v", len(lines), lines)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Log line is not valid JSON: %v", err)
+	}
+	if entry["level"] != "warn" || entry["msg"] != "delivery failed" {
+		t.Errorf("Unexpected level or message: %v", entry)
+	}
+	if entry["product_id"] != float64(42) || entry["branch_id"] != float64(3) || entry["error"] != "boom" {
+		t.Errorf("Unexpected fields: %v", entry)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, entry["time"].(string)); err != nil {
+		t.Errorf("Invalid time field: %v", err)
+	}
+}
+
+func TestTextFormat(t *testing.T) {
+	cleanup := setupLogDir()
+	defer cleanup()
+
+	t.Setenv("LOG_LEVEL", "debug")
+	t.Setenv("LOG_FORMAT", "text")
+	if err := logger.Init(); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer logger.Close()
+
+	logger.WithFields(logger.Fields{"event_id": "abc@1", "channel": "stock changes"}).Debug("received")
+
+	lines := readLogLines(t)
+	if !strings.HasSuffix(lines[0], ` DEBUG received channel="stock changes" event_id=abc@1`) {
+		t.Errorf("Unexpected text line: %s", lines[0])
+	}
+}
+
+func TestInvalidSettings(t *testing.T) {
+	t.Setenv("LOG_LEVEL", "verbose")
+	if err := logger.Init(); err == nil {
+		t.Error("Init() expected error for invalid LOG_LEVEL, got nil")
+	}
+
+	t.Setenv("LOG_LEVEL", "")
+	t.Setenv("LOG_FORMAT", "xml")
+	if err := logger.Init(); err == nil {
+		t.Error("Init() expected error for invalid LOG_FORMAT, got nil")
+	}
+}
@@ -0,0 +1,274 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotationConfig controls when log files are rotated and how long they are kept
+type rotationConfig struct {
+	// Dir is the directory the log files are written to
+	Dir string
+	// MaxSize rotates the current file once it grows beyond this many bytes (0 disables)
+	MaxSize int64
+	// MaxAge removes rotated files older than this (0 keeps them)
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files to keep (0 keeps all)
+	MaxBackups int
+	// Compress gzips rotated files
+	Compress bool
+}
+
+const filePrefix = "stock-consolidation-"
+
+// rotator is an io.WriteCloser writing to stock-consolidation-YYYY-MM-DD.log.
+// It starts a new file when the day changes or the size limit is reached.
+type rotator struct {
+	cfg rotationConfig
+	now func() time.Time
+
+	file *os.File
+	size int64
+	day  string
+
+	// cleanups queues the rotations for the housekeeping worker, which
+	// compresses and prunes the rotated files one rotation at a time
+	cleanups     chan cleanupJob
+	housekeeping sync.WaitGroup
+}
+
+// cleanupJob describes one rotation for the housekeeping worker
+type cleanupJob struct {
+	active string
+	now    time.Time
+}
+
+func newRotator(cfg rotationConfig) (*rotator, error) {
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %v", err)
+	}
+	r := &rotator{cfg: cfg, now: time.Now, cleanups: make(chan cleanupJob, 16)}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	r.housekeeping.Add(1)
+	go r.housekeep(r.cleanups)
+	return r, nil
+}
+
+// housekeep runs the queued cleanups in rotation order until the rotator is closed
+func (r *rotator) housekeep(cleanups <-chan cleanupJob) {
+	defer r.housekeeping.Done()
+	for job := range cleanups {
+		r.cleanup(job.active, job.now)
+	}
+}
+
+func (r *rotator) activePath(day string) string {
+	return filepath.Join(r.cfg.Dir, filePrefix+day+".log")
+}
+
+func (r *rotator) open() error {
+	r.day = r.now().Format("2006-01-02")
+	file, err := os.OpenFile(r.activePath(r.day), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to stat log file: %v", err)
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+// Write writes p to the current file, rotating first when needed
+func (r *rotator) Write(p []byte) (int, error) {
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if day := r.now().Format("2006-01-02"); day != r.day {
+		if err := r.rotate(false); err != nil {
+			return 0, err
+		}
+	} else if r.cfg.MaxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.cfg.MaxSize {
+		if err := r.rotate(true); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate closes the current file and opens a new one. A size based rotation
+// renames the current file to stock-consolidation-YYYY-MM-DD.N.log first; on a
+// day change the old file already carries its date and keeps its name.
+func (r *rotator) rotate(bySize bool) error {
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %v", err)
+	}
+	r.file = nil
+
+	rotated := r.activePath(r.day)
+	if bySize {
+		rotated = r.nextBackupPath(r.day)
+		if err := os.Rename(r.activePath(r.day), rotated); err != nil {
+			return fmt.Errorf("failed to rotate log file: %v", err)
+		}
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	// Writes hold the logger lock, so they must not wait for a slow cleanup.
+	// A skipped cleanup is caught up by the next one.
+	select {
+	case r.cleanups <- cleanupJob{active: r.activePath(r.day), now: r.now()}:
+	default:
+		log.Printf("Warning: Log cleanup queue is full, deferring the cleanup of %s", rotated)
+	}
+	return nil
+}
+
+func (r *rotator) nextBackupPath(day string) string {
+	for i := 1; ; i++ {
+		path := filepath.Join(r.cfg.Dir, fmt.Sprintf("%s%s.%d.log", filePrefix, day, i))
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if _, err := os.Stat(path + ".gz"); os.IsNotExist(err) {
+				return path
+			}
+		}
+	}
+}
+
+// cleanup applies the retention policy to every file except the active one
+// and compresses the rotated files that are kept and not compressed yet
+func (r *rotator) cleanup(active string, now time.Time) {
+	backups, err := r.backups(active)
+	if err != nil {
+		log.Printf("Warning: Failed to list log files: %v", err)
+		return
+	}
+
+	cutoff := now.Add(-r.cfg.MaxAge)
+	for i, b := range backups {
+		expired := r.cfg.MaxAge > 0 && b.modTime.Before(cutoff)
+		excess := r.cfg.MaxBackups > 0 && i >= r.cfg.MaxBackups
+		if expired || excess {
+			if err := os.Remove(b.path); err != nil {
+				log.Printf("Warning: Failed to remove old log file %s: %v", b.path, err)
+			}
+			continue
+		}
+		if r.cfg.Compress && strings.HasSuffix(b.path, ".log") {
+			if err := compressFile(b.path); err != nil {
+				log.Printf("Warning: Failed to compress log file %s: %v", b.path, err)
+			}
+		}
+	}
+}
+
+type backup struct {
+	path    string
+	modTime time.Time
+}
+
+// backups lists rotated log files, newest first. The active file is excluded.
+func (r *rotator) backups(active string) ([]backup, error) {
+	entries, err := os.ReadDir(r.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	active = filepath.Base(active)
+	var backups []backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || name == active || !strings.HasPrefix(name, filePrefix) ||
+			!(strings.HasSuffix(name, ".log") || strings.HasSuffix(name, ".log.gz")) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: filepath.Join(r.cfg.Dir, name), modTime: info.ModTime()})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].modTime.After(backups[j].modTime)
+	})
+	return backups, nil
+}
+
+// Close closes the current file and waits for the queued cleanups
+func (r *rotator) Close() error {
+	var err error
+	if r.file != nil {
+		err = r.file.Close()
+		r.file = nil
+	}
+	if r.cleanups != nil {
+		close(r.cleanups)
+		r.cleanups = nil
+		r.housekeeping.Wait()
+	}
+	return err
+}
+
+// compressFile gzips path to path.gz, keeping the modification time, and removes path
+func compressFile(path string) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(path + ".gz")
+		}
+	}()
+
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err = gz.Close(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	if err = os.Chtimes(path+".gz", info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
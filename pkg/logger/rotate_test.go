@@ -0,0 +1,139 @@
+package logger_test
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"stock-consolidation/pkg/logger"
+)
+
+func listDir(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read log directory: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// initRotation initializes the logger writing to a temporary directory with
+// a rotation size of 1 MB and the given settings, and returns the directory
+func initRotation(t *testing.T, env map[string]string) string {
+	dir := t.TempDir()
+	t.Setenv("TESTING", "1")
+	t.Setenv("LOG_DIR", dir)
+	t.Setenv("LOG_MAX_SIZE_MB", "1")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	if err := logger.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	return dir
+}
+
+// logMegabytes writes about n MB of log entries
+func logMegabytes(n int) {
+	line := strings.Repeat("x", 1000)
+	for i := 0; i < n*1100; i++ {
+		logger.Info("%s", line)
+	}
+}
+
+func TestRotationBySizeWithCompressionAndBackups(t *testing.T) {
+	dir := initRotation(t, map[string]string{"LOG_COMPRESS": "true", "LOG_MAX_BACKUPS": "2"})
+	// Several quick rotations queue their cleanups behind each other
+	logMegabytes(5)
+	logger.Close()
+
+	today := "stock-consolidation-" + time.Now().Format("2006-01-02")
+	var active string
+	var backups []string
+	for _, name := range listDir(t, dir) {
+		switch {
+		case name == today+".log":
+			active = name
+		case strings.HasPrefix(name, today+".") && strings.HasSuffix(name, ".log.gz"):
+			backups = append(backups, name)
+		default:
+			t.Errorf("Unexpected log file %s", name)
+		}
+	}
+	if active == "" || len(backups) != 2 {
+		t.Fatalf("Log files = %v, want the active file and 2 compressed backups", listDir(t, dir))
+	}
+
+	f, err := os.Open(filepath.Join(dir, backups[0]))
+	if err != nil {
+		t.Fatalf("Failed to open compressed log: %v", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Rotated file is not gzip: %v", err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil || !strings.Contains(string(data), strings.Repeat("x", 1000)) {
+		t.Errorf("Compressed content is missing the log entries: %v", err)
+	}
+}
+
+func TestRotationRetention(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "stock-consolidation-2025-06-01.log")
+	recent := filepath.Join(dir, "stock-consolidation-2025-07-28.log")
+	for path, age := range map[string]time.Duration{old: 60 * 24 * time.Hour, recent: time.Hour} {
+		if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+			t.Fatalf("Failed to write old log: %v", err)
+		}
+		modTime := time.Now().Add(-age)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to age old log: %v", err)
+		}
+	}
+
+	initRotation(t, map[string]string{"LOG_DIR": dir, "LOG_COMPRESS": "false", "LOG_MAX_AGE_DAYS": "30"})
+	logMegabytes(2)
+	logger.Close()
+
+	names := listDir(t, dir)
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("Log files = %v, want %s removed", names, filepath.Base(old))
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("Log files = %v, want %s kept", names, filepath.Base(recent))
+	}
+}
+
+func TestRotationCompressesSkippedBackups(t *testing.T) {
+	dir := t.TempDir()
+	// A backup whose cleanup was skipped while the queue was full
+	skipped := filepath.Join(dir, "stock-consolidation-"+time.Now().Format("2006-01-02")+".1.log")
+	if err := os.WriteFile(skipped, []byte("skipped\n"), 0644); err != nil {
+		t.Fatalf("Failed to write backup: %v", err)
+	}
+
+	initRotation(t, map[string]string{"LOG_DIR": dir, "LOG_COMPRESS": "true"})
+	logMegabytes(2)
+	logger.Close()
+
+	names := listDir(t, dir)
+	if _, err := os.Stat(skipped); !os.IsNotExist(err) {
+		t.Errorf("Log files = %v, want %s compressed by the next cleanup", names, filepath.Base(skipped))
+	}
+	if _, err := os.Stat(skipped + ".gz"); err != nil {
+		t.Errorf("Log files = %v, want %s.gz", names, filepath.Base(skipped))
+	}
+}
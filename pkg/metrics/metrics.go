@@ -0,0 +1,221 @@
+// Package metrics provides the Prometheus metrics exposed by the application
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "stock_consolidation"
+
+// Delivery results used for the result label of DeliveriesTotal
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	// ResultInvalid is used by CapturedChanges for changes that failed validation
+	ResultInvalid = "invalid"
+	// ResultStale is used by IngestedChanges for changes older than the stored stock
+	ResultStale = "stale"
+	// ResultDropped is used by AlertNotifications for alerts dropped because
+	// the notification queue was full
+	ResultDropped = "dropped"
+)
+
+var (
+	// NotificationsReceived counts PostgreSQL notifications received per channel
+	NotificationsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_received_total",
+		Help:      "Number of PostgreSQL notifications received.",
+	}, []string{"channel"})
+
+	// DecodeErrors counts notifications whose payload could not be decoded
+	DecodeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notification_decode_errors_total",
+		Help:      "Number of notifications with a payload that could not be decoded.",
+	}, []string{"channel"})
+
+	// QuarantinedChanges counts stock changes held back because they violate
+	// an invariant, by violated rule
+	QuarantinedChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "quarantined_changes_total",
+		Help:      "Number of stock changes quarantined instead of sent to HQ, by violated rule.",
+	}, []string{"rule"})
+
+	// CapturedChanges counts changes of captured tables other than stock by
+	// entity type and result
+	CapturedChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "captured_changes_total",
+		Help:      "Number of captured changes of tables other than stock by type and result.",
+	}, []string{"type", "result"})
+
+	// DeliveriesTotal counts delivery attempts to HQ by result and HTTP status.
+	// The status is "error" when no response was received.
+	DeliveriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "deliveries_total",
+		Help:      "Number of stock change deliveries to HQ by result and status code.",
+	}, []string{"result", "status"})
+
+	// HQRequestDuration observes the latency of requests to the HQ endpoint
+	HQRequestDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "hq_request_duration_seconds",
+		Help:      "Latency of requests to the HQ endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// DeliveryLag observes the time between a stock row update and its delivery to HQ
+	DeliveryLag = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "delivery_lag_seconds",
+		Help:      "Time between the stock row's updated_at and successful delivery to HQ.",
+		Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+	})
+
+	// ListenerConnected is 1 while the PostgreSQL listener connection of a
+	// branch source is up
+	ListenerConnected = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "listener_connected",
+		Help:      "Whether the PostgreSQL listener of a branch source is connected (1) or not (0).",
+	}, []string{"source"})
+
+	// BranchSourceUp is 1 while the listener of a branch source is running
+	BranchSourceUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "branch_source_up",
+		Help:      "Whether the listener of a branch source is running (1) or not (0).",
+	}, []string{"source"})
+
+	// BranchSourceRestarts counts the restarts of the listener of a branch source
+	BranchSourceRestarts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "branch_source_restarts_total",
+		Help:      "Number of times the listener of a branch source was restarted.",
+	}, []string{"source"})
+
+	// Leader is 1 while this instance holds the leader lock and forwards changes
+	Leader = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "leader",
+		Help:      "Whether this instance is the leader forwarding changes (1) or a standby (0).",
+	})
+
+	// StandbySkippedChanges counts changes dropped because this instance is a
+	// standby, by entity type
+	StandbySkippedChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "standby_skipped_changes_total",
+		Help:      "Number of changes not forwarded because this instance is a standby, by type.",
+	}, []string{"type"})
+
+	// DeliveryPaused is 1 while delivery to HQ is paused by an operator
+	DeliveryPaused = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "delivery_paused",
+		Help:      "Whether delivery to HQ is paused (1) or running (0).",
+	})
+
+	// BufferedChanges is the number of changes held while delivery is paused
+	BufferedChanges = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "buffered_changes",
+		Help:      "Number of stock changes held in memory while delivery is paused.",
+	})
+
+	// IngestedChanges counts the stock changes received by the HQ receiver, by
+	// result: applied, duplicate, stale or invalid
+	IngestedChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ingested_changes_total",
+		Help:      "Number of stock changes received from the branches by the HQ receiver, by result.",
+	}, []string{"result"})
+
+	// IngestLag is the time between a change at a branch and its arrival at HQ
+	IngestLag = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ingest_lag_seconds",
+		Help:      "Time between the update of a stock row at a branch and its receipt at HQ.",
+		Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+	})
+
+	// AlertsRaised counts the alerts raised by the HQ receiver, by kind
+	AlertsRaised = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alerts_total",
+		Help:      "Number of stock alerts raised by the HQ receiver, by kind.",
+	}, []string{"kind"})
+
+	// AlertNotifications counts alert notifications, by result: success,
+	// failure or dropped
+	AlertNotifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alert_notifications_total",
+		Help:      "Number of alert notifications sent to the webhooks, by result.",
+	}, []string{"result"})
+
+	queueDepth atomic.Pointer[func() int]
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Number of decoded stock changes waiting to be delivered.",
+	}, func() float64 {
+		if fn := queueDepth.Load(); fn != nil {
+			return float64((*fn)())
+		}
+		return 0
+	})
+)
+
+// SetQueueDepthFunc sets the function reporting the current queue depth at scrape time
+func SetQueueDepthFunc(fn func() int) {
+	queueDepth.Store(&fn)
+}
+
+// SetListenerConnected records the state of the PostgreSQL listener
+// connection of source
+func SetListenerConnected(source string, connected bool) {
+	if connected {
+		ListenerConnected.WithLabelValues(source).Set(1)
+		return
+	}
+	ListenerConnected.WithLabelValues(source).Set(0)
+}
+
+// SetDeliveryPaused records whether delivery to HQ is paused
+func SetDeliveryPaused(paused bool) {
+	if paused {
+		DeliveryPaused.Set(1)
+		return
+	}
+	DeliveryPaused.Set(0)
+}
+
+// ObserveDelivery records the outcome of a delivery attempt. A status of 0
+// means no response was received.
+func ObserveDelivery(status int, err error) {
+	result := ResultSuccess
+	if err != nil {
+		result = ResultFailure
+	}
+	label := "error"
+	if status > 0 {
+		label = strconv.Itoa(status)
+	}
+	DeliveriesTotal.WithLabelValues(result, label).Inc()
+}
+
+// Handler returns the HTTP handler serving the metrics in the Prometheus format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,57 @@
+package metrics_test
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"stock-consolidation/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveDelivery(t *testing.T) {
+	before := testutil.ToFloat64(metrics.DeliveriesTotal.WithLabelValues(metrics.ResultFailure, "503"))
+	metrics.ObserveDelivery(503, errors.New("unavailable"))
+	after := testutil.ToFloat64(metrics.DeliveriesTotal.WithLabelValues(metrics.ResultFailure, "503"))
+	if after-before != 1 {
+		t.Errorf("deliveries_total{result=failure,status=503} increased by %v, want 1", after-before)
+	}
+
+	before = testutil.ToFloat64(metrics.DeliveriesTotal.WithLabelValues(metrics.ResultFailure, "error"))
+	metrics.ObserveDelivery(0, errors.New("connection refused"))
+	after = testutil.ToFloat64(metrics.DeliveriesTotal.WithLabelValues(metrics.ResultFailure, "error"))
+	if after-before != 1 {
+		t.Errorf("deliveries_total{result=failure,status=error} increased by %v, want 1", after-before)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	queue := make(chan int, 5)
+	queue <- 1
+	queue <- 2
+	metrics.SetQueueDepthFunc(func() int { return len(queue) })
+	metrics.SetListenerConnected("main", true)
+	metrics.SetListenerConnected("north", false)
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatalf("Failed to read metrics: %v", err)
+	}
+
+	for _, want := range []string{
+		"stock_consolidation_queue_depth 2",
+		`stock_consolidation_listener_connected{source="main"} 1`,
+		`stock_consolidation_listener_connected{source="north"} 0`,
+		"stock_consolidation_hq_request_duration_seconds_bucket",
+		"stock_consolidation_delivery_lag_seconds_bucket",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Metrics output missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Package tracing provides OpenTelemetry tracing setup for the application
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the spans created by this application
+const instrumentationName = "stock-consolidation"
+
+// defaultServiceName is used when OTEL_SERVICE_NAME is not set
+const defaultServiceName = "stock-consolidation"
+
+// Init configures the global tracer provider and W3C trace context propagation.
+// The exporter is selected with OTEL_TRACES_EXPORTER: "otlp" (OTLP over HTTP,
+// configured by the standard OTEL_EXPORTER_OTLP_* variables), "stdout" or
+// "none" (the default). The returned function flushes and stops the exporter.
+func Init(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	exporter, err := newExporter(ctx, os.Getenv("OTEL_TRACES_EXPORTER"))
+	if err != nil {
+		return nil, err
+	}
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res, err := newResource()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %v", err)
+	}
+
+	// The sampler follows OTEL_TRACES_SAMPLER and defaults to parent based always on
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// newResource describes the process on its spans. The later resource wins a
+// merge, so the default service name replaces the unknown_service name of
+// resource.Default and OTEL_SERVICE_NAME or OTEL_RESOURCE_ATTRIBUTES replace both.
+func newResource() (*resource.Resource, error) {
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewSchemaless(semconv.ServiceName(defaultServiceName)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return resource.Merge(res, resource.Environment())
+}
+
+func newExporter(ctx context.Context, name string) (sdktrace.SpanExporter, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "none":
+		return nil, nil
+	case "stdout", "console":
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %v", err)
+		}
+		return exporter, nil
+	}
+	return nil, fmt.Errorf("invalid OTEL_TRACES_EXPORTER %q", name)
+}
+
+// Tracer returns the tracer used to instrument the application
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// RecordError marks the span as failed with err
+func RecordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
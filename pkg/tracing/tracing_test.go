@@ -0,0 +1,77 @@
+package tracing_test
+
+import (
+	"context"
+	"testing"
+
+	"stock-consolidation/pkg/tracing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+func TestInit(t *testing.T) {
+	for _, exporter := range []string{"", "none", "stdout"} {
+		t.Run("exporter "+exporter, func(t *testing.T) {
+			t.Setenv("OTEL_TRACES_EXPORTER", exporter)
+
+			shutdown, err := tracing.Init(context.Background())
+			if err != nil {
+				t.Fatalf("Init() error = %v", err)
+			}
+
+			_, span := tracing.Tracer().Start(context.Background(), "test span")
+			span.End()
+
+			if err := shutdown(context.Background()); err != nil {
+				t.Errorf("shutdown() error = %v", err)
+			}
+		})
+	}
+
+	t.Run("invalid exporter", func(t *testing.T) {
+		t.Setenv("OTEL_TRACES_EXPORTER", "zipkin")
+		if _, err := tracing.Init(context.Background()); err == nil {
+			t.Error("Init() expected error for unsupported exporter, got nil")
+		}
+	})
+}
+
+func TestInit_ServiceName(t *testing.T) {
+	tests := []struct {
+		name, env, want string
+	}{
+		{name: "default", want: "stock-consolidation"},
+		{name: "OTEL_SERVICE_NAME", env: "branch-bangkok", want: "branch-bangkok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_TRACES_EXPORTER", "stdout")
+			t.Setenv("OTEL_SERVICE_NAME", tt.env)
+
+			shutdown, err := tracing.Init(context.Background())
+			if err != nil {
+				t.Fatalf("Init() error = %v", err)
+			}
+			defer func() {
+				_ = shutdown(context.Background())
+			}()
+
+			_, span := tracing.Tracer().Start(context.Background(), "test span")
+			defer span.End()
+			recorded, ok := span.(sdktrace.ReadOnlySpan)
+			if !ok {
+				t.Fatalf("span %T is not recorded by the SDK", span)
+			}
+			var got string
+			for _, attr := range recorded.Resource().Attributes() {
+				if attr.Key == semconv.ServiceNameKey {
+					got = attr.Value.AsString()
+				}
+			}
+			if got != tt.want {
+				t.Errorf("service.name = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
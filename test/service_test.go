@@ -8,14 +8,15 @@ import (
 	"time"
 
 	"stock-consolidation/internal/core/domain"
+	"stock-consolidation/internal/core/port"
 	"stock-consolidation/internal/service"
 )
 
 type mockStockRepository struct {
-	stockChan chan domain.Stock
+	stockChan chan port.StockChange
 }
 
-func (m *mockStockRepository) ListenForChanges(_ context.Context) (<-chan domain.Stock, error) {
+func (m *mockStockRepository) ListenForChanges(_ context.Context) (<-chan port.StockChange, error) {
 	return m.stockChan, nil
 }
 
@@ -93,7 +94,7 @@ func TestStockService(t *testing.T) {
 
 	t.Run("successful stock change notification", func(t *testing.T) {
 		mockRepo := &mockStockRepository{
-			stockChan: make(chan domain.Stock),
+			stockChan: make(chan port.StockChange),
 		}
 
 		service := service.NewStockService(mockRepo)
@@ -132,7 +133,7 @@ func TestStockService(t *testing.T) {
 		}
 
 		for _, tc := range testCases {
-			mockRepo.stockChan <- tc
+			mockRepo.stockChan <- port.StockChange{Stock: tc}
 			// Allow some time for processing
 			time.Sleep(10 * time.Millisecond) // Reduced from 50ms
 		}
@@ -140,7 +141,7 @@ func TestStockService(t *testing.T) {
 
 	t.Run("context cancellation", func(t *testing.T) {
 		mockRepo := &mockStockRepository{
-			stockChan: make(chan domain.Stock),
+			stockChan: make(chan port.StockChange),
 		}
 
 		service := service.NewStockService(mockRepo)
@@ -173,7 +174,7 @@ func TestStockService(t *testing.T) {
 			UpdatedAt: time.Now(),
 		}
 
-		mockRepo.stockChan <- testStock
+		mockRepo.stockChan <- port.StockChange{Stock: testStock}
 		time.Sleep(10 * time.Millisecond) // Reduced from 50ms
 
 		err := mockRepo.Close()
@@ -187,7 +188,7 @@ func TestStockService(t *testing.T) {
 
 	t.Run("repository close", func(t *testing.T) {
 		mockRepo := &mockStockRepository{
-			stockChan: make(chan domain.Stock),
+			stockChan: make(chan port.StockChange),
 		}
 
 		service := service.NewStockService(mockRepo)
@@ -211,7 +212,7 @@ func TestStockService(t *testing.T) {
 			UpdatedAt: time.Now(),
 		}
 
-		mockRepo.stockChan <- testStock
+		mockRepo.stockChan <- port.StockChange{Stock: testStock}
 		time.Sleep(10 * time.Millisecond) // Reduced from 50ms
 
 		err := mockRepo.Close()